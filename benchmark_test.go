@@ -18,8 +18,8 @@ func BenchmarkWorkerPoolAcquireRelease(b *testing.B) {
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			sdk.Workers().Acquire()
-			sdk.Workers().Release()
+			_ = sdk.Workers().Acquire(context.Background(), pdfsdk.Weight{}, pdfsdk.PriorityNormal)
+			sdk.Workers().Release(pdfsdk.Weight{})
 		}
 	})
 }
@@ -32,8 +32,8 @@ func BenchmarkWorkerPoolTryAcquire(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		if sdk.Workers().TryAcquire() {
-			sdk.Workers().Release()
+		if sdk.Workers().TryAcquire(pdfsdk.Weight{}) {
+			sdk.Workers().Release(pdfsdk.Weight{})
 		}
 	}
 }
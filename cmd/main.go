@@ -10,6 +10,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		os.Exit(runWatch(os.Args[2:]))
+	}
+
 	fmt.Println("🚀 Golang PDF SDK v2.1 - Examples")
 	fmt.Println("==================================")
 
@@ -166,9 +170,12 @@ result, _ := sdk.Pipeline().
 ctx := context.Background()
 results := sdk.Batch(5).CompressBatch(ctx, [][]byte{pdf1, pdf2, pdf3})
 
-// Worker pool control
-sdk.Workers().Acquire()  // Get worker slot
-defer sdk.Workers().Release()
+// Worker pool control (SDK operations are admitted automatically)
+w := pdfsdk.Weight{Slots: 1, Bytes: int64(len(pdf1))}
+if err := sdk.Workers().Acquire(ctx, w, pdfsdk.PriorityHigh); err != nil {
+    return err // ErrWorkerPoolFull when the queue is full
+}
+defer sdk.Workers().Release(w)
 // ... do work ...
 `)
 }
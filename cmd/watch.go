@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	pdfsdk "github.com/infosec554/convert-pdf-go-sdk"
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// runWatch implements "watch": process files dropped into inbox directories
+// with a pipeline loaded from a JSON or YAML definition.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	gotenbergURL := fs.String("gotenberg", "http://localhost:3000", "Gotenberg URL")
+	pipelineFile := fs.String("pipeline", "", "pipeline definition (.json, .yaml)")
+	concurrency := fs.Int("concurrency", 4, "files processed at once")
+	poll := fs.Duration("poll", 2*time.Second, "inbox scan interval")
+	stable := fs.Duration("stable", 2*time.Second, "time a file must stop changing before it is processed")
+	extensions := fs.String("ext", ".pdf", "comma-separated file extensions to pick up")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pdfsdk-example watch -pipeline FILE [flags] INBOX...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *pipelineFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	sdk := pdfsdk.New(*gotenbergURL)
+	defer sdk.Close()
+
+	def, err := service.LoadPipelineDefinition(*pipelineFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	pipeline, err := service.NewPipelineFromDefinition(sdk, def)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+
+	cfg := &pdfsdk.WatcherConfig{
+		Pipelines:     map[string]*service.Pipeline{def.Name: pipeline},
+		PollInterval:  *poll,
+		StableFor:     *stable,
+		MaxConcurrent: *concurrency,
+		OnReport: func(r *pdfsdk.WatchReport) {
+			if r.Status == pdfsdk.WatchStatusDone {
+				fmt.Printf("✅ %s (%d outputs, %s)\n", r.Input, len(r.Outputs), r.Duration.Round(time.Millisecond))
+			} else {
+				fmt.Printf("❌ %s: %s\n", r.Input, r.Error)
+			}
+		},
+	}
+	for _, inbox := range fs.Args() {
+		cfg.Folders = append(cfg.Folders, pdfsdk.WatchFolder{
+			Inbox:      inbox,
+			Pipeline:   def.Name,
+			Extensions: strings.Split(*extensions, ","),
+		})
+	}
+
+	watcher, err := pdfsdk.NewWatcher(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("👀 Watching %s with pipeline %q\n", strings.Join(fs.Args(), ", "), def.Name)
+	if err := watcher.Run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	return 0
+}
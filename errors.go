@@ -3,6 +3,8 @@ package pdfsdk
 import (
 	"errors"
 	"fmt"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
 )
 
 var (
@@ -15,6 +17,8 @@ var (
 	ErrTimeout              = errors.New("operation timed out")
 	ErrWorkerPoolFull       = errors.New("worker pool is full")
 	ErrOperationCanceled    = errors.New("operation canceled")
+	ErrRateLimitExceeded    = errors.New("request exceeds rate limit burst")
+	ErrRateLimiterStopped   = errors.New("rate limiter stopped")
 )
 
 type PDFError struct {
@@ -61,3 +65,35 @@ func IsTimeout(err error) bool {
 func IsGotenbergUnavailable(err error) bool {
 	return errors.Is(err, ErrGotenbergUnavailable)
 }
+
+// ErrorClass maps an error to a stable, low-cardinality label for metrics.
+// Errors other than the SDK's own are labelled by service.ErrorClass, the
+// classifier spans use.
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrInvalidPDF):
+		return "invalid_pdf"
+	case errors.Is(err, ErrEncryptedPDF):
+		return "encrypted_pdf"
+	case errors.Is(err, ErrWrongPassword):
+		return "wrong_password"
+	case errors.Is(err, ErrEmptyInput):
+		return "empty_input"
+	case errors.Is(err, ErrPageOutOfRange):
+		return "page_out_of_range"
+	case errors.Is(err, ErrGotenbergUnavailable):
+		return "gotenberg_unavailable"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrWorkerPoolFull):
+		return "worker_pool_full"
+	case errors.Is(err, ErrRateLimitExceeded):
+		return "rate_limited"
+	case errors.Is(err, ErrOperationCanceled), errors.Is(err, ErrRateLimiterStopped):
+		return "canceled"
+	default:
+		return service.ErrorClass(err)
+	}
+}
@@ -1,6 +1,11 @@
 package pdfsdk_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
 	"testing"
 
 	pdfsdk "github.com/infosec554/convert-pdf-go-sdk"
@@ -87,3 +92,26 @@ func TestIsErrorHelpers(t *testing.T) {
 		t.Error("IsGotenbergUnavailable should return true for ErrGotenbergUnavailable")
 	}
 }
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{pdfsdk.ErrInvalidPDF, "invalid_pdf"},
+		{pdfsdk.WrapError("merge", "a.pdf", pdfsdk.ErrEncryptedPDF), "encrypted_pdf"},
+		{context.DeadlineExceeded, "timeout"},
+		{context.Canceled, "canceled"},
+		{pdfsdk.ErrRateLimitExceeded, "rate_limited"},
+		{fmt.Errorf("pdftoppm failed: %w", &exec.ExitError{}), "subprocess"},
+		{os.ErrNotExist, "io"},
+		{errors.New("boom"), "other"},
+	}
+
+	for _, tt := range tests {
+		if got := pdfsdk.ErrorClass(tt.err); got != tt.want {
+			t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
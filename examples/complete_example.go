@@ -88,7 +88,10 @@ func rateLimitExample() {
 
 	// Use rate limiter
 	for i := 0; i < 5; i++ {
-		rls.RateLimiter().Acquire()
+		if err := rls.RateLimiter().Acquire(); err != nil {
+			fmt.Printf("   ❌ Error: %v\n", err)
+			return
+		}
 		fmt.Printf("   Acquired token %d\n", i+1)
 	}
 
@@ -0,0 +1,1068 @@
+package pdfsdk
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// instrumentation wraps every service call made through the SDK so that
+// operations are recorded without callers having to do it themselves.
+type instrumentation struct {
+	metrics *Metrics
+	pool    *WorkerPool
+}
+
+type call struct {
+	in        *instrumentation
+	op        string
+	backend   string
+	inputSize int64
+	weight    Weight
+	start     time.Time
+	done      func()
+}
+
+// start admits the operation to the worker pool, weighted by its input
+// size and queued with the priority carried by ctx.
+func (in *instrumentation) start(ctx context.Context, op, backend string, inputSize int64) (*call, error) {
+	weight := Weight{Slots: 1, Bytes: inputSize}
+	if err := in.pool.Acquire(ctx, weight, PriorityFromContext(ctx)); err != nil {
+		in.metrics.Record(OperationRecord{
+			Operation:   op,
+			Backend:     backend,
+			InputBytes:  inputSize,
+			OutputBytes: -1,
+			Err:         err,
+		})
+		return nil, err
+	}
+
+	return &call{
+		in:        in,
+		op:        op,
+		backend:   backend,
+		inputSize: inputSize,
+		weight:    weight,
+		start:     time.Now(),
+		done:      in.metrics.TrackInFlight(op),
+	}, nil
+}
+
+func (c *call) end(outputSize int64, err error) {
+	c.done()
+	c.in.pool.Release(c.weight)
+	if err != nil {
+		outputSize = -1
+	}
+	c.in.metrics.Record(OperationRecord{
+		Operation:   c.op,
+		Backend:     c.backend,
+		Duration:    time.Since(c.start),
+		InputBytes:  c.inputSize,
+		OutputBytes: outputSize,
+		Err:         err,
+	})
+}
+
+func instrument[T any](in *instrumentation, op, backend string, inputSize int64, fn func() (T, error)) (T, error) {
+	return instrumentContext(context.Background(), in, op, backend, inputSize, fn)
+}
+
+func instrumentContext[T any](ctx context.Context, in *instrumentation, op, backend string, inputSize int64, fn func() (T, error)) (T, error) {
+	c, err := in.start(ctx, op, backend, inputSize)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	out, err := fn()
+	c.end(sizeOf(out), err)
+	return out, err
+}
+
+func instrumentFile(ctx context.Context, in *instrumentation, op, backend, inputPath, outputPath string, fn func() error) error {
+	c, err := in.start(ctx, op, backend, fileSize(inputPath))
+	if err != nil {
+		return err
+	}
+	err = fn()
+	c.end(fileSize(outputPath), err)
+	return err
+}
+
+func sizeOf(v any) int64 {
+	switch v := v.(type) {
+	case []byte:
+		return int64(len(v))
+	case [][]byte:
+		var n int64
+		for _, b := range v {
+			n += int64(len(b))
+		}
+		return n
+	case map[string][]byte:
+		var n int64
+		for _, b := range v {
+			n += int64(len(b))
+		}
+		return n
+	case []service.SplitPart:
+		var n int64
+		for _, p := range v {
+			n += int64(len(p.Data))
+		}
+		return n
+	case *service.OrientationResult:
+		if v == nil {
+			return -1
+		}
+		return int64(len(v.Output))
+	case *service.TextExtraction:
+		if v == nil {
+			return -1
+		}
+		var n int64
+		for _, p := range v.Pages {
+			n += int64(len(p.Text))
+		}
+		return n
+	case []service.ExtractedImage:
+		var n int64
+		for _, img := range v {
+			n += int64(len(img.Data))
+		}
+		return n
+	case *service.ExportResult:
+		if v == nil {
+			return -1
+		}
+		n := int64(len(v.Document))
+		for _, b := range v.Images {
+			n += int64(len(b))
+		}
+		return n
+	case string:
+		return int64(len(v))
+	default:
+		return -1
+	}
+}
+
+func bytesSize(inputs [][]byte) int64 {
+	return sizeOf(inputs)
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+func filesSize(paths []string) int64 {
+	var n int64
+	for _, p := range paths {
+		size := fileSize(p)
+		if size < 0 {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// metricsTransport counts Gotenberg responses by route and status code.
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *Metrics
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
+	}
+	t.metrics.RecordHTTPStatus(req.URL.Path, code)
+	return resp, err
+}
+
+type instrumentedService struct {
+	service.PDFService
+	wordToPDF       service.WordToPDFService
+	excelToPDF      service.ExcelToPDFService
+	powerPointToPDF service.PowerPointToPDFService
+	jpgToPDF        service.JPGToPDFService
+	pdfToJPG        service.PDFToJPGService
+	compress        service.CompressService
+	merge           service.MergeService
+	split           service.SplitService
+	rotate          service.RotateService
+	watermark       service.WatermarkService
+	protect         service.ProtectService
+	unlock          service.UnlockService
+	info            service.InfoService
+	pages           service.PageService
+	text            service.TextService
+	metadata        service.MetadataService
+	images          service.ImageExtractService
+	archive         service.ArchiveService
+	form            service.FormService
+	attachment      service.AttachmentService
+	ocr             service.OCRService
+	outline         service.OutlineService
+	annotations     service.AnnotationService
+	export          service.ExportService
+}
+
+func newInstrumentedService(s service.PDFService, in *instrumentation) service.PDFService {
+	return &instrumentedService{
+		PDFService:      s,
+		wordToPDF:       &instrumentedWordToPDF{s.WordToPDF(), in},
+		excelToPDF:      &instrumentedExcelToPDF{s.ExcelToPDF(), in},
+		powerPointToPDF: &instrumentedPowerPointToPDF{s.PowerPointToPDF(), in},
+		jpgToPDF:        &instrumentedJPGToPDF{s.JPGToPDF(), in},
+		pdfToJPG:        &instrumentedPDFToJPG{s.PDFToJPG(), in},
+		compress:        &instrumentedCompress{s.Compress(), in},
+		merge:           &instrumentedMerge{s.Merge(), in},
+		split:           &instrumentedSplit{s.Split(), in},
+		rotate:          &instrumentedRotate{s.Rotate(), in},
+		watermark:       &instrumentedWatermark{s.Watermark(), in},
+		protect:         &instrumentedProtect{s.Protect(), in},
+		unlock:          &instrumentedUnlock{s.Unlock(), in},
+		info:            &instrumentedInfo{s.Info(), in},
+		pages:           &instrumentedPages{s.Pages(), in},
+		text:            &instrumentedText{s.Text(), in},
+		metadata:        &instrumentedMetadata{s.Metadata(), in},
+		images:          &instrumentedImages{s.Images(), in},
+		archive:         &instrumentedArchive{s.Archive(), in},
+		form:            &instrumentedForm{s.Form(), in},
+		attachment:      &instrumentedAttachment{s.Attachment(), in},
+		ocr:             &instrumentedOCR{s.OCR(), in},
+		outline:         &instrumentedOutline{s.Outline(), in},
+		annotations:     &instrumentedAnnotations{s.Annotations(), in},
+		export:          &instrumentedExport{s.Export(), in},
+	}
+}
+
+func (s *instrumentedService) WordToPDF() service.WordToPDFService   { return s.wordToPDF }
+func (s *instrumentedService) ExcelToPDF() service.ExcelToPDFService { return s.excelToPDF }
+func (s *instrumentedService) PowerPointToPDF() service.PowerPointToPDFService {
+	return s.powerPointToPDF
+}
+func (s *instrumentedService) JPGToPDF() service.JPGToPDFService      { return s.jpgToPDF }
+func (s *instrumentedService) PDFToJPG() service.PDFToJPGService      { return s.pdfToJPG }
+func (s *instrumentedService) Compress() service.CompressService      { return s.compress }
+func (s *instrumentedService) Merge() service.MergeService            { return s.merge }
+func (s *instrumentedService) Split() service.SplitService            { return s.split }
+func (s *instrumentedService) Rotate() service.RotateService          { return s.rotate }
+func (s *instrumentedService) Watermark() service.WatermarkService    { return s.watermark }
+func (s *instrumentedService) Protect() service.ProtectService        { return s.protect }
+func (s *instrumentedService) Unlock() service.UnlockService          { return s.unlock }
+func (s *instrumentedService) Info() service.InfoService              { return s.info }
+func (s *instrumentedService) Pages() service.PageService             { return s.pages }
+func (s *instrumentedService) Text() service.TextService              { return s.text }
+func (s *instrumentedService) Metadata() service.MetadataService      { return s.metadata }
+func (s *instrumentedService) Images() service.ImageExtractService    { return s.images }
+func (s *instrumentedService) Archive() service.ArchiveService        { return s.archive }
+func (s *instrumentedService) Form() service.FormService              { return s.form }
+func (s *instrumentedService) Attachment() service.AttachmentService  { return s.attachment }
+func (s *instrumentedService) OCR() service.OCRService                { return s.ocr }
+func (s *instrumentedService) Outline() service.OutlineService        { return s.outline }
+func (s *instrumentedService) Annotations() service.AnnotationService { return s.annotations }
+func (s *instrumentedService) Export() service.ExportService          { return s.export }
+
+// Batch and Pipeline are rebuilt on top of the instrumented services so
+// their steps are recorded too.
+func (s *instrumentedService) Batch(maxWorkers int) *service.BatchProcessor {
+	return service.NewBatchProcessor(s, maxWorkers)
+}
+
+func (s *instrumentedService) Pipeline() *service.Pipeline {
+	return service.NewPipeline(s)
+}
+
+type instrumentedWordToPDF struct {
+	service.WordToPDFService
+	in *instrumentation
+}
+
+func (w *instrumentedWordToPDF) Convert(ctx context.Context, input io.Reader, filename string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "word_to_pdf", BackendGotenberg, -1, func() ([]byte, error) {
+		return w.WordToPDFService.Convert(ctx, input, filename)
+	})
+}
+
+func (w *instrumentedWordToPDF) ConvertFile(ctx context.Context, inputPath, outputPath string) error {
+	return instrumentFile(ctx, w.in, "word_to_pdf", BackendGotenberg, inputPath, outputPath, func() error {
+		return w.WordToPDFService.ConvertFile(ctx, inputPath, outputPath)
+	})
+}
+
+func (w *instrumentedWordToPDF) ConvertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "word_to_pdf", BackendGotenberg, int64(len(input)), func() ([]byte, error) {
+		return w.WordToPDFService.ConvertBytes(ctx, input, filename)
+	})
+}
+
+type instrumentedExcelToPDF struct {
+	service.ExcelToPDFService
+	in *instrumentation
+}
+
+func (w *instrumentedExcelToPDF) Convert(ctx context.Context, input io.Reader, filename string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "excel_to_pdf", BackendGotenberg, -1, func() ([]byte, error) {
+		return w.ExcelToPDFService.Convert(ctx, input, filename)
+	})
+}
+
+func (w *instrumentedExcelToPDF) ConvertFile(ctx context.Context, inputPath, outputPath string) error {
+	return instrumentFile(ctx, w.in, "excel_to_pdf", BackendGotenberg, inputPath, outputPath, func() error {
+		return w.ExcelToPDFService.ConvertFile(ctx, inputPath, outputPath)
+	})
+}
+
+func (w *instrumentedExcelToPDF) ConvertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "excel_to_pdf", BackendGotenberg, int64(len(input)), func() ([]byte, error) {
+		return w.ExcelToPDFService.ConvertBytes(ctx, input, filename)
+	})
+}
+
+type instrumentedPowerPointToPDF struct {
+	service.PowerPointToPDFService
+	in *instrumentation
+}
+
+func (w *instrumentedPowerPointToPDF) Convert(ctx context.Context, input io.Reader, filename string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "powerpoint_to_pdf", BackendGotenberg, -1, func() ([]byte, error) {
+		return w.PowerPointToPDFService.Convert(ctx, input, filename)
+	})
+}
+
+func (w *instrumentedPowerPointToPDF) ConvertFile(ctx context.Context, inputPath, outputPath string) error {
+	return instrumentFile(ctx, w.in, "powerpoint_to_pdf", BackendGotenberg, inputPath, outputPath, func() error {
+		return w.PowerPointToPDFService.ConvertFile(ctx, inputPath, outputPath)
+	})
+}
+
+func (w *instrumentedPowerPointToPDF) ConvertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "powerpoint_to_pdf", BackendGotenberg, int64(len(input)), func() ([]byte, error) {
+		return w.PowerPointToPDFService.ConvertBytes(ctx, input, filename)
+	})
+}
+
+type instrumentedJPGToPDF struct {
+	service.JPGToPDFService
+	in *instrumentation
+}
+
+func (w *instrumentedJPGToPDF) Convert(input io.Reader, filename string) ([]byte, error) {
+	return instrument(w.in, "jpg_to_pdf", BackendGofpdf, -1, func() ([]byte, error) {
+		return w.JPGToPDFService.Convert(input, filename)
+	})
+}
+
+func (w *instrumentedJPGToPDF) ConvertMultiple(inputs []io.Reader, filenames []string) ([]byte, error) {
+	return instrument(w.in, "jpg_to_pdf", BackendGofpdf, -1, func() ([]byte, error) {
+		return w.JPGToPDFService.ConvertMultiple(inputs, filenames)
+	})
+}
+
+func (w *instrumentedJPGToPDF) ConvertFiles(inputPaths []string, outputPath string) error {
+	c, err := w.in.start(context.Background(), "jpg_to_pdf", BackendGofpdf, filesSize(inputPaths))
+	if err != nil {
+		return err
+	}
+	err = w.JPGToPDFService.ConvertFiles(inputPaths, outputPath)
+	c.end(fileSize(outputPath), err)
+	return err
+}
+
+func (w *instrumentedJPGToPDF) ConvertBytes(input []byte, filename string) ([]byte, error) {
+	return instrument(w.in, "jpg_to_pdf", BackendGofpdf, int64(len(input)), func() ([]byte, error) {
+		return w.JPGToPDFService.ConvertBytes(input, filename)
+	})
+}
+
+func (w *instrumentedJPGToPDF) ConvertMultipleBytes(inputs [][]byte, filenames []string) ([]byte, error) {
+	return instrument(w.in, "jpg_to_pdf", BackendGofpdf, bytesSize(inputs), func() ([]byte, error) {
+		return w.JPGToPDFService.ConvertMultipleBytes(inputs, filenames)
+	})
+}
+
+type instrumentedPDFToJPG struct {
+	service.PDFToJPGService
+	in *instrumentation
+}
+
+func (w *instrumentedPDFToJPG) Convert(input io.Reader) ([]byte, error) {
+	return instrument(w.in, "pdf_to_jpg", BackendPoppler, -1, func() ([]byte, error) {
+		return w.PDFToJPGService.Convert(input)
+	})
+}
+
+func (w *instrumentedPDFToJPG) ConvertFile(inputPath, outputDir string) ([]string, error) {
+	c, err := w.in.start(context.Background(), "pdf_to_jpg", BackendPoppler, fileSize(inputPath))
+	if err != nil {
+		return nil, err
+	}
+	files, err := w.PDFToJPGService.ConvertFile(inputPath, outputDir)
+	c.end(filesSize(files), err)
+	return files, err
+}
+
+func (w *instrumentedPDFToJPG) ConvertBytes(input []byte) ([]byte, error) {
+	return instrument(w.in, "pdf_to_jpg", BackendPoppler, int64(len(input)), func() ([]byte, error) {
+		return w.PDFToJPGService.ConvertBytes(input)
+	})
+}
+
+func (w *instrumentedPDFToJPG) ConvertToImages(input []byte) ([][]byte, error) {
+	return instrument(w.in, "pdf_to_jpg", BackendPoppler, int64(len(input)), func() ([][]byte, error) {
+		return w.PDFToJPGService.ConvertToImages(input)
+	})
+}
+
+type instrumentedCompress struct {
+	service.CompressService
+	in *instrumentation
+}
+
+func (w *instrumentedCompress) Compress(input io.Reader) ([]byte, error) {
+	return instrument(w.in, "compress", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.CompressService.Compress(input)
+	})
+}
+
+func (w *instrumentedCompress) CompressFile(inputPath, outputPath string) error {
+	return instrumentFile(context.Background(), w.in, "compress", BackendPDFCPU, inputPath, outputPath, func() error {
+		return w.CompressService.CompressFile(inputPath, outputPath)
+	})
+}
+
+func (w *instrumentedCompress) CompressBytes(input []byte) ([]byte, error) {
+	return instrument(w.in, "compress", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.CompressService.CompressBytes(input)
+	})
+}
+
+type instrumentedMerge struct {
+	service.MergeService
+	in *instrumentation
+}
+
+func (w *instrumentedMerge) Merge(inputs []io.Reader) ([]byte, error) {
+	return instrument(w.in, "merge", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.MergeService.Merge(inputs)
+	})
+}
+
+func (w *instrumentedMerge) MergeFiles(inputPaths []string, outputPath string) error {
+	c, err := w.in.start(context.Background(), "merge", BackendPDFCPU, filesSize(inputPaths))
+	if err != nil {
+		return err
+	}
+	err = w.MergeService.MergeFiles(inputPaths, outputPath)
+	c.end(fileSize(outputPath), err)
+	return err
+}
+
+func (w *instrumentedMerge) MergeBytes(inputs [][]byte) ([]byte, error) {
+	return instrument(w.in, "merge", BackendPDFCPU, bytesSize(inputs), func() ([]byte, error) {
+		return w.MergeService.MergeBytes(inputs)
+	})
+}
+
+func (w *instrumentedMerge) MergeWithOptions(inputs []service.MergeInput, opts *service.MergeOptions) ([]byte, error) {
+	var size int64
+	for _, in := range inputs {
+		size += in.Size()
+	}
+	return instrument(w.in, "merge", BackendPDFCPU, size, func() ([]byte, error) {
+		return w.MergeService.MergeWithOptions(inputs, opts)
+	})
+}
+
+type instrumentedSplit struct {
+	service.SplitService
+	in *instrumentation
+}
+
+func (w *instrumentedSplit) Split(input io.Reader, ranges string) ([]byte, error) {
+	return instrument(w.in, "split", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.SplitService.Split(input, ranges)
+	})
+}
+
+func (w *instrumentedSplit) SplitFile(inputPath, outputDir string, ranges string) ([]string, error) {
+	c, err := w.in.start(context.Background(), "split", BackendPDFCPU, fileSize(inputPath))
+	if err != nil {
+		return nil, err
+	}
+	files, err := w.SplitService.SplitFile(inputPath, outputDir, ranges)
+	c.end(filesSize(files), err)
+	return files, err
+}
+
+func (w *instrumentedSplit) SplitBytes(input []byte, ranges string) ([]byte, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.SplitService.SplitBytes(input, ranges)
+	})
+}
+
+func (w *instrumentedSplit) SplitToPages(input []byte) ([][]byte, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([][]byte, error) {
+		return w.SplitService.SplitToPages(input)
+	})
+}
+
+func (w *instrumentedSplit) SplitParts(input []byte, ranges string) ([]service.SplitPart, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([]service.SplitPart, error) {
+		return w.SplitService.SplitParts(input, ranges)
+	})
+}
+
+func (w *instrumentedSplit) SplitByBookmarks(input []byte) ([]service.SplitPart, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([]service.SplitPart, error) {
+		return w.SplitService.SplitByBookmarks(input)
+	})
+}
+
+func (w *instrumentedSplit) SplitEvery(input []byte, pages int) ([]service.SplitPart, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([]service.SplitPart, error) {
+		return w.SplitService.SplitEvery(input, pages)
+	})
+}
+
+func (w *instrumentedSplit) SplitBySize(input []byte, maxBytes int64) ([]service.SplitPart, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([]service.SplitPart, error) {
+		return w.SplitService.SplitBySize(input, maxBytes)
+	})
+}
+
+func (w *instrumentedSplit) SplitBySeparator(input []byte, opts *service.SeparatorOptions) ([]service.SplitPart, error) {
+	return instrument(w.in, "split", BackendPDFCPU, int64(len(input)), func() ([]service.SplitPart, error) {
+		return w.SplitService.SplitBySeparator(input, opts)
+	})
+}
+
+type instrumentedRotate struct {
+	service.RotateService
+	in *instrumentation
+}
+
+func (w *instrumentedRotate) Rotate(input io.Reader, angle int, pages string) ([]byte, error) {
+	return instrument(w.in, "rotate", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.RotateService.Rotate(input, angle, pages)
+	})
+}
+
+func (w *instrumentedRotate) RotateFile(inputPath, outputPath string, angle int, pages string) error {
+	return instrumentFile(context.Background(), w.in, "rotate", BackendPDFCPU, inputPath, outputPath, func() error {
+		return w.RotateService.RotateFile(inputPath, outputPath, angle, pages)
+	})
+}
+
+func (w *instrumentedRotate) RotateBytes(input []byte, angle int, pages string) ([]byte, error) {
+	return instrument(w.in, "rotate", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.RotateService.RotateBytes(input, angle, pages)
+	})
+}
+
+type instrumentedWatermark struct {
+	service.WatermarkService
+	in *instrumentation
+}
+
+func (w *instrumentedWatermark) AddWatermark(input io.Reader, text string, options *service.WatermarkOptions) ([]byte, error) {
+	return instrument(w.in, "watermark", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.WatermarkService.AddWatermark(input, text, options)
+	})
+}
+
+func (w *instrumentedWatermark) AddWatermarkFile(inputPath, outputPath, text string, options *service.WatermarkOptions) error {
+	return instrumentFile(context.Background(), w.in, "watermark", BackendPDFCPU, inputPath, outputPath, func() error {
+		return w.WatermarkService.AddWatermarkFile(inputPath, outputPath, text, options)
+	})
+}
+
+func (w *instrumentedWatermark) AddWatermarkBytes(input []byte, text string, options *service.WatermarkOptions) ([]byte, error) {
+	return instrument(w.in, "watermark", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.WatermarkService.AddWatermarkBytes(input, text, options)
+	})
+}
+
+type instrumentedProtect struct {
+	service.ProtectService
+	in *instrumentation
+}
+
+func (w *instrumentedProtect) Protect(input io.Reader, password string) ([]byte, error) {
+	return instrument(w.in, "protect", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.ProtectService.Protect(input, password)
+	})
+}
+
+func (w *instrumentedProtect) ProtectFile(inputPath, outputPath, password string) error {
+	return instrumentFile(context.Background(), w.in, "protect", BackendPDFCPU, inputPath, outputPath, func() error {
+		return w.ProtectService.ProtectFile(inputPath, outputPath, password)
+	})
+}
+
+func (w *instrumentedProtect) ProtectBytes(input []byte, password string) ([]byte, error) {
+	return instrument(w.in, "protect", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.ProtectService.ProtectBytes(input, password)
+	})
+}
+
+type instrumentedUnlock struct {
+	service.UnlockService
+	in *instrumentation
+}
+
+func (w *instrumentedUnlock) Unlock(input io.Reader, password string) ([]byte, error) {
+	return instrument(w.in, "unlock", BackendPDFCPU, -1, func() ([]byte, error) {
+		return w.UnlockService.Unlock(input, password)
+	})
+}
+
+func (w *instrumentedUnlock) UnlockFile(inputPath, outputPath, password string) error {
+	return instrumentFile(context.Background(), w.in, "unlock", BackendPDFCPU, inputPath, outputPath, func() error {
+		return w.UnlockService.UnlockFile(inputPath, outputPath, password)
+	})
+}
+
+func (w *instrumentedUnlock) UnlockBytes(input []byte, password string) ([]byte, error) {
+	return instrument(w.in, "unlock", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.UnlockService.UnlockBytes(input, password)
+	})
+}
+
+type instrumentedInfo struct {
+	service.InfoService
+	in *instrumentation
+}
+
+func (w *instrumentedInfo) GetInfo(input io.Reader) (*service.PDFInfo, error) {
+	return instrument(w.in, "info", BackendPDFCPU, -1, func() (*service.PDFInfo, error) {
+		return w.InfoService.GetInfo(input)
+	})
+}
+
+func (w *instrumentedInfo) GetInfoFile(inputPath string) (*service.PDFInfo, error) {
+	return instrument(w.in, "info", BackendPDFCPU, fileSize(inputPath), func() (*service.PDFInfo, error) {
+		return w.InfoService.GetInfoFile(inputPath)
+	})
+}
+
+func (w *instrumentedInfo) GetInfoBytes(input []byte) (*service.PDFInfo, error) {
+	return instrument(w.in, "info", BackendPDFCPU, int64(len(input)), func() (*service.PDFInfo, error) {
+		return w.InfoService.GetInfoBytes(input)
+	})
+}
+
+func (w *instrumentedInfo) GetPageCount(input []byte) (int, error) {
+	return instrument(w.in, "info", BackendPDFCPU, int64(len(input)), func() (int, error) {
+		return w.InfoService.GetPageCount(input)
+	})
+}
+
+func (w *instrumentedInfo) ValidatePDF(input []byte) error {
+	_, err := instrument(w.in, "info", BackendPDFCPU, int64(len(input)), func() (struct{}, error) {
+		return struct{}{}, w.InfoService.ValidatePDF(input)
+	})
+	return err
+}
+
+func (w *instrumentedInfo) IsEncrypted(input []byte) (bool, error) {
+	return instrument(w.in, "info", BackendPDFCPU, int64(len(input)), func() (bool, error) {
+		return w.InfoService.IsEncrypted(input)
+	})
+}
+
+type instrumentedPages struct {
+	service.PageService
+	in *instrumentation
+}
+
+func (w *instrumentedPages) ExtractPages(input []byte, pages string) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.ExtractPages(input, pages)
+	})
+}
+
+func (w *instrumentedPages) DeletePages(input []byte, pages string) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.DeletePages(input, pages)
+	})
+}
+
+func (w *instrumentedPages) InsertPages(base []byte, insert []byte, afterPage int) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(base)+len(insert)), func() ([]byte, error) {
+		return w.PageService.InsertPages(base, insert, afterPage)
+	})
+}
+
+func (w *instrumentedPages) ReorderPages(input []byte, order []int) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.ReorderPages(input, order)
+	})
+}
+
+func (w *instrumentedPages) GetPageCount(input []byte) (int, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() (int, error) {
+		return w.PageService.GetPageCount(input)
+	})
+}
+
+func (w *instrumentedPages) NUp(input []byte, opts *service.NUpOptions) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.NUp(input, opts)
+	})
+}
+
+func (w *instrumentedPages) Booklet(input []byte, opts *service.BookletOptions) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.Booklet(input, opts)
+	})
+}
+
+func (w *instrumentedPages) ResizePages(input []byte, opts *service.ResizeOptions) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.ResizePages(input, opts)
+	})
+}
+
+func (w *instrumentedPages) AddMargins(input []byte, pages string, margins service.Margins) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.AddMargins(input, pages, margins)
+	})
+}
+
+func (w *instrumentedPages) GetPageBoxes(input []byte) ([]service.PageBoxes, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]service.PageBoxes, error) {
+		return w.PageService.GetPageBoxes(input)
+	})
+}
+
+func (w *instrumentedPages) SetPageBoxes(input []byte, pages string, boxes service.PageBoxes) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.SetPageBoxes(input, pages, boxes)
+	})
+}
+
+func (w *instrumentedPages) AnalyzeBlankPages(input []byte, opts *service.BlankPageOptions) ([]service.BlankPageScore, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]service.BlankPageScore, error) {
+		return w.PageService.AnalyzeBlankPages(input, opts)
+	})
+}
+
+func (w *instrumentedPages) RemoveBlankPages(input []byte, opts *service.BlankPageOptions) ([]byte, error) {
+	return instrument(w.in, "pages", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.PageService.RemoveBlankPages(input, opts)
+	})
+}
+
+type instrumentedText struct {
+	service.TextService
+	in *instrumentation
+}
+
+func (w *instrumentedText) ExtractText(input []byte) (string, error) {
+	return instrument(w.in, "text", BackendPDFCPU, int64(len(input)), func() (string, error) {
+		return w.TextService.ExtractText(input)
+	})
+}
+
+func (w *instrumentedText) ExtractTextFromPage(input []byte, page int) (string, error) {
+	return instrument(w.in, "text", BackendPDFCPU, int64(len(input)), func() (string, error) {
+		return w.TextService.ExtractTextFromPage(input, page)
+	})
+}
+
+// ExtractTextWithOptions lends idle WorkerPool workers to the OCR
+// fallback, as the OCR service does.
+func (w *instrumentedText) ExtractTextWithOptions(ctx context.Context, input []byte, opts *service.TextExtractionOptions) (*service.TextExtraction, error) {
+	return instrumentContext(ctx, w.in, "text", BackendPDFCPU, int64(len(input)), func() (*service.TextExtraction, error) {
+		return w.TextService.ExtractTextWithOptions(service.WithWorkerSlots(ctx, poolSlots{w.in.pool}), input, opts)
+	})
+}
+
+func (w *instrumentedText) ExtractZones(ctx context.Context, input []byte, tmpl *service.ZoneTemplate, opts *service.TextExtractionOptions) (*service.ZoneExtraction, error) {
+	return instrumentContext(ctx, w.in, "text", BackendPDFCPU, int64(len(input)), func() (*service.ZoneExtraction, error) {
+		return w.TextService.ExtractZones(service.WithWorkerSlots(ctx, poolSlots{w.in.pool}), input, tmpl, opts)
+	})
+}
+
+func (w *instrumentedText) ExtractTables(ctx context.Context, input []byte, opts *service.TableOptions) (*service.TableExtraction, error) {
+	return instrumentContext(ctx, w.in, "text", BackendPDFCPU, int64(len(input)), func() (*service.TableExtraction, error) {
+		return w.TextService.ExtractTables(service.WithWorkerSlots(ctx, poolSlots{w.in.pool}), input, opts)
+	})
+}
+
+type instrumentedMetadata struct {
+	service.MetadataService
+	in *instrumentation
+}
+
+func (w *instrumentedMetadata) GetMetadata(input []byte) (map[string]string, error) {
+	return instrument(w.in, "metadata", BackendPDFCPU, int64(len(input)), func() (map[string]string, error) {
+		return w.MetadataService.GetMetadata(input)
+	})
+}
+
+func (w *instrumentedMetadata) SetMetadata(input []byte, metadata map[string]string) ([]byte, error) {
+	return instrument(w.in, "metadata", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.MetadataService.SetMetadata(input, metadata)
+	})
+}
+
+type instrumentedImages struct {
+	service.ImageExtractService
+	in *instrumentation
+}
+
+func (w *instrumentedImages) ExtractImages(input []byte) ([][]byte, error) {
+	return instrument(w.in, "images", BackendPDFCPU, int64(len(input)), func() ([][]byte, error) {
+		return w.ImageExtractService.ExtractImages(input)
+	})
+}
+
+func (w *instrumentedImages) ExtractImagesFromPage(input []byte, page int) ([][]byte, error) {
+	return instrument(w.in, "images", BackendPDFCPU, int64(len(input)), func() ([][]byte, error) {
+		return w.ImageExtractService.ExtractImagesFromPage(input, page)
+	})
+}
+
+func (w *instrumentedImages) ExtractImagesWithOptions(ctx context.Context, input []byte, opts *service.ImageExtractOptions) ([]service.ExtractedImage, error) {
+	return instrumentContext(ctx, w.in, "images", BackendPDFCPU, int64(len(input)), func() ([]service.ExtractedImage, error) {
+		return w.ImageExtractService.ExtractImagesWithOptions(ctx, input, opts)
+	})
+}
+
+type instrumentedArchive struct {
+	service.ArchiveService
+	in *instrumentation
+}
+
+func (w *instrumentedArchive) ConvertToPDFA(input []byte, format string) ([]byte, error) {
+	return instrument(w.in, "archive", BackendGotenberg, int64(len(input)), func() ([]byte, error) {
+		return w.ArchiveService.ConvertToPDFA(input, format)
+	})
+}
+
+type instrumentedForm struct {
+	service.FormService
+	in *instrumentation
+}
+
+func (w *instrumentedForm) FillForm(input []byte, data map[string]interface{}) ([]byte, error) {
+	return instrument(w.in, "form", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.FormService.FillForm(input, data)
+	})
+}
+
+func (w *instrumentedForm) ListFormFields(input []byte) ([]string, error) {
+	return instrument(w.in, "form", BackendPDFCPU, int64(len(input)), func() ([]string, error) {
+		return w.FormService.ListFormFields(input)
+	})
+}
+
+func (w *instrumentedForm) RemoveFormFields(input []byte) ([]byte, error) {
+	return instrument(w.in, "form", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.FormService.RemoveFormFields(input)
+	})
+}
+
+type instrumentedAttachment struct {
+	service.AttachmentService
+	in *instrumentation
+}
+
+func (w *instrumentedAttachment) AddAttachments(input []byte, files map[string][]byte) ([]byte, error) {
+	return instrument(w.in, "attachment", BackendPDFCPU, int64(len(input))+sizeOf(files), func() ([]byte, error) {
+		return w.AttachmentService.AddAttachments(input, files)
+	})
+}
+
+func (w *instrumentedAttachment) ListAttachments(input []byte) ([]string, error) {
+	return instrument(w.in, "attachment", BackendPDFCPU, int64(len(input)), func() ([]string, error) {
+		return w.AttachmentService.ListAttachments(input)
+	})
+}
+
+func (w *instrumentedAttachment) ExtractAttachments(input []byte) (map[string][]byte, error) {
+	return instrument(w.in, "attachment", BackendPDFCPU, int64(len(input)), func() (map[string][]byte, error) {
+		return w.AttachmentService.ExtractAttachments(input)
+	})
+}
+
+func (w *instrumentedAttachment) RemoveAttachments(input []byte) ([]byte, error) {
+	return instrument(w.in, "attachment", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.AttachmentService.RemoveAttachments(input)
+	})
+}
+
+type instrumentedOCR struct {
+	service.OCRService
+	in *instrumentation
+}
+
+// poolSlots lends the WorkerPool's idle workers to OCR running pages in
+// parallel.
+type poolSlots struct {
+	pool *WorkerPool
+}
+
+func (p poolSlots) TryAcquire() bool { return p.pool.TryAcquire(Weight{Slots: 1}) }
+func (p poolSlots) Release()         { p.pool.giveBack(Weight{Slots: 1}) }
+
+func (w *instrumentedOCR) withSlots(ctx context.Context) context.Context {
+	return service.WithWorkerSlots(ctx, poolSlots{w.in.pool})
+}
+
+func (w *instrumentedOCR) ExtractText(ctx context.Context, input []byte, lang string) (string, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() (string, error) {
+		return w.OCRService.ExtractText(w.withSlots(ctx), input, lang)
+	})
+}
+
+func (w *instrumentedOCR) ExtractTextWithOptions(ctx context.Context, input []byte, opts *service.OCROptions) (string, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() (string, error) {
+		return w.OCRService.ExtractTextWithOptions(w.withSlots(ctx), input, opts)
+	})
+}
+
+func (w *instrumentedOCR) CreateSearchablePDF(ctx context.Context, input []byte, lang string) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() ([]byte, error) {
+		return w.OCRService.CreateSearchablePDF(w.withSlots(ctx), input, lang)
+	})
+}
+
+func (w *instrumentedOCR) CreateSearchablePDFWithOptions(ctx context.Context, input []byte, opts *service.OCROptions) ([]byte, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() ([]byte, error) {
+		return w.OCRService.CreateSearchablePDFWithOptions(w.withSlots(ctx), input, opts)
+	})
+}
+
+func (w *instrumentedOCR) Recognize(ctx context.Context, input []byte, opts *service.OCROptions) (*service.OCRResult, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() (*service.OCRResult, error) {
+		return w.OCRService.Recognize(w.withSlots(ctx), input, opts)
+	})
+}
+
+func (w *instrumentedOCR) DetectOrientation(ctx context.Context, input []byte) ([]service.PageOrientation, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() ([]service.PageOrientation, error) {
+		return w.OCRService.DetectOrientation(w.withSlots(ctx), input)
+	})
+}
+
+func (w *instrumentedOCR) CorrectOrientation(ctx context.Context, input []byte, opts *service.OrientationOptions) (*service.OrientationResult, error) {
+	return instrumentContext(ctx, w.in, "ocr", BackendTesseract, int64(len(input)), func() (*service.OrientationResult, error) {
+		return w.OCRService.CorrectOrientation(w.withSlots(ctx), input, opts)
+	})
+}
+
+type instrumentedOutline struct {
+	service.OutlineService
+	in *instrumentation
+}
+
+func (w *instrumentedOutline) GetOutline(input []byte) ([]service.OutlineItem, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]service.OutlineItem, error) {
+		return w.OutlineService.GetOutline(input)
+	})
+}
+
+func (w *instrumentedOutline) GetOutlineJSON(input []byte) ([]byte, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.OutlineService.GetOutlineJSON(input)
+	})
+}
+
+func (w *instrumentedOutline) SetOutline(input []byte, items []service.OutlineItem) ([]byte, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.OutlineService.SetOutline(input, items)
+	})
+}
+
+func (w *instrumentedOutline) EditOutline(input []byte, edit func([]service.OutlineItem) ([]service.OutlineItem, error)) ([]byte, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.OutlineService.EditOutline(input, edit)
+	})
+}
+
+func (w *instrumentedOutline) RemoveOutline(input []byte) ([]byte, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.OutlineService.RemoveOutline(input)
+	})
+}
+
+func (w *instrumentedOutline) DetectHeadings(input []byte, opts *service.HeadingOptions) ([]service.OutlineItem, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]service.OutlineItem, error) {
+		return w.OutlineService.DetectHeadings(input, opts)
+	})
+}
+
+func (w *instrumentedOutline) GenerateOutline(input []byte, opts *service.HeadingOptions) ([]byte, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.OutlineService.GenerateOutline(input, opts)
+	})
+}
+
+func (w *instrumentedOutline) ImportOutline(input []byte, spec []byte, format string) ([]byte, error) {
+	return instrument(w.in, "outline", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.OutlineService.ImportOutline(input, spec, format)
+	})
+}
+
+type instrumentedAnnotations struct {
+	service.AnnotationService
+	in *instrumentation
+}
+
+func (w *instrumentedAnnotations) ListAnnotations(input []byte) ([]service.Annotation, error) {
+	return instrument(w.in, "annotation", BackendPDFCPU, int64(len(input)), func() ([]service.Annotation, error) {
+		return w.AnnotationService.ListAnnotations(input)
+	})
+}
+
+func (w *instrumentedAnnotations) AddAnnotations(input []byte, annots []service.Annotation) ([]byte, error) {
+	return instrument(w.in, "annotation", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.AnnotationService.AddAnnotations(input, annots)
+	})
+}
+
+func (w *instrumentedAnnotations) RemoveAnnotations(input []byte, filter *service.AnnotationFilter) ([]byte, error) {
+	return instrument(w.in, "annotation", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.AnnotationService.RemoveAnnotations(input, filter)
+	})
+}
+
+func (w *instrumentedAnnotations) FlattenAnnotations(input []byte, filter *service.AnnotationFilter) ([]byte, error) {
+	return instrument(w.in, "annotation", BackendPDFCPU, int64(len(input)), func() ([]byte, error) {
+		return w.AnnotationService.FlattenAnnotations(input, filter)
+	})
+}
+
+type instrumentedExport struct {
+	service.ExportService
+	in *instrumentation
+}
+
+func (w *instrumentedExport) ToHTML(ctx context.Context, input []byte, opts *service.ExportOptions) (*service.ExportResult, error) {
+	return instrumentContext(ctx, w.in, "export", BackendPDFCPU, int64(len(input)), func() (*service.ExportResult, error) {
+		return w.ExportService.ToHTML(ctx, input, opts)
+	})
+}
+
+func (w *instrumentedExport) ToMarkdown(ctx context.Context, input []byte, opts *service.ExportOptions) (*service.ExportResult, error) {
+	return instrumentContext(ctx, w.in, "export", BackendPDFCPU, int64(len(input)), func() (*service.ExportResult, error) {
+		return w.ExportService.ToMarkdown(ctx, input, opts)
+	})
+}
@@ -1,12 +1,67 @@
 package pdfsdk
 
 import (
+	"encoding/json"
+	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Outcome label values recorded for every operation.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Backend label values identifying the engine that served an operation.
+const (
+	BackendPDFCPU    = "pdfcpu"
+	BackendGotenberg = "gotenberg"
+	BackendPoppler   = "poppler"
+	BackendTesseract = "tesseract"
+	BackendGofpdf    = "gofpdf"
+	BackendUnknown   = "unknown"
+)
+
+// Content types served by Metrics.Handler.
+const (
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var (
+	// DefaultLatencyBuckets are the upper bounds, in seconds, of the operation latency histogram.
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+	// DefaultSizeBuckets are the upper bounds, in bytes, of the input and output size histograms.
+	DefaultSizeBuckets = []float64{1 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20, 1 << 30}
+)
+
+// OperationRecord describes a single completed SDK operation.
+// InputBytes and OutputBytes are negative when the size is unknown.
+type OperationRecord struct {
+	Operation   string
+	Backend     string
+	Duration    time.Duration
+	InputBytes  int64
+	OutputBytes int64
+	Err         error
+}
+
+type operationKey struct {
+	operation string
+	backend   string
+	outcome   string
+}
+
+type httpStatusKey struct {
+	route string
+	code  string
+}
+
 type Metrics struct {
 	TotalOperations      int64
 	SuccessfulOperations int64
@@ -28,32 +83,81 @@ type Metrics struct {
 	TotalInputBytes      int64
 	TotalOutputBytes     int64
 	errorCounts          map[string]int64
+	latency              map[operationKey]*histogram
+	inputSizes           map[operationKey]*histogram
+	outputSizes          map[operationKey]*histogram
+	inFlight             map[string]int64
+	httpStatus           map[httpStatusKey]int64
+	workerPool           *WorkerPool
 	mu                   sync.RWMutex
 }
 
 func NewMetrics() *Metrics {
 	return &Metrics{
 		errorCounts: make(map[string]int64),
+		latency:     make(map[operationKey]*histogram),
+		inputSizes:  make(map[operationKey]*histogram),
+		outputSizes: make(map[operationKey]*histogram),
+		inFlight:    make(map[string]int64),
+		httpStatus:  make(map[httpStatusKey]int64),
 	}
 }
 
 func (m *Metrics) RecordOperation(service string, success bool, duration time.Duration, inputSize, outputSize int64) {
+	m.record(OperationRecord{
+		Operation:   service,
+		Backend:     BackendUnknown,
+		Duration:    duration,
+		InputBytes:  inputSize,
+		OutputBytes: outputSize,
+	}, success)
+}
+
+// Record stores a completed operation in the counters and histograms.
+// A non-nil Err marks the operation as failed and is counted by ErrorClass.
+func (m *Metrics) Record(rec OperationRecord) {
+	m.record(rec, rec.Err == nil)
+	if rec.Err != nil {
+		m.RecordError(ErrorClass(rec.Err))
+	}
+}
+
+func (m *Metrics) record(rec OperationRecord, success bool) {
 	atomic.AddInt64(&m.TotalOperations, 1)
+	outcome := OutcomeSuccess
 	if success {
 		atomic.AddInt64(&m.SuccessfulOperations, 1)
 	} else {
 		atomic.AddInt64(&m.FailedOperations, 1)
+		outcome = OutcomeError
 	}
 
-	atomic.AddInt64(&m.TotalInputBytes, inputSize)
-	atomic.AddInt64(&m.TotalOutputBytes, outputSize)
+	if rec.InputBytes > 0 {
+		atomic.AddInt64(&m.TotalInputBytes, rec.InputBytes)
+	}
+	if rec.OutputBytes > 0 {
+		atomic.AddInt64(&m.TotalOutputBytes, rec.OutputBytes)
+	}
+
+	backend := rec.Backend
+	if backend == "" {
+		backend = BackendUnknown
+	}
+	key := operationKey{operation: rec.Operation, backend: backend, outcome: outcome}
 
 	m.mu.Lock()
-	m.TotalDuration += duration
+	m.TotalDuration += rec.Duration
 	m.LastOperationTime = time.Now()
+	observe(m.latency, key, DefaultLatencyBuckets, rec.Duration.Seconds())
+	if rec.InputBytes >= 0 {
+		observe(m.inputSizes, key, DefaultSizeBuckets, float64(rec.InputBytes))
+	}
+	if rec.OutputBytes >= 0 {
+		observe(m.outputSizes, key, DefaultSizeBuckets, float64(rec.OutputBytes))
+	}
 	m.mu.Unlock()
 
-	switch service {
+	switch rec.Operation {
 	case "compress":
 		atomic.AddInt64(&m.CompressCount, 1)
 	case "merge":
@@ -68,7 +172,7 @@ func (m *Metrics) RecordOperation(service string, success bool, duration time.Du
 		atomic.AddInt64(&m.ProtectCount, 1)
 	case "unlock":
 		atomic.AddInt64(&m.UnlockCount, 1)
-	case "convert":
+	case "convert", "word_to_pdf", "excel_to_pdf", "powerpoint_to_pdf", "jpg_to_pdf", "pdf_to_jpg":
 		atomic.AddInt64(&m.ConvertCount, 1)
 	case "info":
 		atomic.AddInt64(&m.InfoCount, 1)
@@ -87,6 +191,43 @@ func (m *Metrics) RecordError(errType string) {
 	m.errorCounts[errType]++
 }
 
+// RecordHTTPStatus counts a Gotenberg response by route and status code.
+// A zero code records a transport failure.
+func (m *Metrics) RecordHTTPStatus(route string, code int) {
+	label := "error"
+	if code > 0 {
+		label = strconv.Itoa(code)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpStatus[httpStatusKey{route: route, code: label}]++
+}
+
+// TrackInFlight marks an operation as running and returns the function that
+// marks it as finished.
+func (m *Metrics) TrackInFlight(operation string) func() {
+	m.mu.Lock()
+	m.inFlight[operation]++
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			m.inFlight[operation]--
+			m.mu.Unlock()
+		})
+	}
+}
+
+// ObserveWorkerPool exports the pool's occupancy as gauges.
+func (m *Metrics) ObserveWorkerPool(wp *WorkerPool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workerPool = wp
+}
+
 func (m *Metrics) GetErrorCounts() map[string]int64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -110,7 +251,10 @@ func (m *Metrics) SuccessRate() float64 {
 func (m *Metrics) AverageDuration() time.Duration {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return m.averageDuration()
+}
 
+func (m *Metrics) averageDuration() time.Duration {
 	total := atomic.LoadInt64(&m.TotalOperations)
 	if total == 0 {
 		return 0
@@ -166,6 +310,10 @@ func (m *Metrics) Reset() {
 	m.TotalDuration = 0
 	m.LastOperationTime = time.Time{}
 	m.errorCounts = make(map[string]int64)
+	m.latency = make(map[operationKey]*histogram)
+	m.inputSizes = make(map[operationKey]*histogram)
+	m.outputSizes = make(map[operationKey]*histogram)
+	m.httpStatus = make(map[httpStatusKey]int64)
 	m.mu.Unlock()
 }
 
@@ -173,7 +321,7 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return MetricsSnapshot{
+	snapshot := MetricsSnapshot{
 		TotalOperations:      atomic.LoadInt64(&m.TotalOperations),
 		SuccessfulOperations: atomic.LoadInt64(&m.SuccessfulOperations),
 		FailedOperations:     atomic.LoadInt64(&m.FailedOperations),
@@ -190,62 +338,357 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 		TotalDuration:        m.TotalDuration,
 		LastOperationTime:    m.LastOperationTime,
 		SuccessRate:          m.SuccessRate(),
-		AverageDuration:      m.AverageDuration(),
+		AverageDuration:      m.averageDuration(),
+		Latency:              snapshotHistograms(m.latency),
+		InputSizes:           snapshotHistograms(m.inputSizes),
+		OutputSizes:          snapshotHistograms(m.outputSizes),
+		Errors:               make(map[string]int64, len(m.errorCounts)),
+		InFlight:             make(map[string]int64, len(m.inFlight)),
 	}
+
+	for k, v := range m.errorCounts {
+		snapshot.Errors[k] = v
+	}
+	for k, v := range m.inFlight {
+		snapshot.InFlight[k] = v
+	}
+	for k, v := range m.httpStatus {
+		snapshot.HTTPStatus = append(snapshot.HTTPStatus, HTTPStatusCount{Route: k.route, Code: k.code, Count: v})
+	}
+	sort.Slice(snapshot.HTTPStatus, func(i, j int) bool {
+		a, b := snapshot.HTTPStatus[i], snapshot.HTTPStatus[j]
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Code < b.Code
+	})
+
+	if m.workerPool != nil {
+		pool := m.workerPool.Snapshot()
+		snapshot.WorkerPool = &WorkerPoolSnapshot{
+			Active:           pool.Active,
+			MaxWorkers:       pool.MaxWorkers,
+			Processed:        pool.Processed,
+			Queued:           pool.Queued,
+			Rejected:         pool.Rejected,
+			BytesInUse:       pool.BytesInUse,
+			MemoryBudget:     pool.MemoryBudget,
+			Admitted:         pool.Admitted,
+			QueueWaitSeconds: pool.QueueWait.Seconds(),
+		}
+	}
+
+	return snapshot
 }
 
 type MetricsSnapshot struct {
-	TotalOperations      int64
-	SuccessfulOperations int64
-	FailedOperations     int64
-	CompressCount        int64
-	MergeCount           int64
-	SplitCount           int64
-	RotateCount          int64
-	WatermarkCount       int64
-	ProtectCount         int64
-	UnlockCount          int64
-	ConvertCount         int64
-	TotalInputBytes      int64
-	TotalOutputBytes     int64
-	TotalDuration        time.Duration
-	LastOperationTime    time.Time
-	SuccessRate          float64
-	AverageDuration      time.Duration
+	TotalOperations      int64               `json:"total_operations"`
+	SuccessfulOperations int64               `json:"successful_operations"`
+	FailedOperations     int64               `json:"failed_operations"`
+	CompressCount        int64               `json:"compress_count"`
+	MergeCount           int64               `json:"merge_count"`
+	SplitCount           int64               `json:"split_count"`
+	RotateCount          int64               `json:"rotate_count"`
+	WatermarkCount       int64               `json:"watermark_count"`
+	ProtectCount         int64               `json:"protect_count"`
+	UnlockCount          int64               `json:"unlock_count"`
+	ConvertCount         int64               `json:"convert_count"`
+	TotalInputBytes      int64               `json:"total_input_bytes"`
+	TotalOutputBytes     int64               `json:"total_output_bytes"`
+	TotalDuration        time.Duration       `json:"total_duration_ns"`
+	LastOperationTime    time.Time           `json:"last_operation_time"`
+	SuccessRate          float64             `json:"success_rate"`
+	AverageDuration      time.Duration       `json:"average_duration_ns"`
+	Latency              []HistogramSnapshot `json:"latency_seconds"`
+	InputSizes           []HistogramSnapshot `json:"input_bytes"`
+	OutputSizes          []HistogramSnapshot `json:"output_bytes"`
+	Errors               map[string]int64    `json:"errors"`
+	InFlight             map[string]int64    `json:"in_flight"`
+	HTTPStatus           []HTTPStatusCount   `json:"gotenberg_responses"`
+	WorkerPool           *WorkerPoolSnapshot `json:"worker_pool,omitempty"`
+}
+
+// HistogramSnapshot is a point-in-time copy of one labelled histogram.
+// Buckets are cumulative and exclude the implicit +Inf bucket, whose count is Count.
+type HistogramSnapshot struct {
+	Operation string        `json:"operation"`
+	Backend   string        `json:"backend"`
+	Outcome   string        `json:"outcome"`
+	Buckets   []BucketCount `json:"buckets"`
+	Sum       float64       `json:"sum"`
+	Count     uint64        `json:"count"`
+}
+
+type BucketCount struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+type HTTPStatusCount struct {
+	Route string `json:"route"`
+	Code  string `json:"code"`
+	Count int64  `json:"count"`
+}
+
+type WorkerPoolSnapshot struct {
+	Active           int     `json:"active"`
+	MaxWorkers       int     `json:"max_workers"`
+	Processed        int64   `json:"processed"`
+	Queued           int     `json:"queued"`
+	Rejected         int64   `json:"rejected"`
+	BytesInUse       int64   `json:"bytes_in_use"`
+	MemoryBudget     int64   `json:"memory_budget"`
+	Admitted         int64   `json:"admitted"`
+	QueueWaitSeconds float64 `json:"queue_wait_seconds"`
 }
 
+// String returns the snapshot as JSON so Metrics satisfies expvar.Var:
+//
+//	expvar.Publish("pdfsdk", sdk.Metrics())
+func (m *Metrics) String() string {
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// PrometheusMetrics renders the metrics in the Prometheus text format (0.0.4).
 func (m *Metrics) PrometheusMetrics() string {
+	return m.exposition(false)
+}
+
+// OpenMetrics renders the metrics in the OpenMetrics 1.0 text format.
+func (m *Metrics) OpenMetrics() string {
+	return m.exposition(true)
+}
+
+// Handler serves the metrics, choosing OpenMetrics when the scraper accepts it.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			w.Header().Set("Content-Type", OpenMetricsContentType)
+			_, _ = w.Write([]byte(m.OpenMetrics()))
+			return
+		}
+		w.Header().Set("Content-Type", PrometheusContentType)
+		_, _ = w.Write([]byte(m.PrometheusMetrics()))
+	})
+}
+
+func (m *Metrics) exposition(openMetrics bool) string {
 	snapshot := m.Snapshot()
+	w := &expositionWriter{openMetrics: openMetrics}
+
+	w.family("pdfsdk_operations", "counter", "Total number of PDF operations")
+	w.sample("pdfsdk_operations_total", formatInt64(snapshot.SuccessfulOperations), "status", OutcomeSuccess)
+	w.sample("pdfsdk_operations_total", formatInt64(snapshot.FailedOperations), "status", "failed")
+
+	byService := []struct {
+		service string
+		count   int64
+	}{
+		{"compress", snapshot.CompressCount},
+		{"merge", snapshot.MergeCount},
+		{"split", snapshot.SplitCount},
+		{"rotate", snapshot.RotateCount},
+		{"watermark", snapshot.WatermarkCount},
+		{"protect", snapshot.ProtectCount},
+		{"unlock", snapshot.UnlockCount},
+		{"convert", snapshot.ConvertCount},
+	}
+	w.family("pdfsdk_operations_by_service", "counter", "Operations count by service")
+	for _, c := range byService {
+		w.sample("pdfsdk_operations_by_service_total", formatInt64(c.count), "service", c.service)
+	}
+	// Deprecated: the samples were named without _total before the
+	// OpenMetrics export. The Prometheus format keeps them until dashboards
+	// move to the new name; OpenMetrics counters need the suffix.
+	if !openMetrics {
+		w.header("pdfsdk_operations_by_service", "counter", "Operations count by service (deprecated, use pdfsdk_operations_by_service_total)")
+		for _, c := range byService {
+			w.sample("pdfsdk_operations_by_service", formatInt64(c.count), "service", c.service)
+		}
+	}
+
+	w.family("pdfsdk_bytes_processed", "counter", "Total bytes processed")
+	w.sample("pdfsdk_bytes_processed_total", formatInt64(snapshot.TotalInputBytes), "direction", "input")
+	w.sample("pdfsdk_bytes_processed_total", formatInt64(snapshot.TotalOutputBytes), "direction", "output")
+
+	w.family("pdfsdk_success_rate", "gauge", "Success rate percentage")
+	w.sample("pdfsdk_success_rate", formatFloat64(snapshot.SuccessRate))
+
+	w.family("pdfsdk_average_duration_seconds", "gauge", "Average operation duration")
+	w.sample("pdfsdk_average_duration_seconds", formatFloat64(snapshot.AverageDuration.Seconds()))
+
+	w.histograms("pdfsdk_operation_duration_seconds", "Operation latency by operation, backend and outcome", snapshot.Latency)
+	w.histograms("pdfsdk_operation_input_bytes", "Operation input size by operation, backend and outcome", snapshot.InputSizes)
+	w.histograms("pdfsdk_operation_output_bytes", "Operation output size by operation, backend and outcome", snapshot.OutputSizes)
+
+	w.family("pdfsdk_errors", "counter", "Failed operations by error class")
+	for _, class := range sortedKeys(snapshot.Errors) {
+		w.sample("pdfsdk_errors_total", formatInt64(snapshot.Errors[class]), "class", class)
+	}
+
+	w.family("pdfsdk_operations_in_flight", "gauge", "Operations currently running")
+	for _, op := range sortedKeys(snapshot.InFlight) {
+		w.sample("pdfsdk_operations_in_flight", formatInt64(snapshot.InFlight[op]), "operation", op)
+	}
+
+	if snapshot.WorkerPool != nil {
+		w.family("pdfsdk_worker_pool_active", "gauge", "Worker pool slots in use")
+		w.sample("pdfsdk_worker_pool_active", strconv.Itoa(snapshot.WorkerPool.Active))
+		w.family("pdfsdk_worker_pool_capacity", "gauge", "Worker pool size")
+		w.sample("pdfsdk_worker_pool_capacity", strconv.Itoa(snapshot.WorkerPool.MaxWorkers))
+		w.family("pdfsdk_worker_pool_processed", "counter", "Tasks released by the worker pool")
+		w.sample("pdfsdk_worker_pool_processed_total", formatInt64(snapshot.WorkerPool.Processed))
+		w.family("pdfsdk_worker_pool_queued", "gauge", "Operations waiting for a worker")
+		w.sample("pdfsdk_worker_pool_queued", strconv.Itoa(snapshot.WorkerPool.Queued))
+		w.family("pdfsdk_worker_pool_rejected", "counter", "Operations rejected because the queue was full")
+		w.sample("pdfsdk_worker_pool_rejected_total", formatInt64(snapshot.WorkerPool.Rejected))
+		w.family("pdfsdk_worker_pool_memory_bytes", "gauge", "Estimated bytes held by running operations")
+		w.sample("pdfsdk_worker_pool_memory_bytes", formatInt64(snapshot.WorkerPool.BytesInUse))
+		w.family("pdfsdk_worker_pool_queue_wait_seconds", "summary", "Time operations spent waiting for a worker")
+		w.sample("pdfsdk_worker_pool_queue_wait_seconds_sum", formatFloat64(snapshot.WorkerPool.QueueWaitSeconds))
+		w.sample("pdfsdk_worker_pool_queue_wait_seconds_count", formatInt64(snapshot.WorkerPool.Admitted))
+	}
+
+	w.family("pdfsdk_gotenberg_responses", "counter", "Gotenberg HTTP responses by route and status code")
+	for _, s := range snapshot.HTTPStatus {
+		w.sample("pdfsdk_gotenberg_responses_total", formatInt64(s.Count), "route", s.Route, "code", s.Code)
+	}
+
+	if openMetrics {
+		w.b.WriteString("# EOF\n")
+	}
+	return w.b.String()
+}
 
-	return `# HELP pdfsdk_operations_total Total number of PDF operations
-# TYPE pdfsdk_operations_total counter
-pdfsdk_operations_total{status="success"} ` + formatInt64(snapshot.SuccessfulOperations) + `
-pdfsdk_operations_total{status="failed"} ` + formatInt64(snapshot.FailedOperations) + `
-
-# HELP pdfsdk_operations_by_service Operations count by service
-# TYPE pdfsdk_operations_by_service counter
-pdfsdk_operations_by_service{service="compress"} ` + formatInt64(snapshot.CompressCount) + `
-pdfsdk_operations_by_service{service="merge"} ` + formatInt64(snapshot.MergeCount) + `
-pdfsdk_operations_by_service{service="split"} ` + formatInt64(snapshot.SplitCount) + `
-pdfsdk_operations_by_service{service="rotate"} ` + formatInt64(snapshot.RotateCount) + `
-pdfsdk_operations_by_service{service="watermark"} ` + formatInt64(snapshot.WatermarkCount) + `
-pdfsdk_operations_by_service{service="protect"} ` + formatInt64(snapshot.ProtectCount) + `
-pdfsdk_operations_by_service{service="unlock"} ` + formatInt64(snapshot.UnlockCount) + `
-pdfsdk_operations_by_service{service="convert"} ` + formatInt64(snapshot.ConvertCount) + `
-
-# HELP pdfsdk_bytes_processed_total Total bytes processed
-# TYPE pdfsdk_bytes_processed_total counter
-pdfsdk_bytes_processed_total{direction="input"} ` + formatInt64(snapshot.TotalInputBytes) + `
-pdfsdk_bytes_processed_total{direction="output"} ` + formatInt64(snapshot.TotalOutputBytes) + `
-
-# HELP pdfsdk_success_rate Success rate percentage
-# TYPE pdfsdk_success_rate gauge
-pdfsdk_success_rate ` + formatFloat64(snapshot.SuccessRate) + `
-
-# HELP pdfsdk_average_duration_seconds Average operation duration
-# TYPE pdfsdk_average_duration_seconds gauge
-pdfsdk_average_duration_seconds ` + formatFloat64(snapshot.AverageDuration.Seconds()) + `
-`
+type expositionWriter struct {
+	b           strings.Builder
+	openMetrics bool
+}
+
+func (w *expositionWriter) family(name, typ, help string) {
+	// The Prometheus text format names counter families after their
+	// samples, OpenMetrics after the sample name without _total.
+	if typ == "counter" && !w.openMetrics {
+		name += "_total"
+	}
+	w.header(name, typ, help)
+}
+
+// header starts a family named exactly name.
+func (w *expositionWriter) header(name, typ, help string) {
+	if !w.openMetrics && w.b.Len() > 0 {
+		w.b.WriteByte('\n')
+	}
+	w.b.WriteString("# HELP " + name + " " + help + "\n")
+	w.b.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one line; labels are given as name, value pairs.
+func (w *expositionWriter) sample(name, value string, labels ...string) {
+	w.b.WriteString(name)
+	if len(labels) > 0 {
+		w.b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.b.WriteByte(',')
+			}
+			w.b.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		}
+		w.b.WriteByte('}')
+	}
+	w.b.WriteString(" " + value + "\n")
+}
+
+func (w *expositionWriter) histograms(name, help string, hs []HistogramSnapshot) {
+	w.family(name, "histogram", help)
+	for _, h := range hs {
+		labels := []string{"operation", h.Operation, "backend", h.Backend, "outcome", h.Outcome}
+		for _, b := range h.Buckets {
+			w.sample(name+"_bucket", strconv.FormatUint(b.Count, 10), append(labels, "le", formatBound(b.UpperBound))...)
+		}
+		w.sample(name+"_bucket", strconv.FormatUint(h.Count, 10), append(labels, "le", "+Inf")...)
+		w.sample(name+"_sum", strconv.FormatFloat(h.Sum, 'f', -1, 64), labels...)
+		w.sample(name+"_count", strconv.FormatUint(h.Count, 10), labels...)
+	}
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.sum += v
+	h.count++
+}
+
+func observe(hs map[operationKey]*histogram, key operationKey, bounds []float64, v float64) {
+	h, ok := hs[key]
+	if !ok {
+		h = newHistogram(bounds)
+		hs[key] = h
+	}
+	h.observe(v)
+}
+
+func snapshotHistograms(hs map[operationKey]*histogram) []HistogramSnapshot {
+	result := make([]HistogramSnapshot, 0, len(hs))
+	for key, h := range hs {
+		s := HistogramSnapshot{
+			Operation: key.operation,
+			Backend:   key.backend,
+			Outcome:   key.outcome,
+			Buckets:   make([]BucketCount, len(h.bounds)),
+			Sum:       h.sum,
+			Count:     h.count,
+		}
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			s.Buckets[i] = BucketCount{UpperBound: bound, Count: cumulative}
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		if a.Backend != b.Backend {
+			return a.Backend < b.Backend
+		}
+		return a.Outcome < b.Outcome
+	})
+	return result
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
 }
 
 func formatInt64(v int64) string {
@@ -255,3 +698,7 @@ func formatInt64(v int64) string {
 func formatFloat64(v float64) string {
 	return strconv.FormatFloat(v, 'f', 2, 64)
 }
+
+func formatBound(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
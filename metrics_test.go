@@ -1,6 +1,12 @@
 package pdfsdk_test
 
 import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -132,4 +138,155 @@ func TestPrometheusMetrics(t *testing.T) {
 	if len(prometheusOutput) < 100 {
 		t.Error("Prometheus output seems too short")
 	}
+
+	// The old sample name stays alongside the new one for existing dashboards.
+	for _, want := range []string{
+		`pdfsdk_operations_by_service_total{service="compress"} 1`,
+		`pdfsdk_operations_by_service{service="compress"} 1`,
+	} {
+		if !strings.Contains(prometheusOutput, want) {
+			t.Errorf("Prometheus output missing %q", want)
+		}
+	}
+	if strings.Contains(metrics.OpenMetrics(), `pdfsdk_operations_by_service{`) {
+		t.Error("OpenMetrics counters must end in _total")
+	}
+}
+
+func TestMetricsRecordHistograms(t *testing.T) {
+	metrics := pdfsdk.NewMetrics()
+
+	metrics.Record(pdfsdk.OperationRecord{
+		Operation:   "compress",
+		Backend:     pdfsdk.BackendPDFCPU,
+		Duration:    30 * time.Millisecond,
+		InputBytes:  2048,
+		OutputBytes: 1024,
+	})
+	metrics.Record(pdfsdk.OperationRecord{
+		Operation:   "compress",
+		Backend:     pdfsdk.BackendPDFCPU,
+		Duration:    2 * time.Second,
+		InputBytes:  4096,
+		OutputBytes: -1,
+		Err:         pdfsdk.WrapError("compress", "a.pdf", pdfsdk.ErrInvalidPDF),
+	})
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot.Latency) != 2 {
+		t.Fatalf("Expected 2 latency series, got %d", len(snapshot.Latency))
+	}
+
+	failed := snapshot.Latency[0]
+	if failed.Outcome != pdfsdk.OutcomeError || failed.Backend != pdfsdk.BackendPDFCPU {
+		t.Errorf("Unexpected labels on first series: %+v", failed)
+	}
+	if failed.Count != 1 {
+		t.Errorf("Expected 1 observation, got %d", failed.Count)
+	}
+	for _, b := range failed.Buckets {
+		if b.UpperBound < 2 && b.Count != 0 {
+			t.Errorf("2s observation counted in le=%v bucket", b.UpperBound)
+		}
+	}
+
+	if len(snapshot.OutputSizes) != 1 {
+		t.Errorf("Unknown output size should not be observed, got %d series", len(snapshot.OutputSizes))
+	}
+	if snapshot.Errors["invalid_pdf"] != 1 {
+		t.Errorf("Expected 1 invalid_pdf error, got %d", snapshot.Errors["invalid_pdf"])
+	}
+	if snapshot.CompressCount != 2 {
+		t.Errorf("Expected 2 compress count, got %d", snapshot.CompressCount)
+	}
+}
+
+func TestOpenMetrics(t *testing.T) {
+	metrics := pdfsdk.NewMetrics()
+	metrics.Record(pdfsdk.OperationRecord{
+		Operation:   "merge",
+		Backend:     pdfsdk.BackendPDFCPU,
+		Duration:    time.Millisecond,
+		InputBytes:  10,
+		OutputBytes: 5,
+	})
+	metrics.RecordHTTPStatus("/forms/libreoffice/convert", 503)
+
+	output := metrics.OpenMetrics()
+
+	if !strings.HasSuffix(output, "# EOF\n") {
+		t.Error("OpenMetrics output must end with # EOF")
+	}
+	for _, want := range []string{
+		"# TYPE pdfsdk_operation_duration_seconds histogram",
+		`pdfsdk_operation_duration_seconds_bucket{operation="merge",backend="pdfcpu",outcome="success",le="0.005"} 1`,
+		`pdfsdk_operation_duration_seconds_bucket{operation="merge",backend="pdfcpu",outcome="success",le="+Inf"} 1`,
+		`pdfsdk_operation_duration_seconds_count{operation="merge",backend="pdfcpu",outcome="success"} 1`,
+		"# TYPE pdfsdk_gotenberg_responses counter",
+		`pdfsdk_gotenberg_responses_total{route="/forms/libreoffice/convert",code="503"} 1`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("OpenMetrics output missing %q", want)
+		}
+	}
+
+	if strings.Contains(metrics.PrometheusMetrics(), "# EOF") {
+		t.Error("Prometheus text output must not contain # EOF")
+	}
+}
+
+func TestMetricsExpvarJSON(t *testing.T) {
+	metrics := pdfsdk.NewMetrics()
+	metrics.Record(pdfsdk.OperationRecord{Operation: "rotate", Backend: pdfsdk.BackendPDFCPU, InputBytes: 1, OutputBytes: 1})
+
+	var v expvar.Var = metrics
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(v.String()), &decoded); err != nil {
+		t.Fatalf("String() is not valid JSON: %v", err)
+	}
+	if decoded["total_operations"] != float64(1) {
+		t.Errorf("Expected total_operations=1, got %v", decoded["total_operations"])
+	}
+}
+
+func TestSDKRecordsOperations(t *testing.T) {
+	gotenberg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer gotenberg.Close()
+
+	sdk := pdfsdk.New(gotenberg.URL)
+	defer sdk.Close()
+
+	if _, err := sdk.Info().GetInfoBytes([]byte("not a pdf")); err == nil {
+		t.Fatal("Expected error for invalid input")
+	}
+	if _, err := sdk.WordToPDF().ConvertBytes(context.Background(), []byte("doc"), "a.docx"); err == nil {
+		t.Fatal("Expected error from unavailable Gotenberg")
+	}
+
+	snapshot := sdk.Metrics().Snapshot()
+	if snapshot.FailedOperations != 2 {
+		t.Errorf("Expected 2 failed operations, got %d", snapshot.FailedOperations)
+	}
+	if snapshot.WorkerPool == nil {
+		t.Error("Expected worker pool gauges in snapshot")
+	}
+
+	found := false
+	for _, s := range snapshot.HTTPStatus {
+		if s.Code == "503" && s.Count == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected one 503 Gotenberg response, got %+v", snapshot.HTTPStatus)
+	}
+
+	for _, h := range snapshot.Latency {
+		if h.Operation == "word_to_pdf" && h.Backend != pdfsdk.BackendGotenberg {
+			t.Errorf("Expected gotenberg backend for word_to_pdf, got %s", h.Backend)
+		}
+	}
 }
@@ -3,7 +3,6 @@ package pdfsdk
 import (
 	"net"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/gotenberg"
@@ -23,6 +22,15 @@ type Options struct {
 	IdleConnTimeout     time.Duration
 	RequestTimeout      time.Duration
 	MaxWorkers          int
+	// MemoryBudget caps the estimated bytes held by running operations;
+	// 0 disables the budget.
+	MemoryBudget int64
+	// MaxQueueDepth limits how many operations may wait for a worker before
+	// ErrWorkerPoolFull is returned; 0 means unlimited.
+	MaxQueueDepth int
+	// Metrics receives a record of every operation. A new Metrics is
+	// created when nil; set it to share one registry between SDKs.
+	Metrics *Metrics
 }
 
 func DefaultOptions() *Options {
@@ -43,66 +51,10 @@ type SDK struct {
 	service.PDFService
 	httpClient *http.Client
 	workerPool *WorkerPool
+	metrics    *Metrics
 	opts       *Options
 }
 
-type WorkerPool struct {
-	maxWorkers int
-	semaphore  chan struct{}
-	mu         sync.RWMutex
-	active     int
-	processed  int64
-}
-
-func NewWorkerPool(maxWorkers int) *WorkerPool {
-	if maxWorkers <= 0 {
-		maxWorkers = 10
-	}
-	return &WorkerPool{
-		maxWorkers: maxWorkers,
-		semaphore:  make(chan struct{}, maxWorkers),
-	}
-}
-
-func (wp *WorkerPool) Acquire() {
-	wp.semaphore <- struct{}{}
-	wp.mu.Lock()
-	wp.active++
-	wp.mu.Unlock()
-}
-
-func (wp *WorkerPool) Release() {
-	wp.mu.Lock()
-	wp.active--
-	wp.processed++
-	wp.mu.Unlock()
-	<-wp.semaphore
-}
-
-func (wp *WorkerPool) TryAcquire() bool {
-	select {
-	case wp.semaphore <- struct{}{}:
-		wp.mu.Lock()
-		wp.active++
-		wp.mu.Unlock()
-		return true
-	default:
-		return false
-	}
-}
-
-func (wp *WorkerPool) Stats() (active, maxWorkers int, processed int64) {
-	wp.mu.RLock()
-	defer wp.mu.RUnlock()
-	return wp.active, wp.maxWorkers, wp.processed
-}
-
-func (wp *WorkerPool) Available() int {
-	wp.mu.RLock()
-	defer wp.mu.RUnlock()
-	return wp.maxWorkers - wp.active
-}
-
 func New(gotenbergURL string) *SDK {
 	opts := DefaultOptions()
 	opts.GotenbergURL = gotenbergURL
@@ -128,20 +80,7 @@ func NewWithOptions(opts *Options) *SDK {
 		ForceAttemptHTTP2:   true,
 	}
 
-	httpClient := &http.Client{
-		Transport: transport,
-		Timeout:   opts.RequestTimeout,
-	}
-
-	log := logger.New(opts.ServiceName)
-	gotClient := gotenberg.NewWithClient(opts.GotenbergURL, httpClient)
-
-	return &SDK{
-		PDFService: service.New(log, gotClient),
-		httpClient: httpClient,
-		workerPool: NewWorkerPool(opts.MaxWorkers),
-		opts:       opts,
-	}
+	return newSDK(opts, logger.New(opts.ServiceName), transport)
 }
 
 func NewWithLogger(gotenbergURL string, log logger.ILogger) *SDK {
@@ -154,16 +93,35 @@ func NewWithLogger(gotenbergURL string, log logger.ILogger) *SDK {
 		IdleConnTimeout:     opts.IdleConnTimeout,
 	}
 
+	return newSDK(opts, log, transport)
+}
+
+func newSDK(opts *Options, log logger.ILogger, transport http.RoundTripper) *SDK {
+	metrics := opts.Metrics
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+
 	httpClient := &http.Client{
-		Transport: transport,
+		Transport: &metricsTransport{base: transport, metrics: metrics},
 		Timeout:   opts.RequestTimeout,
 	}
 
-	gotClient := gotenberg.NewWithClient(gotenbergURL, httpClient)
+	gotClient := gotenberg.NewWithClient(opts.GotenbergURL, httpClient)
+	workerPool := NewWorkerPoolWithConfig(&WorkerPoolConfig{
+		MaxWorkers:    opts.MaxWorkers,
+		MemoryBudget:  opts.MemoryBudget,
+		MaxQueueDepth: opts.MaxQueueDepth,
+	})
+	metrics.ObserveWorkerPool(workerPool)
+
+	in := &instrumentation{metrics: metrics, pool: workerPool}
+
 	return &SDK{
-		PDFService: service.New(log, gotClient),
+		PDFService: newInstrumentedService(service.New(log, gotClient), in),
 		httpClient: httpClient,
-		workerPool: NewWorkerPool(opts.MaxWorkers),
+		workerPool: workerPool,
+		metrics:    metrics,
 		opts:       opts,
 	}
 }
@@ -172,13 +130,23 @@ func (sdk *SDK) Workers() *WorkerPool {
 	return sdk.workerPool
 }
 
+// Metrics returns the registry that records every operation run through the SDK.
+func (sdk *SDK) Metrics() *Metrics {
+	return sdk.metrics
+}
+
 func (sdk *SDK) Stats() SDKStats {
-	active, max, processed := sdk.workerPool.Stats()
+	pool := sdk.workerPool.Snapshot()
 	return SDKStats{
-		ActiveWorkers:    active,
-		MaxWorkers:       max,
-		ProcessedTasks:   processed,
-		AvailableWorkers: max - active,
+		ActiveWorkers:    pool.Active,
+		MaxWorkers:       pool.MaxWorkers,
+		ProcessedTasks:   pool.Processed,
+		AvailableWorkers: pool.MaxWorkers - pool.Active,
+		QueuedTasks:      pool.Queued,
+		RejectedTasks:    pool.Rejected,
+		MemoryInUse:      pool.BytesInUse,
+		AverageQueueWait: pool.AverageQueueWait(),
+		MaxQueueWait:     pool.MaxQueueWait,
 	}
 }
 
@@ -187,6 +155,11 @@ type SDKStats struct {
 	MaxWorkers       int
 	ProcessedTasks   int64
 	AvailableWorkers int
+	QueuedTasks      int
+	RejectedTasks    int64
+	MemoryInUse      int64
+	AverageQueueWait time.Duration
+	MaxQueueWait     time.Duration
 }
 
 func (sdk *SDK) Close() {
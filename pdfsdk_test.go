@@ -1,6 +1,7 @@
 package pdfsdk_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -81,13 +82,15 @@ func TestWorkerPool(t *testing.T) {
 	}
 
 	// Acquire worker
-	sdk.Workers().Acquire()
+	if err := sdk.Workers().Acquire(context.Background(), pdfsdk.Weight{}, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
 	if sdk.Workers().Available() != 2 {
 		t.Errorf("Expected 2 available workers after acquire, got %d", sdk.Workers().Available())
 	}
 
 	// Release worker
-	sdk.Workers().Release()
+	sdk.Workers().Release(pdfsdk.Weight{})
 	if sdk.Workers().Available() != 3 {
 		t.Errorf("Expected 3 available workers after release, got %d", sdk.Workers().Available())
 	}
@@ -100,21 +103,21 @@ func TestWorkerPoolTryAcquire(t *testing.T) {
 	defer sdk.Close()
 
 	// First acquire should succeed
-	if !sdk.Workers().TryAcquire() {
+	if !sdk.Workers().TryAcquire(pdfsdk.Weight{}) {
 		t.Error("Expected TryAcquire to succeed on first call")
 	}
 
 	// Second acquire should fail (only 1 worker)
-	if sdk.Workers().TryAcquire() {
+	if sdk.Workers().TryAcquire(pdfsdk.Weight{}) {
 		t.Error("Expected TryAcquire to fail when all workers busy")
 	}
 
 	// Release and try again
-	sdk.Workers().Release()
-	if !sdk.Workers().TryAcquire() {
+	sdk.Workers().Release(pdfsdk.Weight{})
+	if !sdk.Workers().TryAcquire(pdfsdk.Weight{}) {
 		t.Error("Expected TryAcquire to succeed after release")
 	}
-	sdk.Workers().Release()
+	sdk.Workers().Release(pdfsdk.Weight{})
 }
 
 func TestWorkerPoolStats(t *testing.T) {
@@ -135,8 +138,10 @@ func TestWorkerPoolStats(t *testing.T) {
 	}
 
 	// Acquire and release to increment processed
-	sdk.Workers().Acquire()
-	sdk.Workers().Release()
+	if err := sdk.Workers().Acquire(context.Background(), pdfsdk.Weight{}, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	sdk.Workers().Release(pdfsdk.Weight{})
 
 	_, _, processed = sdk.Workers().Stats()
 	if processed != 1 {
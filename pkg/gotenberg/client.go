@@ -100,7 +100,7 @@ func (g *gotenbergClient) PDFToWord(ctx context.Context, pdfPath string) ([]byte
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("conversion failed: %w", err)
 	}
@@ -143,7 +143,7 @@ func (g *gotenbergClient) WordToPDF(ctx context.Context, wordPath string) ([]byt
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("conversion failed: %w", err)
 	}
@@ -186,7 +186,7 @@ func (g *gotenbergClient) WordToPDFStream(ctx context.Context, wordPath string,
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return fmt.Errorf("conversion failed: %w", err)
 	}
@@ -230,7 +230,7 @@ func (g *gotenbergClient) ExcelToPDF(ctx context.Context, excelPath string) ([]b
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("conversion failed: %w", err)
 	}
@@ -273,7 +273,7 @@ func (g *gotenbergClient) ExcelToPDFStream(ctx context.Context, excelPath string
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return fmt.Errorf("conversion failed: %w", err)
 	}
@@ -317,7 +317,7 @@ func (g *gotenbergClient) PowerPointToPDF(ctx context.Context, pptPath string) (
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("conversion failed: %w", err)
 	}
@@ -359,7 +359,7 @@ func (g *gotenbergClient) HTMLToPDF(ctx context.Context, htmlPath string) ([]byt
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("conversion request failed: %w", err)
 	}
@@ -25,7 +25,7 @@ func (g *gotenbergClient) HealthCheck(ctx context.Context) *HealthStatus {
 		return status
 	}
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	status.ResponseTime = time.Since(start)
 
 	if err != nil {
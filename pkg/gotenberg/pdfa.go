@@ -43,7 +43,7 @@ func (g *gotenbergClient) ConvertToPDFA(ctx context.Context, pdfPath string, for
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := g.httpClient.Do(req)
+	resp, err := g.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("conversion failed: %w", err)
 	}
@@ -0,0 +1,62 @@
+package gotenberg
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/infosec554/convert-pdf-go-sdk/pkg/gotenberg"
+
+// do sends req inside a client span and propagates the W3C trace context to
+// Gotenberg via the traceparent header.
+func (g *gotenbergClient) do(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(tracerName).Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", redactedURL(req.URL)),
+			attribute.String("server.address", req.URL.Hostname()),
+		),
+	)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// redactedURL returns u for the url.full attribute without its user info
+// and with query values replaced, since either may carry credentials.
+func redactedURL(u *url.URL) string {
+	r := *u
+	r.User = nil
+	if r.RawQuery != "" {
+		query := r.Query()
+		for _, values := range query {
+			for i := range values {
+				values[i] = "REDACTED"
+			}
+		}
+		r.RawQuery = query.Encode()
+	}
+	return r.String()
+}
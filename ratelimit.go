@@ -1,19 +1,198 @@
 package pdfsdk
 
 import (
+	"context"
+	"math"
 	"sync"
 	"time"
 )
 
+// RateLimiterConfig describes a token bucket: it holds at most Burst tokens
+// and refills continuously at Rate tokens per second.
+type RateLimiterConfig struct {
+	Rate  float64
+	Burst int
+	// Store keeps the bucket state. A MemoryRateLimitStore is created when
+	// nil; use a shared store to apply one limit across several processes.
+	Store RateLimitStore
+	// Key names the bucket of a single RateLimiter inside Store.
+	Key string
+	// IdleTimeout is how long a full bucket may go unused before the
+	// default in-memory store evicts it.
+	IdleTimeout time.Duration
+	// Now overrides the clock, mainly for tests.
+	Now func() time.Time
+}
+
+func DefaultRateLimiterConfig() *RateLimiterConfig {
+	return &RateLimiterConfig{
+		Rate:        100,
+		Burst:       100,
+		IdleTimeout: 5 * time.Minute,
+	}
+}
+
+// Every converts a minimum interval between events into a per-second rate.
+func Every(interval time.Duration) float64 {
+	if interval <= 0 {
+		return math.Inf(1)
+	}
+	return float64(time.Second) / float64(interval)
+}
+
+func (cfg *RateLimiterConfig) withDefaults() RateLimiterConfig {
+	c := *DefaultRateLimiterConfig()
+	if cfg != nil {
+		if cfg.Rate > 0 {
+			c.Rate = cfg.Rate
+		}
+		if cfg.Burst > 0 {
+			c.Burst = cfg.Burst
+		}
+		if cfg.IdleTimeout > 0 {
+			c.IdleTimeout = cfg.IdleTimeout
+		}
+		c.Store = cfg.Store
+		c.Key = cfg.Key
+		c.Now = cfg.Now
+	}
+	if c.Store == nil {
+		c.Store = NewMemoryRateLimitStore(c.IdleTimeout)
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+	return c
+}
+
+// RateLimitStore holds token bucket state by key. Implementations backed by
+// a shared database let several SDK processes enforce the same limits.
+type RateLimitStore interface {
+	// Take removes n tokens from the bucket for key after refilling it up to
+	// now. When fewer than n tokens are available nothing is taken and
+	// retryAfter reports how long until n tokens will be.
+	Take(ctx context.Context, key string, rate float64, burst, n int, now time.Time) (ok bool, retryAfter time.Duration, err error)
+	// Tokens reports the tokens available in the bucket for key at now.
+	Tokens(ctx context.Context, key string, rate float64, burst int, now time.Time) (float64, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  int
+}
+
+func (b *bucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(b.burst), b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// MemoryRateLimitStore is a process-local RateLimitStore. Buckets that are
+// full and have been idle for longer than the idle timeout are evicted, so
+// per-tenant keys do not accumulate.
+type MemoryRateLimitStore struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	idleTimeout time.Duration
+	lastSweep   time.Time
+}
+
+func NewMemoryRateLimitStore(idleTimeout time.Duration) *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:     make(map[string]*bucket),
+		idleTimeout: idleTimeout,
+	}
+}
+
+func (m *MemoryRateLimitStore) Take(ctx context.Context, key string, rate float64, burst, n int, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b := m.bucket(key, rate, burst, now)
+	need := float64(n)
+	if b.tokens >= need {
+		b.tokens -= need
+		return true, 0, nil
+	}
+	if rate <= 0 || math.IsInf(rate, 1) {
+		return false, 0, nil
+	}
+	wait := time.Duration((need - b.tokens) / rate * float64(time.Second))
+	return false, wait, nil
+}
+
+func (m *MemoryRateLimitStore) Tokens(ctx context.Context, key string, rate float64, burst int, now time.Time) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.bucket(key, rate, burst, now).tokens, nil
+}
+
+// Len reports the number of buckets currently held.
+func (m *MemoryRateLimitStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+// EvictIdle drops buckets that are full and unused since before
+// now minus the idle timeout, and returns how many were removed.
+func (m *MemoryRateLimitStore) EvictIdle(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastSweep = time.Time{}
+	return m.sweep(now)
+}
+
+func (m *MemoryRateLimitStore) bucket(key string, rate float64, burst int, now time.Time) *bucket {
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		m.buckets[key] = b
+	}
+	b.rate = rate
+	b.burst = burst
+	b.advance(now)
+	return b
+}
+
+func (m *MemoryRateLimitStore) sweep(now time.Time) int {
+	if m.idleTimeout <= 0 || now.Sub(m.lastSweep) < m.idleTimeout {
+		return 0
+	}
+	m.lastSweep = now
+
+	evicted := 0
+	for key, b := range m.buckets {
+		if now.Sub(b.last) < m.idleTimeout {
+			continue
+		}
+		// A bucket that would refill completely loses nothing by being
+		// recreated on next use.
+		b.advance(now)
+		if b.tokens >= float64(b.burst) {
+			delete(m.buckets, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// RateLimiter is a token bucket with burst capacity and smooth refill.
 type RateLimiter struct {
-	tokens     chan struct{}
-	interval   time.Duration
-	maxTokens  int
-	mu         sync.Mutex
-	stopCh     chan struct{}
-	refillOnce sync.Once
+	cfg      RateLimiterConfig
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
+// NewRateLimiter allows bursts of up to maxOps operations, refilled
+// at maxOps per interval.
 func NewRateLimiter(maxOps int, interval time.Duration) *RateLimiter {
 	if maxOps <= 0 {
 		maxOps = 100
@@ -22,72 +201,155 @@ func NewRateLimiter(maxOps int, interval time.Duration) *RateLimiter {
 		interval = time.Second
 	}
 
-	rl := &RateLimiter{
-		tokens:    make(chan struct{}, maxOps),
-		interval:  interval,
-		maxTokens: maxOps,
-		stopCh:    make(chan struct{}),
-	}
+	return NewRateLimiterWithConfig(&RateLimiterConfig{
+		Rate:  float64(maxOps) / interval.Seconds(),
+		Burst: maxOps,
+	})
+}
 
-	for i := 0; i < maxOps; i++ {
-		rl.tokens <- struct{}{}
+func NewRateLimiterWithConfig(cfg *RateLimiterConfig) *RateLimiter {
+	return &RateLimiter{
+		cfg:    cfg.withDefaults(),
+		stopCh: make(chan struct{}),
 	}
+}
 
-	rl.startRefill()
+// Acquire blocks until one token is available. When none is and the
+// limiter has been stopped, it returns ErrRateLimiterStopped instead.
+func (rl *RateLimiter) Acquire() error {
+	return rl.WaitN(context.Background(), 1)
+}
 
-	return rl
+func (rl *RateLimiter) TryAcquire() bool {
+	return rl.AllowN(1)
 }
 
-func (rl *RateLimiter) startRefill() {
-	rl.refillOnce.Do(func() {
-		go func() {
-			ticker := time.NewTicker(rl.interval)
-			defer ticker.Stop()
+// Wait blocks until one token is available or ctx is done.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	return rl.WaitN(ctx, 1)
+}
 
-			for {
-				select {
-				case <-rl.stopCh:
-					return
-				case <-ticker.C:
-					rl.refill()
-				}
-			}
-		}()
-	})
+// WaitN blocks until n tokens are available, e.g. to charge an operation by
+// page count or size. It fails with ErrRateLimitExceeded when n exceeds the
+// burst, since such a request could never be satisfied.
+func (rl *RateLimiter) WaitN(ctx context.Context, n int) error {
+	return waitN(ctx, &rl.cfg, rl.cfg.Key, n, rl.stopCh)
 }
 
-func (rl *RateLimiter) refill() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+func (rl *RateLimiter) AllowN(n int) bool {
+	ok, _, err := rl.cfg.Store.Take(context.Background(), rl.cfg.Key, rl.cfg.Rate, rl.cfg.Burst, n, rl.cfg.Now())
+	return err == nil && ok
+}
 
-	for len(rl.tokens) < rl.maxTokens {
-		select {
-		case rl.tokens <- struct{}{}:
-		default:
-			return
-		}
+// Available reports the whole tokens currently in the bucket.
+func (rl *RateLimiter) Available() int {
+	tokens, err := rl.cfg.Store.Tokens(context.Background(), rl.cfg.Key, rl.cfg.Rate, rl.cfg.Burst, rl.cfg.Now())
+	if err != nil {
+		return 0
 	}
+	return int(tokens)
 }
 
-func (rl *RateLimiter) Acquire() {
-	<-rl.tokens
+func (rl *RateLimiter) Rate() float64 {
+	return rl.cfg.Rate
 }
 
-func (rl *RateLimiter) TryAcquire() bool {
-	select {
-	case <-rl.tokens:
-		return true
-	default:
-		return false
+func (rl *RateLimiter) Burst() int {
+	return rl.cfg.Burst
+}
+
+// Stop releases any goroutines blocked in Wait with ErrRateLimiterStopped.
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.stopCh) })
+}
+
+// KeyedRateLimiter applies the same limit independently per key, such as a
+// tenant or API key.
+type KeyedRateLimiter struct {
+	cfg      RateLimiterConfig
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewKeyedRateLimiter(cfg *RateLimiterConfig) *KeyedRateLimiter {
+	return &KeyedRateLimiter{
+		cfg:    cfg.withDefaults(),
+		stopCh: make(chan struct{}),
 	}
 }
 
-func (rl *RateLimiter) Available() int {
-	return len(rl.tokens)
+func (k *KeyedRateLimiter) Wait(ctx context.Context, key string) error {
+	return k.WaitN(ctx, key, 1)
 }
 
-func (rl *RateLimiter) Stop() {
-	close(rl.stopCh)
+func (k *KeyedRateLimiter) WaitN(ctx context.Context, key string, n int) error {
+	return waitN(ctx, &k.cfg, k.key(key), n, k.stopCh)
+}
+
+func (k *KeyedRateLimiter) Allow(key string) bool {
+	return k.AllowN(key, 1)
+}
+
+func (k *KeyedRateLimiter) AllowN(key string, n int) bool {
+	ok, _, err := k.cfg.Store.Take(context.Background(), k.key(key), k.cfg.Rate, k.cfg.Burst, n, k.cfg.Now())
+	return err == nil && ok
+}
+
+func (k *KeyedRateLimiter) Available(key string) int {
+	tokens, err := k.cfg.Store.Tokens(context.Background(), k.key(key), k.cfg.Rate, k.cfg.Burst, k.cfg.Now())
+	if err != nil {
+		return 0
+	}
+	return int(tokens)
+}
+
+// Store returns the store holding the per-key buckets.
+func (k *KeyedRateLimiter) Store() RateLimitStore {
+	return k.cfg.Store
+}
+
+func (k *KeyedRateLimiter) Stop() {
+	k.stopOnce.Do(func() { close(k.stopCh) })
+}
+
+func (k *KeyedRateLimiter) key(key string) string {
+	if k.cfg.Key == "" {
+		return key
+	}
+	return k.cfg.Key + ":" + key
+}
+
+func waitN(ctx context.Context, cfg *RateLimiterConfig, key string, n int, stopCh <-chan struct{}) error {
+	if n <= 0 {
+		return nil
+	}
+	if n > cfg.Burst {
+		return ErrRateLimitExceeded
+	}
+
+	for {
+		ok, retryAfter, err := cfg.Store.Take(ctx, key, cfg.Rate, cfg.Burst, n, cfg.Now())
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if retryAfter < time.Millisecond {
+			retryAfter = time.Millisecond
+		}
+
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-stopCh:
+			timer.Stop()
+			return ErrRateLimiterStopped
+		case <-timer.C:
+		}
+	}
 }
 
 type RateLimitedSDK struct {
@@ -102,6 +364,13 @@ func (sdk *SDK) WithRateLimiter(maxOps int, interval time.Duration) *RateLimited
 	}
 }
 
+func (sdk *SDK) WithRateLimiterConfig(cfg *RateLimiterConfig) *RateLimitedSDK {
+	return &RateLimitedSDK{
+		SDK:     sdk,
+		limiter: NewRateLimiterWithConfig(cfg),
+	}
+}
+
 func (rls *RateLimitedSDK) Close() {
 	rls.limiter.Stop()
 	rls.SDK.Close()
@@ -1,6 +1,9 @@
 package pdfsdk_test
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -77,3 +80,222 @@ func TestRateLimitedSDK(t *testing.T) {
 		t.Errorf("Expected 10 available tokens, got %d", rls.RateLimiter().Available())
 	}
 }
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// fakeStore wraps the in-memory store to stand in for a shared backend,
+// recording calls and optionally failing.
+type fakeStore struct {
+	*pdfsdk.MemoryRateLimitStore
+	mu    sync.Mutex
+	takes int
+	keys  map[string]int
+	err   error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		MemoryRateLimitStore: pdfsdk.NewMemoryRateLimitStore(0),
+		keys:                 make(map[string]int),
+	}
+}
+
+func (f *fakeStore) Take(ctx context.Context, key string, rate float64, burst, n int, now time.Time) (bool, time.Duration, error) {
+	f.mu.Lock()
+	f.takes++
+	f.keys[key]++
+	err := f.err
+	f.mu.Unlock()
+	if err != nil {
+		return false, 0, err
+	}
+	return f.MemoryRateLimitStore.Take(ctx, key, rate, burst, n, now)
+}
+
+func TestRateLimiterSmoothRefill(t *testing.T) {
+	clock := newFakeClock()
+	limiter := pdfsdk.NewRateLimiterWithConfig(&pdfsdk.RateLimiterConfig{
+		Rate:  10,
+		Burst: 5,
+		Now:   clock.Now,
+	})
+	defer limiter.Stop()
+
+	if !limiter.AllowN(5) {
+		t.Fatal("Expected full burst to be allowed")
+	}
+	if limiter.TryAcquire() {
+		t.Fatal("Expected empty bucket")
+	}
+
+	// 10 tokens/s refills one token every 100ms rather than all at once.
+	clock.Advance(250 * time.Millisecond)
+	if got := limiter.Available(); got != 2 {
+		t.Errorf("Expected 2 tokens after 250ms, got %d", got)
+	}
+
+	clock.Advance(time.Hour)
+	if got := limiter.Available(); got != 5 {
+		t.Errorf("Expected refill capped at burst 5, got %d", got)
+	}
+}
+
+func TestRateLimiterWaitN(t *testing.T) {
+	limiter := pdfsdk.NewRateLimiterWithConfig(&pdfsdk.RateLimiterConfig{Rate: 100, Burst: 10})
+	defer limiter.Stop()
+
+	ctx := context.Background()
+	if err := limiter.WaitN(ctx, 10); err != nil {
+		t.Fatalf("WaitN failed: %v", err)
+	}
+
+	start := time.Now()
+	if err := limiter.WaitN(ctx, 3); err != nil {
+		t.Fatalf("WaitN failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected WaitN to wait for refill, returned after %v", elapsed)
+	}
+
+	if err := limiter.WaitN(ctx, 11); !errors.Is(err, pdfsdk.ErrRateLimitExceeded) {
+		t.Errorf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestRateLimiterWaitContext(t *testing.T) {
+	limiter := pdfsdk.NewRateLimiterWithConfig(&pdfsdk.RateLimiterConfig{Rate: 0.1, Burst: 1})
+	defer limiter.Stop()
+
+	limiter.Acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimiterStopReleasesWaiters(t *testing.T) {
+	limiter := pdfsdk.NewRateLimiterWithConfig(&pdfsdk.RateLimiterConfig{Rate: 0.1, Burst: 1})
+	limiter.Acquire()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Wait(context.Background())
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	limiter.Stop()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, pdfsdk.ErrRateLimiterStopped) {
+			t.Errorf("Expected ErrRateLimiterStopped, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after Stop")
+	}
+
+	if err := limiter.Acquire(); !errors.Is(err, pdfsdk.ErrRateLimiterStopped) {
+		t.Errorf("Expected Acquire after Stop to fail with ErrRateLimiterStopped, got %v", err)
+	}
+}
+
+func TestKeyedRateLimiter(t *testing.T) {
+	clock := newFakeClock()
+	limiter := pdfsdk.NewKeyedRateLimiter(&pdfsdk.RateLimiterConfig{
+		Rate:  1,
+		Burst: 2,
+		Now:   clock.Now,
+	})
+	defer limiter.Stop()
+
+	if !limiter.AllowN("tenant-a", 2) {
+		t.Fatal("Expected tenant-a burst to be allowed")
+	}
+	if limiter.Allow("tenant-a") {
+		t.Error("Expected tenant-a to be limited")
+	}
+	if !limiter.Allow("tenant-b") {
+		t.Error("Expected tenant-b to have its own bucket")
+	}
+	if got := limiter.Available("tenant-b"); got != 1 {
+		t.Errorf("Expected 1 token for tenant-b, got %d", got)
+	}
+}
+
+func TestKeyedRateLimiterEvictsIdleKeys(t *testing.T) {
+	clock := newFakeClock()
+	store := pdfsdk.NewMemoryRateLimitStore(time.Minute)
+	limiter := pdfsdk.NewKeyedRateLimiter(&pdfsdk.RateLimiterConfig{
+		Rate:  1,
+		Burst: 1000,
+		Store: store,
+		Now:   clock.Now,
+	})
+	defer limiter.Stop()
+
+	limiter.AllowN("drained", 1000)
+	limiter.Allow("idle")
+
+	clock.Advance(2 * time.Minute)
+	if evicted := store.EvictIdle(clock.Now()); evicted != 1 {
+		t.Errorf("Expected only the refilled key to be evicted, got %d", evicted)
+	}
+	if store.Len() != 1 {
+		t.Errorf("Expected drained bucket to be kept, got %d buckets", store.Len())
+	}
+
+	// Once refilled, the drained bucket is swept lazily on the next use.
+	clock.Advance(20 * time.Minute)
+	limiter.Allow("other")
+	if store.Len() != 1 {
+		t.Errorf("Expected idle buckets to be swept on use, got %d buckets", store.Len())
+	}
+}
+
+func TestRateLimiterSharedStore(t *testing.T) {
+	store := newFakeStore()
+	cfg := &pdfsdk.RateLimiterConfig{Rate: 1, Burst: 3, Store: store, Key: "global"}
+
+	// Two limiters over one store behave like two SDK processes.
+	first := pdfsdk.NewRateLimiterWithConfig(cfg)
+	second := pdfsdk.NewRateLimiterWithConfig(cfg)
+	defer first.Stop()
+	defer second.Stop()
+
+	if !first.AllowN(2) {
+		t.Fatal("Expected first limiter to take 2 tokens")
+	}
+	if second.AllowN(2) {
+		t.Error("Expected second limiter to see the shared bucket")
+	}
+	if store.keys["global"] != 2 {
+		t.Errorf("Expected both limiters to use key global, got %v", store.keys)
+	}
+
+	store.err = errors.New("store unavailable")
+	if err := second.Wait(context.Background()); err == nil || err.Error() != "store unavailable" {
+		t.Errorf("Expected store error, got %v", err)
+	}
+}
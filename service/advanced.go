@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
 )
@@ -18,17 +20,49 @@ type PageService interface {
 	InsertPages(base []byte, insert []byte, afterPage int) ([]byte, error)
 	ReorderPages(input []byte, order []int) ([]byte, error)
 	GetPageCount(input []byte) (int, error)
+
+	// NUp places N pages (2, 4, 6 or 9) on each sheet.
+	NUp(input []byte, opts *NUpOptions) ([]byte, error)
+	// Booklet imposes pages two per sheet side for saddle stitching.
+	Booklet(input []byte, opts *BookletOptions) ([]byte, error)
+	// ResizePages scales pages onto a paper size, keeping links and forms.
+	ResizePages(input []byte, opts *ResizeOptions) ([]byte, error)
+	// AddMargins grows the selected pages by the given margins.
+	AddMargins(input []byte, pages string, margins Margins) ([]byte, error)
+	// GetPageBoxes returns the effective boxes of every page.
+	GetPageBoxes(input []byte) ([]PageBoxes, error)
+	// SetPageBoxes sets the given boxes on the selected pages.
+	SetPageBoxes(input []byte, pages string, boxes PageBoxes) ([]byte, error)
+
+	// AnalyzeBlankPages scores how blank each page is.
+	AnalyzeBlankPages(input []byte, opts *BlankPageOptions) ([]BlankPageScore, error)
+	// RemoveBlankPages deletes the pages AnalyzeBlankPages reports blank.
+	RemoveBlankPages(input []byte, opts *BlankPageOptions) ([]byte, error)
 }
 
 type pageService struct {
-	log logger.ILogger
+	log      logger.ILogger
+	renderer PageRenderer
 }
 
 func NewPageService(log logger.ILogger) PageService {
-	return &pageService{log: log}
+	return NewPageServiceWithRenderer(log, NewPopplerRenderer())
+}
+
+// NewPageServiceWithRenderer creates a page service that renders scanned
+// pages for blank page detection with renderer.
+func NewPageServiceWithRenderer(log logger.ILogger, renderer PageRenderer) PageService {
+	return &pageService{log: log, renderer: renderer}
 }
 
 func (s *pageService) ExtractPages(input []byte, pages string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.ExtractPages", AttrInputBytes.Int(len(input)))
+	output, err := s.extractPages(ctx, input, pages)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) extractPages(ctx context.Context, input []byte, pages string) ([]byte, error) {
 	s.log.Info("PageService.ExtractPages called", logger.String("pages", pages))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-extract-*")
@@ -38,18 +72,20 @@ func (s *pageService) ExtractPages(input []byte, pages string) ([]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
 	outputPath := filepath.Join(tmpDir, "output.pdf")
 
-	if err := api.TrimFile(inputPath, outputPath, []string{pages}, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.TrimFile", func() error {
+		return api.TrimFile(inputPath, outputPath, []string{pages}, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu trim failed", logger.Error(err))
 		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +95,13 @@ func (s *pageService) ExtractPages(input []byte, pages string) ([]byte, error) {
 }
 
 func (s *pageService) DeletePages(input []byte, pages string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.DeletePages", AttrInputBytes.Int(len(input)))
+	output, err := s.deletePages(ctx, input, pages)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) deletePages(ctx context.Context, input []byte, pages string) ([]byte, error) {
 	s.log.Info("PageService.DeletePages called", logger.String("pages", pages))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-delete-*")
@@ -67,17 +110,24 @@ func (s *pageService) DeletePages(input []byte, pages string) ([]byte, error) {
 	}
 	defer os.RemoveAll(tmpDir)
 
+	selection, err := api.ParsePageSelection(pages)
+	if err != nil {
+		return nil, err
+	}
+
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
-	if err := api.RemovePagesFile(inputPath, "", []string{pages}, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.RemovePagesFile", func() error {
+		return api.RemovePagesFile(inputPath, "", selection, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu remove failed", logger.Error(err))
 		return nil, err
 	}
 
-	output, err := os.ReadFile(inputPath)
+	output, err := readFile(ctx, inputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +137,13 @@ func (s *pageService) DeletePages(input []byte, pages string) ([]byte, error) {
 }
 
 func (s *pageService) InsertPages(base []byte, insert []byte, afterPage int) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.InsertPages", AttrInputBytes.Int(len(base)+len(insert)))
+	output, err := s.insertPages(ctx, base, insert, afterPage)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) insertPages(ctx context.Context, base []byte, insert []byte, afterPage int) ([]byte, error) {
 	s.log.Info("PageService.InsertPages called", logger.Int("afterPage", afterPage))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-insert-*")
@@ -99,47 +156,50 @@ func (s *pageService) InsertPages(base []byte, insert []byte, afterPage int) ([]
 	insertPath := filepath.Join(tmpDir, "insert.pdf")
 	outputPath := filepath.Join(tmpDir, "output.pdf")
 
-	if err := os.WriteFile(basePath, base, 0644); err != nil {
+	if err := writeFile(ctx, basePath, base); err != nil {
 		return nil, err
 	}
-	if err := os.WriteFile(insertPath, insert, 0644); err != nil {
+	if err := writeFile(ctx, insertPath, insert); err != nil {
 		return nil, err
 	}
 
-	baseCtx, err := api.ReadContextFile(basePath)
+	baseCtx, err := readContextFile(ctx, basePath)
 	if err != nil {
 		return nil, err
 	}
 
+	var mergePaths []string
 	if afterPage <= 0 {
-		conf := model.NewDefaultConfiguration()
-		if err := api.MergeCreateFile([]string{insertPath, basePath}, outputPath, false, conf); err != nil {
-			return nil, err
-		}
+		mergePaths = []string{insertPath, basePath}
 	} else if afterPage >= baseCtx.PageCount {
-		conf := model.NewDefaultConfiguration()
-		if err := api.MergeCreateFile([]string{basePath, insertPath}, outputPath, false, conf); err != nil {
-			return nil, err
-		}
+		mergePaths = []string{basePath, insertPath}
 	} else {
 		part1Path := filepath.Join(tmpDir, "part1.pdf")
 		part2Path := filepath.Join(tmpDir, "part2.pdf")
 
-		if err := api.TrimFile(basePath, part1Path, []string{fmt.Sprintf("1-%d", afterPage)}, nil); err != nil {
+		if err := traceStep(ctx, "pdfcpu.TrimFile", func() error {
+			return api.TrimFile(basePath, part1Path, []string{fmt.Sprintf("1-%d", afterPage)}, nil)
+		}); err != nil {
 			return nil, err
 		}
 
-		if err := api.TrimFile(basePath, part2Path, []string{fmt.Sprintf("%d-", afterPage+1)}, nil); err != nil {
+		if err := traceStep(ctx, "pdfcpu.TrimFile", func() error {
+			return api.TrimFile(basePath, part2Path, []string{fmt.Sprintf("%d-", afterPage+1)}, nil)
+		}); err != nil {
 			return nil, err
 		}
 
-		conf := model.NewDefaultConfiguration()
-		if err := api.MergeCreateFile([]string{part1Path, insertPath, part2Path}, outputPath, false, conf); err != nil {
-			return nil, err
-		}
+		mergePaths = []string{part1Path, insertPath, part2Path}
+	}
+
+	conf := model.NewDefaultConfiguration()
+	if err := traceStep(ctx, "pdfcpu.MergeCreateFile", func() error {
+		return api.MergeCreateFile(mergePaths, outputPath, false, conf)
+	}); err != nil {
+		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +209,13 @@ func (s *pageService) InsertPages(base []byte, insert []byte, afterPage int) ([]
 }
 
 func (s *pageService) ReorderPages(input []byte, order []int) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.ReorderPages", AttrInputBytes.Int(len(input)))
+	output, err := s.reorderPages(ctx, input, order)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) reorderPages(ctx context.Context, input []byte, order []int) ([]byte, error) {
 	s.log.Info("PageService.ReorderPages called", logger.Int("newOrderLen", len(order)))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-reorder-*")
@@ -158,7 +225,7 @@ func (s *pageService) ReorderPages(input []byte, order []int) ([]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
@@ -167,7 +234,9 @@ func (s *pageService) ReorderPages(input []byte, order []int) ([]byte, error) {
 		return nil, err
 	}
 
-	if err := api.SplitFile(inputPath, pagesDir, 1, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.SplitFile", func() error {
+		return api.SplitFile(inputPath, pagesDir, 1, nil)
+	}); err != nil {
 		return nil, err
 	}
 
@@ -193,11 +262,13 @@ func (s *pageService) ReorderPages(input []byte, order []int) ([]byte, error) {
 
 	outputPath := filepath.Join(tmpDir, "output.pdf")
 	conf := model.NewDefaultConfiguration()
-	if err := api.MergeCreateFile(reorderedFiles, outputPath, false, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.MergeCreateFile", func() error {
+		return api.MergeCreateFile(reorderedFiles, outputPath, false, conf)
+	}); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -209,40 +280,74 @@ func (s *pageService) ReorderPages(input []byte, order []int) ([]byte, error) {
 func (s *pageService) GetPageCount(input []byte) (int, error) {
 	s.log.Info("PageService.GetPageCount called")
 
+	ctx, span := startSpan(context.Background(), "PageService.GetPageCount", AttrInputBytes.Int(len(input)))
+	count, err := pageCount(ctx, input)
+	endSpan(span, err, AttrPageCount.Int(count))
+	return count, err
+}
+
+func pageCount(ctx context.Context, input []byte) (int, error) {
 	tmpFile, err := os.CreateTemp("", "pdf-count-*.pdf")
 	if err != nil {
 		return 0, err
 	}
 	defer os.Remove(tmpFile.Name())
 
-	if _, err := tmpFile.Write(input); err != nil {
-		tmpFile.Close()
+	if err := writeTemp(ctx, tmpFile, input); err != nil {
 		return 0, err
 	}
-	tmpFile.Close()
 
-	ctx, err := api.ReadContextFile(tmpFile.Name())
+	pdfCtx, err := readContextFile(ctx, tmpFile.Name())
 	if err != nil {
 		return 0, err
 	}
 
-	return ctx.PageCount, nil
+	return pdfCtx.PageCount, nil
 }
 
 type TextService interface {
 	ExtractText(input []byte) (string, error)
 	ExtractTextFromPage(input []byte, page int) (string, error)
+
+	// ExtractTextWithOptions reads each page's text layer and falls back
+	// to OCR for pages without meaningful text, reporting the method
+	// used for every page
+	ExtractTextWithOptions(ctx context.Context, input []byte, opts *TextExtractionOptions) (*TextExtraction, error)
+
+	// ExtractZones reads the value of each zone of a template from the
+	// text layer, falling back to OCR of the zone on scanned pages, and
+	// checks it against the zone's type and pattern
+	ExtractZones(ctx context.Context, input []byte, tmpl *ZoneTemplate, opts *TextExtractionOptions) (*ZoneExtraction, error)
+
+	// ExtractTables finds tables from ruling lines and text alignment,
+	// using OCR word boxes on scanned pages, and returns their cells
+	// with row and column spans
+	ExtractTables(ctx context.Context, input []byte, opts *TableOptions) (*TableExtraction, error)
 }
 
 type textService struct {
 	log logger.ILogger
+	ocr OCRService
 }
 
 func NewTextService(log logger.ILogger) TextService {
-	return &textService{log: log}
+	return NewTextServiceWithOCR(log, NewOCRService(log))
+}
+
+// NewTextServiceWithOCR creates a text service that falls back to ocr
+// for scanned pages.
+func NewTextServiceWithOCR(log logger.ILogger, ocr OCRService) TextService {
+	return &textService{log: log, ocr: ocr}
 }
 
 func (s *textService) ExtractText(input []byte) (string, error) {
+	ctx, span := startSpan(context.Background(), "TextService.ExtractText", AttrInputBytes.Int(len(input)))
+	text, err := s.extractText(ctx, input)
+	endSpan(span, err, AttrOutputBytes.Int(len(text)))
+	return text, err
+}
+
+func (s *textService) extractText(ctx context.Context, input []byte) (string, error) {
 	s.log.Info("TextService.ExtractText called")
 
 	tmpFile, err := os.CreateTemp("", "pdf-text-*.pdf")
@@ -251,11 +356,9 @@ func (s *textService) ExtractText(input []byte) (string, error) {
 	}
 	defer os.Remove(tmpFile.Name())
 
-	if _, err := tmpFile.Write(input); err != nil {
-		tmpFile.Close()
+	if err := writeTemp(ctx, tmpFile, input); err != nil {
 		return "", err
 	}
-	tmpFile.Close()
 
 	textFile, err := os.CreateTemp("", "pdf-text-*.txt")
 	if err != nil {
@@ -264,12 +367,14 @@ func (s *textService) ExtractText(input []byte) (string, error) {
 	defer os.Remove(textFile.Name())
 	textFile.Close()
 
-	if err := api.ExtractContentFile(tmpFile.Name(), textFile.Name(), nil, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.ExtractContentFile", func() error {
+		return api.ExtractContentFile(tmpFile.Name(), textFile.Name(), nil, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu extract text failed", logger.Error(err))
 		return "", err
 	}
 
-	textBytes, err := os.ReadFile(textFile.Name())
+	textBytes, err := readFile(ctx, textFile.Name())
 	if err != nil {
 		return "", err
 	}
@@ -281,13 +386,20 @@ func (s *textService) ExtractText(input []byte) (string, error) {
 func (s *textService) ExtractTextFromPage(input []byte, page int) (string, error) {
 	s.log.Info("TextService.ExtractTextFromPage called", logger.Int("page", page))
 
+	ctx, span := startSpan(context.Background(), "TextService.ExtractTextFromPage", AttrInputBytes.Int(len(input)), AttrPage.Int(page))
+	text, err := s.extractTextFromPage(ctx, input, page)
+	endSpan(span, err, AttrOutputBytes.Int(len(text)))
+	return text, err
+}
+
+func (s *textService) extractTextFromPage(ctx context.Context, input []byte, page int) (string, error) {
 	pageService := &pageService{log: s.log}
-	pageBytes, err := pageService.ExtractPages(input, string(rune('0'+page)))
+	pageBytes, err := pageService.extractPages(ctx, input, string(rune('0'+page)))
 	if err != nil {
 		return "", err
 	}
 
-	return s.ExtractText(pageBytes)
+	return s.extractText(ctx, pageBytes)
 }
 
 type MetadataService interface {
@@ -304,6 +416,13 @@ func NewMetadataService(log logger.ILogger) MetadataService {
 }
 
 func (s *metadataService) GetMetadata(input []byte) (map[string]string, error) {
+	ctx, span := startSpan(context.Background(), "MetadataService.GetMetadata", AttrInputBytes.Int(len(input)))
+	metadata, err := s.getMetadata(ctx, input)
+	endSpan(span, err)
+	return metadata, err
+}
+
+func (s *metadataService) getMetadata(ctx context.Context, input []byte) (map[string]string, error) {
 	s.log.Info("MetadataService.GetMetadata called")
 
 	tmpFile, err := os.CreateTemp("", "pdf-meta-*.pdf")
@@ -312,22 +431,20 @@ func (s *metadataService) GetMetadata(input []byte) (map[string]string, error) {
 	}
 	defer os.Remove(tmpFile.Name())
 
-	if _, err := tmpFile.Write(input); err != nil {
-		tmpFile.Close()
+	if err := writeTemp(ctx, tmpFile, input); err != nil {
 		return nil, err
 	}
-	tmpFile.Close()
 
-	ctx, err := api.ReadContextFile(tmpFile.Name())
+	pdfCtx, err := readContextFile(ctx, tmpFile.Name())
 	if err != nil {
 		return nil, err
 	}
 
 	metadata := make(map[string]string)
-	metadata["pages"] = string(rune('0' + ctx.PageCount))
-	metadata["version"] = ctx.HeaderVersion.String()
+	metadata["pages"] = string(rune('0' + pdfCtx.PageCount))
+	metadata["version"] = pdfCtx.HeaderVersion.String()
 	metadata["encrypted"] = "false"
-	if ctx.Encrypt != nil {
+	if pdfCtx.Encrypt != nil {
 		metadata["encrypted"] = "true"
 	}
 
@@ -336,6 +453,9 @@ func (s *metadataService) GetMetadata(input []byte) (map[string]string, error) {
 }
 
 func (s *metadataService) SetMetadata(input []byte, metadata map[string]string) ([]byte, error) {
+	_, span := startSpan(context.Background(), "MetadataService.SetMetadata", AttrInputBytes.Int(len(input)))
+	defer endSpan(span, nil)
+
 	s.log.Info("MetadataService.SetMetadata called")
 	s.log.Warn("SetMetadata has limited support - returning input unchanged")
 
@@ -349,6 +469,10 @@ func (s *metadataService) SetMetadata(input []byte, metadata map[string]string)
 type ImageExtractService interface {
 	ExtractImages(input []byte) ([][]byte, error)
 	ExtractImagesFromPage(input []byte, page int) ([][]byte, error)
+	// ExtractImagesWithOptions returns the images with their page and
+	// properties, skipping masks, small images and duplicates, and
+	// optionally converting them all to PNG or JPEG.
+	ExtractImagesWithOptions(ctx context.Context, input []byte, opts *ImageExtractOptions) ([]ExtractedImage, error)
 }
 
 type imageExtractService struct {
@@ -360,6 +484,13 @@ func NewImageExtractService(log logger.ILogger) ImageExtractService {
 }
 
 func (s *imageExtractService) ExtractImages(input []byte) ([][]byte, error) {
+	ctx, span := startSpan(context.Background(), "ImageExtractService.ExtractImages", AttrInputBytes.Int(len(input)))
+	images, err := s.extractImages(ctx, input)
+	endSpan(span, err, attribute.Int("pdf.image_count", len(images)))
+	return images, err
+}
+
+func (s *imageExtractService) extractImages(ctx context.Context, input []byte) ([][]byte, error) {
 	s.log.Info("ImageExtractService.ExtractImages called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-img-extract-*")
@@ -369,7 +500,7 @@ func (s *imageExtractService) ExtractImages(input []byte) ([][]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
@@ -378,7 +509,9 @@ func (s *imageExtractService) ExtractImages(input []byte) ([][]byte, error) {
 		return nil, err
 	}
 
-	if err := api.ExtractImagesFile(inputPath, outputDir, nil, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.ExtractImagesFile", func() error {
+		return api.ExtractImagesFile(inputPath, outputDir, nil, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu extract images failed", logger.Error(err))
 		return nil, err
 	}
@@ -393,7 +526,7 @@ func (s *imageExtractService) ExtractImages(input []byte) ([][]byte, error) {
 		if f.IsDir() {
 			continue
 		}
-		imgData, err := os.ReadFile(filepath.Join(outputDir, f.Name()))
+		imgData, err := readFile(ctx, filepath.Join(outputDir, f.Name()))
 		if err != nil {
 			continue
 		}
@@ -407,11 +540,18 @@ func (s *imageExtractService) ExtractImages(input []byte) ([][]byte, error) {
 func (s *imageExtractService) ExtractImagesFromPage(input []byte, page int) ([][]byte, error) {
 	s.log.Info("ImageExtractService.ExtractImagesFromPage called", logger.Int("page", page))
 
+	ctx, span := startSpan(context.Background(), "ImageExtractService.ExtractImagesFromPage", AttrInputBytes.Int(len(input)), AttrPage.Int(page))
+	images, err := s.extractImagesFromPage(ctx, input, page)
+	endSpan(span, err, attribute.Int("pdf.image_count", len(images)))
+	return images, err
+}
+
+func (s *imageExtractService) extractImagesFromPage(ctx context.Context, input []byte, page int) ([][]byte, error) {
 	pageService := &pageService{log: s.log}
-	pageBytes, err := pageService.ExtractPages(input, string(rune('0'+page)))
+	pageBytes, err := pageService.extractPages(ctx, input, string(rune('0'+page)))
 	if err != nil {
 		return nil, err
 	}
 
-	return s.ExtractImages(pageBytes)
+	return s.extractImages(ctx, pageBytes)
 }
@@ -0,0 +1,993 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+type AnnotationService interface {
+	// ListAnnotations returns the annotations on every page in page order.
+	// Popup annotations are not listed; they belong to their parent.
+	ListAnnotations(input []byte) ([]Annotation, error)
+	// AddAnnotations adds annotations with generated appearance streams,
+	// so they render the same in every viewer and can be flattened.
+	AddAnnotations(input []byte, annots []Annotation) ([]byte, error)
+	// RemoveAnnotations removes the matching annotations and their popups.
+	// Form field widgets are never removed.
+	RemoveAnnotations(input []byte, filter *AnnotationFilter) ([]byte, error)
+	// FlattenAnnotations draws the appearance of the matching annotations
+	// into the page content and removes them. Links, widgets and
+	// annotations without an appearance stream are left in place.
+	FlattenAnnotations(input []byte, filter *AnnotationFilter) ([]byte, error)
+}
+
+type AnnotationType string
+
+const (
+	AnnotationHighlight AnnotationType = "Highlight"
+	AnnotationUnderline AnnotationType = "Underline"
+	AnnotationStrikeOut AnnotationType = "StrikeOut"
+	// AnnotationNote is a sticky note, stored as a Text annotation.
+	AnnotationNote     AnnotationType = "Text"
+	AnnotationFreeText AnnotationType = "FreeText"
+	AnnotationInk      AnnotationType = "Ink"
+	AnnotationLink     AnnotationType = "Link"
+	AnnotationStamp    AnnotationType = "Stamp"
+)
+
+// Annotation describes one page annotation. Rect is [llx lly urx ury] in
+// PDF points from the bottom left of the page. Listing fills in whatever
+// the document holds, including types that cannot be added. A sticky note
+// whose Rect gives only the lower left corner gets a 20pt icon.
+type Annotation struct {
+	// ID is the annotation's unique name; one is generated when adding.
+	ID       string         `json:"id,omitempty"`
+	Page     int            `json:"page"`
+	Type     AnnotationType `json:"type"`
+	Rect     [4]float64     `json:"rect"`
+	Author   string         `json:"author,omitempty"`
+	Contents string         `json:"contents,omitempty"`
+	Created  time.Time      `json:"created,omitzero"`
+	Modified time.Time      `json:"modified,omitzero"`
+	// Color is a hex RGB value such as "#ffff00": the highlight, line,
+	// icon or text colour depending on the type.
+	Color string `json:"color,omitempty"`
+
+	// QuadPoints mark the text covered by a highlight, underline or
+	// strike-out, eight numbers per quadrilateral; Rect is used when empty.
+	QuadPoints []float64 `json:"quad_points,omitempty"`
+	// InkList holds the strokes of an ink annotation as x,y pairs.
+	InkList [][]float64 `json:"ink_list,omitempty"`
+	// Width is the ink stroke width or the free text border width.
+	Width float64 `json:"width,omitempty"`
+	// FontSize is the free text size, 12 when zero.
+	FontSize float64 `json:"font_size,omitempty"`
+	// Icon is the sticky note icon (Comment, Note, ...) or the stamp name
+	// (Approved, Draft, Confidential or any other word).
+	Icon string `json:"icon,omitempty"`
+	// URI or DestPage is the target of a link.
+	URI      string `json:"uri,omitempty"`
+	DestPage int    `json:"dest_page,omitempty"`
+}
+
+// AnnotationFilter selects annotations; empty fields match everything.
+type AnnotationFilter struct {
+	// Pages is a page selection such as "1-3,7".
+	Pages   string           `json:"pages,omitempty"`
+	Types   []AnnotationType `json:"types,omitempty"`
+	Authors []string         `json:"authors,omitempty"`
+	IDs     []string         `json:"ids,omitempty"`
+}
+
+func (f *AnnotationFilter) matches(a Annotation) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !containsValue(f.Types, a.Type) {
+		return false
+	}
+	if len(f.Authors) > 0 && !containsValue(f.Authors, a.Author) {
+		return false
+	}
+	if len(f.IDs) > 0 && !containsValue(f.IDs, a.ID) {
+		return false
+	}
+	return true
+}
+
+func containsValue[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+type annotationService struct {
+	log logger.ILogger
+}
+
+func NewAnnotationService(log logger.ILogger) AnnotationService {
+	return &annotationService{log: log}
+}
+
+func (s *annotationService) ListAnnotations(input []byte) ([]Annotation, error) {
+	ctx, span := startSpan(context.Background(), "AnnotationService.ListAnnotations", AttrInputBytes.Int(len(input)))
+	annots, err := s.listAnnotations(ctx, input)
+	endSpan(span, err, attribute.Int("pdf.annotation_count", len(annots)))
+	return annots, err
+}
+
+func (s *annotationService) listAnnotations(ctx context.Context, input []byte) ([]Annotation, error) {
+	s.log.Info("AnnotationService.ListAnnotations called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var annots []Annotation
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		page, err := pageAnnotations(pdfCtx, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, pa := range page {
+			if pa.annot.Type != "Popup" {
+				annots = append(annots, pa.annot)
+			}
+		}
+	}
+	return annots, nil
+}
+
+func (s *annotationService) AddAnnotations(input []byte, annots []Annotation) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "AnnotationService.AddAnnotations",
+		AttrInputBytes.Int(len(input)), attribute.Int("pdf.annotation_count", len(annots)))
+	output, err := s.addAnnotations(ctx, input, annots)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *annotationService) addAnnotations(ctx context.Context, input []byte, annots []Annotation) ([]byte, error) {
+	s.log.Info("AnnotationService.AddAnnotations called", logger.Int("count", len(annots)))
+
+	if len(annots) == 0 {
+		return nil, errors.New("no annotations given")
+	}
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	for i, a := range annots {
+		if err := validateAnnotation(a, pdfCtx.PageCount); err != nil {
+			return nil, fmt.Errorf("annotation %d: %w", i+1, err)
+		}
+	}
+
+	now := time.Now()
+	for _, a := range annots {
+		if err := addAnnotation(pdfCtx, a, now); err != nil {
+			return nil, fmt.Errorf("page %d: %w", a.Page, err)
+		}
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		s.log.Error("annotation write failed", logger.Error(err))
+		return nil, err
+	}
+	s.log.Info("Annotations added", logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+func (s *annotationService) RemoveAnnotations(input []byte, filter *AnnotationFilter) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "AnnotationService.RemoveAnnotations", AttrInputBytes.Int(len(input)))
+	output, err := s.removeAnnotations(ctx, input, filter, false)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *annotationService) FlattenAnnotations(input []byte, filter *AnnotationFilter) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "AnnotationService.FlattenAnnotations", AttrInputBytes.Int(len(input)))
+	output, err := s.removeAnnotations(ctx, input, filter, true)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+// removeAnnotations removes matching annotations, first drawing their
+// appearance into the page when flatten is set.
+func (s *annotationService) removeAnnotations(ctx context.Context, input []byte, filter *AnnotationFilter, flatten bool) ([]byte, error) {
+	op := "AnnotationService.RemoveAnnotations"
+	if flatten {
+		op = "AnnotationService.FlattenAnnotations"
+	}
+	s.log.Info(op + " called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var selection string
+	if filter != nil {
+		selection = filter.Pages
+	}
+	pages, err := selectedPages(pdfCtx, selection)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := 0
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !pages[p] {
+			continue
+		}
+		n, err := removePageAnnotations(pdfCtx, p, filter, flatten)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		removed += n
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Annotations removed", logger.Int("count", removed), logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+// pageAnnotation is an annotation together with its dictionary and the
+// object number of that dictionary, if it is indirect.
+type pageAnnotation struct {
+	annot Annotation
+	dict  types.Dict
+	objNr int
+	entry types.Object
+}
+
+func pageAnnotations(pdfCtx *model.Context, page int) ([]pageAnnotation, error) {
+	d, _, _, err := pdfCtx.PageDict(page, false)
+	if err != nil {
+		return nil, err
+	}
+	arr, err := pdfCtx.DereferenceArray(d["Annots"])
+	if err != nil {
+		return nil, err
+	}
+
+	var annots []pageAnnotation
+	for _, entry := range arr {
+		ad, err := pdfCtx.DereferenceDict(entry)
+		if err != nil || ad == nil {
+			continue
+		}
+		pa := pageAnnotation{annot: readAnnotation(pdfCtx, ad, page), dict: ad, entry: entry}
+		if ir, ok := entry.(types.IndirectRef); ok {
+			pa.objNr = ir.ObjectNumber.Value()
+		}
+		annots = append(annots, pa)
+	}
+	return annots, nil
+}
+
+func readAnnotation(pdfCtx *model.Context, d types.Dict, page int) Annotation {
+	a := Annotation{Page: page}
+	if subtype := d.NameEntry("Subtype"); subtype != nil {
+		a.Type = AnnotationType(*subtype)
+	}
+	a.Rect = annotationRect(pdfCtx, d)
+	a.ID = dictText(pdfCtx, d, "NM")
+	a.Author = dictText(pdfCtx, d, "T")
+	a.Contents = dictText(pdfCtx, d, "Contents")
+	a.Created, _ = types.DateTime(dictText(pdfCtx, d, "CreationDate"), true)
+	a.Modified, _ = types.DateTime(dictText(pdfCtx, d, "M"), true)
+
+	if c, err := pdfCtx.DereferenceArray(d["C"]); err == nil && len(c) > 0 {
+		a.Color = colorFromArray(pdfCtx, c)
+	}
+	if q, err := pdfCtx.DereferenceArray(d["QuadPoints"]); err == nil {
+		a.QuadPoints = numberArray(pdfCtx, q)
+	}
+	if ink, err := pdfCtx.DereferenceArray(d["InkList"]); err == nil {
+		for _, stroke := range ink {
+			if points, err := pdfCtx.DereferenceArray(stroke); err == nil {
+				a.InkList = append(a.InkList, numberArray(pdfCtx, points))
+			}
+		}
+	}
+	if bs := dictEntry(pdfCtx, d, "BS"); bs != nil {
+		a.Width, _ = pdfCtx.DereferenceNumber(bs["W"])
+	}
+	if name := d.NameEntry("Name"); name != nil {
+		a.Icon = *name
+	}
+	if da := dictText(pdfCtx, d, "DA"); da != "" {
+		scanContent([]byte(da), func(op string, args []any) {
+			if op == "Tf" {
+				a.FontSize = numberOperand(args, 1)
+			}
+		})
+	}
+
+	if a.Type == AnnotationLink {
+		dest := d["Dest"]
+		if action := dictEntry(pdfCtx, d, "A"); action != nil {
+			a.URI = dictText(pdfCtx, action, "URI")
+			if dest == nil {
+				dest = action["D"]
+			}
+		}
+		if dest != nil {
+			if arr, err := destinationArray(pdfCtx, dest); err == nil && len(arr) > 0 {
+				if ir, ok := arr[0].(types.IndirectRef); ok {
+					a.DestPage, _ = pdfCtx.PageNumber(ir.ObjectNumber.Value())
+				}
+			}
+		}
+	}
+	return a
+}
+
+func annotationRect(pdfCtx *model.Context, d types.Dict) [4]float64 {
+	var r [4]float64
+	if arr, err := pdfCtx.DereferenceArray(d["Rect"]); err == nil && len(arr) == 4 {
+		copy(r[:], numberArray(pdfCtx, arr))
+	}
+	return normalizeRect(r)
+}
+
+func normalizeRect(r [4]float64) [4]float64 {
+	return [4]float64{math.Min(r[0], r[2]), math.Min(r[1], r[3]), math.Max(r[0], r[2]), math.Max(r[1], r[3])}
+}
+
+func dictText(pdfCtx *model.Context, d types.Dict, key string) string {
+	if d[key] == nil {
+		return ""
+	}
+	s, err := pdfCtx.DereferenceText(d[key])
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+func numberArray(pdfCtx *model.Context, arr types.Array) []float64 {
+	out := make([]float64, 0, len(arr))
+	for _, o := range arr {
+		f, err := pdfCtx.DereferenceNumber(o)
+		if err != nil {
+			return nil
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// colorFromArray converts a gray, RGB or CMYK colour array to hex RGB.
+func colorFromArray(pdfCtx *model.Context, arr types.Array) string {
+	c := numberArray(pdfCtx, arr)
+	switch len(c) {
+	case 1:
+		return formatHexColor([3]float64{c[0], c[0], c[0]})
+	case 3:
+		return formatHexColor([3]float64{c[0], c[1], c[2]})
+	case 4:
+		k := 1 - c[3]
+		return formatHexColor([3]float64{(1 - c[0]) * k, (1 - c[1]) * k, (1 - c[2]) * k})
+	}
+	return ""
+}
+
+func validateAnnotation(a Annotation, pageCount int) error {
+	if a.Page < 1 || a.Page > pageCount {
+		return fmt.Errorf("page %d is outside 1-%d", a.Page, pageCount)
+	}
+	if a.Color != "" {
+		if _, err := parseHexColor(a.Color); err != nil {
+			return err
+		}
+	}
+	r := normalizeRect(a.Rect)
+	hasArea := r[2] > r[0] && r[3] > r[1]
+
+	switch a.Type {
+	case AnnotationHighlight, AnnotationUnderline, AnnotationStrikeOut:
+		if len(a.QuadPoints)%8 != 0 {
+			return errors.New("quad_points needs eight numbers per quadrilateral")
+		}
+		if len(a.QuadPoints) == 0 && !hasArea {
+			return fmt.Errorf("%s needs a rect or quad_points", a.Type)
+		}
+	case AnnotationNote:
+	case AnnotationFreeText:
+		if !hasArea {
+			return errors.New("free text needs a rect")
+		}
+	case AnnotationInk:
+		if len(a.InkList) == 0 {
+			return errors.New("ink needs ink_list")
+		}
+		for _, stroke := range a.InkList {
+			if len(stroke) < 2 || len(stroke)%2 != 0 {
+				return errors.New("ink strokes need x,y pairs")
+			}
+		}
+	case AnnotationLink:
+		if !hasArea {
+			return errors.New("link needs a rect")
+		}
+		if (a.URI == "") == (a.DestPage == 0) {
+			return errors.New("link needs exactly one of uri or dest_page")
+		}
+		if a.DestPage < 0 || a.DestPage > pageCount {
+			return fmt.Errorf("dest_page %d is outside 1-%d", a.DestPage, pageCount)
+		}
+	case AnnotationStamp:
+		if !hasArea {
+			return errors.New("stamp needs a rect")
+		}
+	default:
+		return fmt.Errorf("unsupported annotation type %q", a.Type)
+	}
+	return nil
+}
+
+var defaultAnnotationColors = map[AnnotationType]string{
+	AnnotationHighlight: "#ffff00",
+	AnnotationUnderline: "#0000ff",
+	AnnotationStrikeOut: "#ff0000",
+	AnnotationNote:      "#ffd700",
+	AnnotationFreeText:  "#000000",
+	AnnotationInk:       "#0000ff",
+	AnnotationStamp:     "#d00000",
+}
+
+func addAnnotation(pdfCtx *model.Context, a Annotation, now time.Time) error {
+	pageDict, pageRef, _, err := pdfCtx.PageDict(a.Page, false)
+	if err != nil {
+		return err
+	}
+
+	if a.ID == "" {
+		a.ID = newAnnotationID()
+	}
+	if a.Modified.IsZero() {
+		a.Modified = now
+	}
+	if a.Color == "" {
+		a.Color = defaultAnnotationColors[a.Type]
+	}
+	rgb, _ := parseHexColor(a.Color)
+	if a.Type == AnnotationNote && a.Rect[2] == 0 && a.Rect[3] == 0 {
+		// Only the position was given; use the usual icon size.
+		a.Rect[2], a.Rect[3] = a.Rect[0]+20, a.Rect[1]+20
+	}
+	a.Rect = normalizeRect(a.Rect)
+
+	d := types.Dict{
+		"Type":    types.Name("Annot"),
+		"Subtype": types.Name(string(a.Type)),
+		"P":       *pageRef,
+		"NM":      textString(a.ID),
+		"M":       types.StringLiteral(types.DateString(a.Modified)),
+		"F":       types.Integer(4), // print
+	}
+	if a.Type != AnnotationLink {
+		created := a.Created
+		if created.IsZero() {
+			created = now
+		}
+		d["CreationDate"] = types.StringLiteral(types.DateString(created))
+		d["C"] = types.Array{types.Float(rgb[0]), types.Float(rgb[1]), types.Float(rgb[2])}
+		if a.Author != "" {
+			d["T"] = textString(a.Author)
+		}
+	}
+	if a.Contents != "" {
+		d["Contents"] = textString(a.Contents)
+	}
+
+	var ap appearance
+	switch a.Type {
+	case AnnotationHighlight, AnnotationUnderline, AnnotationStrikeOut:
+		quads := a.QuadPoints
+		if len(quads) == 0 {
+			r := a.Rect
+			quads = []float64{r[0], r[3], r[2], r[3], r[0], r[1], r[2], r[1]}
+		}
+		a.Rect = quadBounds(quads)
+		d["QuadPoints"] = floatArray(quads)
+		ap = markupAppearance(a.Type, quads, rgb)
+	case AnnotationNote:
+		icon := a.Icon
+		if icon == "" {
+			icon = "Comment"
+		}
+		d["Name"] = types.Name(icon)
+		ap = noteAppearance(a.Rect, rgb)
+	case AnnotationFreeText:
+		size := a.FontSize
+		if size <= 0 {
+			size = 12
+		}
+		d["DA"] = types.StringLiteral(fmt.Sprintf("/Helv %s Tf %s rg", pdfNumber(size), colorOperands(rgb)))
+		d["BS"] = types.Dict{"W": types.Float(a.Width)}
+		delete(d, "C")
+		ap = freeTextAppearance(a.Rect, a.Contents, size, a.Width, rgb)
+	case AnnotationInk:
+		width := a.Width
+		if width <= 0 {
+			width = 2
+		}
+		var strokes types.Array
+		for _, stroke := range a.InkList {
+			strokes = append(strokes, floatArray(stroke))
+		}
+		d["InkList"] = strokes
+		d["BS"] = types.Dict{"W": types.Float(width)}
+		a.Rect = inkBounds(a.InkList, width)
+		ap = inkAppearance(a.InkList, width, rgb)
+	case AnnotationLink:
+		d["Border"] = types.Array{types.Integer(0), types.Integer(0), types.Integer(0)}
+		if a.URI != "" {
+			d["A"] = types.Dict{"S": types.Name("URI"), "URI": types.StringLiteral(escapeLiteral(a.URI))}
+		} else {
+			_, target, _, err := pdfCtx.PageDict(a.DestPage, false)
+			if err != nil {
+				return err
+			}
+			d["Dest"] = types.Array{*target, types.Name("Fit")}
+		}
+	case AnnotationStamp:
+		icon := a.Icon
+		if icon == "" {
+			icon = "Draft"
+		}
+		d["Name"] = types.Name(icon)
+		ap = stampAppearance(a.Rect, stampLabel(icon), rgb)
+	}
+	d["Rect"] = floatArray(a.Rect[:])
+
+	if ap.content != nil {
+		form, err := newFormXObject(pdfCtx, a.Rect, ap.resources, ap.content)
+		if err != nil {
+			return err
+		}
+		d["AP"] = types.Dict{"N": *form}
+	}
+
+	ir, err := pdfCtx.IndRefForNewObject(d)
+	if err != nil {
+		return err
+	}
+	annots, err := pdfCtx.DereferenceArray(pageDict["Annots"])
+	if err != nil {
+		return err
+	}
+	pageDict["Annots"] = append(annots, *ir)
+	return nil
+}
+
+// removePageAnnotations removes matching annotations from one page and
+// returns how many were removed.
+func removePageAnnotations(pdfCtx *model.Context, page int, filter *AnnotationFilter, flatten bool) (int, error) {
+	annots, err := pageAnnotations(pdfCtx, page)
+	if err != nil || len(annots) == 0 {
+		return 0, err
+	}
+	pageDict, _, inh, err := pdfCtx.PageDict(page, true)
+	if err != nil {
+		return 0, err
+	}
+
+	drop := make(map[int]bool)
+	var overlay bytes.Buffer
+	var resources types.Dict
+	for i, pa := range annots {
+		a := pa.annot
+		if a.Type == "Widget" || a.Type == "Popup" || !filter.matches(a) {
+			continue
+		}
+		if flatten {
+			if a.Type == AnnotationLink {
+				continue
+			}
+			if resources == nil {
+				if resources, err = ownResources(pdfCtx, pageDict, inh); err != nil {
+					return 0, err
+				}
+			}
+			ok, err := flattenAnnotation(pdfCtx, pa, resources, &overlay)
+			if err != nil {
+				return 0, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		drop[i] = true
+	}
+	if len(drop) == 0 {
+		return 0, nil
+	}
+
+	// Popups go with their parent.
+	for i, pa := range annots {
+		if pa.annot.Type != "Popup" {
+			continue
+		}
+		if parent, ok := pa.dict["Parent"].(types.IndirectRef); ok {
+			for j, other := range annots {
+				if drop[j] && other.objNr == parent.ObjectNumber.Value() {
+					drop[i] = true
+				}
+			}
+		}
+	}
+
+	var kept types.Array
+	for i, pa := range annots {
+		if !drop[i] {
+			kept = append(kept, pa.entry)
+		}
+	}
+	if len(kept) == 0 {
+		delete(pageDict, "Annots")
+	} else {
+		pageDict["Annots"] = kept
+	}
+
+	if overlay.Len() > 0 {
+		// The original content is wrapped in q/Q so its graphics state
+		// does not leak into the overlay.
+		if err := wrapPageContent(pdfCtx, pageDict, []byte("q\n"), append([]byte("\nQ\n"), overlay.Bytes()...)); err != nil {
+			return 0, err
+		}
+	}
+
+	removed := 0
+	for i := range drop {
+		if annots[i].annot.Type != "Popup" {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// flattenAnnotation writes the operators that draw pa's normal appearance
+// to overlay, registering the appearance as an XObject in resources. It
+// reports false for hidden annotations and those without an appearance.
+func flattenAnnotation(pdfCtx *model.Context, pa pageAnnotation, resources types.Dict, overlay *bytes.Buffer) (bool, error) {
+	if f := pa.dict.IntEntry("F"); f != nil && *f&(2|32) != 0 {
+		return false, nil
+	}
+	ap := dictEntry(pdfCtx, pa.dict, "AP")
+	if ap == nil || ap["N"] == nil {
+		return false, nil
+	}
+
+	normal := ap["N"]
+	if states, err := pdfCtx.DereferenceDict(normal); err == nil && states != nil {
+		state := pa.dict.NameEntry("AS")
+		if state == nil {
+			return false, nil
+		}
+		normal = states[*state]
+	}
+	ir, ok := normal.(types.IndirectRef)
+	if !ok {
+		return false, nil
+	}
+	sd, _, err := pdfCtx.DereferenceStreamDict(ir)
+	if err != nil || sd == nil {
+		return false, err
+	}
+
+	bbox := [4]float64{0, 0, 0, 0}
+	if arr, err := pdfCtx.DereferenceArray(sd.Dict["BBox"]); err == nil && len(arr) == 4 {
+		copy(bbox[:], numberArray(pdfCtx, arr))
+	}
+	m := identityMatrix
+	if arr, err := pdfCtx.DereferenceArray(sd.Dict["Matrix"]); err == nil && len(arr) == 6 {
+		copy(m[:], numberArray(pdfCtx, arr))
+	}
+	box := transformRect(normalizeRect(bbox), m)
+	rect := pa.annot.Rect
+	if box[2]-box[0] <= 0 || box[3]-box[1] <= 0 || rect[2]-rect[0] <= 0 || rect[3]-rect[1] <= 0 {
+		return false, nil
+	}
+
+	xobjects := dictEntry(pdfCtx, resources, "XObject")
+	if xobjects == nil {
+		xobjects = types.Dict{}
+		resources["XObject"] = xobjects
+	}
+	name := "FlatAnnot" + strconv.Itoa(len(xobjects)+1)
+	for i := len(xobjects) + 1; xobjects[name] != nil; i++ {
+		name = "FlatAnnot" + strconv.Itoa(i)
+	}
+	xobjects[name] = ir
+
+	// Map the transformed bounding box onto Rect, as a viewer does.
+	sx := (rect[2] - rect[0]) / (box[2] - box[0])
+	sy := (rect[3] - rect[1]) / (box[3] - box[1])
+	fmt.Fprintf(overlay, "q %s 0 0 %s %s %s cm /%s Do Q\n",
+		pdfNumber(sx), pdfNumber(sy), pdfNumber(rect[0]-box[0]*sx), pdfNumber(rect[1]-box[1]*sy), name)
+	return true, nil
+}
+
+// ownResources returns the page's resource dictionary, giving the page
+// its own copy when the resources are inherited from the page tree.
+func ownResources(pdfCtx *model.Context, pageDict types.Dict, inh *model.InheritedPageAttrs) (types.Dict, error) {
+	if pageDict["Resources"] != nil {
+		return pdfCtx.DereferenceDict(pageDict["Resources"])
+	}
+	resources := types.Dict{}
+	if inh != nil && inh.Resources != nil {
+		resources = inh.Resources.Clone().(types.Dict)
+	}
+	pageDict["Resources"] = resources
+	return resources, nil
+}
+
+func transformRect(r [4]float64, m matrix) [4]float64 {
+	xs := []float64{r[0], r[2]}
+	ys := []float64{r[1], r[3]}
+	out := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, x := range xs {
+		for _, y := range ys {
+			tx := x*m[0] + y*m[2] + m[4]
+			ty := x*m[1] + y*m[3] + m[5]
+			out = [4]float64{math.Min(out[0], tx), math.Min(out[1], ty), math.Max(out[2], tx), math.Max(out[3], ty)}
+		}
+	}
+	return out
+}
+
+// appearance is the content and resources of an annotation's normal
+// appearance stream, drawn in page coordinates.
+type appearance struct {
+	content   []byte
+	resources types.Dict
+}
+
+func newFormXObject(pdfCtx *model.Context, bbox [4]float64, resources types.Dict, content []byte) (*types.IndirectRef, error) {
+	sd, err := pdfCtx.NewStreamDictForBuf(content)
+	if err != nil {
+		return nil, err
+	}
+	sd.InsertName("Type", "XObject")
+	sd.InsertName("Subtype", "Form")
+	sd.Insert("BBox", floatArray(bbox[:]))
+	if resources != nil {
+		sd.Insert("Resources", resources)
+	}
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return pdfCtx.IndRefForNewObject(*sd)
+}
+
+func markupAppearance(t AnnotationType, quads []float64, rgb [3]float64) appearance {
+	var b bytes.Buffer
+	var resources types.Dict
+	for i := 0; i+8 <= len(quads); i += 8 {
+		q := quads[i : i+8]
+		// Points are upper left, upper right, lower left, lower right.
+		height := math.Hypot(q[0]-q[4], q[1]-q[5])
+		switch t {
+		case AnnotationHighlight:
+			resources = types.Dict{"ExtGState": types.Dict{"GS0": types.Dict{"BM": types.Name("Multiply")}}}
+			fmt.Fprintf(&b, "/GS0 gs %s rg %s %s m %s %s l %s %s l %s %s l h f\n", colorOperands(rgb),
+				pdfNumber(q[0]), pdfNumber(q[1]), pdfNumber(q[2]), pdfNumber(q[3]),
+				pdfNumber(q[6]), pdfNumber(q[7]), pdfNumber(q[4]), pdfNumber(q[5]))
+		case AnnotationUnderline:
+			width := math.Max(1, height/14)
+			off := width / 2
+			fmt.Fprintf(&b, "%s RG %s w %s %s m %s %s l S\n", colorOperands(rgb), pdfNumber(width),
+				pdfNumber(q[4]), pdfNumber(q[5]+off), pdfNumber(q[6]), pdfNumber(q[7]+off))
+		case AnnotationStrikeOut:
+			width := math.Max(1, height/14)
+			fmt.Fprintf(&b, "%s RG %s w %s %s m %s %s l S\n", colorOperands(rgb), pdfNumber(width),
+				pdfNumber((q[0]+q[4])/2), pdfNumber((q[1]+q[5])/2), pdfNumber((q[2]+q[6])/2), pdfNumber((q[3]+q[7])/2))
+		}
+	}
+	return appearance{content: b.Bytes(), resources: resources}
+}
+
+func noteAppearance(r [4]float64, rgb [3]float64) appearance {
+	w, h := r[2]-r[0], r[3]-r[1]
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s rg 0 G 0.75 w %s %s %s %s re B\n", colorOperands(rgb),
+		pdfNumber(r[0]+0.5), pdfNumber(r[1]+0.5), pdfNumber(w-1), pdfNumber(h-1))
+	for i := 1; i <= 3; i++ {
+		y := r[3] - h*float64(i)/4.5
+		fmt.Fprintf(&b, "%s %s m %s %s l S\n", pdfNumber(r[0]+w*0.2), pdfNumber(y), pdfNumber(r[2]-w*0.2), pdfNumber(y))
+	}
+	return appearance{content: b.Bytes()}
+}
+
+func inkAppearance(strokes [][]float64, width float64, rgb [3]float64) appearance {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s RG %s w 1 J 1 j\n", colorOperands(rgb), pdfNumber(width))
+	for _, s := range strokes {
+		fmt.Fprintf(&b, "%s %s m", pdfNumber(s[0]), pdfNumber(s[1]))
+		if len(s) == 2 {
+			fmt.Fprintf(&b, " %s %s l", pdfNumber(s[0]), pdfNumber(s[1]))
+		}
+		for i := 2; i+1 < len(s); i += 2 {
+			fmt.Fprintf(&b, " %s %s l", pdfNumber(s[i]), pdfNumber(s[i+1]))
+		}
+		b.WriteString(" S\n")
+	}
+	return appearance{content: b.Bytes()}
+}
+
+var helveticaResources = types.Dict{"Font": types.Dict{"Helv": types.Dict{
+	"Type":     types.Name("Font"),
+	"Subtype":  types.Name("Type1"),
+	"BaseFont": types.Name("Helvetica"),
+	"Encoding": types.Name("WinAnsiEncoding"),
+}}}
+
+func freeTextAppearance(r [4]float64, text string, size, border float64, rgb [3]float64) appearance {
+	const padding = 2.0
+	measure := helveticaMeasure(size)
+	lines := wrapText(text, r[2]-r[0]-2*padding-border*2, measure)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s %s %s re W n\n", pdfNumber(r[0]), pdfNumber(r[1]), pdfNumber(r[2]-r[0]), pdfNumber(r[3]-r[1]))
+	if border > 0 {
+		fmt.Fprintf(&b, "%s RG %s w %s %s %s %s re S\n", colorOperands(rgb), pdfNumber(border),
+			pdfNumber(r[0]+border/2), pdfNumber(r[1]+border/2), pdfNumber(r[2]-r[0]-border), pdfNumber(r[3]-r[1]-border))
+	}
+	tr := gofpdf.New("P", "pt", "A4", "").UnicodeTranslatorFromDescriptor("")
+	fmt.Fprintf(&b, "BT /Helv %s Tf %s rg %s TL %s %s Td\n", pdfNumber(size), colorOperands(rgb), pdfNumber(size*1.2),
+		pdfNumber(r[0]+padding+border), pdfNumber(r[3]-padding-border-size))
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("T* ")
+		}
+		fmt.Fprintf(&b, "(%s) Tj\n", escapeLiteral(tr(line)))
+	}
+	b.WriteString("ET\n")
+	return appearance{content: b.Bytes(), resources: helveticaResources.Clone().(types.Dict)}
+}
+
+func stampAppearance(r [4]float64, label string, rgb [3]float64) appearance {
+	w, h := r[2]-r[0], r[3]-r[1]
+	border := math.Max(1.5, math.Min(w, h)/16)
+	size := math.Min(h*0.5, (w-4*border)/math.Max(helveticaMeasure(1)(label), 1))
+	textWidth := helveticaMeasure(size)(label)
+	tr := gofpdf.New("P", "pt", "A4", "").UnicodeTranslatorFromDescriptor("")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s RG %s rg %s w %s %s %s %s re S\n", colorOperands(rgb), colorOperands(rgb), pdfNumber(border),
+		pdfNumber(r[0]+border/2), pdfNumber(r[1]+border/2), pdfNumber(w-border), pdfNumber(h-border))
+	fmt.Fprintf(&b, "BT /Helv %s Tf %s %s Td (%s) Tj ET\n", pdfNumber(size),
+		pdfNumber(r[0]+(w-textWidth)/2), pdfNumber(r[1]+(h-size*0.7)/2), escapeLiteral(tr(label)))
+	return appearance{content: b.Bytes(), resources: helveticaResources.Clone().(types.Dict)}
+}
+
+// stampLabel turns a stamp name such as "NotApproved" into "NOT APPROVED".
+func stampLabel(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// helveticaMeasure returns the width in points of text set in Helvetica
+// at size.
+func helveticaMeasure(size float64) func(string) float64 {
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	pdf.SetFont("Helvetica", "", size)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	return func(s string) float64 {
+		return pdf.GetStringWidth(tr(s))
+	}
+}
+
+// wrapText breaks text into lines no wider than width, keeping explicit
+// line breaks.
+func wrapText(text string, width float64, measure func(string) float64) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && measure(candidate) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func quadBounds(quads []float64) [4]float64 {
+	r := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for i := 0; i+1 < len(quads); i += 2 {
+		r = [4]float64{math.Min(r[0], quads[i]), math.Min(r[1], quads[i+1]), math.Max(r[2], quads[i]), math.Max(r[3], quads[i+1])}
+	}
+	return r
+}
+
+func inkBounds(strokes [][]float64, width float64) [4]float64 {
+	var points []float64
+	for _, s := range strokes {
+		points = append(points, s...)
+	}
+	r := quadBounds(points)
+	return [4]float64{r[0] - width, r[1] - width, r[2] + width, r[3] + width}
+}
+
+func floatArray(values []float64) types.Array {
+	arr := make(types.Array, len(values))
+	for i, v := range values {
+		arr[i] = types.Float(v)
+	}
+	return arr
+}
+
+func colorOperands(rgb [3]float64) string {
+	return pdfNumber(rgb[0]) + " " + pdfNumber(rgb[1]) + " " + pdfNumber(rgb[2])
+}
+
+func pdfNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+// escapeLiteral escapes a string for use inside a PDF literal string.
+func escapeLiteral(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`).Replace(s)
+}
+
+// textString encodes s as a PDF text string, using UTF-16 only when s is
+// not plain ASCII.
+func textString(s string) types.StringLiteral {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			escaped, err := types.EscapedUTF16String(s)
+			if err == nil {
+				return types.StringLiteral(*escaped)
+			}
+			break
+		}
+	}
+	return types.StringLiteral(escapeLiteral(s))
+}
+
+func newAnnotationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "annot-" + hex.EncodeToString(b)
+}
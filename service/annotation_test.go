@@ -0,0 +1,175 @@
+package service_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func reviewAnnotations() []service.Annotation {
+	return []service.Annotation{
+		{Page: 1, Type: service.AnnotationHighlight, Rect: [4]float64{50, 700, 200, 715}, Author: "Ana", Contents: "Check this"},
+		{Page: 1, Type: service.AnnotationNote, Rect: [4]float64{300, 700, 0, 0}, Author: "Ben", Contents: "Typo?", Icon: "Note"},
+		{Page: 1, Type: service.AnnotationFreeText, Rect: [4]float64{50, 500, 250, 560}, Author: "Ana", Contents: "Reworded paragraph (draft)", FontSize: 10, Color: "#333333"},
+		{Page: 2, Type: service.AnnotationInk, InkList: [][]float64{{100, 100, 150, 120, 200, 100}}, Author: "Ben"},
+		{Page: 2, Type: service.AnnotationStamp, Rect: [4]float64{300, 600, 450, 650}, Icon: "NotApproved", Author: "Ana"},
+		{Page: 2, Type: service.AnnotationLink, Rect: [4]float64{50, 50, 150, 70}, DestPage: 1},
+		{Page: 2, Type: service.AnnotationLink, Rect: [4]float64{200, 50, 300, 70}, URI: "https://example.com/review?id=(1)"},
+	}
+}
+
+func TestAddAndListAnnotations(t *testing.T) {
+	annotations := service.NewAnnotationService(getTestLogger())
+
+	output, err := annotations.AddAnnotations(textPDF(t, "a", "b"), reviewAnnotations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := annotations.ListAnnotations(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 7 {
+		t.Fatalf("got %d annotations: %+v", len(got), got)
+	}
+
+	highlight, note, freeText, ink, stamp, link, uri := got[0], got[1], got[2], got[3], got[4], got[5], got[6]
+	if highlight.Type != service.AnnotationHighlight || highlight.Author != "Ana" || highlight.Contents != "Check this" ||
+		highlight.Color != "#ffff00" || len(highlight.QuadPoints) != 8 || highlight.ID == "" || highlight.Created.IsZero() {
+		t.Errorf("highlight = %+v", highlight)
+	}
+	if highlight.Rect != [4]float64{50, 700, 200, 715} {
+		t.Errorf("highlight rect = %v", highlight.Rect)
+	}
+	if note.Type != service.AnnotationNote || note.Icon != "Note" || note.Rect != [4]float64{300, 700, 320, 720} {
+		t.Errorf("note = %+v", note)
+	}
+	if freeText.FontSize != 10 || freeText.Contents != "Reworded paragraph (draft)" {
+		t.Errorf("free text = %+v", freeText)
+	}
+	if ink.Page != 2 || len(ink.InkList) != 1 || len(ink.InkList[0]) != 6 || ink.Width != 2 {
+		t.Errorf("ink = %+v", ink)
+	}
+	if stamp.Icon != "NotApproved" || stamp.Author != "Ana" {
+		t.Errorf("stamp = %+v", stamp)
+	}
+	if link.DestPage != 1 || uri.URI != "https://example.com/review?id=(1)" {
+		t.Errorf("links = %+v, %+v", link, uri)
+	}
+}
+
+func TestAddAnnotationsValidates(t *testing.T) {
+	annotations := service.NewAnnotationService(getTestLogger())
+	input := textPDF(t, "a")
+
+	for name, a := range map[string]service.Annotation{
+		"page":  {Page: 3, Type: service.AnnotationNote},
+		"type":  {Page: 1, Type: "Sound"},
+		"color": {Page: 1, Type: service.AnnotationNote, Color: "yellow"},
+		"quads": {Page: 1, Type: service.AnnotationUnderline, QuadPoints: []float64{1, 2, 3}},
+		"ink":   {Page: 1, Type: service.AnnotationInk},
+		"link":  {Page: 1, Type: service.AnnotationLink, Rect: [4]float64{0, 0, 10, 10}},
+	} {
+		if _, err := annotations.AddAnnotations(input, []service.Annotation{a}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRemoveAnnotations(t *testing.T) {
+	annotations := service.NewAnnotationService(getTestLogger())
+	input, err := annotations.AddAnnotations(textPDF(t, "a", "b"), reviewAnnotations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := annotations.RemoveAnnotations(input, &service.AnnotationFilter{Authors: []string{"Ana"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := annotations.ListAnnotations(output); len(got) != 4 {
+		t.Errorf("after removing Ana's: %+v", got)
+	}
+
+	output, err = annotations.RemoveAnnotations(input, &service.AnnotationFilter{Pages: "2", Types: []service.AnnotationType{service.AnnotationLink}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := annotations.ListAnnotations(output); len(got) != 5 {
+		t.Errorf("after removing page 2 links: %+v", got)
+	}
+
+	output, err = annotations.RemoveAnnotations(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := annotations.ListAnnotations(output); len(got) != 0 {
+		t.Errorf("after removing all: %+v", got)
+	}
+}
+
+func TestFlattenAnnotations(t *testing.T) {
+	annotations := service.NewAnnotationService(getTestLogger())
+	input, err := annotations.AddAnnotations(textPDF(t, "a", "b"), reviewAnnotations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := annotations.FlattenAnnotations(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := annotations.ListAnnotations(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range got {
+		if a.Type != service.AnnotationLink {
+			t.Errorf("%s annotation was not flattened", a.Type)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("links = %+v", got)
+	}
+
+	pdfCtx, err := api.ReadAndValidate(bytes.NewReader(output), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := 1; p <= 2; p++ {
+		d, _, _, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := pdfCtx.PageContent(d, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(content, []byte("/FlatAnnot1 Do")) {
+			t.Errorf("page %d content does not draw the flattened annotations", p)
+		}
+	}
+}
+
+func TestAnnotationsStep(t *testing.T) {
+	svc := service.NewWithGotenberg("http://localhost:3000")
+
+	if err := (&service.AnnotationsStep{}).Validate(); err == nil {
+		t.Error("expected error without add, remove or flatten")
+	}
+
+	step := &service.AnnotationsStep{
+		Add:     []service.Annotation{{Page: 1, Type: service.AnnotationStamp, Rect: [4]float64{100, 100, 250, 150}, Icon: "Approved"}},
+		Flatten: true,
+	}
+	docs, err := step.Run(t.Context(), svc, []service.Document{{Name: "a.pdf", Data: textPDF(t, "a")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := svc.Annotations().ListAnnotations(docs[0].Data); err != nil || len(got) != 0 {
+		t.Errorf("annotations = %+v, %v", got, err)
+	}
+}
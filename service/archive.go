@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/gotenberg"
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
 )
@@ -29,6 +31,13 @@ func NewArchiveService(log logger.ILogger, gotClient gotenberg.Client) ArchiveSe
 }
 
 func (s *archiveService) ConvertToPDFA(input []byte, format string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "ArchiveService.ConvertToPDFA", AttrInputBytes.Int(len(input)), attribute.String("pdf.pdfa_format", format))
+	output, err := s.convertToPDFA(ctx, input, format)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *archiveService) convertToPDFA(ctx context.Context, input []byte, format string) ([]byte, error) {
 	s.log.Info("ArchiveService.ConvertToPDFA called", logger.String("format", format))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-archive-*")
@@ -38,11 +47,11 @@ func (s *archiveService) ConvertToPDFA(input []byte, format string) ([]byte, err
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
-	output, err := s.gotClient.ConvertToPDFA(context.Background(), inputPath, format)
+	output, err := s.gotClient.ConvertToPDFA(ctx, inputPath, format)
 	if err != nil {
 		s.log.Error("PDF/A conversion failed", logger.Error(err))
 		return nil, err
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
 )
@@ -26,6 +28,13 @@ func NewAttachmentService(log logger.ILogger) AttachmentService {
 }
 
 func (s *attachmentService) AddAttachments(input []byte, files map[string][]byte) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "AttachmentService.AddAttachments", AttrInputBytes.Int(len(input)), attribute.Int("pdf.attachment_count", len(files)))
+	output, err := s.addAttachments(ctx, input, files)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *attachmentService) addAttachments(ctx context.Context, input []byte, files map[string][]byte) ([]byte, error) {
 	s.log.Info("AttachmentService.AddAttachments called", logger.Int("count", len(files)))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-attach-*")
@@ -35,7 +44,7 @@ func (s *attachmentService) AddAttachments(input []byte, files map[string][]byte
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
@@ -44,7 +53,7 @@ func (s *attachmentService) AddAttachments(input []byte, files map[string][]byte
 		// Security fix: sanitize filename
 		safeName := filepath.Base(name)
 		filePath := filepath.Join(tmpDir, safeName)
-		if err := os.WriteFile(filePath, content, 0644); err != nil {
+		if err := writeFile(ctx, filePath, content); err != nil {
 			return nil, err
 		}
 		fileNames = append(fileNames, filePath)
@@ -53,11 +62,13 @@ func (s *attachmentService) AddAttachments(input []byte, files map[string][]byte
 	outputPath := filepath.Join(tmpDir, "output.pdf")
 	conf := model.NewDefaultConfiguration()
 
-	if err := api.AddAttachmentsFile(inputPath, outputPath, fileNames, true, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.AddAttachmentsFile", func() error {
+		return api.AddAttachmentsFile(inputPath, outputPath, fileNames, true, conf)
+	}); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +86,13 @@ func (s *attachmentService) ListAttachments(input []byte) ([]string, error) {
 }
 
 func (s *attachmentService) ExtractAttachments(input []byte) (map[string][]byte, error) {
+	ctx, span := startSpan(context.Background(), "AttachmentService.ExtractAttachments", AttrInputBytes.Int(len(input)))
+	results, err := s.extractAttachments(ctx, input)
+	endSpan(span, err, attribute.Int("pdf.attachment_count", len(results)))
+	return results, err
+}
+
+func (s *attachmentService) extractAttachments(ctx context.Context, input []byte) (map[string][]byte, error) {
 	s.log.Info("AttachmentService.ExtractAttachments called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-extract-attach-*")
@@ -84,7 +102,7 @@ func (s *attachmentService) ExtractAttachments(input []byte) (map[string][]byte,
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
@@ -93,7 +111,9 @@ func (s *attachmentService) ExtractAttachments(input []byte) (map[string][]byte,
 		return nil, err
 	}
 
-	if err := api.ExtractAttachmentsFile(inputPath, outDir, nil, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.ExtractAttachmentsFile", func() error {
+		return api.ExtractAttachmentsFile(inputPath, outDir, nil, nil)
+	}); err != nil {
 		return nil, err
 	}
 
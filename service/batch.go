@@ -2,270 +2,408 @@ package service
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"time"
 )
 
-type BatchResult struct {
-	Index int
-	Data  []byte
-	Error error
-}
+// ErrBatchAborted is reported for items that never ran because a FailFast
+// batch stopped after an earlier failure.
+var ErrBatchAborted = errors.New("batch aborted after an earlier failure")
 
-type BatchProcessor struct {
-	pdfService PDFService
-	maxWorkers int
+type BatchPolicy int
+
+const (
+	// ContinueOnError processes every item and reports failures individually.
+	ContinueOnError BatchPolicy = iota
+	// FailFast stops taking new items after the first failure.
+	FailFast
+)
+
+type BatchOptions struct {
+	Workers int
+	Policy  BatchPolicy
+	// ItemTimeout bounds each attempt at an item; 0 means no timeout.
+	// The item is reported as soon as it times out, but an operation that
+	// ignores its context keeps one of the Workers busy until it returns,
+	// and is not retried before then.
+	ItemTimeout time.Duration
+	// Retries is how many times a failed item is retried, waiting
+	// RetryDelay before the first retry and doubling it after each.
+	Retries    int
+	RetryDelay time.Duration
+	// RetryIf limits retries to matching errors; nil retries any error
+	// except cancellation of the batch itself.
+	RetryIf func(error) bool
+	// Progress is called after every item, one call at a time.
+	Progress func(BatchProgress)
 }
 
-func NewBatchProcessor(pdfService PDFService, maxWorkers int) *BatchProcessor {
-	if maxWorkers <= 0 {
-		maxWorkers = 5
-	}
-	return &BatchProcessor{
-		pdfService: pdfService,
-		maxWorkers: maxWorkers,
+func DefaultBatchOptions() *BatchOptions {
+	return &BatchOptions{
+		Workers:    5,
+		Policy:     ContinueOnError,
+		RetryDelay: 100 * time.Millisecond,
 	}
 }
 
-func (bp *BatchProcessor) CompressBatch(ctx context.Context, inputs [][]byte) []BatchResult {
-	results := make([]BatchResult, len(inputs))
-	semaphore := make(chan struct{}, bp.maxWorkers)
-	var wg sync.WaitGroup
+// BatchProgress is a running count of finished items. Total is 0 when the
+// input is a stream of unknown length.
+type BatchProgress struct {
+	Total     int
+	Completed int
+	Succeeded int
+	Failed    int
+	Elapsed   time.Duration
+	Last      int
+}
 
-	for i, input := range inputs {
-		wg.Add(1)
-		go func(index int, data []byte) {
-			defer wg.Done()
+// BatchItem is the outcome for one input, sent as soon as it completes.
+type BatchItem[In, Out any] struct {
+	Index    int
+	Input    In
+	Value    Out
+	Err      error
+	Attempts int
+	Duration time.Duration
+}
 
-			select {
-			case <-ctx.Done():
-				results[index] = BatchResult{Index: index, Error: ctx.Err()}
-				return
-			case semaphore <- struct{}{}:
-				defer func() { <-semaphore }()
-			}
+// BatchFunc is an operation applied to each input.
+type BatchFunc[In, Out any] func(ctx context.Context, input In) (Out, error)
 
-			output, err := bp.pdfService.Compress().CompressBytes(data)
-			results[index] = BatchResult{
-				Index: index,
-				Data:  output,
-				Error: err,
-			}
-		}(i, input)
+// BytesFunc adapts a service method such as CompressBytes to a BatchFunc.
+func BytesFunc(fn func([]byte) ([]byte, error)) BatchFunc[[]byte, []byte] {
+	return func(ctx context.Context, input []byte) ([]byte, error) {
+		return fn(input)
 	}
+}
 
-	wg.Wait()
-	return results
+// Batch runs an operation over many inputs on a fixed number of workers.
+// Results are streamed as they complete, so neither inputs nor outputs
+// need to be held in memory all at once.
+type Batch[In, Out any] struct {
+	op   BatchFunc[In, Out]
+	opts BatchOptions
 }
 
-func (bp *BatchProcessor) MergeBatch(ctx context.Context, inputSets [][][]byte) []BatchResult {
-	results := make([]BatchResult, len(inputSets))
-	semaphore := make(chan struct{}, bp.maxWorkers)
-	var wg sync.WaitGroup
+func NewBatch[In, Out any](op BatchFunc[In, Out], opts *BatchOptions) *Batch[In, Out] {
+	o := *DefaultBatchOptions()
+	if opts != nil {
+		o = *opts
+	}
+	if o.Workers <= 0 {
+		o.Workers = 5
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	}
+	return &Batch[In, Out]{op: op, opts: o}
+}
 
-	for i, inputs := range inputSets {
-		wg.Add(1)
-		go func(index int, data [][]byte) {
-			defer wg.Done()
+// NewPipelineBatch runs a Pipeline once per input document.
+func NewPipelineBatch(p *Pipeline, opts *BatchOptions) *Batch[Document, *PipelineResult] {
+	return NewBatch(func(ctx context.Context, doc Document) (*PipelineResult, error) {
+		return p.Run(ctx, doc)
+	}, opts)
+}
+
+// Stream processes inputs until the channel is closed, ctx is done, or a
+// FailFast batch sees an error. The returned channel is closed once all
+// workers have finished and must be drained by the caller.
+func (b *Batch[In, Out]) Stream(ctx context.Context, inputs <-chan In) <-chan BatchItem[In, Out] {
+	return b.stream(ctx, inputs, 0)
+}
 
+// Run processes a slice of inputs, streaming results as they complete.
+func (b *Batch[In, Out]) Run(ctx context.Context, inputs []In) <-chan BatchItem[In, Out] {
+	feed := make(chan In)
+	go func() {
+		defer close(feed)
+		for _, input := range inputs {
 			select {
+			case feed <- input:
 			case <-ctx.Done():
-				results[index] = BatchResult{Index: index, Error: ctx.Err()}
 				return
-			case semaphore <- struct{}{}:
-				defer func() { <-semaphore }()
 			}
+		}
+	}()
+	return b.stream(ctx, feed, len(inputs))
+}
 
-			output, err := bp.pdfService.Merge().MergeBytes(data)
-			results[index] = BatchResult{
-				Index: index,
-				Data:  output,
-				Error: err,
-			}
-		}(i, inputs)
+// Collect runs the batch and returns one item per input in input order.
+// Items that never ran carry ctx.Err() or ErrBatchAborted.
+func (b *Batch[In, Out]) Collect(ctx context.Context, inputs []In) []BatchItem[In, Out] {
+	items := make([]BatchItem[In, Out], len(inputs))
+	done := make([]bool, len(inputs))
+	for item := range b.Run(ctx, inputs) {
+		items[item.Index] = item
+		done[item.Index] = true
 	}
 
-	wg.Wait()
-	return results
+	for i := range items {
+		if done[i] {
+			continue
+		}
+		err := ctx.Err()
+		if err == nil {
+			err = ErrBatchAborted
+		}
+		items[i] = BatchItem[In, Out]{Index: i, Input: inputs[i], Err: err}
+	}
+	return items
 }
 
-func (bp *BatchProcessor) RotateBatch(ctx context.Context, inputs [][]byte, angle int, pages string) []BatchResult {
-	results := make([]BatchResult, len(inputs))
-	semaphore := make(chan struct{}, bp.maxWorkers)
-	var wg sync.WaitGroup
+type batchJob[In any] struct {
+	index int
+	input In
+}
 
-	for i, input := range inputs {
-		wg.Add(1)
-		go func(index int, data []byte) {
-			defer wg.Done()
+func (b *Batch[In, Out]) stream(parent context.Context, inputs <-chan In, total int) <-chan BatchItem[In, Out] {
+	ctx, cancel := context.WithCancel(parent)
+	out := make(chan BatchItem[In, Out], b.opts.Workers)
+	jobs := make(chan batchJob[In])
+	progress := &batchProgress{total: total, start: time.Now(), fn: b.opts.Progress}
+	// busy holds one token per running call of op, including calls that
+	// timed out but have not returned, so they never outnumber Workers.
+	busy := make(chan struct{}, b.opts.Workers)
+
+	go func() {
+		defer close(jobs)
+		for index := 0; ; index++ {
+			var input In
+			var ok bool
+			select {
+			case input, ok = <-inputs:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
 
 			select {
+			case jobs <- batchJob[In]{index: index, input: input}:
 			case <-ctx.Done():
-				results[index] = BatchResult{Index: index, Error: ctx.Err()}
 				return
-			case semaphore <- struct{}{}:
-				defer func() { <-semaphore }()
 			}
+		}
+	}()
 
-			output, err := bp.pdfService.Rotate().RotateBytes(data, angle, pages)
-			results[index] = BatchResult{
-				Index: index,
-				Data:  output,
-				Error: err,
+	var wg sync.WaitGroup
+	for w := 0; w < b.opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				item := b.process(ctx, job, busy)
+				if item.Err != nil && b.opts.Policy == FailFast {
+					cancel()
+				}
+				progress.record(item.Index, item.Err)
+				out <- item
 			}
-		}(i, input)
+		}()
 	}
 
-	wg.Wait()
-	return results
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+
+	return out
 }
 
-func (bp *BatchProcessor) WatermarkBatch(ctx context.Context, inputs [][]byte, text string, opts *WatermarkOptions) []BatchResult {
-	results := make([]BatchResult, len(inputs))
-	semaphore := make(chan struct{}, bp.maxWorkers)
-	var wg sync.WaitGroup
+func (b *Batch[In, Out]) process(ctx context.Context, job batchJob[In], busy chan struct{}) BatchItem[In, Out] {
+	item := BatchItem[In, Out]{Index: job.index, Input: job.input}
+	start := time.Now()
+	delay := b.opts.RetryDelay
+
+	for {
+		item.Attempts++
+		var running <-chan struct{}
+		item.Value, running, item.Err = b.attempt(ctx, job.input, busy)
+		if item.Err == nil || item.Attempts > b.opts.Retries || ctx.Err() != nil {
+			break
+		}
+		if b.opts.RetryIf != nil && !b.opts.RetryIf(item.Err) {
+			break
+		}
 
-	for i, input := range inputs {
-		wg.Add(1)
-		go func(index int, data []byte) {
-			defer wg.Done()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			item.Duration = time.Since(start)
+			return item
+		case <-timer.C:
+		}
+		// Never run two attempts at the same item at once.
+		select {
+		case <-ctx.Done():
+			item.Duration = time.Since(start)
+			return item
+		case <-running:
+		}
+		delay *= 2
+	}
 
-			select {
-			case <-ctx.Done():
-				results[index] = BatchResult{Index: index, Error: ctx.Err()}
-				return
-			case semaphore <- struct{}{}:
-				defer func() { <-semaphore }()
-			}
+	item.Duration = time.Since(start)
+	return item
+}
 
-			output, err := bp.pdfService.Watermark().AddWatermarkBytes(data, text, opts)
-			results[index] = BatchResult{
-				Index: index,
-				Data:  output,
-				Error: err,
-			}
-		}(i, input)
+// attempt runs op once while holding a busy token. The returned channel is
+// closed once op has returned, which is later than attempt itself when the
+// attempt timed out.
+func (b *Batch[In, Out]) attempt(ctx context.Context, input In, busy chan struct{}) (Out, <-chan struct{}, error) {
+	var zero Out
+	running := make(chan struct{})
+	select {
+	case busy <- struct{}{}:
+	case <-ctx.Done():
+		close(running)
+		return zero, running, ctx.Err()
 	}
 
-	wg.Wait()
-	return results
-}
+	if b.opts.ItemTimeout <= 0 {
+		defer close(running)
+		defer func() { <-busy }()
+		value, err := b.op(ctx, input)
+		return value, running, err
+	}
 
-func (bp *BatchProcessor) ProtectBatch(ctx context.Context, inputs [][]byte, password string) []BatchResult {
-	results := make([]BatchResult, len(inputs))
-	semaphore := make(chan struct{}, bp.maxWorkers)
-	var wg sync.WaitGroup
+	ctx, cancel := context.WithTimeout(ctx, b.opts.ItemTimeout)
+	defer cancel()
 
-	for i, input := range inputs {
-		wg.Add(1)
-		go func(index int, data []byte) {
-			defer wg.Done()
+	type result struct {
+		value Out
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer close(running)
+		defer func() { <-busy }()
+		value, err := b.op(ctx, input)
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, running, r.err
+	case <-ctx.Done():
+		return zero, running, ctx.Err()
+	}
+}
 
-			select {
-			case <-ctx.Done():
-				results[index] = BatchResult{Index: index, Error: ctx.Err()}
-				return
-			case semaphore <- struct{}{}:
-				defer func() { <-semaphore }()
-			}
+type batchProgress struct {
+	mu    sync.Mutex
+	total int
+	start time.Time
+	fn    func(BatchProgress)
+	state BatchProgress
+}
 
-			output, err := bp.pdfService.Protect().ProtectBytes(data, password)
-			results[index] = BatchResult{
-				Index: index,
-				Data:  output,
-				Error: err,
-			}
-		}(i, input)
+func (p *batchProgress) record(index int, err error) {
+	if p.fn == nil {
+		return
 	}
 
-	wg.Wait()
-	return results
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Total = p.total
+	p.state.Completed++
+	if err != nil {
+		p.state.Failed++
+	} else {
+		p.state.Succeeded++
+	}
+	p.state.Elapsed = time.Since(p.start)
+	p.state.Last = index
+	p.fn(p.state)
 }
 
-type Pipeline struct {
-	pdfService PDFService
-	operations []PipelineOp
+type BatchResult struct {
+	Index int
+	Data  []byte
+	Error error
 }
 
-type PipelineOp struct {
-	Type   string
-	Params map[string]interface{}
+// BatchProcessor keeps the fixed-operation helpers; each is a thin wrapper
+// around Batch.
+type BatchProcessor struct {
+	pdfService PDFService
+	maxWorkers int
 }
 
-func NewPipeline(pdfService PDFService) *Pipeline {
-	return &Pipeline{
+func NewBatchProcessor(pdfService PDFService, maxWorkers int) *BatchProcessor {
+	if maxWorkers <= 0 {
+		maxWorkers = 5
+	}
+	return &BatchProcessor{
 		pdfService: pdfService,
-		operations: make([]PipelineOp, 0),
+		maxWorkers: maxWorkers,
 	}
 }
 
-func (p *Pipeline) Compress() *Pipeline {
-	p.operations = append(p.operations, PipelineOp{Type: "compress"})
-	return p
+// Pipeline returns a Batch that runs p on each document with this
+// processor's worker count.
+func (bp *BatchProcessor) Pipeline(p *Pipeline, opts *BatchOptions) *Batch[Document, *PipelineResult] {
+	return NewPipelineBatch(p, bp.options(opts))
 }
 
-func (p *Pipeline) Rotate(angle int, pages string) *Pipeline {
-	p.operations = append(p.operations, PipelineOp{
-		Type: "rotate",
-		Params: map[string]interface{}{
-			"angle": angle,
-			"pages": pages,
-		},
-	})
-	return p
+func (bp *BatchProcessor) options(opts *BatchOptions) *BatchOptions {
+	o := *DefaultBatchOptions()
+	o.Workers = bp.maxWorkers
+	if opts != nil {
+		o = *opts
+	}
+	if o.Workers <= 0 {
+		o.Workers = bp.maxWorkers
+	}
+	return &o
 }
 
-func (p *Pipeline) Watermark(text string, opts *WatermarkOptions) *Pipeline {
-	p.operations = append(p.operations, PipelineOp{
-		Type: "watermark",
-		Params: map[string]interface{}{
-			"text": text,
-			"opts": opts,
-		},
-	})
-	return p
+func collectResults[In any](ctx context.Context, batch *Batch[In, []byte], inputs []In) []BatchResult {
+	items := batch.Collect(ctx, inputs)
+	results := make([]BatchResult, len(items))
+	for i, item := range items {
+		results[i] = BatchResult{Index: item.Index, Data: item.Value, Error: item.Err}
+	}
+	return results
 }
 
-func (p *Pipeline) Protect(password string) *Pipeline {
-	p.operations = append(p.operations, PipelineOp{
-		Type: "protect",
-		Params: map[string]interface{}{
-			"password": password,
-		},
-	})
-	return p
+func (bp *BatchProcessor) bytesBatch(ctx context.Context, inputs [][]byte, fn func([]byte) ([]byte, error)) []BatchResult {
+	return collectResults(ctx, NewBatch(BytesFunc(fn), bp.options(nil)), inputs)
 }
 
-func (p *Pipeline) Execute(input []byte) ([]byte, error) {
-	result := input
-
-	for _, op := range p.operations {
-		var err error
-
-		switch op.Type {
-		case "compress":
-			result, err = p.pdfService.Compress().CompressBytes(result)
-		case "rotate":
-			angle := op.Params["angle"].(int)
-			pages := op.Params["pages"].(string)
-			result, err = p.pdfService.Rotate().RotateBytes(result, angle, pages)
-		case "watermark":
-			text := op.Params["text"].(string)
-			opts, _ := op.Params["opts"].(*WatermarkOptions)
-			result, err = p.pdfService.Watermark().AddWatermarkBytes(result, text, opts)
-		case "protect":
-			password := op.Params["password"].(string)
-			result, err = p.pdfService.Protect().ProtectBytes(result, password)
-		}
+func (bp *BatchProcessor) CompressBatch(ctx context.Context, inputs [][]byte) []BatchResult {
+	return bp.bytesBatch(ctx, inputs, bp.pdfService.Compress().CompressBytes)
+}
 
-		if err != nil {
-			return nil, err
-		}
+func (bp *BatchProcessor) MergeBatch(ctx context.Context, inputSets [][][]byte) []BatchResult {
+	merge := func(ctx context.Context, inputs [][]byte) ([]byte, error) {
+		return bp.pdfService.Merge().MergeBytes(inputs)
 	}
+	return collectResults(ctx, NewBatch(merge, bp.options(nil)), inputSets)
+}
 
-	return result, nil
+func (bp *BatchProcessor) RotateBatch(ctx context.Context, inputs [][]byte, angle int, pages string) []BatchResult {
+	return bp.bytesBatch(ctx, inputs, func(data []byte) ([]byte, error) {
+		return bp.pdfService.Rotate().RotateBytes(data, angle, pages)
+	})
+}
+
+func (bp *BatchProcessor) WatermarkBatch(ctx context.Context, inputs [][]byte, text string, opts *WatermarkOptions) []BatchResult {
+	return bp.bytesBatch(ctx, inputs, func(data []byte) ([]byte, error) {
+		return bp.pdfService.Watermark().AddWatermarkBytes(data, text, opts)
+	})
 }
 
-func (p *Pipeline) Reset() *Pipeline {
-	p.operations = make([]PipelineOp, 0)
-	return p
+func (bp *BatchProcessor) ProtectBatch(ctx context.Context, inputs [][]byte, password string) []BatchResult {
+	return bp.bytesBatch(ctx, inputs, func(data []byte) ([]byte, error) {
+		return bp.pdfService.Protect().ProtectBytes(data, password)
+	})
 }
@@ -0,0 +1,516 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultOutputTemplate = "{dir}/{name}{ext}"
+
+type FileStatus string
+
+const (
+	FileStatusPending FileStatus = "pending"
+	FileStatusDone    FileStatus = "done"
+	FileStatusFailed  FileStatus = "failed"
+	// FileStatusSkipped marks files whose output was already up to date.
+	FileStatusSkipped FileStatus = "skipped"
+)
+
+type FileBatchOptions struct {
+	// Inputs are files, directories or glob patterns. Directories are walked
+	// recursively; the tree below each directory or below the fixed prefix
+	// of each glob is recreated under OutputDir.
+	Inputs    []string
+	OutputDir string
+	// Template names each output relative to OutputDir. {dir} is the input's
+	// directory relative to its root, {name} its base name without extension
+	// and {ext} its extension. Defaults to DefaultOutputTemplate.
+	Template string
+	// Extensions filters files found by walking directories. Defaults to .pdf.
+	Extensions []string
+	// Manifest is where per-file status is recorded and resumed from.
+	// Defaults to manifest.json in OutputDir.
+	Manifest string
+	// Force reprocesses files even when their output is up to date.
+	Force bool
+	// SaveInterval throttles manifest writes while the batch runs.
+	SaveInterval time.Duration
+	Batch        *BatchOptions
+}
+
+// FileFunc writes the result for inputPath to outputPath.
+type FileFunc func(ctx context.Context, inputPath, outputPath string) error
+
+type ManifestEntry struct {
+	Input        string        `json:"input"`
+	Output       string        `json:"output"`
+	Status       FileStatus    `json:"status"`
+	InputSize    int64         `json:"input_size"`
+	InputModTime time.Time     `json:"input_mod_time"`
+	OutputSize   int64         `json:"output_size,omitempty"`
+	Attempts     int           `json:"attempts,omitempty"`
+	Duration     time.Duration `json:"duration_ns,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+type BatchManifest struct {
+	StartedAt  time.Time        `json:"started_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	Entries    []*ManifestEntry `json:"entries"`
+}
+
+type ManifestSummary struct {
+	Total   int
+	Done    int
+	Failed  int
+	Skipped int
+	Pending int
+}
+
+func (m *BatchManifest) Summary() ManifestSummary {
+	s := ManifestSummary{Total: len(m.Entries)}
+	for _, e := range m.Entries {
+		switch e.Status {
+		case FileStatusDone:
+			s.Done++
+		case FileStatusFailed:
+			s.Failed++
+		case FileStatusSkipped:
+			s.Skipped++
+		default:
+			s.Pending++
+		}
+	}
+	return s
+}
+
+// Failed returns the entries that failed in the last run.
+func (m *BatchManifest) Failed() []*ManifestEntry {
+	var failed []*ManifestEntry
+	for _, e := range m.Entries {
+		if e.Status == FileStatusFailed {
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+func LoadBatchManifest(path string) (*BatchManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m BatchManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid batch manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest atomically so an interrupted run leaves either
+// the previous or the new version on disk.
+func (m *BatchManifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Files runs fn for every input file and records the outcome in a manifest.
+// Outputs that are newer than their input, or recorded as done in an
+// existing manifest for an unchanged input, are skipped. Per-file failures
+// are reported in the manifest; the error is for problems with the batch
+// as a whole.
+func (bp *BatchProcessor) Files(ctx context.Context, opts *FileBatchOptions, fn FileFunc) (*BatchManifest, error) {
+	plan, err := planFileBatch(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BatchManifest{StartedAt: time.Now(), Entries: plan.entries}
+	if previous, err := LoadBatchManifest(plan.manifestPath); err == nil {
+		plan.resume(previous)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var pending []*ManifestEntry
+	for _, e := range manifest.Entries {
+		if e.Status == FileStatusPending {
+			pending = append(pending, e)
+		}
+	}
+
+	if err := os.MkdirAll(plan.outputDir, 0755); err != nil {
+		return nil, err
+	}
+	saver := &manifestSaver{manifest: manifest, path: plan.manifestPath, interval: plan.saveInterval}
+	if err := saver.save(); err != nil {
+		return nil, err
+	}
+
+	op := func(ctx context.Context, e *ManifestEntry) (int64, error) {
+		return writeFileOutput(ctx, e.Input, e.Output, fn)
+	}
+	for item := range NewBatch(op, bp.options(opts.Batch)).Run(ctx, pending) {
+		e := item.Input
+		e.Attempts = item.Attempts
+		e.Duration = item.Duration
+		if item.Err != nil {
+			e.Status = FileStatusFailed
+			e.Error = item.Err.Error()
+		} else {
+			e.Status = FileStatusDone
+			e.OutputSize = item.Value
+			e.Error = ""
+		}
+		if err := saver.maybeSave(); err != nil {
+			return manifest, err
+		}
+	}
+
+	if ctx.Err() == nil {
+		finished := time.Now()
+		manifest.FinishedAt = &finished
+	}
+	if err := saver.save(); err != nil {
+		return manifest, err
+	}
+	return manifest, ctx.Err()
+}
+
+func (bp *BatchProcessor) CompressFiles(ctx context.Context, opts *FileBatchOptions) (*BatchManifest, error) {
+	return bp.Files(ctx, opts, func(ctx context.Context, in, out string) error {
+		return bp.pdfService.Compress().CompressFile(in, out)
+	})
+}
+
+func (bp *BatchProcessor) RotateFiles(ctx context.Context, opts *FileBatchOptions, angle int, pages string) (*BatchManifest, error) {
+	return bp.Files(ctx, opts, func(ctx context.Context, in, out string) error {
+		return bp.pdfService.Rotate().RotateFile(in, out, angle, pages)
+	})
+}
+
+func (bp *BatchProcessor) WatermarkFiles(ctx context.Context, opts *FileBatchOptions, text string, wmOpts *WatermarkOptions) (*BatchManifest, error) {
+	return bp.Files(ctx, opts, func(ctx context.Context, in, out string) error {
+		return bp.pdfService.Watermark().AddWatermarkFile(in, out, text, wmOpts)
+	})
+}
+
+func (bp *BatchProcessor) ProtectFiles(ctx context.Context, opts *FileBatchOptions, password string) (*BatchManifest, error) {
+	return bp.Files(ctx, opts, func(ctx context.Context, in, out string) error {
+		return bp.pdfService.Protect().ProtectFile(in, out, password)
+	})
+}
+
+// PipelineFiles runs p on every input file. The pipeline must produce
+// exactly one document per input.
+func (bp *BatchProcessor) PipelineFiles(ctx context.Context, opts *FileBatchOptions, p *Pipeline) (*BatchManifest, error) {
+	return bp.Files(ctx, opts, func(ctx context.Context, in, out string) error {
+		data, err := os.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		result, err := p.Run(ctx, Document{Name: filepath.Base(in), Data: data})
+		if err != nil {
+			return err
+		}
+		if len(result.Documents) != 1 {
+			return fmt.Errorf("pipeline produced %d documents, expected 1", len(result.Documents))
+		}
+		return os.WriteFile(out, result.Documents[0].Data, 0644)
+	})
+}
+
+// writeFileOutput runs fn against a hidden partial file next to outputPath
+// and renames it into place, so an interrupted run never leaves an output
+// that looks complete.
+func writeFileOutput(ctx context.Context, inputPath, outputPath string, fn FileFunc) (int64, error) {
+	dir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	partial := filepath.Join(dir, "."+filepath.Base(outputPath)+".partial"+filepath.Ext(outputPath))
+	defer os.Remove(partial)
+
+	if err := fn(ctx, inputPath, partial); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(partial)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partial, outputPath); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+type fileBatchPlan struct {
+	entries      []*ManifestEntry
+	outputDir    string
+	manifestPath string
+	saveInterval time.Duration
+	force        bool
+}
+
+func planFileBatch(opts *FileBatchOptions) (*fileBatchPlan, error) {
+	if opts == nil || len(opts.Inputs) == 0 {
+		return nil, errors.New("no inputs")
+	}
+	if opts.OutputDir == "" {
+		return nil, errors.New("output directory is required")
+	}
+
+	plan := &fileBatchPlan{
+		outputDir:    filepath.Clean(opts.OutputDir),
+		manifestPath: opts.Manifest,
+		saveInterval: opts.SaveInterval,
+		force:        opts.Force,
+	}
+	if plan.manifestPath == "" {
+		plan.manifestPath = filepath.Join(plan.outputDir, "manifest.json")
+	}
+	if plan.saveInterval <= 0 {
+		plan.saveInterval = 2 * time.Second
+	}
+	template := opts.Template
+	if template == "" {
+		template = DefaultOutputTemplate
+	}
+	extensions := opts.Extensions
+	if len(extensions) == 0 {
+		extensions = []string{".pdf"}
+	}
+
+	files, err := findInputFiles(opts.Inputs, extensions, plan.outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no input files matched")
+	}
+
+	outputs := make(map[string]string, len(files))
+	for _, f := range files {
+		output := filepath.Join(plan.outputDir, expandOutputTemplate(template, f.rel))
+		if filepath.Clean(f.path) == output {
+			return nil, fmt.Errorf("output for %s would overwrite the input", f.path)
+		}
+		if other, ok := outputs[output]; ok {
+			return nil, fmt.Errorf("%s and %s both map to %s", other, f.path, output)
+		}
+		outputs[output] = f.path
+
+		plan.entries = append(plan.entries, &ManifestEntry{
+			Input:        f.path,
+			Output:       output,
+			Status:       FileStatusPending,
+			InputSize:    f.info.Size(),
+			InputModTime: f.info.ModTime(),
+		})
+	}
+
+	if !plan.force {
+		for _, e := range plan.entries {
+			if out, err := os.Stat(e.Output); err == nil && !out.ModTime().Before(e.InputModTime) {
+				e.Status = FileStatusSkipped
+				e.OutputSize = out.Size()
+			}
+		}
+	}
+	return plan, nil
+}
+
+// resume skips entries the previous manifest recorded as done, as long as
+// the input is unchanged and the output still exists.
+func (p *fileBatchPlan) resume(previous *BatchManifest) {
+	if p.force {
+		return
+	}
+	done := make(map[string]*ManifestEntry, len(previous.Entries))
+	for _, e := range previous.Entries {
+		if e.Status == FileStatusDone || e.Status == FileStatusSkipped {
+			done[e.Input] = e
+		}
+	}
+	for _, e := range p.entries {
+		prev, ok := done[e.Input]
+		if !ok || e.Status != FileStatusPending || prev.Output != e.Output ||
+			prev.InputSize != e.InputSize || !prev.InputModTime.Equal(e.InputModTime) {
+			continue
+		}
+		if out, err := os.Stat(e.Output); err == nil {
+			e.Status = FileStatusSkipped
+			e.OutputSize = out.Size()
+		}
+	}
+}
+
+type inputFile struct {
+	path string
+	rel  string
+	info fs.FileInfo
+}
+
+func findInputFiles(inputs, extensions []string, outputDir string) ([]inputFile, error) {
+	// Compare absolute paths, so the output directory is skipped however
+	// it and the inputs are written.
+	outputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var files []inputFile
+	add := func(path, root string, info fs.FileInfo) error {
+		path = filepath.Clean(path)
+		if seen[path] {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		seen[path] = true
+		files = append(files, inputFile{path: path, rel: rel, info: info})
+		return nil
+	}
+
+	for _, input := range inputs {
+		root := globRoot(input)
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q: %w", input, err)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if root == filepath.Clean(match) {
+					root = filepath.Dir(match)
+				}
+				if err := add(match, root, info); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			walkRoot := root
+			if walkRoot == filepath.Clean(match) || !hasGlobMeta(input) {
+				walkRoot = match
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if abs, err := filepath.Abs(path); err == nil && abs == outputDir {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !hasExtension(path, extensions) {
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				return add(path, walkRoot, info)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// globRoot returns the leading directories of pattern that contain no
+// glob metacharacters.
+func globRoot(pattern string) string {
+	if !hasGlobMeta(pattern) {
+		return filepath.Clean(pattern)
+	}
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	var fixed []string
+	for _, part := range parts[:len(parts)-1] {
+		if hasGlobMeta(part) {
+			break
+		}
+		fixed = append(fixed, part)
+	}
+	root := strings.Join(fixed, "/")
+	if root == "" && strings.HasPrefix(pattern, "/") {
+		root = "/"
+	}
+	if root == "" {
+		root = "."
+	}
+	return filepath.Clean(filepath.FromSlash(root))
+}
+
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+func hasExtension(path string, extensions []string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range extensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func expandOutputTemplate(template, rel string) string {
+	dir := filepath.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+	base := filepath.Base(rel)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	r := strings.NewReplacer("{dir}", filepath.ToSlash(dir), "{name}", name, "{ext}", ext)
+	return filepath.FromSlash(r.Replace(template))
+}
+
+type manifestSaver struct {
+	manifest *BatchManifest
+	path     string
+	interval time.Duration
+	last     time.Time
+}
+
+func (s *manifestSaver) maybeSave() error {
+	if time.Since(s.last) < s.interval {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *manifestSaver) save() error {
+	s.manifest.UpdatedAt = time.Now()
+	s.last = s.manifest.UpdatedAt
+	return s.manifest.Save(s.path)
+}
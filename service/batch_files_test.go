@@ -0,0 +1,212 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func writeTree(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, minimalPDF, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func copyFile(calls *int32) service.FileFunc {
+	return func(ctx context.Context, in, out string) error {
+		atomic.AddInt32(calls, 1)
+		data, err := os.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(out, data, 0644)
+	}
+}
+
+func TestFilesPreservesTreeAndTemplate(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeTree(t, in, "a.pdf", "sub/b.pdf", "sub/deep/c.PDF", "notes.txt")
+
+	var calls int32
+	bp := service.NewBatchProcessor(service.NewWithGotenberg("http://localhost:3000"), 2)
+	manifest, err := bp.Files(context.Background(), &service.FileBatchOptions{
+		Inputs:    []string{in},
+		OutputDir: out,
+		Template:  "{dir}/{name}-compressed.pdf",
+	}, copyFile(&calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"a-compressed.pdf", "sub/b-compressed.pdf", "sub/deep/c-compressed.pdf"} {
+		if _, err := os.Stat(filepath.Join(out, want)); err != nil {
+			t.Errorf("missing output %s", want)
+		}
+	}
+	if s := manifest.Summary(); s.Total != 3 || s.Done != 3 {
+		t.Errorf("summary = %+v", s)
+	}
+
+	saved, err := service.LoadBatchManifest(filepath.Join(out, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Entries) != 3 || saved.FinishedAt == nil {
+		t.Errorf("saved manifest has %d entries, finished=%v", len(saved.Entries), saved.FinishedAt)
+	}
+}
+
+func TestFilesGlobAndSkipUpToDate(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeTree(t, in, "x/1.pdf", "y/2.pdf", "y/3.pdf")
+
+	var calls int32
+	bp := service.NewBatchProcessor(service.NewWithGotenberg("http://localhost:3000"), 2)
+	opts := &service.FileBatchOptions{Inputs: []string{filepath.Join(in, "y", "*.pdf")}, OutputDir: out}
+
+	if _, err := bp.Files(context.Background(), opts, copyFile(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("first run processed %d files, want 2", calls)
+	}
+	if _, err := os.Stat(filepath.Join(out, "2.pdf")); err != nil {
+		t.Errorf("glob output not relative to glob root: %v", err)
+	}
+
+	manifest, err := bp.Files(context.Background(), opts, copyFile(&calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("second run reprocessed up-to-date files")
+	}
+	if s := manifest.Summary(); s.Skipped != 2 {
+		t.Errorf("summary = %+v, want 2 skipped", s)
+	}
+
+	opts.Force = true
+	if _, err := bp.Files(context.Background(), opts, copyFile(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Errorf("Force did not reprocess, calls = %d", calls)
+	}
+}
+
+func TestFilesRecordsFailuresAndResumes(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeTree(t, in, "good.pdf", "bad.pdf")
+
+	var calls int32
+	failBad := func(ctx context.Context, in, out string) error {
+		if strings.HasSuffix(in, "bad.pdf") {
+			return errors.New("corrupt")
+		}
+		return copyFile(&calls)(ctx, in, out)
+	}
+
+	bp := service.NewBatchProcessor(service.NewWithGotenberg("http://localhost:3000"), 2)
+	opts := &service.FileBatchOptions{Inputs: []string{in}, OutputDir: out}
+	manifest, err := bp.Files(context.Background(), opts, failBad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := manifest.Failed()
+	if len(failed) != 1 || failed[0].Error != "corrupt" {
+		t.Fatalf("failed entries = %+v", failed)
+	}
+	if _, err := os.Stat(filepath.Join(out, "bad.pdf")); !os.IsNotExist(err) {
+		t.Error("failed item left an output file behind")
+	}
+
+	// Make the good output look stale so only the manifest can tell it is done.
+	stale := failed[0].InputModTime.Add(-time.Second)
+	if err := os.Chtimes(filepath.Join(out, "good.pdf"), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = 0
+	manifest, err = bp.Files(context.Background(), opts, copyFile(&calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("resume processed %d files, want only the failed one", calls)
+	}
+	if s := manifest.Summary(); s.Done != 1 || s.Skipped != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestFilesRejectsOutputCollisions(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeTree(t, in, "a/doc.pdf", "b/doc.pdf")
+
+	bp := service.NewBatchProcessor(service.NewWithGotenberg("http://localhost:3000"), 2)
+	var calls int32
+	_, err := bp.Files(context.Background(), &service.FileBatchOptions{
+		Inputs:    []string{in},
+		OutputDir: out,
+		Template:  "{name}.pdf",
+	}, copyFile(&calls))
+	if err == nil {
+		t.Error("expected an error when two inputs map to the same output")
+	}
+}
+
+func TestFilesSkipsOutputDirInsideInputs(t *testing.T) {
+	in := t.TempDir()
+	writeTree(t, in, "a.pdf", "out/old-a.pdf")
+	t.Chdir(in)
+
+	bp := service.NewBatchProcessor(service.NewWithGotenberg("http://localhost:3000"), 2)
+	var calls int32
+	// Absolute inputs with a relative output directory inside them.
+	manifest, err := bp.Files(context.Background(), &service.FileBatchOptions{
+		Inputs:    []string{in},
+		OutputDir: "out",
+	}, copyFile(&calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := manifest.Summary(); s.Total != 1 || calls != 1 {
+		t.Errorf("summary = %+v after %d calls, want only a.pdf", s, calls)
+	}
+}
+
+func TestCompressFiles(t *testing.T) {
+	out := t.TempDir()
+	bp := service.NewBatchProcessor(service.NewWithGotenberg("http://localhost:3000"), 2)
+	manifest, err := bp.CompressFiles(context.Background(), &service.FileBatchOptions{
+		Inputs:    []string{"testdata/test.pdf"},
+		OutputDir: out,
+		Template:  "{name}-compressed{ext}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := manifest.Summary(); s.Done != 1 {
+		t.Fatalf("summary = %+v, entries = %+v", s, manifest.Entries[0])
+	}
+	if manifest.Entries[0].OutputSize == 0 {
+		t.Error("output size not recorded")
+	}
+	if _, err := os.Stat(filepath.Join(out, "test-compressed.pdf")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,245 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func TestBatchStreamsEveryItem(t *testing.T) {
+	double := func(ctx context.Context, n int) (int, error) { return n * 2, nil }
+
+	var mu sync.Mutex
+	var last service.BatchProgress
+	batch := service.NewBatch(double, &service.BatchOptions{
+		Workers: 3,
+		Progress: func(p service.BatchProgress) {
+			mu.Lock()
+			last = p
+			mu.Unlock()
+		},
+	})
+
+	inputs := make([]int, 50)
+	for i := range inputs {
+		inputs[i] = i
+	}
+
+	seen := make(map[int]bool)
+	for item := range batch.Run(context.Background(), inputs) {
+		if item.Err != nil {
+			t.Fatalf("item %d: %v", item.Index, item.Err)
+		}
+		if item.Value != inputs[item.Index]*2 {
+			t.Errorf("item %d = %d, want %d", item.Index, item.Value, inputs[item.Index]*2)
+		}
+		seen[item.Index] = true
+	}
+	if len(seen) != len(inputs) {
+		t.Errorf("got %d items, want %d", len(seen), len(inputs))
+	}
+	if last.Total != 50 || last.Completed != 50 || last.Succeeded != 50 || last.Failed != 0 {
+		t.Errorf("final progress = %+v", last)
+	}
+}
+
+func TestBatchStreamFromChannel(t *testing.T) {
+	inputs := make(chan string)
+	go func() {
+		defer close(inputs)
+		for _, s := range []string{"a", "b", "c"} {
+			inputs <- s
+		}
+	}()
+
+	upper := func(ctx context.Context, s string) (string, error) { return s + s, nil }
+	count := 0
+	for item := range service.NewBatch(upper, nil).Stream(context.Background(), inputs) {
+		if item.Value != item.Input+item.Input {
+			t.Errorf("item %d = %q", item.Index, item.Value)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("got %d items, want 3", count)
+	}
+}
+
+func TestBatchBoundsConcurrency(t *testing.T) {
+	var running, peak int32
+	op := func(ctx context.Context, n int) (int, error) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return n, nil
+	}
+
+	service.NewBatch(op, &service.BatchOptions{Workers: 4}).Collect(context.Background(), make([]int, 40))
+	if peak > 4 {
+		t.Errorf("peak concurrency = %d, want <= 4", peak)
+	}
+}
+
+func TestBatchContinueOnError(t *testing.T) {
+	errOdd := errors.New("odd")
+	op := func(ctx context.Context, n int) (int, error) {
+		if n%2 == 1 {
+			return 0, errOdd
+		}
+		return n, nil
+	}
+
+	items := service.NewBatch(op, &service.BatchOptions{Workers: 2}).Collect(context.Background(), []int{0, 1, 2, 3, 4})
+	for i, item := range items {
+		if wantErr := i%2 == 1; (item.Err != nil) != wantErr {
+			t.Errorf("item %d err = %v", i, item.Err)
+		}
+	}
+}
+
+func TestBatchFailFast(t *testing.T) {
+	var calls int32
+	op := func(ctx context.Context, n int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		if n == 0 {
+			return 0, errors.New("boom")
+		}
+		time.Sleep(time.Millisecond)
+		return n, nil
+	}
+
+	inputs := make([]int, 100)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	items := service.NewBatch(op, &service.BatchOptions{Workers: 1, Policy: service.FailFast}).Collect(context.Background(), inputs)
+
+	if calls > 2 {
+		t.Errorf("op called %d times after fail-fast", calls)
+	}
+	if !errors.Is(items[len(items)-1].Err, service.ErrBatchAborted) {
+		t.Errorf("last item err = %v, want ErrBatchAborted", items[len(items)-1].Err)
+	}
+}
+
+func TestBatchItemTimeout(t *testing.T) {
+	slow := func(ctx context.Context, n int) (int, error) {
+		time.Sleep(200 * time.Millisecond)
+		return n, nil
+	}
+
+	start := time.Now()
+	items := service.NewBatch(slow, &service.BatchOptions{Workers: 1, ItemTimeout: 10 * time.Millisecond}).Collect(context.Background(), []int{1})
+	if !errors.Is(items[0].Err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", items[0].Err)
+	}
+	if time.Since(start) > 150*time.Millisecond {
+		t.Error("timeout did not stop waiting on the item")
+	}
+}
+
+func TestBatchRetries(t *testing.T) {
+	var calls int32
+	flaky := func(ctx context.Context, n int) (int, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return 0, errors.New("transient")
+		}
+		return n, nil
+	}
+
+	items := service.NewBatch(flaky, &service.BatchOptions{Workers: 1, Retries: 2, RetryDelay: time.Millisecond}).Collect(context.Background(), []int{7})
+	if items[0].Err != nil || items[0].Value != 7 {
+		t.Fatalf("item = %+v", items[0])
+	}
+	if items[0].Attempts != 3 {
+		t.Errorf("attempts = %d, want 3", items[0].Attempts)
+	}
+}
+
+func TestPipelineBatch(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+	p := service.NewPipeline(pdfService).Compress()
+
+	docs := []service.Document{{Name: "a.pdf", Data: minimalPDF}, {Name: "b.pdf", Data: minimalPDF}}
+	for _, item := range service.NewPipelineBatch(p, nil).Collect(context.Background(), docs) {
+		if item.Err != nil {
+			t.Skipf("pipeline failed on minimal PDF: %v", item.Err)
+		}
+		if len(item.Value.Documents) != 1 {
+			t.Errorf("item %d produced %d documents", item.Index, len(item.Value.Documents))
+		}
+	}
+}
+
+// peakStep records the most documents it ever runs on at once.
+type peakStep struct {
+	running, peak int32
+}
+
+func (s *peakStep) Type() string    { return "test_peak" }
+func (s *peakStep) Validate() error { return nil }
+
+func (s *peakStep) Run(ctx context.Context, svc service.PDFService, docs []service.Document) ([]service.Document, error) {
+	cur := atomic.AddInt32(&s.running, 1)
+	for {
+		old := atomic.LoadInt32(&s.peak)
+		if cur <= old || atomic.CompareAndSwapInt32(&s.peak, old, cur) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	atomic.AddInt32(&s.running, -1)
+	return docs, nil
+}
+
+func TestBatchProcessorUsesMaxWorkers(t *testing.T) {
+	step := &peakStep{}
+	p := service.NewPipeline(nil).Then(step)
+	docs := make([]service.Document, 60)
+	for i := range docs {
+		docs[i] = service.Document{Name: "doc.pdf", Data: minimalPDF}
+	}
+
+	service.NewBatchProcessor(nil, 20).Pipeline(p, nil).Collect(context.Background(), docs)
+	if step.peak <= 5 || step.peak > 20 {
+		t.Errorf("peak concurrency = %d, want up to maxWorkers 20", step.peak)
+	}
+}
+
+func TestBatchTimeoutsKeepConcurrencyBounded(t *testing.T) {
+	var running, peak int32
+	stubborn := func(ctx context.Context, n int) (int, error) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond) // ignores ctx
+		atomic.AddInt32(&running, -1)
+		return n, nil
+	}
+
+	opts := &service.BatchOptions{Workers: 2, ItemTimeout: 2 * time.Millisecond, Retries: 1, RetryDelay: time.Millisecond}
+	items := service.NewBatch(stubborn, opts).Collect(context.Background(), make([]int, 10))
+	for _, item := range items {
+		if !errors.Is(item.Err, context.DeadlineExceeded) || item.Attempts != 2 {
+			t.Errorf("item %d: attempts %d, err %v", item.Index, item.Attempts, item.Err)
+		}
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", p)
+	}
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// BlankPageOptions controls blank page detection.
+type BlankPageOptions struct {
+	// Sensitivity from 0 to 1 sets how much ink a scanned page may carry
+	// and still count as blank: 1% of its area at 1, 0.5% at the default
+	// of 0.5. Higher values remove more pages. Zero uses the default.
+	Sensitivity float64 `json:"sensitivity,omitempty"`
+	// ContentOnly skips rendering. Pages with images or drawings are then
+	// treated as not blank, and no page renderer is needed.
+	ContentOnly bool `json:"content_only,omitempty"`
+	// Pages limits the analysis to a page selection such as "2-"; other
+	// pages are never reported blank.
+	Pages string `json:"pages,omitempty"`
+}
+
+// BlankPageScore is the blank page analysis of one page.
+type BlankPageScore struct {
+	Page int `json:"page"`
+	// Score is 1 for a page that is certainly blank and 0 for one that
+	// certainly is not; pages scoring 0.5 or more are blank.
+	Score float64 `json:"score"`
+	Blank bool    `json:"blank"`
+	// Text, Drawing and Image report what the content stream paints.
+	// Invisible text, such as an OCR layer, and white fills do not count.
+	Text    bool `json:"text"`
+	Drawing bool `json:"drawing"`
+	Image   bool `json:"image"`
+	// Rendered is set when the page was rendered; InkCoverage is then the
+	// share of dark pixels, ignoring a thin border where scanners leave
+	// edge shadows.
+	Rendered    bool    `json:"rendered"`
+	InkCoverage float64 `json:"ink_coverage,omitempty"`
+}
+
+// blankRenderDPI is enough to see handwriting and stamps while keeping
+// rendering cheap.
+const blankRenderDPI = 50
+
+func (o *BlankPageOptions) inkThreshold() float64 {
+	sensitivity := 0.5
+	if o != nil && o.Sensitivity > 0 {
+		sensitivity = math.Min(o.Sensitivity, 1)
+	}
+	return sensitivity * 0.01
+}
+
+func (s *pageService) AnalyzeBlankPages(input []byte, opts *BlankPageOptions) ([]BlankPageScore, error) {
+	ctx, span := startSpan(context.Background(), "PageService.AnalyzeBlankPages", AttrInputBytes.Int(len(input)))
+	scores, err := s.analyzeBlankPages(ctx, input, opts)
+	endSpan(span, err, attribute.Int("pdf.blank_pages", countBlank(scores)))
+	return scores, err
+}
+
+func (s *pageService) analyzeBlankPages(ctx context.Context, input []byte, opts *BlankPageOptions) ([]BlankPageScore, error) {
+	s.log.Info("PageService.AnalyzeBlankPages called")
+
+	if opts == nil {
+		opts = &BlankPageOptions{}
+	}
+	if opts.Sensitivity < 0 || opts.Sensitivity > 1 {
+		return nil, fmt.Errorf("sensitivity must be between 0 and 1, got %g", opts.Sensitivity)
+	}
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, opts.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var scores []BlankPageScore
+	var render []int
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		marks, err := pageMarks(pdfCtx, p)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		score := BlankPageScore{Page: p, Text: marks.text, Drawing: marks.drawing, Image: marks.image}
+		switch {
+		case marks.text:
+		case marks.empty():
+			score.Score, score.Blank = 1, true
+		case !opts.ContentOnly:
+			render = append(render, len(scores))
+		}
+		scores = append(scores, score)
+	}
+
+	if len(render) > 0 {
+		if err := s.scoreInk(ctx, input, scores, render, opts.inkThreshold()); err != nil {
+			return nil, err
+		}
+	}
+
+	s.log.Info("Blank pages analyzed", logger.Int("pages", len(scores)), logger.Int("rendered", len(render)),
+		logger.Int("blank", countBlank(scores)))
+	return scores, nil
+}
+
+// scoreInk renders the pages at the given indexes of scores and scores
+// them by ink coverage against threshold.
+func (s *pageService) scoreInk(ctx context.Context, input []byte, scores []BlankPageScore, indexes []int, threshold float64) error {
+	if !s.renderer.Available() {
+		return fmt.Errorf("blank page detection on scanned pages needs page renderer %q (or set ContentOnly)", s.renderer.Name())
+	}
+
+	tmpDir, err := os.MkdirTemp("", "pdf-blank-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inputPath := filepath.Join(tmpDir, "input.pdf")
+	if err := writeFile(ctx, inputPath, input); err != nil {
+		return err
+	}
+
+	for _, i := range indexes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := s.renderer.RenderPage(ctx, inputPath, scores[i].Page, blankRenderDPI, "png", true)
+		if err != nil {
+			return err
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("page %d: %w", scores[i].Page, err)
+		}
+
+		coverage := inkCoverage(img)
+		scores[i].Rendered = true
+		scores[i].InkCoverage = coverage
+		scores[i].Score = inkScore(coverage, threshold)
+		scores[i].Blank = scores[i].Score >= 0.5
+	}
+	return nil
+}
+
+// inkScore maps ink coverage to a score that is 1 without ink, 0.5 at the
+// threshold and 0 at twice the threshold or more.
+func inkScore(coverage, threshold float64) float64 {
+	if threshold <= 0 {
+		if coverage == 0 {
+			return 1
+		}
+		return 0
+	}
+	return math.Max(0, 1-coverage/(2*threshold))
+}
+
+// inkCoverage returns the share of dark pixels in img, ignoring a border
+// of 4% on every side.
+func inkCoverage(img image.Image) float64 {
+	b := img.Bounds()
+	mx, my := b.Dx()*4/100, b.Dy()*4/100
+	var dark, total int
+	for y := b.Min.Y + my; y < b.Max.Y-my; y++ {
+		for x := b.Min.X + mx; x < b.Max.X-mx; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			// Luminance on a 16-bit scale; below about 60% counts as ink
+			// so that light show-through from the other side does not.
+			if (299*r+587*g+114*bl)/1000 < 0x9999 {
+				dark++
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(dark) / float64(total)
+}
+
+func (s *pageService) RemoveBlankPages(input []byte, opts *BlankPageOptions) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.RemoveBlankPages", AttrInputBytes.Int(len(input)))
+	output, err := s.removeBlankPages(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) removeBlankPages(ctx context.Context, input []byte, opts *BlankPageOptions) ([]byte, error) {
+	s.log.Info("PageService.RemoveBlankPages called")
+
+	scores, err := s.analyzeBlankPages(ctx, input, opts)
+	if err != nil {
+		return nil, err
+	}
+	count, err := pageCount(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var blank []string
+	for _, score := range scores {
+		if score.Blank {
+			blank = append(blank, strconv.Itoa(score.Page))
+		}
+	}
+	if len(blank) == 0 {
+		s.log.Info("No blank pages found")
+		return input, nil
+	}
+	if len(blank) == count {
+		return nil, errors.New("every page is blank")
+	}
+	return s.deletePages(ctx, input, strings.Join(blank, ","))
+}
+
+func countBlank(scores []BlankPageScore) int {
+	n := 0
+	for _, score := range scores {
+		if score.Blank {
+			n++
+		}
+	}
+	return n
+}
+
+// contentMarks records what a page's content paints. hiddenText is text
+// in an invisible render mode, such as an OCR layer; it does not count
+// as painting.
+type contentMarks struct {
+	text, drawing, image bool
+	hiddenText           bool
+}
+
+func (m contentMarks) empty() bool {
+	return !m.text && !m.drawing && !m.image
+}
+
+// pageMarks inspects a page's content, following form XObjects.
+func pageMarks(pdfCtx *model.Context, page int) (contentMarks, error) {
+	d, _, inh, err := pdfCtx.PageDict(page, true)
+	if err != nil {
+		return contentMarks{}, err
+	}
+	content, err := pdfCtx.PageContent(d, page)
+	if err != nil && !errors.Is(err, model.ErrNoContent) {
+		return contentMarks{}, err
+	}
+
+	var marks contentMarks
+	var resources types.Dict
+	if inh != nil {
+		resources = inh.Resources
+	}
+	inspectContent(pdfCtx, content, resources, &marks, 0)
+	return marks, nil
+}
+
+// paintState is the part of the graphics state that decides whether
+// painting leaves a visible mark.
+type paintState struct {
+	whiteFill, whiteStroke bool
+	invisibleText          bool
+}
+
+func inspectContent(pdfCtx *model.Context, content []byte, resources types.Dict, marks *contentMarks, depth int) {
+	var st paintState
+	var stack []paintState
+
+	scanContent(content, func(op string, args []any) {
+		switch op {
+		case "q":
+			stack = append(stack, st)
+		case "Q":
+			if n := len(stack); n > 0 {
+				st = stack[n-1]
+				stack = stack[:n-1]
+			}
+		case "g", "rg", "k", "sc", "scn":
+			st.whiteFill = isWhite(op, args)
+		case "G", "RG", "K", "SC", "SCN":
+			st.whiteStroke = isWhite(strings.ToLower(op), args)
+		case "Tr":
+			// Modes 3 and 7 neither fill nor stroke the glyphs.
+			mode := numberOperand(args, 0)
+			st.invisibleText = mode == 3 || mode == 7
+		case "Tj", "'", "\"", "TJ":
+			if showsGlyphs(args) {
+				if st.invisibleText {
+					marks.hiddenText = true
+				} else {
+					marks.text = true
+				}
+			}
+		case "f", "F", "f*":
+			marks.drawing = marks.drawing || !st.whiteFill
+		case "S", "s":
+			marks.drawing = marks.drawing || !st.whiteStroke
+		case "B", "B*", "b", "b*":
+			marks.drawing = marks.drawing || !st.whiteFill || !st.whiteStroke
+		case "sh":
+			marks.drawing = true
+		case "BI":
+			marks.image = true
+		case "Do":
+			if len(args) == 1 {
+				if name, ok := args[0].(pdfName); ok {
+					inspectXObject(pdfCtx, resources, string(name), marks, depth)
+				}
+			}
+		}
+	})
+}
+
+func inspectXObject(pdfCtx *model.Context, resources types.Dict, name string, marks *contentMarks, depth int) {
+	xobjects := dictEntry(pdfCtx, resources, "XObject")
+	if xobjects == nil {
+		return
+	}
+	sd, _, err := pdfCtx.DereferenceStreamDict(xobjects[name])
+	if err != nil || sd == nil {
+		return
+	}
+	switch subtype := sd.Dict.NameEntry("Subtype"); {
+	case subtype == nil:
+	case *subtype == "Image":
+		marks.image = true
+	case *subtype == "Form" && depth < maxFormDepth:
+		if err := sd.Decode(); err != nil {
+			// Assume an unreadable form paints something.
+			marks.drawing = true
+			return
+		}
+		formResources := dictEntry(pdfCtx, sd.Dict, "Resources")
+		if formResources == nil {
+			formResources = resources
+		}
+		inspectContent(pdfCtx, sd.Content, formResources, marks, depth+1)
+	}
+}
+
+// isWhite reports whether colour operands for a lowercase colour operator
+// are white. Pattern and unknown colours count as not white.
+func isWhite(op string, args []any) bool {
+	nums := make([]float64, 0, len(args))
+	for _, a := range args {
+		f, ok := a.(float64)
+		if !ok {
+			return false
+		}
+		nums = append(nums, f)
+	}
+	switch {
+	case op == "k" || len(nums) == 4:
+		return len(nums) == 4 && nums[0] == 0 && nums[1] == 0 && nums[2] == 0 && nums[3] == 0
+	case len(nums) == 1:
+		return nums[0] >= 1
+	case len(nums) == 3:
+		return nums[0] >= 1 && nums[1] >= 1 && nums[2] >= 1
+	}
+	return false
+}
+
+// showsGlyphs reports whether the operands of a text showing operator
+// contain anything other than spaces.
+func showsGlyphs(args []any) bool {
+	for _, a := range args {
+		switch v := a.(type) {
+		case pdfString:
+			if len(bytes.Trim(v, " \x00")) > 0 {
+				return true
+			}
+		case []any:
+			if showsGlyphs(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
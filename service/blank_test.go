@@ -0,0 +1,138 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func TestAnalyzeBlankPages(t *testing.T) {
+	pages := service.NewPageService(getTestLogger())
+
+	// Text, empty, invisible OCR text, a white box, a drawn line, spaces.
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddPage()
+	pdf.Text(20, 20, "content")
+	pdf.AddPage()
+	pdf.AddPage()
+	pdf.SetTextRenderingMode(3)
+	pdf.Text(20, 20, "hidden")
+	pdf.SetTextRenderingMode(0)
+	pdf.AddPage()
+	pdf.SetFillColor(255, 255, 255)
+	pdf.Rect(10, 10, 100, 100, "F")
+	pdf.AddPage()
+	pdf.Line(10, 10, 100, 100)
+	pdf.AddPage()
+	pdf.Text(20, 20, "   ")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	scores, err := pages.AnalyzeBlankPages(buf.Bytes(), &service.BlankPageOptions{ContentOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{false, true, true, true, false, true}
+	if len(scores) != len(want) {
+		t.Fatalf("got %d scores, want %d", len(scores), len(want))
+	}
+	for i, score := range scores {
+		if score.Page != i+1 || score.Blank != want[i] || score.Rendered {
+			t.Errorf("page %d: %+v, want blank %v", i+1, score, want[i])
+		}
+	}
+	if !scores[0].Text || scores[0].Score != 0 || !scores[4].Drawing || scores[1].Score != 1 {
+		t.Errorf("scores = %+v", scores)
+	}
+
+	scores, err = pages.AnalyzeBlankPages(buf.Bytes(), &service.BlankPageOptions{ContentOnly: true, Pages: "2-3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 2 || scores[0].Page != 2 || scores[1].Page != 3 {
+		t.Errorf("selected scores = %+v", scores)
+	}
+
+	if _, err := pages.AnalyzeBlankPages(buf.Bytes(), &service.BlankPageOptions{Sensitivity: 2}); err == nil {
+		t.Error("expected error for sensitivity above 1")
+	}
+}
+
+func TestRemoveBlankPages(t *testing.T) {
+	pages := service.NewPageService(getTestLogger())
+
+	output, err := pages.RemoveBlankPages(textPDF(t, "one", "", "two", ""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores, err := pages.AnalyzeBlankPages(output, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 2 || scores[0].Blank || scores[1].Blank {
+		t.Errorf("remaining pages = %+v", scores)
+	}
+
+	input := textPDF(t, "one", "two")
+	output, err = pages.RemoveBlankPages(input, nil)
+	if err != nil || !bytes.Equal(output, input) {
+		t.Errorf("document without blank pages changed: %v", err)
+	}
+
+	if _, err := pages.RemoveBlankPages(textPDF(t, "", ""), nil); err == nil {
+		t.Error("expected error when every page is blank")
+	}
+
+	svc := service.NewWithGotenberg("http://localhost:3000")
+	if err := (&service.RemoveBlankPagesStep{BlankPageOptions: service.BlankPageOptions{Sensitivity: -1}}).Validate(); err == nil {
+		t.Error("expected error for negative sensitivity")
+	}
+	docs := []service.Document{{Name: "a.pdf", Data: textPDF(t, "", "one")}}
+	docs, err = (&service.RemoveBlankPagesStep{}).Run(t.Context(), svc, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := svc.Pages().GetPageCount(docs[0].Data); err != nil || count != 1 {
+		t.Errorf("step page count = %d, %v", count, err)
+	}
+}
+
+func TestAnalyzeBlankPagesRendersWithRenderer(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	img.SetGray(50, 50, color.Gray{Y: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	scan, err := service.NewJPGToPDFService(getTestLogger()).ConvertBytes(buf.Bytes(), "scan.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fakeRenderer draws every page white, so the dark scan reads as blank.
+	pages := service.NewPageServiceWithRenderer(getTestLogger(), fakeRenderer{})
+	scores, err := pages.AnalyzeBlankPages(scan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 1 || !scores[0].Image || !scores[0].Rendered || !scores[0].Blank {
+		t.Errorf("scores = %+v", scores)
+	}
+
+	pages = service.NewPageServiceWithRenderer(getTestLogger(), missingRenderer{})
+	if _, err := pages.AnalyzeBlankPages(scan, nil); err == nil {
+		t.Error("expected error when the renderer is not available")
+	}
+	if _, err := pages.AnalyzeBlankPages(scan, &service.BlankPageOptions{ContentOnly: true}); err != nil {
+		t.Errorf("ContentOnly needs no renderer: %v", err)
+	}
+}
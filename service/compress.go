@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"io"
 	"os"
 
@@ -39,12 +40,21 @@ func (s *compressService) Compress(input io.Reader) ([]byte, error) {
 }
 
 func (s *compressService) CompressFile(inputPath, outputPath string) error {
+	ctx, span := startSpan(context.Background(), "CompressService.CompressFile")
+	err := s.compressFile(ctx, inputPath, outputPath)
+	endSpan(span, err)
+	return err
+}
+
+func (s *compressService) compressFile(ctx context.Context, inputPath, outputPath string) error {
 	s.log.Info("CompressService.CompressFile called", logger.String("input", inputPath))
 
 	conf := model.NewDefaultConfiguration()
 	conf.Cmd = model.OPTIMIZE
 
-	if err := api.OptimizeFile(inputPath, outputPath, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.OptimizeFile", func() error {
+		return api.OptimizeFile(inputPath, outputPath, conf)
+	}); err != nil {
 		s.log.Error("pdfcpu optimize failed", logger.Error(err))
 		return err
 	}
@@ -54,6 +64,13 @@ func (s *compressService) CompressFile(inputPath, outputPath string) error {
 }
 
 func (s *compressService) CompressBytes(input []byte) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "CompressService.CompressBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.compressBytes(ctx, input)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *compressService) compressBytes(ctx context.Context, input []byte) ([]byte, error) {
 	s.log.Info("CompressService.CompressBytes called")
 
 	tmpInput, err := os.CreateTemp("", "pdf-compress-input-*.pdf")
@@ -70,16 +87,15 @@ func (s *compressService) CompressBytes(input []byte) ([]byte, error) {
 	defer os.Remove(tmpOutput.Name())
 	tmpOutput.Close()
 
-	if _, err := tmpInput.Write(input); err != nil {
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
-	if err := s.CompressFile(tmpInput.Name(), tmpOutput.Name()); err != nil {
+	if err := s.compressFile(ctx, tmpInput.Name(), tmpOutput.Name()); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(tmpOutput.Name())
+	output, err := readFile(ctx, tmpOutput.Name())
 	if err != nil {
 		return nil, err
 	}
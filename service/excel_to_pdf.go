@@ -40,6 +40,13 @@ func (s *excelToPDFService) Convert(ctx context.Context, input io.Reader, filena
 }
 
 func (s *excelToPDFService) ConvertFile(ctx context.Context, inputPath, outputPath string) error {
+	ctx, span := startSpan(ctx, "ExcelToPDFService.ConvertFile")
+	err := s.convertFile(ctx, inputPath, outputPath)
+	endSpan(span, err)
+	return err
+}
+
+func (s *excelToPDFService) convertFile(ctx context.Context, inputPath, outputPath string) error {
 	s.log.Info("ExcelToPDFService.ConvertFile called", logger.String("input", inputPath))
 
 	resultBytes, err := s.gotClient.ExcelToPDF(ctx, inputPath)
@@ -48,7 +55,7 @@ func (s *excelToPDFService) ConvertFile(ctx context.Context, inputPath, outputPa
 		return err
 	}
 
-	if err := os.WriteFile(outputPath, resultBytes, 0644); err != nil {
+	if err := writeFile(ctx, outputPath, resultBytes); err != nil {
 		s.log.Error("Failed to write output file", logger.Error(err))
 		return err
 	}
@@ -58,6 +65,13 @@ func (s *excelToPDFService) ConvertFile(ctx context.Context, inputPath, outputPa
 }
 
 func (s *excelToPDFService) ConvertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "ExcelToPDFService.ConvertBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.convertBytes(ctx, input, filename)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *excelToPDFService) convertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
 	s.log.Info("ExcelToPDFService.ConvertBytes called")
 
 	ext := getExcelExtension(filename)
@@ -67,11 +81,9 @@ func (s *excelToPDFService) ConvertBytes(ctx context.Context, input []byte, file
 	}
 	defer os.Remove(tmpInput.Name())
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
 	resultBytes, err := s.gotClient.ExcelToPDF(ctx, tmpInput.Name())
 	if err != nil {
@@ -0,0 +1,723 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// ExportFormat is the markup a PDF is exported to.
+type ExportFormat string
+
+const (
+	ExportHTML     ExportFormat = "html"
+	ExportMarkdown ExportFormat = "markdown"
+)
+
+// DefaultImagePrefix is where exported images are placed relative to
+// the document.
+const DefaultImagePrefix = "images/"
+
+// ExportOptions controls ToHTML and ToMarkdown.
+type ExportOptions struct {
+	// Pages limits the export to a page selection such as "1-5,8".
+	Pages string `json:"pages,omitempty"`
+	// Title is the HTML document title. Empty uses the document's title,
+	// or failing that its first heading.
+	Title string `json:"title,omitempty"`
+	// SingleFile embeds images in the document as data URIs instead of
+	// returning them as separate files.
+	SingleFile bool `json:"single_file,omitempty"`
+	// ImagePrefix is prepended to image file names, DefaultImagePrefix
+	// when empty. It may name a directory ("images/") or a file name
+	// prefix ("manual-").
+	ImagePrefix string `json:"image_prefix,omitempty"`
+	// Headings tunes heading detection from font sizes. Lines matching a
+	// bookmark on their page are headings at the bookmark's depth.
+	Headings *HeadingOptions `json:"headings,omitempty"`
+	// TableMethod chooses how tables are found. Empty uses TableAuto.
+	TableMethod TableMethod `json:"table_method,omitempty"`
+	// SkipTables leaves table text as paragraphs.
+	SkipTables bool `json:"skip_tables,omitempty"`
+}
+
+func (o *ExportOptions) withDefaults() (ExportOptions, error) {
+	opts := ExportOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.ImagePrefix == "" {
+		opts.ImagePrefix = DefaultImagePrefix
+	}
+	switch opts.TableMethod {
+	case "":
+		opts.TableMethod = TableAuto
+	case TableAuto, TableLattice, TableStream:
+	default:
+		return opts, fmt.Errorf("unsupported table method %q", opts.TableMethod)
+	}
+	return opts, nil
+}
+
+// ExportResult is an exported document and the images it refers to.
+type ExportResult struct {
+	Document []byte `json:"document"`
+	// Images maps the file names used in Document to image data. It is
+	// empty in single-file mode.
+	Images map[string][]byte `json:"images,omitempty"`
+}
+
+// ExportService turns PDFs into structured markup, the reverse of the
+// HTML to PDF conversion done through Gotenberg.
+type ExportService interface {
+	// ToHTML exports a PDF as an HTML document with headings,
+	// paragraphs, lists, tables, links and images
+	ToHTML(ctx context.Context, input []byte, opts *ExportOptions) (*ExportResult, error)
+
+	// ToMarkdown exports a PDF as Markdown with the same structure as
+	// ToHTML; tables become pipe tables
+	ToMarkdown(ctx context.Context, input []byte, opts *ExportOptions) (*ExportResult, error)
+}
+
+type exportService struct {
+	log logger.ILogger
+}
+
+func NewExportService(log logger.ILogger) ExportService {
+	return &exportService{log: log}
+}
+
+func (s *exportService) ToHTML(ctx context.Context, input []byte, opts *ExportOptions) (*ExportResult, error) {
+	ctx, span := startSpan(ctx, "ExportService.ToHTML", AttrInputBytes.Int(len(input)))
+	result, err := s.export(ctx, input, opts, ExportHTML)
+	var size int
+	if result != nil {
+		size = len(result.Document)
+	}
+	endSpan(span, err, AttrOutputBytes.Int(size), attribute.Int("export.images", len(result.imageFiles())))
+	return result, err
+}
+
+func (s *exportService) ToMarkdown(ctx context.Context, input []byte, opts *ExportOptions) (*ExportResult, error) {
+	ctx, span := startSpan(ctx, "ExportService.ToMarkdown", AttrInputBytes.Int(len(input)))
+	result, err := s.export(ctx, input, opts, ExportMarkdown)
+	var size int
+	if result != nil {
+		size = len(result.Document)
+	}
+	endSpan(span, err, AttrOutputBytes.Int(size), attribute.Int("export.images", len(result.imageFiles())))
+	return result, err
+}
+
+// imageFiles returns the separate image files of a result, if any.
+func (r *ExportResult) imageFiles() map[string][]byte {
+	if r == nil {
+		return nil
+	}
+	return r.Images
+}
+
+func (s *exportService) export(ctx context.Context, input []byte, opts *ExportOptions, format ExportFormat) (*ExportResult, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("ExportService.Export called", logger.String("format", string(format)), logger.String("pages", o.Pages))
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, o.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &exportDocument{opts: &o, images: map[string][]byte{}, imageNames: map[int]string{}, anchors: map[int]bool{}}
+	if err := traceStep(ctx, "export.layout", func() error {
+		return doc.read(ctx, pdfCtx, selected)
+	}, AttrPageCount.Int(pdfCtx.PageCount)); err != nil {
+		return nil, err
+	}
+	blocks := doc.blocks()
+
+	title := o.Title
+	if title == "" {
+		if pdfCtx.Info != nil {
+			if info, err := pdfCtx.DereferenceDict(*pdfCtx.Info); err == nil {
+				title = dictText(pdfCtx, info, "Title")
+			}
+		}
+	}
+	if title == "" {
+		for _, b := range blocks {
+			if b.kind == blockHeading {
+				title = b.text()
+				break
+			}
+		}
+	}
+
+	result := &ExportResult{}
+	if format == ExportMarkdown {
+		result.Document = doc.markdown(blocks)
+	} else {
+		result.Document = doc.html(title, blocks)
+	}
+	if !o.SingleFile && len(doc.images) > 0 {
+		result.Images = doc.images
+	}
+	s.log.Info("PDF exported", logger.Int("blocks", len(blocks)), logger.Int("images", len(doc.imageNames)))
+	return result, nil
+}
+
+type exportBlockKind int
+
+const (
+	blockHeading exportBlockKind = iota
+	blockParagraph
+	blockListItem
+	blockTable
+	blockImage
+)
+
+// exportBlock is one element of the exported document.
+type exportBlock struct {
+	kind exportBlockKind
+	page int
+	// y is the block's top in page space, which orders blocks on a page.
+	y       float64
+	level   int
+	ordered bool
+	spans   []exportSpan
+	table   *Table
+	src     string
+	// indent is where the text of a list item starts; lines continuing
+	// the item are indented at least as far.
+	indent float64
+	// last is the block's last line, which a following line continues.
+	last *exportLine
+}
+
+func (b *exportBlock) text() string {
+	var sb strings.Builder
+	for _, s := range b.spans {
+		sb.WriteString(s.text)
+	}
+	return sb.String()
+}
+
+// exportSpan is a piece of inline text, linked when href is set.
+type exportSpan struct {
+	text string
+	href string
+}
+
+// exportLine is a line of words, each with the link covering it if any.
+type exportLine struct {
+	page       int
+	words      []tableWord
+	links      []string
+	x0, y0, y1 float64
+	size       float64
+	text       string
+	heading    int
+}
+
+// exportDocument collects the layout of the exported pages.
+type exportDocument struct {
+	opts   *ExportOptions
+	lines  []exportLine
+	others []exportBlock
+	// bookmarks maps a page and normalised title to a heading level.
+	bookmarks map[string]int
+	// images maps file names to data, and imageNames image objects to
+	// the name or data URI used for them.
+	images     map[string][]byte
+	imageNames map[int]string
+	anchors    map[int]bool
+	pageCount  int
+}
+
+// listMarker matches the ordered list markers "1." "2)" "a." and "b)".
+var listMarker = regexp.MustCompile(`^(\d{1,3}|[a-z])[.)]$`)
+
+// bullets are the characters that start an unordered list item.
+const bullets = "•◦▪▫‣⁃○●■□–-*·"
+
+func (d *exportDocument) read(ctx context.Context, pdfCtx *model.Context, selected map[int]bool) error {
+	outline, err := readOutline(pdfCtx)
+	if err != nil {
+		return err
+	}
+	d.bookmarks = map[string]int{}
+	var walk func(items []OutlineItem, depth int)
+	walk = func(items []OutlineItem, depth int) {
+		for _, item := range items {
+			d.bookmarks[bookmarkKey(item.Page, item.Title)] = min(depth, 6)
+			walk(item.Children, depth+1)
+		}
+	}
+	walk(outline, 1)
+
+	fonts := map[int]*pdfFont{}
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d.pageCount++
+
+		runs, rules, images, err := pageLayout(pdfCtx, p, fonts)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", p, err)
+		}
+		_, _, inh, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			return err
+		}
+		display, _, height := displayMatrix(visibleBox(inh), normalizedRotation(inh.Rotate))
+		toPage := func(box [4]float64) [4]float64 {
+			x0, y0 := display.apply(box[0], box[1])
+			x1, y1 := display.apply(box[2], box[3])
+			return normalizeRect([4]float64{x0, height - y0, x1, height - y1})
+		}
+		words := layoutWords(runs, display, height)
+
+		if !d.opts.SkipTables {
+			tableOpts := &TableOptions{Method: d.opts.TableMethod, MinRows: DefaultTableMinRows, MinColumns: DefaultTableMinColumns}
+			for _, t := range findTables(p, TextMethodPDF, words, pageRules(rules, display, height), tableOpts) {
+				var rest []tableWord
+				for _, w := range words {
+					cx, cy := (w.X0+w.X1)/2, (w.Y0+w.Y1)/2
+					if cx < t.X || cx > t.X+t.Width || cy < t.Y || cy > t.Y+t.Height {
+						rest = append(rest, w)
+					}
+				}
+				words = rest
+				d.others = append(d.others, exportBlock{kind: blockTable, page: p, y: t.Y, table: &t})
+			}
+		}
+
+		annots, err := pageAnnotations(pdfCtx, p)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", p, err)
+		}
+		type link struct {
+			box  [4]float64
+			href string
+		}
+		var links []link
+		for _, pa := range annots {
+			a := pa.annot
+			switch {
+			case a.Type != AnnotationLink:
+			case a.URI != "":
+				links = append(links, link{toPage(a.Rect), a.URI})
+			case a.DestPage > 0:
+				links = append(links, link{toPage(a.Rect), "#page-" + strconv.Itoa(a.DestPage)})
+				d.anchors[a.DestPage] = true
+			}
+		}
+
+		for _, row := range textRows(words) {
+			line := exportLine{page: p, words: row, links: make([]string, len(row)), x0: row[0].X0, y0: row[0].Y0, y1: row[0].Y1}
+			texts := make([]string, len(row))
+			for i, w := range row {
+				texts[i] = w.Text
+				line.y0, line.y1 = min(line.y0, w.Y0), max(line.y1, w.Y1)
+				line.size = max(line.size, w.Size)
+				cx, cy := (w.X0+w.X1)/2, (w.Y0+w.Y1)/2
+				for _, l := range links {
+					if cx >= l.box[0] && cx <= l.box[2] && cy >= l.box[1] && cy <= l.box[3] {
+						line.links[i] = l.href
+						break
+					}
+				}
+			}
+			line.text = strings.Join(texts, " ")
+			d.lines = append(d.lines, line)
+		}
+
+		for _, img := range images {
+			src, err := d.image(pdfCtx, img)
+			if err != nil {
+				return fmt.Errorf("page %d: image %s: %w", p, img.Name, err)
+			}
+			if src != "" {
+				d.others = append(d.others, exportBlock{kind: blockImage, page: p, y: toPage(img.Box)[1], src: src})
+			}
+		}
+	}
+	return nil
+}
+
+func bookmarkKey(page int, title string) string {
+	return strconv.Itoa(page) + "\x00" + strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// image extracts a drawn image once per image object, returning the
+// file name or data URI to refer to it by. Images pdfcpu cannot export
+// are left out.
+func (d *exportDocument) image(pdfCtx *model.Context, draw imageDraw) (string, error) {
+	if src, ok := d.imageNames[draw.ObjNr]; ok && draw.ObjNr != 0 {
+		return src, nil
+	}
+	img, err := pdfcpu.ExtractImage(pdfCtx, draw.Stream, false, draw.Name, draw.ObjNr, false)
+	if err != nil || img == nil {
+		return "", nil
+	}
+	data, err := io.ReadAll(img)
+	if err != nil {
+		return "", err
+	}
+
+	var src string
+	if d.opts.SingleFile {
+		mime := map[string]string{"jpg": "image/jpeg", "png": "image/png", "tif": "image/tiff", "webp": "image/webp"}[img.FileType]
+		if mime == "" {
+			mime = "application/octet-stream"
+		}
+		src = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+	} else {
+		src = fmt.Sprintf("%simage-%d.%s", d.opts.ImagePrefix, len(d.images)+1, img.FileType)
+		d.images[src] = data
+	}
+	if draw.ObjNr != 0 {
+		d.imageNames[draw.ObjNr] = src
+	}
+	return src, nil
+}
+
+// blocks classifies the collected lines and merges them into headings,
+// paragraphs and list items, then orders them with the tables and
+// images on each page from top to bottom.
+func (d *exportDocument) blocks() []exportBlock {
+	o := d.opts.Headings.withDefaults()
+
+	lines := d.lines
+	if !o.KeepRepeated && d.pageCount > 2 {
+		pages := map[string]map[int]bool{}
+		for _, l := range lines {
+			if pages[l.text] == nil {
+				pages[l.text] = map[int]bool{}
+			}
+			pages[l.text][l.page] = true
+		}
+		var kept []exportLine
+		for _, l := range lines {
+			if len(pages[l.text])*2 <= d.pageCount {
+				kept = append(kept, l)
+			}
+		}
+		lines = kept
+	}
+
+	// Body text is the size covering the most characters; larger sizes
+	// are heading levels, largest first.
+	chars := map[float64]int{}
+	for _, l := range lines {
+		chars[roundSize(l.size)] += len([]rune(l.text))
+	}
+	var body float64
+	for size, n := range chars {
+		if n > chars[body] || (n == chars[body] && size < body) {
+			body = size
+		}
+	}
+	var sizes []float64
+	for size := range chars {
+		if body > 0 && size >= body*o.MinRatio {
+			sizes = append(sizes, size)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sizes)))
+	levels := map[float64]int{}
+	for i, size := range sizes {
+		if i < o.MaxLevels {
+			levels[size] = i + 1
+		}
+	}
+
+	var blocks []exportBlock
+	for i := range lines {
+		l := &lines[i]
+		if level, ok := d.bookmarks[bookmarkKey(l.page, l.text)]; ok {
+			l.heading = level
+		} else if isHeadingText(l.text, o.MaxLength) {
+			l.heading = levels[roundSize(l.size)]
+		}
+
+		var prev *exportBlock
+		if n := len(blocks); n > 0 && blocks[n-1].page == l.page {
+			prev = &blocks[n-1]
+		}
+		continues := prev != nil && l.y0-prev.last.y1 <= prev.last.size*0.8 && roundSize(l.size) == roundSize(prev.last.size)
+
+		switch {
+		case l.heading > 0:
+			if continues && prev.kind == blockHeading && prev.level == l.heading {
+				prev.spans = appendLineSpans(prev.spans, l, 0)
+				prev.last = l
+				continue
+			}
+			blocks = append(blocks, exportBlock{kind: blockHeading, page: l.page, y: l.y0, level: l.heading, spans: appendLineSpans(nil, l, 0), last: l})
+		case listItemMarker(l) > 0:
+			skip := listItemMarker(l)
+			b := exportBlock{kind: blockListItem, page: l.page, y: l.y0, ordered: listMarker.MatchString(l.words[0].Text), last: l}
+			b.indent = l.x0 + l.size/2
+			if skip == len([]rune(l.words[0].Text)) {
+				b.indent = l.words[1].X0 - 1
+			}
+			b.spans = appendLineSpans(nil, l, skip)
+			blocks = append(blocks, b)
+		case continues && (prev.kind == blockParagraph || (prev.kind == blockListItem && l.x0 >= prev.indent)):
+			prev.spans = appendLineSpans(prev.spans, l, 0)
+			prev.last = l
+		default:
+			blocks = append(blocks, exportBlock{kind: blockParagraph, page: l.page, y: l.y0, spans: appendLineSpans(nil, l, 0), last: l})
+		}
+	}
+
+	for i := range blocks {
+		blocks[i].spans = unlinkPunctuation(blocks[i].spans)
+	}
+	blocks = append(blocks, d.others...)
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].page != blocks[j].page {
+			return blocks[i].page < blocks[j].page
+		}
+		return blocks[i].y < blocks[j].y
+	})
+	return blocks
+}
+
+// listItemMarker returns how many leading characters of a line's first
+// word form a list marker, or 0 when the line does not start a list
+// item. A marker must be followed by text.
+func listItemMarker(l *exportLine) int {
+	if len(l.words) == 0 {
+		return 0
+	}
+	first := l.words[0].Text
+	r := []rune(first)
+	switch {
+	case len(l.words) > 1 && (listMarker.MatchString(first) || (len(r) == 1 && strings.ContainsRune(bullets, r[0]))):
+		return len(r)
+	case len(r) > 1 && strings.ContainsRune(bullets, r[0]) && r[0] != '-' && r[0] != '*' && unicode.IsLetter(r[1]):
+		return 1
+	}
+	return 0
+}
+
+// appendLineSpans adds the words of a line to spans, skipping the first
+// skip characters. A word hyphenated across lines is joined again.
+func appendLineSpans(spans []exportSpan, l *exportLine, skip int) []exportSpan {
+	for i, w := range l.words {
+		text := w.Text
+		if i == 0 && skip > 0 {
+			text = strings.TrimSpace(string([]rune(text)[skip:]))
+			if text == "" {
+				continue
+			}
+		}
+		if n := len(spans); n > 0 {
+			prev := &spans[n-1]
+			switch {
+			case i == 0 && strings.HasSuffix(prev.text, "-") && len(prev.text) > 1 && unicode.IsLower([]rune(text)[0]):
+				prev.text = strings.TrimSuffix(prev.text, "-")
+			default:
+				text = " " + text
+			}
+			if prev.href == l.links[i] {
+				prev.text += text
+				continue
+			}
+			if prev.href == "" && strings.HasPrefix(text, " ") {
+				prev.text += " "
+				text = text[1:]
+			}
+		}
+		spans = append(spans, exportSpan{text: text, href: l.links[i]})
+	}
+	return spans
+}
+
+// unlinkPunctuation moves sentence punctuation at the end of links out of
+// them, as link areas are matched to whole words.
+func unlinkPunctuation(spans []exportSpan) []exportSpan {
+	var out []exportSpan
+	for _, s := range spans {
+		text := strings.TrimRight(s.text, ".,;:!?")
+		if s.href == "" || text == s.text || text == "" {
+			out = append(out, s)
+			continue
+		}
+		out = append(out, exportSpan{text: text, href: s.href}, exportSpan{text: s.text[len(text):]})
+	}
+	return out
+}
+
+// html writes the blocks as an HTML5 document.
+func (d *exportDocument) html(title string, blocks []exportBlock) []byte {
+	var b bytes.Buffer
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n</head>\n<body>\n", html.EscapeString(title))
+
+	inline := func(spans []exportSpan) string {
+		var sb strings.Builder
+		for _, s := range spans {
+			if s.href != "" {
+				fmt.Fprintf(&sb, `<a href="%s">%s</a>`, html.EscapeString(s.href), html.EscapeString(s.text))
+			} else {
+				sb.WriteString(html.EscapeString(s.text))
+			}
+		}
+		return sb.String()
+	}
+
+	page := 0
+	for i, blk := range blocks {
+		for ; page < blk.page; page++ {
+			if d.anchors[page+1] {
+				fmt.Fprintf(&b, "<a id=\"page-%d\"></a>\n", page+1)
+			}
+		}
+		switch blk.kind {
+		case blockHeading:
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", blk.level, inline(blk.spans), blk.level)
+		case blockParagraph:
+			fmt.Fprintf(&b, "<p>%s</p>\n", inline(blk.spans))
+		case blockListItem:
+			tag := "ul"
+			if blk.ordered {
+				tag = "ol"
+			}
+			if i == 0 || blocks[i-1].kind != blockListItem || blocks[i-1].ordered != blk.ordered {
+				fmt.Fprintf(&b, "<%s>\n", tag)
+			}
+			fmt.Fprintf(&b, "<li>%s</li>\n", inline(blk.spans))
+			if i == len(blocks)-1 || blocks[i+1].kind != blockListItem || blocks[i+1].ordered != blk.ordered {
+				fmt.Fprintf(&b, "</%s>\n", tag)
+			}
+		case blockTable:
+			b.WriteString("<table>\n")
+			row := -1
+			for _, c := range blk.table.Cells {
+				if c.Row != row {
+					if row >= 0 {
+						b.WriteString("</tr>\n")
+					}
+					b.WriteString("<tr>")
+					row = c.Row
+				}
+				b.WriteString("<td")
+				if c.RowSpan > 1 {
+					fmt.Fprintf(&b, ` rowspan="%d"`, c.RowSpan)
+				}
+				if c.ColSpan > 1 {
+					fmt.Fprintf(&b, ` colspan="%d"`, c.ColSpan)
+				}
+				fmt.Fprintf(&b, ">%s</td>", strings.ReplaceAll(html.EscapeString(c.Text), "\n", "<br>"))
+			}
+			if row >= 0 {
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</table>\n")
+		case blockImage:
+			fmt.Fprintf(&b, "<figure><img src=\"%s\" alt=\"\"></figure>\n", html.EscapeString(blk.src))
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.Bytes()
+}
+
+// markdownEscaper escapes the characters Markdown would read as markup.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, "#", `\#`, "|", `\|`, ">", `\>`,
+)
+
+// markdown writes the blocks as CommonMark with GitHub pipe tables.
+// Table cells spanning several positions are written once, leaving the
+// others empty.
+func (d *exportDocument) markdown(blocks []exportBlock) []byte {
+	var b bytes.Buffer
+	inline := func(spans []exportSpan) string {
+		var sb strings.Builder
+		for _, s := range spans {
+			if s.href != "" {
+				fmt.Fprintf(&sb, "[%s](<%s>)", markdownEscaper.Replace(s.text), strings.ReplaceAll(s.href, ">", "%3E"))
+			} else {
+				sb.WriteString(markdownEscaper.Replace(s.text))
+			}
+		}
+		return strings.TrimLeftFunc(sb.String(), unicode.IsSpace)
+	}
+
+	page, number := 0, 0
+	for i, blk := range blocks {
+		for ; page < blk.page; page++ {
+			if d.anchors[page+1] {
+				fmt.Fprintf(&b, "<a id=\"page-%d\"></a>\n\n", page+1)
+			}
+		}
+		switch blk.kind {
+		case blockHeading:
+			fmt.Fprintf(&b, "%s %s\n\n", strings.Repeat("#", blk.level), inline(blk.spans))
+		case blockParagraph:
+			text := inline(blk.spans)
+			// Keep a paragraph that only looks like a list item one.
+			if first, _, _ := strings.Cut(text, " "); listMarker.MatchString(first) {
+				text = first[:len(first)-1] + `\` + text[len(first)-1:]
+			} else if strings.HasPrefix(text, "- ") || strings.HasPrefix(text, "+ ") {
+				text = `\` + text
+			}
+			fmt.Fprintf(&b, "%s\n\n", text)
+		case blockListItem:
+			if i > 0 && blocks[i-1].kind == blockListItem && blocks[i-1].ordered == blk.ordered {
+				number++
+			} else {
+				number = 1
+			}
+			if blk.ordered {
+				fmt.Fprintf(&b, "%d. %s\n", number, inline(blk.spans))
+			} else {
+				fmt.Fprintf(&b, "- %s\n", inline(blk.spans))
+			}
+			if i == len(blocks)-1 || blocks[i+1].kind != blockListItem || blocks[i+1].ordered != blk.ordered {
+				b.WriteString("\n")
+			}
+		case blockTable:
+			for r, row := range blk.table.Grid() {
+				cells := make([]string, len(row))
+				for c, text := range row {
+					cells[c] = strings.ReplaceAll(markdownEscaper.Replace(text), "\n", "<br>")
+				}
+				fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+				if r == 0 {
+					fmt.Fprintf(&b, "|%s\n", strings.Repeat(" --- |", len(row)))
+				}
+			}
+			b.WriteString("\n")
+		case blockImage:
+			fmt.Fprintf(&b, "![](<%s>)\n\n", blk.src)
+		}
+	}
+	return b.Bytes()
+}
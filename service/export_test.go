@@ -0,0 +1,143 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// manualPDF returns a two page manual with headings, a hyphenated
+// paragraph, lists, links, a logo and a ruled table. The second page's
+// heading is set in body text and only known from its bookmark.
+func manualPDF(t *testing.T) []byte {
+	t.Helper()
+	logo := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0x80
+	}
+	logo.Set(0, 0, color.Black)
+	var logoPNG bytes.Buffer
+	if err := png.Encode(&logoPNG, logo); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	pdf.SetTitle("Widget Manual", true)
+	reference := pdf.AddLink()
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 24)
+	pdf.Text(50, 80, "Widget Manual")
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("logo", opts, &logoPNG)
+	pdf.ImageOptions("logo", 50, 95, 40, 20, false, opts, 0, "")
+
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.Text(50, 140, "The widget needs a short instal-")
+	pdf.Text(50, 153, "lation before first use & care.")
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.Text(50, 190, "Getting started")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.Text(50, 215, "\x95")
+	pdf.Text(62, 215, "Unpack the widget and")
+	pdf.Text(62, 228, "remove the film")
+	pdf.Text(50, 241, "\x95")
+	pdf.Text(62, 241, "Plug it in")
+	pdf.Text(50, 265, "1.")
+	pdf.Text(62, 265, "Press start")
+	pdf.Text(50, 278, "2.")
+	pdf.Text(62, 278, "Wait for the light")
+
+	pdf.Text(50, 305, "Read the")
+	x := 50 + pdf.GetStringWidth("Read the ")
+	pdf.Text(x, 305, "online help")
+	pdf.LinkString(x, 295, pdf.GetStringWidth("online help"), 12, "https://example.com/help")
+	pdf.Text(50, 318, "or see the reference.")
+	pdf.Link(50+pdf.GetStringWidth("or see the "), 308, pdf.GetStringWidth("reference"), 12, reference)
+
+	for i, row := range [][]string{{"Part", "Count"}, {"Screw", "4"}} {
+		for j, text := range row {
+			pdf.SetXY(50+float64(j)*100, 350+float64(i)*20)
+			pdf.CellFormat(100, 20, text, "1", 0, "L", false, 0, "")
+		}
+	}
+
+	pdf.AddPage()
+	pdf.SetLink(reference, 0, -1)
+	pdf.Bookmark("Reference", 0, 80)
+	pdf.Text(50, 80, "Reference")
+	pdf.Text(50, 110, "Specifications follow.")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportService_ToHTML(t *testing.T) {
+	exportService := service.NewExportService(getTestLogger())
+	result, err := exportService.ToHTML(t.Context(), manualPDF(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(result.Document)
+	for _, want := range []string{
+		"<title>Widget Manual</title>",
+		"<h1>Widget Manual</h1>\n<figure><img src=\"images/image-1.png\" alt=\"\"></figure>",
+		"<p>The widget needs a short installation before first use &amp; care.</p>",
+		"<h2>Getting started</h2>",
+		"<ul>\n<li>Unpack the widget and remove the film</li>\n<li>Plug it in</li>\n</ul>",
+		"<ol>\n<li>Press start</li>\n<li>Wait for the light</li>\n</ol>",
+		`<p>Read the <a href="https://example.com/help">online help</a> or see the <a href="#page-2">reference</a>.</p>`,
+		"<table>\n<tr><td>Part</td><td>Count</td></tr>\n<tr><td>Screw</td><td>4</td></tr>\n</table>",
+		"<a id=\"page-2\"></a>\n<h1>Reference</h1>\n<p>Specifications follow.</p>",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("document lacks %q", want)
+		}
+	}
+	if len(result.Images) != 1 || !bytes.HasPrefix(result.Images["images/image-1.png"], []byte("\x89PNG")) {
+		t.Errorf("images = %d", len(result.Images))
+	}
+
+	single, err := exportService.ToHTML(t.Context(), manualPDF(t), &service.ExportOptions{SingleFile: true, Pages: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.Images) != 0 || !bytes.Contains(single.Document, []byte(`<img src="data:image/png;base64,`)) {
+		t.Errorf("single file export has %d image files", len(single.Images))
+	}
+	if bytes.Contains(single.Document, []byte("Reference")) {
+		t.Error("page selection ignored")
+	}
+}
+
+func TestExportService_ToMarkdown(t *testing.T) {
+	result, err := service.NewExportService(getTestLogger()).ToMarkdown(t.Context(), manualPDF(t), &service.ExportOptions{ImagePrefix: "manual-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(result.Document)
+	for _, want := range []string{
+		"# Widget Manual\n\n![](<manual-image-1.png>)\n\n",
+		"The widget needs a short installation before first use & care.\n\n",
+		"## Getting started\n\n- Unpack the widget and remove the film\n- Plug it in\n\n1. Press start\n2. Wait for the light\n\n",
+		"Read the [online help](<https://example.com/help>) or see the [reference](<#page-2>).\n\n",
+		"| Part | Count |\n| --- | --- |\n| Screw | 4 |\n\n",
+		"<a id=\"page-2\"></a>\n\n# Reference\n\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("document lacks %q", want)
+		}
+	}
+	if _, ok := result.Images["manual-image-1.png"]; !ok {
+		t.Errorf("images = %v", result.Images)
+	}
+}
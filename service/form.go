@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -25,6 +26,13 @@ func NewFormService(log logger.ILogger) FormService {
 }
 
 func (s *formService) FillForm(input []byte, data map[string]interface{}) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "FormService.FillForm", AttrInputBytes.Int(len(input)))
+	output, err := s.fillForm(ctx, input, data)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *formService) fillForm(ctx context.Context, input []byte, data map[string]interface{}) ([]byte, error) {
 	s.log.Info("FormService.FillForm called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-form-*")
@@ -34,7 +42,7 @@ func (s *formService) FillForm(input []byte, data map[string]interface{}) ([]byt
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
@@ -43,17 +51,19 @@ func (s *formService) FillForm(input []byte, data map[string]interface{}) ([]byt
 	if err != nil {
 		return nil, err
 	}
-	if err := os.WriteFile(jsonPath, jsonData, 0644); err != nil {
+	if err := writeFile(ctx, jsonPath, jsonData); err != nil {
 		return nil, err
 	}
 
 	outputPath := filepath.Join(tmpDir, "output.pdf")
 
-	if err := api.FillFormFile(inputPath, jsonPath, outputPath, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.FillFormFile", func() error {
+		return api.FillFormFile(inputPath, jsonPath, outputPath, nil)
+	}); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +80,13 @@ func (s *formService) ListFormFields(input []byte) ([]string, error) {
 }
 
 func (s *formService) RemoveFormFields(input []byte) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "FormService.RemoveFormFields", AttrInputBytes.Int(len(input)))
+	output, err := s.removeFormFields(ctx, input)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *formService) removeFormFields(ctx context.Context, input []byte) ([]byte, error) {
 	s.log.Info("FormService.RemoveFormFields called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-remove-form-*")
@@ -79,15 +96,17 @@ func (s *formService) RemoveFormFields(input []byte) ([]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
-	if err := api.OptimizeFile(inputPath, "", nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.OptimizeFile", func() error {
+		return api.OptimizeFile(inputPath, "", nil)
+	}); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(inputPath)
+	output, err := readFile(ctx, inputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// DefaultImageQuality is the JPEG quality used when converting images.
+const DefaultImageQuality = 90
+
+// ImageExtractOptions controls ExtractImagesWithOptions.
+type ImageExtractOptions struct {
+	// Pages limits extraction to a page selection such as "1-5,8".
+	Pages string `json:"pages,omitempty"`
+	// MinWidth and MinHeight skip images smaller than this many pixels,
+	// such as spacers and rules.
+	MinWidth  int `json:"min_width,omitempty"`
+	MinHeight int `json:"min_height,omitempty"`
+	// KeepDuplicates returns an image again for every page it is used
+	// on. By default it is returned once, for the first of its pages.
+	KeepDuplicates bool `json:"keep_duplicates,omitempty"`
+	// Format converts every image to "png" or "jpeg". Empty keeps each
+	// image in the format it is stored in. JPEG 2000 images cannot be
+	// decoded and are always kept as they are.
+	Format string `json:"format,omitempty"`
+	// Quality is the JPEG quality (1-100) for conversions to "jpeg".
+	// Zero uses DefaultImageQuality.
+	Quality int `json:"quality,omitempty"`
+}
+
+func (o *ImageExtractOptions) withDefaults() (ImageExtractOptions, error) {
+	opts := ImageExtractOptions{}
+	if o != nil {
+		opts = *o
+	}
+	switch opts.Format = strings.ToLower(opts.Format); opts.Format {
+	case "", "png", "jpeg":
+	case "jpg":
+		opts.Format = "jpeg"
+	default:
+		return opts, fmt.Errorf("unsupported image format %q", o.Format)
+	}
+	if opts.Quality == 0 {
+		opts.Quality = DefaultImageQuality
+	}
+	if opts.Quality < 1 || opts.Quality > 100 {
+		return opts, fmt.Errorf("quality must be between 1 and 100, got %d", opts.Quality)
+	}
+	if opts.MinWidth < 0 || opts.MinHeight < 0 {
+		return opts, fmt.Errorf("minimum size must not be negative, got %dx%d", opts.MinWidth, opts.MinHeight)
+	}
+	return opts, nil
+}
+
+// ExtractedImage is an image embedded in a PDF, with the properties of
+// the image as stored.
+type ExtractedImage struct {
+	// Page is the first page showing the image and Index its position,
+	// in drawing order, among the images returned for that page, from 1.
+	Page  int `json:"page"`
+	Index int `json:"index"`
+	// Pages lists every page showing the image when duplicates are
+	// merged, and just Page otherwise.
+	Pages []int `json:"pages"`
+	// Name is the image's resource name on the page, such as "Im1".
+	Name             string `json:"name"`
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+	BitsPerComponent int    `json:"bits_per_component"`
+	// ColorSpace is the colour space family, such as "DeviceRGB",
+	// "ICCBased" or "Indexed".
+	ColorSpace string `json:"color_space,omitempty"`
+	// Filter is the filter pipeline the image is stored with, such as
+	// "DCTDecode" or "FlateDecode".
+	Filter string `json:"filter,omitempty"`
+	// Format is the format of Data: "png", "jpeg", "tiff" or "jpx".
+	Format string `json:"format"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// pdfcpuImageFormats maps the file types pdfcpu renders images to onto
+// format names.
+var pdfcpuImageFormats = map[string]string{"png": "png", "jpg": "jpeg", "tif": "tiff", "jpx": "jpx"}
+
+func (s *imageExtractService) ExtractImagesWithOptions(ctx context.Context, input []byte, opts *ImageExtractOptions) ([]ExtractedImage, error) {
+	ctx, span := startSpan(ctx, "ImageExtractService.ExtractImagesWithOptions", AttrInputBytes.Int(len(input)))
+	images, err := s.extractImagesWithOptions(ctx, input, opts)
+	endSpan(span, err, attribute.Int("pdf.image_count", len(images)))
+	return images, err
+}
+
+func (s *imageExtractService) extractImagesWithOptions(ctx context.Context, input []byte, opts *ImageExtractOptions) ([]ExtractedImage, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("ImageExtractService.ExtractImagesWithOptions called", logger.String("pages", o.Pages), logger.String("format", o.Format))
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, o.Pages)
+	if err != nil {
+		return nil, err
+	}
+	masks := imageMasks(pdfCtx)
+	fonts := map[int]*pdfFont{}
+
+	var images []ExtractedImage
+	seen := map[int]int{}
+	seenData := map[[sha256.Size]byte]int{}
+	skipped := 0
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		objNrs := pdfcpu.ImageObjNrs(pdfCtx, p)
+		drawOrder(pdfCtx, p, fonts, objNrs)
+		index := 0
+		for _, objNr := range objNrs {
+			if masks[objNr] {
+				continue
+			}
+			if i, ok := seen[objNr]; ok && !o.KeepDuplicates {
+				images[i].addPage(p)
+				continue
+			}
+			obj := pdfCtx.Optimize.ImageObjects[objNr]
+			img := imageProperties(pdfCtx, obj.ImageDict)
+			if img.Width < o.MinWidth || img.Height < o.MinHeight {
+				skipped++
+				continue
+			}
+
+			var data []byte
+			if err := traceStep(ctx, "pdfcpu.ExtractImage", func() error {
+				extracted, err := pdfcpu.ExtractImage(pdfCtx, obj.ImageDict, false, obj.ResourceNames[p-1], objNr, false)
+				if err != nil || extracted == nil || extracted.Reader == nil {
+					return err
+				}
+				img.Format = pdfcpuImageFormats[extracted.FileType]
+				data, err = io.ReadAll(extracted)
+				return err
+			}); err != nil {
+				return nil, fmt.Errorf("page %d: image %d: %w", p, objNr, err)
+			}
+			if data == nil {
+				s.log.Warn("Image skipped, filter not supported", logger.Int("page", p), logger.String("filter", img.Filter))
+				continue
+			}
+			sum := sha256.Sum256(data)
+			if i, ok := seenData[sum]; ok && !o.KeepDuplicates {
+				images[i].addPage(p)
+				seen[objNr] = i
+				continue
+			}
+
+			img.Page, img.Pages, img.Name, img.Data = p, []int{p}, obj.ResourceNames[p-1], data
+			if o.Format != "" && o.Format != img.Format {
+				if err := convertImage(&img, o.Format, o.Quality); err != nil {
+					s.log.Warn("Image kept in its stored format", logger.Int("page", p), logger.String("format", img.Format), logger.Error(err))
+				}
+			}
+			index++
+			img.Index = index
+			seen[objNr], seenData[sum] = len(images), len(images)
+			images = append(images, img)
+		}
+	}
+
+	s.log.Info("Images extracted", logger.Int("count", len(images)), logger.Int("skipped", skipped))
+	return images, nil
+}
+
+// addPage records that the image is shown on page p as well.
+func (img *ExtractedImage) addPage(p int) {
+	if img.Pages[len(img.Pages)-1] != p {
+		img.Pages = append(img.Pages, p)
+	}
+}
+
+// drawOrder sorts the image objects of a page by where they are first
+// drawn. Images not found in the page content follow in object order.
+func drawOrder(pdfCtx *model.Context, page int, fonts map[int]*pdfFont, objNrs []int) {
+	first := map[int]int{}
+	if _, _, draws, err := pageLayout(pdfCtx, page, fonts); err == nil {
+		for i, d := range draws {
+			if _, ok := first[d.ObjNr]; !ok {
+				first[d.ObjNr] = i
+			}
+		}
+	}
+	sort.Slice(objNrs, func(i, j int) bool {
+		a, aok := first[objNrs[i]]
+		b, bok := first[objNrs[j]]
+		if aok != bok {
+			return aok
+		}
+		if a != b {
+			return a < b
+		}
+		return objNrs[i] < objNrs[j]
+	})
+}
+
+// imageMasks returns the object numbers of images only used as the soft
+// or stencil mask of another image. They are not extracted on their own.
+func imageMasks(pdfCtx *model.Context) map[int]bool {
+	masks := map[int]bool{}
+	for _, obj := range pdfCtx.Optimize.ImageObjects {
+		for _, key := range []string{"SMask", "Mask"} {
+			if ref, ok := obj.ImageDict.Dict[key].(types.IndirectRef); ok {
+				masks[ref.ObjectNumber.Value()] = true
+			}
+		}
+	}
+	return masks
+}
+
+// imageProperties reads an image's size, colour space and filters from
+// its dictionary.
+func imageProperties(pdfCtx *model.Context, sd *types.StreamDict) ExtractedImage {
+	intEntry := func(key string) int {
+		o, _ := pdfCtx.DereferenceDictEntry(sd.Dict, key)
+		if i, ok := o.(types.Integer); ok {
+			return i.Value()
+		}
+		return 0
+	}
+	img := ExtractedImage{Width: intEntry("Width"), Height: intEntry("Height"), BitsPerComponent: intEntry("BitsPerComponent")}
+
+	cs, _ := pdfCtx.DereferenceDictEntry(sd.Dict, "ColorSpace")
+	if a, ok := cs.(types.Array); ok && len(a) > 0 {
+		cs = a[0]
+	}
+	if name, ok := cs.(types.Name); ok {
+		img.ColorSpace = name.Value()
+	}
+	if mask := sd.BooleanEntry("ImageMask"); mask != nil && *mask {
+		img.BitsPerComponent = 1
+	}
+
+	filters := make([]string, len(sd.FilterPipeline))
+	for i, f := range sd.FilterPipeline {
+		filters[i] = f.Name
+	}
+	img.Filter = strings.Join(filters, ",")
+	return img
+}
+
+// convertImage re-encodes img's data as a PNG or JPEG file.
+func convertImage(img *ExtractedImage, format string, quality int) error {
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, decoded)
+	}
+	if err != nil {
+		return err
+	}
+	img.Data, img.Format = buf.Bytes(), format
+	return nil
+}
@@ -0,0 +1,143 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// cataloguePDF returns two pages showing the same product photo, with a
+// spacer pixel and a JPEG photo on the first page and a logo with an
+// alpha channel on the second.
+func cataloguePDF(t *testing.T) []byte {
+	t.Helper()
+	encode := func(img image.Image, jpg bool) *bytes.Buffer {
+		var buf bytes.Buffer
+		var err error
+		if jpg {
+			err = jpeg.Encode(&buf, img, nil)
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+	fill := func(img interface {
+		image.Image
+		Set(x, y int, c color.Color)
+	}, c func(x, y int) color.Color) {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				img.Set(x, y, c(x, y))
+			}
+		}
+	}
+	photo := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	fill(photo, func(x, y int) color.Color { return color.RGBA{uint8(x * 6), uint8(y * 8), 90, 255} })
+	shot := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	fill(shot, func(x, y int) color.Color { return color.RGBA{200, uint8(x * 8), uint8(y * 10), 255} })
+	logo := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	fill(logo, func(x, y int) color.Color { return color.NRGBA{0, 0, 255, uint8(x * 16)} })
+
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	register := func(name, typ string, buf *bytes.Buffer) {
+		pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: typ}, buf)
+	}
+	register("photo", "PNG", encode(photo, false))
+	register("spacer", "PNG", encode(image.NewGray(image.Rect(0, 0, 1, 1)), false))
+	register("shot", "JPG", encode(shot, true))
+	register("logo", "PNG", encode(logo, false))
+	draw := func(name string, x float64) {
+		pdf.ImageOptions(name, x, 100, 80, 60, false, gofpdf.ImageOptions{}, 0, "")
+	}
+
+	pdf.AddPage()
+	draw("photo", 50)
+	draw("spacer", 150)
+	draw("shot", 250)
+	pdf.AddPage()
+	draw("photo", 50)
+	draw("logo", 150)
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageExtractService_ExtractImagesWithOptions(t *testing.T) {
+	imageService := service.NewImageExtractService(getTestLogger())
+	input := cataloguePDF(t)
+
+	images, err := imageService.ExtractImagesWithOptions(t.Context(), input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		Page, Index   int
+		Pages         []int
+		Width, Height int
+		Bits          int
+		ColorSpace    string
+		Filter        string
+		Format        string
+	}
+	var got []summary
+	for _, img := range images {
+		got = append(got, summary{img.Page, img.Index, img.Pages, img.Width, img.Height, img.BitsPerComponent, img.ColorSpace, img.Filter, img.Format})
+		if img.Name == "" || len(img.Data) == 0 {
+			t.Errorf("image %d on page %d has no name or data", img.Index, img.Page)
+		}
+	}
+	want := []summary{
+		{1, 1, []int{1, 2}, 40, 30, 8, "DeviceRGB", "FlateDecode", "png"},
+		{1, 2, []int{1}, 1, 1, 8, "DeviceGray", "FlateDecode", "png"},
+		{1, 3, []int{1}, 32, 24, 8, "DeviceRGB", "DCTDecode", "jpeg"},
+		{2, 1, []int{2}, 16, 16, 8, "DeviceRGB", "FlateDecode", "png"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("images =\n%+v\nwant\n%+v", got, want)
+	}
+
+	images, err = imageService.ExtractImagesWithOptions(t.Context(), input, &service.ImageExtractOptions{MinWidth: 10, MinHeight: 10, KeepDuplicates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []int
+	for _, img := range images {
+		pages = append(pages, img.Page)
+	}
+	if !reflect.DeepEqual(pages, []int{1, 1, 2, 2}) {
+		t.Errorf("pages with duplicates and no spacer = %v", pages)
+	}
+
+	images, err = imageService.ExtractImagesWithOptions(t.Context(), input, &service.ImageExtractOptions{Pages: "2", Format: "jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("found %d images on page 2", len(images))
+	}
+	for _, img := range images {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+		if err != nil || format != "jpeg" || img.Format != "jpeg" || cfg.Width != img.Width || cfg.Height != img.Height {
+			t.Errorf("converted image %d: %s %dx%d, %v", img.Index, format, cfg.Width, cfg.Height, err)
+		}
+	}
+
+	if _, err := imageService.ExtractImagesWithOptions(t.Context(), input, &service.ImageExtractOptions{Format: "gif"}); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
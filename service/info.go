@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"io"
 	"os"
 
@@ -46,17 +47,27 @@ func (s *infoService) GetInfo(input io.Reader) (*PDFInfo, error) {
 }
 
 func (s *infoService) GetInfoFile(inputPath string) (*PDFInfo, error) {
+	ctx, span := startSpan(context.Background(), "InfoService.GetInfoFile")
+	info, err := s.getInfoFile(ctx, inputPath)
+	if info != nil {
+		span.SetAttributes(AttrPageCount.Int(info.PageCount))
+	}
+	endSpan(span, err)
+	return info, err
+}
+
+func (s *infoService) getInfoFile(ctx context.Context, inputPath string) (*PDFInfo, error) {
 	s.log.Info("InfoService.GetInfoFile called", logger.String("input", inputPath))
 
-	ctx, err := api.ReadContextFile(inputPath)
+	pdfCtx, err := readContextFile(ctx, inputPath)
 	if err != nil {
 		return nil, err
 	}
 
 	info := &PDFInfo{
-		PageCount: ctx.PageCount,
-		Version:   ctx.HeaderVersion.String(),
-		Encrypted: ctx.Encrypt != nil,
+		PageCount: pdfCtx.PageCount,
+		Version:   pdfCtx.HeaderVersion.String(),
+		Encrypted: pdfCtx.Encrypt != nil,
 		IsValid:   true,
 	}
 
@@ -69,6 +80,16 @@ func (s *infoService) GetInfoFile(inputPath string) (*PDFInfo, error) {
 }
 
 func (s *infoService) GetInfoBytes(input []byte) (*PDFInfo, error) {
+	ctx, span := startSpan(context.Background(), "InfoService.GetInfoBytes", AttrInputBytes.Int(len(input)))
+	info, err := s.getInfoBytes(ctx, input)
+	if info != nil {
+		span.SetAttributes(AttrPageCount.Int(info.PageCount))
+	}
+	endSpan(span, err)
+	return info, err
+}
+
+func (s *infoService) getInfoBytes(ctx context.Context, input []byte) (*PDFInfo, error) {
 	s.log.Info("InfoService.GetInfoBytes called")
 
 	tmpFile, err := os.CreateTemp("", "pdf-info-*.pdf")
@@ -77,13 +98,11 @@ func (s *infoService) GetInfoBytes(input []byte) (*PDFInfo, error) {
 	}
 	defer os.Remove(tmpFile.Name())
 
-	if _, err := tmpFile.Write(input); err != nil {
-		tmpFile.Close()
+	if err := writeTemp(ctx, tmpFile, input); err != nil {
 		return nil, err
 	}
-	tmpFile.Close()
 
-	info, err := s.GetInfoFile(tmpFile.Name())
+	info, err := s.getInfoFile(ctx, tmpFile.Name())
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +123,13 @@ func (s *infoService) GetPageCount(input []byte) (int, error) {
 }
 
 func (s *infoService) ValidatePDF(input []byte) error {
+	ctx, span := startSpan(context.Background(), "InfoService.ValidatePDF", AttrInputBytes.Int(len(input)))
+	err := s.validatePDF(ctx, input)
+	endSpan(span, err)
+	return err
+}
+
+func (s *infoService) validatePDF(ctx context.Context, input []byte) error {
 	s.log.Info("InfoService.ValidatePDF called")
 
 	tmpFile, err := os.CreateTemp("", "pdf-validate-*.pdf")
@@ -112,13 +138,13 @@ func (s *infoService) ValidatePDF(input []byte) error {
 	}
 	defer os.Remove(tmpFile.Name())
 
-	if _, err := tmpFile.Write(input); err != nil {
-		tmpFile.Close()
+	if err := writeTemp(ctx, tmpFile, input); err != nil {
 		return err
 	}
-	tmpFile.Close()
 
-	return api.ValidateFile(tmpFile.Name(), nil)
+	return traceStep(ctx, "pdfcpu.ValidateFile", func() error {
+		return api.ValidateFile(tmpFile.Name(), nil)
+	})
 }
 
 func (s *infoService) IsEncrypted(input []byte) (bool, error) {
@@ -1,7 +1,7 @@
 package service
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,6 +9,7 @@ import (
 	"sort"
 
 	"github.com/jung-kurt/gofpdf"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
 )
@@ -58,6 +59,13 @@ func (s *jpgToPDFService) ConvertMultiple(inputs []io.Reader, filenames []string
 }
 
 func (s *jpgToPDFService) ConvertFiles(inputPaths []string, outputPath string) error {
+	ctx, span := startSpan(context.Background(), "JPGToPDFService.ConvertFiles", attribute.Int("pdf.image_count", len(inputPaths)))
+	err := s.convertFiles(ctx, inputPaths, outputPath)
+	endSpan(span, err)
+	return err
+}
+
+func (s *jpgToPDFService) convertFiles(ctx context.Context, inputPaths []string, outputPath string) error {
 	s.log.Info("JPGToPDFService.ConvertFiles called", logger.Int("count", len(inputPaths)))
 
 	sort.Strings(inputPaths)
@@ -80,7 +88,9 @@ func (s *jpgToPDFService) ConvertFiles(inputPaths []string, outputPath string) e
 		pdf.ImageOptions(imgPath, 0, 0, pageW, pageH, false, gofpdf.ImageOptions{ImageType: imgType}, 0, "")
 	}
 
-	if err := pdf.OutputFileAndClose(outputPath); err != nil {
+	if err := traceStep(ctx, "gofpdf.OutputFileAndClose", func() error {
+		return pdf.OutputFileAndClose(outputPath)
+	}, AttrPageCount.Int(len(inputPaths))); err != nil {
 		s.log.Error("Failed to create PDF", logger.Error(err))
 		return err
 	}
@@ -94,6 +104,17 @@ func (s *jpgToPDFService) ConvertBytes(input []byte, filename string) ([]byte, e
 }
 
 func (s *jpgToPDFService) ConvertMultipleBytes(inputs [][]byte, filenames []string) ([]byte, error) {
+	inputSize := 0
+	for _, data := range inputs {
+		inputSize += len(data)
+	}
+	ctx, span := startSpan(context.Background(), "JPGToPDFService.ConvertMultipleBytes", AttrInputBytes.Int(inputSize), attribute.Int("pdf.image_count", len(inputs)))
+	output, err := s.convertMultipleBytes(ctx, inputs, filenames)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *jpgToPDFService) convertMultipleBytes(ctx context.Context, inputs [][]byte, filenames []string) ([]byte, error) {
 	s.log.Info("JPGToPDFService.ConvertMultipleBytes called", logger.Int("count", len(inputs)))
 
 	tmpDir, err := os.MkdirTemp("", "jpg-to-pdf-*")
@@ -110,18 +131,18 @@ func (s *jpgToPDFService) ConvertMultipleBytes(inputs [][]byte, filenames []stri
 			filename = filepath.Base(filenames[i])
 		}
 		tmpPath := filepath.Join(tmpDir, filename)
-		if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		if err := writeFile(ctx, tmpPath, data); err != nil {
 			return nil, err
 		}
 		inputPaths = append(inputPaths, tmpPath)
 	}
 
 	outputPath := filepath.Join(tmpDir, "output.pdf")
-	if err := s.ConvertFiles(inputPaths, outputPath); err != nil {
+	if err := s.convertFiles(ctx, inputPaths, outputPath); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -129,13 +150,3 @@ func (s *jpgToPDFService) ConvertMultipleBytes(inputs [][]byte, filenames []stri
 	s.log.Info("Images to PDF conversion completed", logger.Int("outputSize", len(output)))
 	return output, nil
 }
-
-func detectImageType(data []byte) string {
-	if len(data) < 3 {
-		return "JPG"
-	}
-	if bytes.HasPrefix(data, []byte{0x89, 0x50, 0x4E}) {
-		return "PNG"
-	}
-	return "JPG"
-}
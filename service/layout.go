@@ -0,0 +1,836 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// FitPolicy decides how a page is scaled into a target area.
+type FitPolicy string
+
+const (
+	// FitContain scales the page to fit inside the area, keeping all of it.
+	FitContain FitPolicy = "fit"
+	// FitCover scales the page to cover the area, cropping what overflows.
+	FitCover FitPolicy = "fill"
+)
+
+// NUpOptions controls N-up imposition. Sizes are in points.
+type NUpOptions struct {
+	// N is the number of pages per sheet: 2, 4, 6 or 9.
+	N int `json:"n"`
+	// PaperSize is the sheet size, "A4" when empty. A trailing "P" or
+	// "L" forces the orientation; otherwise 2 and 6-up sheets are landscape.
+	PaperSize string  `json:"paper_size,omitempty"`
+	Margin    float64 `json:"margin,omitempty"`
+	// Gutter is the space between neighbouring pages.
+	Gutter float64 `json:"gutter,omitempty"`
+	// Border draws a thin frame around each page.
+	Border bool `json:"border,omitempty"`
+}
+
+// BookletOptions controls saddle-stitch booklet imposition.
+type BookletOptions struct {
+	// PaperSize is the sheet size, "A4" when empty; sheets are landscape
+	// so two A5 pages sit side by side.
+	PaperSize string  `json:"paper_size,omitempty"`
+	Margin    float64 `json:"margin,omitempty"`
+	// Gutter is the space at the fold between the two pages.
+	Gutter float64 `json:"gutter,omitempty"`
+	Border bool    `json:"border,omitempty"`
+}
+
+// ResizeOptions controls scaling pages to a paper size.
+type ResizeOptions struct {
+	// PaperSize names the target such as "A4" or "Letter"; Width and
+	// Height in points are used instead when set.
+	PaperSize string    `json:"paper_size,omitempty"`
+	Width     float64   `json:"width,omitempty"`
+	Height    float64   `json:"height,omitempty"`
+	Policy    FitPolicy `json:"policy,omitempty"`
+	// MatchOrientation turns the target landscape for landscape pages,
+	// so mixed scans keep their orientation.
+	MatchOrientation bool `json:"match_orientation,omitempty"`
+	// Pages is a page selection; all pages when empty.
+	Pages string `json:"pages,omitempty"`
+}
+
+// Margins are page margins in points.
+type Margins struct {
+	Top    float64 `json:"top,omitempty"`
+	Right  float64 `json:"right,omitempty"`
+	Bottom float64 `json:"bottom,omitempty"`
+	Left   float64 `json:"left,omitempty"`
+}
+
+// PageBoxes holds a page's boundary boxes as [llx lly urx ury] in points.
+// When setting, nil boxes are left unchanged.
+type PageBoxes struct {
+	Media *[4]float64 `json:"media,omitempty"`
+	Crop  *[4]float64 `json:"crop,omitempty"`
+	Trim  *[4]float64 `json:"trim,omitempty"`
+	Bleed *[4]float64 `json:"bleed,omitempty"`
+	Art   *[4]float64 `json:"art,omitempty"`
+}
+
+func (s *pageService) NUp(input []byte, opts *NUpOptions) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.NUp", AttrInputBytes.Int(len(input)))
+	output, err := s.nUp(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) nUp(ctx context.Context, input []byte, opts *NUpOptions) ([]byte, error) {
+	if opts == nil {
+		return nil, errors.New("n-up options are required")
+	}
+	s.log.Info("PageService.NUp called", logger.Int("n", opts.N))
+
+	cols, rows, ok := nUpGrid(opts.N)
+	if !ok {
+		return nil, fmt.Errorf("n must be 2, 4, 6 or 9, got %d", opts.N)
+	}
+	width, height, err := sheetSize(opts.PaperSize, cols > rows)
+	if err != nil {
+		return nil, err
+	}
+	cells, err := gridCells(width, height, cols, rows, opts.Margin, opts.Gutter, opts.Gutter)
+	if err != nil {
+		return nil, err
+	}
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheets []sheet
+	for p := 1; p <= pdfCtx.PageCount; p += opts.N {
+		sh := sheet{width: width, height: height}
+		for i := 0; i < opts.N && p+i <= pdfCtx.PageCount; i++ {
+			sh.tiles = append(sh.tiles, sheetTile{page: p + i, cell: cells[i]})
+		}
+		sheets = append(sheets, sh)
+	}
+	if err := imposeSheets(pdfCtx, sheets, opts.Border); err != nil {
+		return nil, err
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("N-up created", logger.Int("sheets", len(sheets)), logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+func (s *pageService) Booklet(input []byte, opts *BookletOptions) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.Booklet", AttrInputBytes.Int(len(input)))
+	output, err := s.booklet(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) booklet(ctx context.Context, input []byte, opts *BookletOptions) ([]byte, error) {
+	s.log.Info("PageService.Booklet called")
+
+	if opts == nil {
+		opts = &BookletOptions{}
+	}
+	width, height, err := sheetSize(opts.PaperSize, true)
+	if err != nil {
+		return nil, err
+	}
+	cells, err := gridCells(width, height, 2, 1, opts.Margin, opts.Gutter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	order := bookletOrder(pdfCtx.PageCount)
+	sheets := make([]sheet, 0, len(order)/2)
+	for i := 0; i < len(order); i += 2 {
+		sh := sheet{width: width, height: height}
+		for j, page := range order[i : i+2] {
+			if page <= pdfCtx.PageCount {
+				sh.tiles = append(sh.tiles, sheetTile{page: page, cell: cells[j]})
+			}
+		}
+		sheets = append(sheets, sh)
+	}
+	if err := imposeSheets(pdfCtx, sheets, opts.Border); err != nil {
+		return nil, err
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Booklet created", logger.Int("sheetSides", len(sheets)), logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+func (s *pageService) ResizePages(input []byte, opts *ResizeOptions) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.ResizePages", AttrInputBytes.Int(len(input)))
+	output, err := s.resizePages(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) resizePages(ctx context.Context, input []byte, opts *ResizeOptions) ([]byte, error) {
+	if opts == nil {
+		return nil, errors.New("resize options are required")
+	}
+	s.log.Info("PageService.ResizePages called", logger.String("paperSize", opts.PaperSize))
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	width, height := opts.Width, opts.Height
+	if width == 0 {
+		var err error
+		if width, height, err = paperSize(opts.PaperSize); err != nil {
+			return nil, err
+		}
+	}
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := selectedPages(pdfCtx, opts.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !pages[p] {
+			continue
+		}
+		if err := resizePage(pdfCtx, p, width, height, opts); err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Pages resized", logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+func (o *ResizeOptions) validate() error {
+	switch o.Policy {
+	case "", FitContain, FitCover:
+	default:
+		return fmt.Errorf("unknown fit policy %q", o.Policy)
+	}
+	if (o.Width != 0 || o.Height != 0) && (o.Width <= 0 || o.Height <= 0) {
+		return errors.New("width and height must both be positive")
+	}
+	if o.Width == 0 && o.PaperSize == "" {
+		return errors.New("paper size or width and height are required")
+	}
+	return nil
+}
+
+func (s *pageService) AddMargins(input []byte, pages string, margins Margins) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.AddMargins", AttrInputBytes.Int(len(input)))
+	output, err := s.addMargins(ctx, input, pages, margins)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) addMargins(ctx context.Context, input []byte, pages string, margins Margins) ([]byte, error) {
+	s.log.Info("PageService.AddMargins called", logger.String("pages", pages))
+
+	if margins.Top < 0 || margins.Right < 0 || margins.Bottom < 0 || margins.Left < 0 {
+		return nil, errors.New("margins must not be negative")
+	}
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		d, _, inh, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			return nil, err
+		}
+		box := visibleBox(inh)
+		// Margins are given as the page is displayed; map them onto the
+		// unrotated sides.
+		display := [4]float64{margins.Top, margins.Right, margins.Bottom, margins.Left}
+		turn := normalizedRotation(inh.Rotate) / 90
+		var side [4]float64
+		for i := range side {
+			side[i] = display[(i+turn)%4]
+		}
+		d["MediaBox"] = floatArray([]float64{box[0] - side[3], box[1] - side[2], box[2] + side[1], box[3] + side[0]})
+		delete(d, "CropBox")
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Margins added", logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+func (s *pageService) GetPageBoxes(input []byte) ([]PageBoxes, error) {
+	ctx, span := startSpan(context.Background(), "PageService.GetPageBoxes", AttrInputBytes.Int(len(input)))
+	boxes, err := s.getPageBoxes(ctx, input)
+	endSpan(span, err, AttrPageCount.Int(len(boxes)))
+	return boxes, err
+}
+
+func (s *pageService) getPageBoxes(ctx context.Context, input []byte) ([]PageBoxes, error) {
+	s.log.Info("PageService.GetPageBoxes called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	boxes := make([]PageBoxes, pdfCtx.PageCount)
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		d, _, inh, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			return nil, err
+		}
+		media := rectangleBox(inh.MediaBox)
+		crop := visibleBox(inh)
+		// Trim, bleed and art boxes default to the crop box.
+		boxes[p-1] = PageBoxes{
+			Media: &media,
+			Crop:  &crop,
+			Trim:  boxEntry(pdfCtx, d, "TrimBox", crop),
+			Bleed: boxEntry(pdfCtx, d, "BleedBox", crop),
+			Art:   boxEntry(pdfCtx, d, "ArtBox", crop),
+		}
+	}
+	return boxes, nil
+}
+
+func (s *pageService) SetPageBoxes(input []byte, pages string, boxes PageBoxes) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PageService.SetPageBoxes", AttrInputBytes.Int(len(input)))
+	output, err := s.setPageBoxes(ctx, input, pages, boxes)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pageService) setPageBoxes(ctx context.Context, input []byte, pages string, boxes PageBoxes) ([]byte, error) {
+	s.log.Info("PageService.SetPageBoxes called", logger.String("pages", pages))
+
+	entries := map[string]*[4]float64{
+		"MediaBox": boxes.Media, "CropBox": boxes.Crop, "TrimBox": boxes.Trim, "BleedBox": boxes.Bleed, "ArtBox": boxes.Art,
+	}
+	set := 0
+	for key, box := range entries {
+		if box == nil {
+			continue
+		}
+		set++
+		if r := normalizeRect(*box); r[2]-r[0] <= 0 || r[3]-r[1] <= 0 {
+			return nil, fmt.Errorf("%s %v is empty", key, *box)
+		}
+	}
+	if set == 0 {
+		return nil, errors.New("no boxes given")
+	}
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		d, _, inh, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			return nil, err
+		}
+		media := rectangleBox(inh.MediaBox)
+		if boxes.Media != nil {
+			media = normalizeRect(*boxes.Media)
+		}
+		for key, box := range entries {
+			if box == nil {
+				continue
+			}
+			r := normalizeRect(*box)
+			if key != "MediaBox" && (r[0] < media[0] || r[1] < media[1] || r[2] > media[2] || r[3] > media[3]) {
+				return nil, fmt.Errorf("page %d: %s %v is outside the media box %v", p, key, r, media)
+			}
+			d[key] = floatArray(r[:])
+		}
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Page boxes set", logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+// selectedPages resolves a page selection, selecting every page when it is
+// empty.
+func selectedPages(pdfCtx *model.Context, pages string) (types.IntSet, error) {
+	return pageSelection(pdfCtx.PageCount, pages)
+}
+
+// pageSelection is selectedPages for a document of count pages.
+func pageSelection(count int, pages string) (types.IntSet, error) {
+	if strings.TrimSpace(pages) == "" {
+		all := types.IntSet{}
+		for p := 1; p <= count; p++ {
+			all[p] = true
+		}
+		return all, nil
+	}
+	selection, err := api.ParsePageSelection(pages)
+	if err != nil {
+		return nil, err
+	}
+	return api.PagesForPageSelection(count, selection, false, true)
+}
+
+// paperSize returns the portrait size of a named paper format such as
+// "A4" or "Letter"; a trailing "L" returns it landscape.
+func paperSize(name string) (float64, float64, error) {
+	lookup := func(name string) *types.Dim {
+		for key, dim := range types.PaperSize {
+			if strings.EqualFold(key, name) {
+				return dim
+			}
+		}
+		return nil
+	}
+	if dim := lookup(name); dim != nil {
+		return dim.Width, dim.Height, nil
+	}
+	if n := len(name); n > 1 {
+		if dim := lookup(name[:n-1]); dim != nil {
+			switch name[n-1] {
+			case 'P', 'p':
+				return dim.Width, dim.Height, nil
+			case 'L', 'l':
+				return dim.Height, dim.Width, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("unknown paper size %q", name)
+}
+
+// sheetSize returns the paper size for imposition, A4 by default, turned
+// landscape when the name does not fix the orientation.
+func sheetSize(name string, landscape bool) (float64, float64, error) {
+	if name == "" {
+		name = "A4"
+	}
+	width, height, err := paperSize(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	if last := name[len(name)-1]; landscape && width < height && last != 'P' && last != 'p' {
+		width, height = height, width
+	}
+	return width, height, nil
+}
+
+func nUpGrid(n int) (cols, rows int, ok bool) {
+	switch n {
+	case 2:
+		return 2, 1, true
+	case 4:
+		return 2, 2, true
+	case 6:
+		return 3, 2, true
+	case 9:
+		return 3, 3, true
+	}
+	return 0, 0, false
+}
+
+// gridCells divides a sheet inside its margin into cols × rows cells,
+// left to right and top to bottom.
+func gridCells(width, height float64, cols, rows int, margin, colGap, rowGap float64) ([][4]float64, error) {
+	if margin < 0 || colGap < 0 || rowGap < 0 {
+		return nil, errors.New("margin and gutter must not be negative")
+	}
+	cellW := (width - 2*margin - float64(cols-1)*colGap) / float64(cols)
+	cellH := (height - 2*margin - float64(rows-1)*rowGap) / float64(rows)
+	if cellW <= 0 || cellH <= 0 {
+		return nil, errors.New("margin and gutter leave no room for pages")
+	}
+
+	cells := make([][4]float64, 0, cols*rows)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			x := margin + float64(c)*(cellW+colGap)
+			y := height - margin - float64(r+1)*cellH - float64(r)*rowGap
+			cells = append(cells, [4]float64{x, y, x + cellW, y + cellH})
+		}
+	}
+	return cells, nil
+}
+
+// bookletOrder returns the page order for saddle-stitch sheets, two pages
+// per sheet side, front then back. The page count is padded to a multiple
+// of four; padding pages are numbered past the end. Sheets are meant to be
+// printed duplex, flipped on the short edge.
+func bookletOrder(pageCount int) []int {
+	n := (pageCount + 3) / 4 * 4
+	order := make([]int, 0, n)
+	for i := 0; i < n/4; i++ {
+		order = append(order, n-2*i, 2*i+1, 2*i+2, n-2*i-1)
+	}
+	return order
+}
+
+type sheetTile struct {
+	page int
+	cell [4]float64
+}
+
+type sheet struct {
+	width, height float64
+	tiles         []sheetTile
+}
+
+// imposeSheets replaces the document's pages with sheets showing the
+// original pages scaled into their cells. Bookmarks, form fields and page
+// labels refer to the original pages and are dropped.
+func imposeSheets(pdfCtx *model.Context, sheets []sheet, border bool) error {
+	pagesDict := types.Dict{
+		"Type":  types.Name("Pages"),
+		"Kids":  types.Array{},
+		"Count": types.Integer(len(sheets)),
+	}
+	pagesRef, err := pdfCtx.IndRefForNewObject(pagesDict)
+	if err != nil {
+		return err
+	}
+
+	forms := make(map[int]pageForm)
+	kids := make(types.Array, 0, len(sheets))
+	for _, sh := range sheets {
+		var content bytes.Buffer
+		xobjects := types.Dict{}
+		for _, tile := range sh.tiles {
+			form, ok := forms[tile.page]
+			if !ok {
+				if form, err = newPageForm(pdfCtx, tile.page); err != nil {
+					return fmt.Errorf("page %d: %w", tile.page, err)
+				}
+				forms[tile.page] = form
+			}
+			name := fmt.Sprintf("Pg%d", tile.page)
+			xobjects[name] = form.ref
+
+			c := tile.cell
+			m := fitMatrix(form.width, form.height, c, FitContain, true)
+			fmt.Fprintf(&content, "q %s %s %s %s re W n %s cm /%s Do Q\n",
+				pdfNumber(c[0]), pdfNumber(c[1]), pdfNumber(c[2]-c[0]), pdfNumber(c[3]-c[1]), m.operands(), name)
+			if border {
+				fmt.Fprintf(&content, "q 0.5 G 0.5 w %s %s %s %s re S Q\n",
+					pdfNumber(c[0]), pdfNumber(c[1]), pdfNumber(c[2]-c[0]), pdfNumber(c[3]-c[1]))
+			}
+		}
+
+		contents, err := pdfCtx.StreamDictIndRef(content.Bytes())
+		if err != nil {
+			return err
+		}
+		page := types.Dict{
+			"Type":      types.Name("Page"),
+			"Parent":    *pagesRef,
+			"MediaBox":  floatArray([]float64{0, 0, sh.width, sh.height}),
+			"Resources": types.Dict{"XObject": xobjects},
+			"Contents":  *contents,
+		}
+		ref, err := pdfCtx.IndRefForNewObject(page)
+		if err != nil {
+			return err
+		}
+		kids = append(kids, *ref)
+	}
+	pagesDict["Kids"] = kids
+
+	root, err := pdfCtx.Catalog()
+	if err != nil {
+		return err
+	}
+	root["Pages"] = *pagesRef
+	for _, key := range []string{"Outlines", "AcroForm", "PageLabels", "Dests", "OpenAction"} {
+		delete(root, key)
+	}
+	pdfCtx.PageCount = len(sheets)
+	return nil
+}
+
+// pageForm is a page turned into a form XObject, with the size the page
+// is displayed at.
+type pageForm struct {
+	ref           types.IndirectRef
+	width, height float64
+}
+
+// newPageForm wraps a page's content in a form XObject whose space is the
+// page's visible area as displayed, with any /Rotate applied.
+func newPageForm(pdfCtx *model.Context, page int) (pageForm, error) {
+	d, _, inh, err := pdfCtx.PageDict(page, true)
+	if err != nil {
+		return pageForm{}, err
+	}
+	content, err := pdfCtx.PageContent(d, page)
+	if err != nil && !errors.Is(err, model.ErrNoContent) {
+		return pageForm{}, err
+	}
+
+	box := visibleBox(inh)
+	m, width, height := displayMatrix(box, normalizedRotation(inh.Rotate))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "q %s cm\n", m.operands())
+	buf.Write(content)
+	buf.WriteString("\nQ\n")
+
+	resources := inh.Resources
+	if resources == nil {
+		resources = types.Dict{}
+	}
+	ref, err := newFormXObject(pdfCtx, [4]float64{0, 0, width, height}, resources, buf.Bytes())
+	if err != nil {
+		return pageForm{}, err
+	}
+	return pageForm{ref: *ref, width: width, height: height}, nil
+}
+
+// displayMatrix maps the unrotated box onto [0 0 width height] as the page
+// is displayed with rotation rot (0, 90, 180 or 270, clockwise).
+func displayMatrix(box [4]float64, rot int) (matrix, float64, float64) {
+	w, h := box[2]-box[0], box[3]-box[1]
+	switch rot {
+	case 90:
+		return matrix{0, -1, 1, 0, -box[1], w + box[0]}, h, w
+	case 180:
+		return matrix{-1, 0, 0, -1, w + box[0], h + box[1]}, w, h
+	case 270:
+		return matrix{0, 1, -1, 0, h + box[1], -box[0]}, h, w
+	}
+	return translate(-box[0], -box[1]), w, h
+}
+
+// fitMatrix maps a width × height area at the origin into cell according
+// to policy, centred. With allowRotate the area is turned a quarter when
+// that makes it larger.
+func fitMatrix(width, height float64, cell [4]float64, policy FitPolicy, allowRotate bool) matrix {
+	cw, ch := cell[2]-cell[0], cell[3]-cell[1]
+	scale := func(w, h float64) float64 {
+		if policy == FitCover {
+			return math.Max(cw/w, ch/h)
+		}
+		return math.Min(cw/w, ch/h)
+	}
+
+	s := scale(width, height)
+	if allowRotate && policy != FitCover && scale(height, width) > s*1.01 {
+		// Turn counter-clockwise so the page bottom faces right.
+		s = scale(height, width)
+		m := matrix{0, s, -s, 0, height * s, 0}
+		return m.mul(translate(cell[0]+(cw-height*s)/2, cell[1]+(ch-width*s)/2))
+	}
+	return matrix{s, 0, 0, s, cell[0] + (cw-width*s)/2, cell[1] + (ch-height*s)/2}
+}
+
+// resizePage scales a page's content onto a new media box in place, so
+// links, bookmarks and form fields keep pointing at it.
+func resizePage(pdfCtx *model.Context, page int, width, height float64, opts *ResizeOptions) error {
+	d, _, inh, err := pdfCtx.PageDict(page, false)
+	if err != nil {
+		return err
+	}
+	box := visibleBox(inh)
+	rot := normalizedRotation(inh.Rotate)
+	w, h := box[2]-box[0], box[3]-box[1]
+	if rot == 90 || rot == 270 {
+		w, h = h, w
+	}
+
+	if opts.MatchOrientation && (w > h) != (width > height) {
+		width, height = height, width
+	}
+	// The media box is in unrotated space.
+	if rot == 90 || rot == 270 {
+		width, height = height, width
+		w, h = h, w
+	}
+
+	target := [4]float64{0, 0, width, height}
+	m := translate(-box[0], -box[1]).mul(fitMatrix(w, h, target, opts.Policy, false))
+	if err := wrapPageContent(pdfCtx, d, []byte("q "+m.operands()+" cm\n"), []byte("\nQ\n")); err != nil {
+		return err
+	}
+
+	d["MediaBox"] = floatArray(target[:])
+	delete(d, "CropBox")
+	for _, key := range []string{"TrimBox", "BleedBox", "ArtBox"} {
+		if d[key] != nil {
+			r := clipRect(transformRect(*boxEntry(pdfCtx, d, key, target), m), target)
+			d[key] = floatArray(r[:])
+		}
+	}
+	return transformAnnotations(pdfCtx, d, m)
+}
+
+// transformAnnotations moves a page's annotations along with content
+// transformed by m.
+func transformAnnotations(pdfCtx *model.Context, pageDict types.Dict, m matrix) error {
+	annots, err := pdfCtx.DereferenceArray(pageDict["Annots"])
+	if err != nil {
+		return err
+	}
+	for _, entry := range annots {
+		d, err := pdfCtx.DereferenceDict(entry)
+		if err != nil || d == nil {
+			continue
+		}
+		r := transformRect(annotationRect(pdfCtx, d), m)
+		d["Rect"] = floatArray(r[:])
+		if arr, err := pdfCtx.DereferenceArray(d["QuadPoints"]); err == nil && arr != nil {
+			d["QuadPoints"] = floatArray(m.applyAll(numberArray(pdfCtx, arr)))
+		}
+		if ink, err := pdfCtx.DereferenceArray(d["InkList"]); err == nil && ink != nil {
+			strokes := make(types.Array, 0, len(ink))
+			for _, stroke := range ink {
+				points, _ := pdfCtx.DereferenceArray(stroke)
+				strokes = append(strokes, floatArray(m.applyAll(numberArray(pdfCtx, points))))
+			}
+			d["InkList"] = strokes
+		}
+	}
+	return nil
+}
+
+// wrapPageContent puts before and after around the page's content
+// streams without touching them.
+func wrapPageContent(pdfCtx *model.Context, pageDict types.Dict, before, after []byte) error {
+	head, err := pdfCtx.StreamDictIndRef(before)
+	if err != nil {
+		return err
+	}
+	tail, err := pdfCtx.StreamDictIndRef(after)
+	if err != nil {
+		return err
+	}
+
+	contents := types.Array{*head}
+	existing, err := pdfCtx.Dereference(pageDict["Contents"])
+	if err != nil {
+		return err
+	}
+	switch c := existing.(type) {
+	case types.Array:
+		contents = append(contents, c...)
+	case types.StreamDict:
+		contents = append(contents, pageDict["Contents"])
+	}
+	pageDict["Contents"] = append(contents, *tail)
+	return nil
+}
+
+// boxEntry returns the box stored under key, or fallback.
+func boxEntry(pdfCtx *model.Context, d types.Dict, key string, fallback [4]float64) *[4]float64 {
+	box := fallback
+	if arr, err := pdfCtx.DereferenceArray(d[key]); err == nil && len(arr) == 4 {
+		copy(box[:], numberArray(pdfCtx, arr))
+		box = normalizeRect(box)
+	}
+	return &box
+}
+
+// visibleBox returns the crop box, or the media box when there is none.
+func visibleBox(inh *model.InheritedPageAttrs) [4]float64 {
+	if inh.CropBox != nil {
+		return rectangleBox(inh.CropBox)
+	}
+	return rectangleBox(inh.MediaBox)
+}
+
+func rectangleBox(r *types.Rectangle) [4]float64 {
+	if r == nil {
+		return [4]float64{}
+	}
+	return normalizeRect([4]float64{r.LL.X, r.LL.Y, r.UR.X, r.UR.Y})
+}
+
+func normalizedRotation(rot int) int {
+	return ((rot%360 + 360) % 360) / 90 * 90
+}
+
+func clipRect(r, bounds [4]float64) [4]float64 {
+	return [4]float64{math.Max(r[0], bounds[0]), math.Max(r[1], bounds[1]), math.Min(r[2], bounds[2]), math.Min(r[3], bounds[3])}
+}
+
+// apply returns the point (x, y) transformed by m.
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// applyAll transforms a list of x,y pairs.
+func (m matrix) applyAll(points []float64) []float64 {
+	out := make([]float64, len(points))
+	for i := 0; i+1 < len(points); i += 2 {
+		out[i], out[i+1] = m.apply(points[i], points[i+1])
+	}
+	return out
+}
+
+// inverse returns the matrix undoing m.
+func (m matrix) inverse() matrix {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return identityMatrix
+	}
+	a, b, c, d := m[3]/det, -m[1]/det, -m[2]/det, m[0]/det
+	return matrix{a, b, c, d, -(m[4]*a + m[5]*c), -(m[4]*b + m[5]*d)}
+}
+
+// operands formats m for the cm operator.
+func (m matrix) operands() string {
+	parts := make([]string, len(m))
+	for i, v := range m {
+		parts[i] = pdfNumber(v)
+	}
+	return strings.Join(parts, " ")
+}
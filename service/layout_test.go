@@ -0,0 +1,214 @@
+package service_test
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// sheetPages returns, for each page, the source pages it draws in order.
+func sheetPages(t *testing.T, data []byte) [][]string {
+	t.Helper()
+	pdfCtx, err := api.ReadAndValidate(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`/Pg(\d+) Do`)
+	var sheets [][]string
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		d, _, _, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := pdfCtx.PageContent(d, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pages []string
+		for _, m := range re.FindAllSubmatch(content, -1) {
+			pages = append(pages, string(m[1]))
+		}
+		sheets = append(sheets, pages)
+	}
+	return sheets
+}
+
+func pageSize(t *testing.T, svc service.PageService, data []byte, page int) (float64, float64) {
+	t.Helper()
+	boxes, err := svc.GetPageBoxes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := *boxes[page-1].Media
+	return math.Round(b[2] - b[0]), math.Round(b[3] - b[1])
+}
+
+func TestNUp(t *testing.T) {
+	pages := service.NewPageService(getTestLogger())
+	input := textPDF(t, "1", "2", "3", "4", "5")
+
+	output, err := pages.NUp(input, &service.NUpOptions{N: 4, Gutter: 10, Margin: 20, Border: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sheetPages(t, output)
+	if len(got) != 2 || !equalStrings(got[0], []string{"1", "2", "3", "4"}) || !equalStrings(got[1], []string{"5"}) {
+		t.Errorf("sheets = %v", got)
+	}
+	if w, h := pageSize(t, pages, output, 1); w != 595 || h != 842 {
+		t.Errorf("4-up sheet = %vx%v, want A4 portrait", w, h)
+	}
+
+	output, err = pages.NUp(input, &service.NUpOptions{N: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := pageSize(t, pages, output, 1); w != 842 || h != 595 {
+		t.Errorf("2-up sheet = %vx%v, want A4 landscape", w, h)
+	}
+	if got := sheetPages(t, output); len(got) != 3 {
+		t.Errorf("2-up sheets = %v", got)
+	}
+
+	for _, opts := range []*service.NUpOptions{{N: 3}, {N: 4, PaperSize: "B52"}, {N: 9, Margin: 400}} {
+		if _, err := pages.NUp(input, opts); err == nil {
+			t.Errorf("%+v: expected error", *opts)
+		}
+	}
+}
+
+func TestBooklet(t *testing.T) {
+	pages := service.NewPageService(getTestLogger())
+
+	output, err := pages.Booklet(textPDF(t, "1", "2", "3", "4", "5", "6"), &service.BookletOptions{Gutter: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Eight pages per two sheets: 8|1, 2|7, 6|3, 4|5, with 7 and 8 left blank.
+	got := sheetPages(t, output)
+	want := [][]string{{"1"}, {"2"}, {"6", "3"}, {"4", "5"}}
+	if len(got) != len(want) {
+		t.Fatalf("sheet sides = %v", got)
+	}
+	for i := range want {
+		if !equalStrings(got[i], want[i]) {
+			t.Errorf("sheet sides = %v, want %v", got, want)
+			break
+		}
+	}
+	if w, h := pageSize(t, pages, output, 1); w != 842 || h != 595 {
+		t.Errorf("sheet = %vx%v, want A4 landscape", w, h)
+	}
+}
+
+func TestResizePages(t *testing.T) {
+	pages := service.NewPageService(getTestLogger())
+
+	// A letter page, a small landscape scan and an A3 page.
+	pdf := gofpdf.New("P", "pt", "Letter", "")
+	pdf.AddPage()
+	pdf.AddPageFormat("L", gofpdf.SizeType{Wd: 200, Ht: 300})
+	pdf.AddPageFormat("P", gofpdf.SizeType{Wd: 842, Ht: 1191})
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	input := buf.Bytes()
+
+	output, err := pages.ResizePages(input, &service.ResizeOptions{PaperSize: "A4", MatchOrientation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for page, want := range map[int][2]float64{1: {595, 842}, 2: {842, 595}, 3: {595, 842}} {
+		if w, h := pageSize(t, pages, output, page); w != want[0] || h != want[1] {
+			t.Errorf("page %d = %vx%v, want %v", page, w, h, want)
+		}
+	}
+
+	output, err = pages.ResizePages(input, &service.ResizeOptions{Width: 400, Height: 400, Policy: service.FitCover, Pages: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := pageSize(t, pages, output, 2); w != 400 || h != 400 {
+		t.Errorf("page 2 = %vx%v", w, h)
+	}
+	if w, h := pageSize(t, pages, output, 1); w != 612 || h != 792 {
+		t.Errorf("unselected page 1 = %vx%v", w, h)
+	}
+
+	if _, err := pages.ResizePages(input, &service.ResizeOptions{PaperSize: "A4", Policy: "stretch"}); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestMarginsAndBoxes(t *testing.T) {
+	pages := service.NewPageService(getTestLogger())
+	input := textPDF(t, "a", "b")
+
+	output, err := pages.AddMargins(input, "1", service.Margins{Top: 10, Right: 20, Bottom: 30, Left: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes, err := pages.GetPageBoxes(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	media := *boxes[0].Media
+	if math.Round(media[0]) != -40 || math.Round(media[1]) != -30 || math.Round(media[2]) != 615 || math.Round(media[3]) != 852 {
+		t.Errorf("page 1 media = %v", media)
+	}
+	if *boxes[1].Media != *boxes[1].Crop || math.Round(boxes[1].Media[2]) != 595 {
+		t.Errorf("page 2 boxes = %v %v", *boxes[1].Media, *boxes[1].Crop)
+	}
+
+	trim := [4]float64{20, 20, 575, 822}
+	bleed := [4]float64{10, 10, 585, 832}
+	output, err = pages.SetPageBoxes(input, "", service.PageBoxes{Trim: &trim, Bleed: &bleed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes, err = pages.GetPageBoxes(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range boxes {
+		if *b.Trim != trim || *b.Bleed != bleed || *b.Art != *b.Crop {
+			t.Errorf("page %d boxes = %+v", i+1, b)
+		}
+	}
+
+	outside := [4]float64{0, 0, 1000, 1000}
+	if _, err := pages.SetPageBoxes(input, "", service.PageBoxes{Crop: &outside}); err == nil {
+		t.Error("expected error for crop box outside the media box")
+	}
+}
+
+func TestLayoutSteps(t *testing.T) {
+	svc := service.NewWithGotenberg("http://localhost:3000")
+
+	if err := (&service.NUpStep{}).Validate(); err == nil {
+		t.Error("expected error for n = 0")
+	}
+	if err := (&service.ResizeStep{}).Validate(); err == nil {
+		t.Error("expected error without a paper size")
+	}
+
+	docs := []service.Document{{Name: "a.pdf", Data: textPDF(t, "1", "2", "3", "4")}}
+	docs, err := (&service.ResizeStep{ResizeOptions: service.ResizeOptions{PaperSize: "Letter"}}).Run(t.Context(), svc, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err = (&service.NUpStep{NUpOptions: service.NUpOptions{N: 2}}).Run(t.Context(), svc, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := svc.Pages().GetPageCount(docs[0].Data); err != nil || count != 2 {
+		t.Errorf("page count = %d, %v", count, err)
+	}
+}
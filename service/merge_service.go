@@ -2,10 +2,19 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/jung-kurt/gofpdf"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
@@ -15,6 +24,72 @@ type MergeService interface {
 	Merge(inputs []io.Reader) ([]byte, error)
 	MergeFiles(inputPaths []string, outputPath string) error
 	MergeBytes(inputs [][]byte) ([]byte, error)
+	MergeWithOptions(inputs []MergeInput, opts *MergeOptions) ([]byte, error)
+}
+
+// MergeInput is one source for MergeWithOptions, given either as Data or
+// as a file Path.
+type MergeInput struct {
+	Data []byte
+	Path string
+	// Name is used for the bookmark when Title is empty, e.g. the
+	// original file name.
+	Name  string
+	Title string
+	// Pages selects and orders the pages taken from this input, e.g.
+	// "1-3,7"; all pages when empty.
+	Pages string
+}
+
+// Size is the input's size in bytes, taken from the file when Path is set.
+// It is 0 for a Path that cannot be read.
+func (in MergeInput) Size() int64 {
+	if in.Path == "" {
+		return int64(len(in.Data))
+	}
+	info, err := os.Stat(in.Path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+type MergeOptions struct {
+	// Bookmarks adds a top-level bookmark at the first page of each input.
+	Bookmarks bool
+	// TableOfContents prepends a page listing every input and the page it
+	// starts on. Titles are limited to the Latin-1 character set.
+	TableOfContents bool
+	TOCTitle        string
+	// DropBookmarks discards the inputs' own bookmarks instead of nesting
+	// them under each input.
+	DropBookmarks bool
+	// DropFormFields removes form fields from every input.
+	DropFormFields bool
+	// OddPageStart inserts a blank page where needed so every input starts
+	// on an odd page, for duplex printing. The table of contents is padded
+	// the same way.
+	OddPageStart bool
+	// Interleave combines exactly two single-sided scans: inputs[0] holds
+	// the fronts in order and inputs[1] the backs in reverse order, as
+	// produced by turning the stack over. Bookmark and TOC options are
+	// ignored.
+	Interleave bool
+}
+
+func DefaultMergeOptions() *MergeOptions {
+	return &MergeOptions{
+		Bookmarks: true,
+		TOCTitle:  "Contents",
+	}
+}
+
+// tocTitle is the TOC heading and bookmark title, "Contents" when unset.
+func (o *MergeOptions) tocTitle() string {
+	if o.TOCTitle == "" {
+		return DefaultMergeOptions().TOCTitle
+	}
+	return o.TOCTitle
 }
 
 type mergeService struct {
@@ -41,11 +116,20 @@ func (s *mergeService) Merge(inputs []io.Reader) ([]byte, error) {
 }
 
 func (s *mergeService) MergeFiles(inputPaths []string, outputPath string) error {
+	ctx, span := startSpan(context.Background(), "MergeService.MergeFiles")
+	err := s.mergeFiles(ctx, inputPaths, outputPath)
+	endSpan(span, err)
+	return err
+}
+
+func (s *mergeService) mergeFiles(ctx context.Context, inputPaths []string, outputPath string) error {
 	s.log.Info("MergeService.MergeFiles called", logger.Int("inputCount", len(inputPaths)))
 
 	conf := model.NewDefaultConfiguration()
 
-	if err := api.MergeCreateFile(inputPaths, outputPath, false, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.MergeCreateFile", func() error {
+		return api.MergeCreateFile(inputPaths, outputPath, false, conf)
+	}); err != nil {
 		s.log.Error("pdfcpu merge failed", logger.Error(err))
 		return err
 	}
@@ -55,6 +139,18 @@ func (s *mergeService) MergeFiles(inputPaths []string, outputPath string) error
 }
 
 func (s *mergeService) MergeBytes(inputs [][]byte) ([]byte, error) {
+	var inputSize int
+	for _, data := range inputs {
+		inputSize += len(data)
+	}
+
+	ctx, span := startSpan(context.Background(), "MergeService.MergeBytes", AttrInputBytes.Int(inputSize))
+	output, err := s.mergeBytes(ctx, inputs)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *mergeService) mergeBytes(ctx context.Context, inputs [][]byte) ([]byte, error) {
 	s.log.Info("MergeService.MergeBytes called", logger.Int("inputCount", len(inputs)))
 
 	tmpDir, err := os.MkdirTemp("", "pdf-merge-*")
@@ -66,18 +162,104 @@ func (s *mergeService) MergeBytes(inputs [][]byte) ([]byte, error) {
 	var inputPaths []string
 	for i, data := range inputs {
 		tmpPath := tmpDir + "/" + string(rune('a'+i)) + ".pdf"
-		if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		if err := writeFile(ctx, tmpPath, data); err != nil {
 			return nil, err
 		}
 		inputPaths = append(inputPaths, tmpPath)
 	}
 
 	outputPath := tmpDir + "/merged.pdf"
-	if err := s.MergeFiles(inputPaths, outputPath); err != nil {
+	if err := s.mergeFiles(ctx, inputPaths, outputPath); err != nil {
+		return nil, err
+	}
+
+	output, err := readFile(ctx, outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("PDF merge completed", logger.Int("outputSize", len(output)))
+	return output, nil
+}
+
+func (s *mergeService) MergeWithOptions(inputs []MergeInput, opts *MergeOptions) ([]byte, error) {
+	var inputSize int64
+	for _, in := range inputs {
+		inputSize += in.Size()
+	}
+
+	ctx, span := startSpan(context.Background(), "MergeService.MergeWithOptions", AttrInputBytes.Int64(inputSize))
+	output, err := s.mergeWithOptions(ctx, inputs, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+// mergePart is an input after page selection, form removal and padding.
+type mergePart struct {
+	path      string
+	pages     int
+	title     string
+	bookmarks []pdfcpu.Bookmark
+}
+
+func (s *mergeService) mergeWithOptions(ctx context.Context, inputs []MergeInput, opts *MergeOptions) ([]byte, error) {
+	s.log.Info("MergeService.MergeWithOptions called", logger.Int("inputCount", len(inputs)))
+
+	if opts == nil {
+		opts = DefaultMergeOptions()
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("no inputs to merge")
+	}
+	if opts.Interleave && len(inputs) != 2 {
+		return nil, fmt.Errorf("interleave needs exactly 2 inputs, got %d", len(inputs))
+	}
+
+	tmpDir, err := os.MkdirTemp("", "pdf-merge-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	parts := make([]mergePart, len(inputs))
+	for i, in := range inputs {
+		pad := opts.OddPageStart && !opts.Interleave && i < len(inputs)-1
+		part, err := s.prepareMergeInput(ctx, tmpDir, i, in, opts, pad)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i+1, err)
+		}
+		parts[i] = part
+	}
+
+	paths := make([]string, len(parts))
+	for i, part := range parts {
+		paths[i] = part.path
+	}
+	merged := filepath.Join(tmpDir, "merged.pdf")
+	if err := mergeWithoutBookmarks(ctx, paths, merged); err != nil {
+		s.log.Error("pdfcpu merge failed", logger.Error(err))
+		return nil, err
+	}
+
+	if opts.Interleave {
+		if err := interleaveFile(ctx, merged, parts[0].pages, parts[1].pages); err != nil {
+			return nil, err
+		}
+		return readFile(ctx, merged)
+	}
+
+	tocPages := 0
+	if opts.TableOfContents {
+		if tocPages, err = prependTOC(ctx, tmpDir, merged, opts.tocTitle(), parts, opts.OddPageStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyMergeBookmarks(ctx, merged, parts, tocPages, opts); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, merged)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +268,314 @@ func (s *mergeService) MergeBytes(inputs [][]byte) ([]byte, error) {
 	return output, nil
 }
 
+func (s *mergeService) prepareMergeInput(ctx context.Context, tmpDir string, index int, in MergeInput, opts *MergeOptions, pad bool) (mergePart, error) {
+	part := mergePart{path: in.Path, title: mergeTitle(in, index)}
+	if part.path == "" {
+		part.path = filepath.Join(tmpDir, fmt.Sprintf("input-%d.pdf", index))
+		if err := writeFile(ctx, part.path, in.Data); err != nil {
+			return part, err
+		}
+	}
+	conf := model.NewDefaultConfiguration()
+
+	// Each stage writes a new file so a caller's Path is never modified.
+	stage := 0
+	next := func() string {
+		stage++
+		return filepath.Join(tmpDir, fmt.Sprintf("input-%d-%d.pdf", index, stage))
+	}
+
+	if err := traceStep(ctx, "pdfcpu.PageCountFile", func() (err error) {
+		part.pages, err = api.PageCountFile(part.path)
+		return err
+	}); err != nil {
+		return part, err
+	}
+
+	if !opts.DropBookmarks && !opts.Interleave {
+		if err := traceStep(ctx, "pdfcpu.Bookmarks", func() error {
+			f, err := os.Open(part.path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			part.bookmarks, err = api.Bookmarks(f, conf)
+			return err
+		}); err != nil {
+			return part, err
+		}
+	}
+
+	if in.Pages != "" {
+		selection := strings.Split(in.Pages, ",")
+		pages, err := api.PagesForPageCollection(part.pages, selection)
+		if err != nil {
+			return part, err
+		}
+		out := next()
+		if err := traceStep(ctx, "pdfcpu.CollectFile", func() error {
+			return api.CollectFile(part.path, out, selection, model.NewDefaultConfiguration())
+		}); err != nil {
+			return part, err
+		}
+		part.path = out
+		part.pages = len(pages)
+		part.bookmarks = remapBookmarks(part.bookmarks, pages)
+	}
+
+	if opts.DropFormFields {
+		var ids []string
+		if err := traceStep(ctx, "pdfcpu.FormFields", func() error {
+			f, err := os.Open(part.path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fields, err := api.FormFields(f, model.NewDefaultConfiguration())
+			for _, field := range fields {
+				ids = append(ids, field.ID)
+			}
+			return err
+		}); err != nil {
+			return part, err
+		}
+		if len(ids) > 0 {
+			out := next()
+			if err := traceStep(ctx, "pdfcpu.RemoveFormFieldsFile", func() error {
+				return api.RemoveFormFieldsFile(part.path, out, ids, model.NewDefaultConfiguration())
+			}); err != nil {
+				return part, err
+			}
+			part.path = out
+		}
+	}
+
+	if pad && part.pages%2 == 1 {
+		out := next()
+		if err := traceStep(ctx, "pdfcpu.InsertPagesFile", func() error {
+			return api.InsertPagesFile(part.path, out, []string{strconv.Itoa(part.pages)}, false, nil, model.NewDefaultConfiguration())
+		}); err != nil {
+			return part, err
+		}
+		part.path = out
+		part.pages++
+	}
+
+	return part, nil
+}
+
+func mergeTitle(in MergeInput, index int) string {
+	if in.Title != "" {
+		return in.Title
+	}
+	name := in.Name
+	if name == "" {
+		name = in.Path
+	}
+	if name != "" {
+		base := filepath.Base(name)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return fmt.Sprintf("Document %d", index+1)
+}
+
+func mergeWithoutBookmarks(ctx context.Context, paths []string, outputPath string) error {
+	conf := model.NewDefaultConfiguration()
+	conf.CreateBookmarks = false
+
+	if len(paths) == 1 {
+		data, err := readFile(ctx, paths[0])
+		if err != nil {
+			return err
+		}
+		return writeFile(ctx, outputPath, data)
+	}
+	return traceStep(ctx, "pdfcpu.MergeCreateFile", func() error {
+		return api.MergeCreateFile(paths, outputPath, false, conf)
+	})
+}
+
+// interleaveFile reorders a merge of fronts followed by reversed backs
+// into front 1, back 1, front 2, back 2 and so on.
+func interleaveFile(ctx context.Context, path string, fronts, backs int) error {
+	var order []string
+	for i := 0; i < fronts || i < backs; i++ {
+		if i < fronts {
+			order = append(order, strconv.Itoa(i+1))
+		}
+		if i < backs {
+			order = append(order, strconv.Itoa(fronts+backs-i))
+		}
+	}
+	return traceStep(ctx, "pdfcpu.CollectFile", func() error {
+		return api.CollectFile(path, "", order, model.NewDefaultConfiguration())
+	})
+}
+
+// remapBookmarks moves bookmarks onto the positions of their pages in a
+// page collection. Bookmarks whose page was not selected are dropped and
+// their children promoted.
+func remapBookmarks(bms []pdfcpu.Bookmark, pages []int) []pdfcpu.Bookmark {
+	position := make(map[int]int, len(pages))
+	for i, p := range pages {
+		if _, ok := position[p]; !ok {
+			position[p] = i + 1
+		}
+	}
+
+	var out []pdfcpu.Bookmark
+	for _, bm := range bms {
+		kids := remapBookmarks(bm.Kids, pages)
+		pos, ok := position[bm.PageFrom]
+		if !ok {
+			out = append(out, kids...)
+			continue
+		}
+		bm.PageFrom = pos
+		bm.Kids = kids
+		out = append(out, bm)
+	}
+	return sortBookmarks(out)
+}
+
+// shiftBookmarks offsets bookmarks by the pages that precede their input
+// and drops any that point outside it.
+func shiftBookmarks(bms []pdfcpu.Bookmark, offset, pages int) []pdfcpu.Bookmark {
+	var out []pdfcpu.Bookmark
+	for _, bm := range bms {
+		kids := shiftBookmarks(bm.Kids, offset, pages)
+		if bm.PageFrom < 1 || bm.PageFrom > pages {
+			out = append(out, kids...)
+			continue
+		}
+		out = append(out, pdfcpu.Bookmark{
+			Title:    bm.Title,
+			PageFrom: bm.PageFrom + offset,
+			Bold:     bm.Bold,
+			Italic:   bm.Italic,
+			Color:    bm.Color,
+			Kids:     kids,
+		})
+	}
+	return sortBookmarks(out)
+}
+
+// sortBookmarks orders siblings by page and lifts any child that starts
+// before its parent, both of which pdfcpu rejects.
+func sortBookmarks(bms []pdfcpu.Bookmark) []pdfcpu.Bookmark {
+	var out []pdfcpu.Bookmark
+	for _, bm := range bms {
+		var kids []pdfcpu.Bookmark
+		for _, kid := range bm.Kids {
+			if kid.PageFrom < bm.PageFrom {
+				out = append(out, kid)
+			} else {
+				kids = append(kids, kid)
+			}
+		}
+		bm.Kids = kids
+		bm.Parent = nil
+		out = append(out, bm)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].PageFrom < out[j].PageFrom })
+	return out
+}
+
+func applyMergeBookmarks(ctx context.Context, path string, parts []mergePart, tocPages int, opts *MergeOptions) error {
+	var bms []pdfcpu.Bookmark
+	if opts.Bookmarks && tocPages > 0 {
+		bms = append(bms, pdfcpu.Bookmark{Title: opts.tocTitle(), PageFrom: 1})
+	}
+
+	start := tocPages + 1
+	for _, part := range parts {
+		kids := shiftBookmarks(part.bookmarks, start-1, part.pages)
+		if opts.Bookmarks {
+			bms = append(bms, pdfcpu.Bookmark{Title: part.title, PageFrom: start, Kids: kids})
+		} else {
+			bms = append(bms, kids...)
+		}
+		start += part.pages
+	}
+
+	conf := model.NewDefaultConfiguration()
+	if len(bms) == 0 {
+		// The first input's outline survives the merge; drop it so the
+		// result is consistent.
+		err := traceStep(ctx, "pdfcpu.RemoveBookmarksFile", func() error {
+			return api.RemoveBookmarksFile(path, "", conf)
+		})
+		if errors.Is(err, api.ErrNoOutlines) {
+			return nil
+		}
+		return err
+	}
+	return traceStep(ctx, "pdfcpu.AddBookmarksFile", func() error {
+		return api.AddBookmarksFile(path, "", bms, true, conf)
+	})
+}
+
+// prependTOC puts a contents page listing each part's start page in front
+// of path and returns how many pages it took. With even set, the TOC is
+// padded to an even number of pages so the first part still starts on an
+// odd page.
+func prependTOC(ctx context.Context, tmpDir, path, title string, parts []mergePart, even bool) (int, error) {
+	tocPath := filepath.Join(tmpDir, "toc.pdf")
+
+	// Page numbers depend on the TOC's own length, so render until the
+	// guess matches.
+	tocPages := 1
+	for {
+		pages, err := renderTOC(ctx, tocPath, title, parts, tocPages, even)
+		if err != nil {
+			return 0, err
+		}
+		if pages == tocPages {
+			break
+		}
+		tocPages = pages
+	}
+
+	withTOC := filepath.Join(tmpDir, "with-toc.pdf")
+	if err := mergeWithoutBookmarks(ctx, []string{tocPath, path}, withTOC); err != nil {
+		return 0, err
+	}
+	return tocPages, os.Rename(withTOC, path)
+}
+
+func renderTOC(ctx context.Context, outputPath, title string, parts []mergePart, tocPages int, even bool) (int, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 12, tr(title), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "", 11)
+	width, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	numberWidth := 15.0
+	start := tocPages + 1
+	for _, part := range parts {
+		pdf.CellFormat(width-left-right-numberWidth, 7, tr(part.title), "", 0, "L", false, 0, "")
+		pdf.CellFormat(numberWidth, 7, strconv.Itoa(start), "", 1, "R", false, 0, "")
+		start += part.pages
+	}
+	if even && pdf.PageNo()%2 == 1 {
+		pdf.AddPage()
+	}
+
+	if err := traceStep(ctx, "gofpdf.OutputFileAndClose", func() error {
+		return pdf.OutputFileAndClose(outputPath)
+	}); err != nil {
+		return 0, err
+	}
+	return pdf.PageNo(), nil
+}
+
 func tempPDFName(prefix string, index int) string {
 	buf := bytes.NewBufferString(prefix)
 	buf.WriteByte(byte('0' + index%10))
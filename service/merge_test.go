@@ -0,0 +1,166 @@
+package service_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// sizedPDF builds a PDF with one page per width, so page order can be
+// checked from page dimensions.
+func sizedPDF(t *testing.T, widths ...float64) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	for _, w := range widths {
+		pdf.AddPageFormat("P", gofpdf.SizeType{Wd: w, Ht: 800})
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func pageWidths(t *testing.T, data []byte) []int {
+	t.Helper()
+	dims, err := api.PageDims(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	widths := make([]int, len(dims))
+	for i, d := range dims {
+		widths[i] = int(d.Width + 0.5)
+	}
+	return widths
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMergeWithOptionsBookmarksAndOddStart(t *testing.T) {
+	merge := service.NewMergeService(getTestLogger())
+
+	output, err := merge.MergeWithOptions([]service.MergeInput{
+		{Data: sizedPDF(t, 301), Name: "intro.pdf"},
+		{Data: sizedPDF(t, 302, 303, 304), Title: "Chapter 1"},
+		{Data: sizedPDF(t, 305)},
+	}, &service.MergeOptions{Bookmarks: true, OddPageStart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{301, 612, 302, 303, 304, 612, 305}
+	got := pageWidths(t, output)
+	if len(got) != len(want) || got[0] != 301 || got[2] != 302 || got[6] != 305 {
+		t.Errorf("page widths = %v, want blank pages padding to %v", got, want)
+	}
+
+	bms, err := api.Bookmarks(bytes.NewReader(output), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTitles := []string{"intro", "Chapter 1", "Document 3"}
+	wantPages := []int{1, 3, 7}
+	if len(bms) != len(wantTitles) {
+		t.Fatalf("got %d bookmarks, want %d", len(bms), len(wantTitles))
+	}
+	for i, bm := range bms {
+		if bm.Title != wantTitles[i] || bm.PageFrom != wantPages[i] {
+			t.Errorf("bookmark %d = %q@%d, want %q@%d", i, bm.Title, bm.PageFrom, wantTitles[i], wantPages[i])
+		}
+	}
+}
+
+func TestMergeWithOptionsPageSelection(t *testing.T) {
+	merge := service.NewMergeService(getTestLogger())
+
+	output, err := merge.MergeWithOptions([]service.MergeInput{
+		{Data: sizedPDF(t, 301, 302, 303), Pages: "3,1"},
+		{Data: sizedPDF(t, 304, 305), Pages: "2"},
+	}, &service.MergeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pageWidths(t, output), []int{303, 301, 305}; !equalInts(got, want) {
+		t.Errorf("page widths = %v, want %v", got, want)
+	}
+}
+
+func TestMergeWithOptionsTableOfContents(t *testing.T) {
+	merge := service.NewMergeService(getTestLogger())
+
+	output, err := merge.MergeWithOptions([]service.MergeInput{
+		{Data: sizedPDF(t, 301, 302), Title: "First"},
+		{Data: sizedPDF(t, 303), Title: "Second"},
+	}, &service.MergeOptions{Bookmarks: true, TableOfContents: true, TOCTitle: "Contents"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pageWidths(t, output); len(got) != 4 || got[1] != 301 || got[3] != 303 {
+		t.Errorf("page widths = %v, want a TOC page followed by the inputs", got)
+	}
+
+	bms, err := api.Bookmarks(bytes.NewReader(output), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bms) != 3 || bms[0].Title != "Contents" || bms[1].PageFrom != 2 || bms[2].PageFrom != 4 {
+		t.Errorf("bookmarks = %+v", bms)
+	}
+}
+
+func TestMergeWithOptionsTableOfContentsOddStart(t *testing.T) {
+	merge := service.NewMergeService(getTestLogger())
+
+	output, err := merge.MergeWithOptions([]service.MergeInput{
+		{Data: sizedPDF(t, 301), Title: "A"},
+		{Data: sizedPDF(t, 302), Title: "B"},
+	}, &service.MergeOptions{Bookmarks: true, TableOfContents: true, OddPageStart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pageWidths(t, output); len(got) != 5 || got[2] != 301 || got[4] != 302 {
+		t.Errorf("page widths = %v, want a padded TOC and inputs on odd pages", got)
+	}
+
+	bms, err := api.Bookmarks(bytes.NewReader(output), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bms) != 3 || bms[0].Title != "Contents" || bms[1].PageFrom != 3 || bms[2].PageFrom != 5 {
+		t.Errorf("bookmarks = %+v", bms)
+	}
+}
+
+func TestMergeWithOptionsInterleave(t *testing.T) {
+	merge := service.NewMergeService(getTestLogger())
+
+	fronts := sizedPDF(t, 301, 303, 305)
+	backs := sizedPDF(t, 306, 304, 302)
+	output, err := merge.MergeWithOptions([]service.MergeInput{{Data: fronts}, {Data: backs}}, &service.MergeOptions{Interleave: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pageWidths(t, output), []int{301, 302, 303, 304, 305, 306}; !equalInts(got, want) {
+		t.Errorf("page widths = %v, want %v", got, want)
+	}
+
+	if _, err := merge.MergeWithOptions([]service.MergeInput{{Data: fronts}}, &service.MergeOptions{Interleave: true}); err == nil {
+		t.Error("expected an error when interleaving a single input")
+	}
+}
@@ -4,130 +4,414 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
 )
 
 // OCRService provides Optical Character Recognition capabilities
 type OCRService interface {
-	// ExtractText extracts text from scanned PDF or images using OCR
+	// ExtractText extracts text from scanned PDF or images using OCR.
+	// Inputs may be PDFs or PNG, JPEG or (multi-page) TIFF images. Pages
+	// the engine fails on are logged and left out of the text
 	ExtractText(ctx context.Context, input []byte, lang string) (string, error)
 
+	// ExtractTextWithOptions is ExtractText with rendering, Tesseract and
+	// concurrency settings
+	ExtractTextWithOptions(ctx context.Context, input []byte, opts *OCROptions) (string, error)
+
 	// CreateSearchablePDF converts scanned PDF to searchable PDF (adds text layer)
 	CreateSearchablePDF(ctx context.Context, input []byte, lang string) ([]byte, error)
 
-	// IsAvailable checks if Tesseract OCR and pdftoppm are installed
+	// CreateSearchablePDFWithOptions is CreateSearchablePDF with rendering,
+	// Tesseract and concurrency settings
+	CreateSearchablePDFWithOptions(ctx context.Context, input []byte, opts *OCROptions) ([]byte, error)
+
+	// Recognize runs OCR and returns words with their boxes and confidences,
+	// flagging pages whose mean confidence is below the review threshold
+	Recognize(ctx context.Context, input []byte, opts *OCROptions) (*OCRResult, error)
+
+	// DetectOrientation reports the orientation and skew of every page
+	DetectOrientation(ctx context.Context, input []byte) ([]PageOrientation, error)
+
+	// CorrectOrientation turns sideways and upside-down pages upright and
+	// optionally deskews scanned pages
+	CorrectOrientation(ctx context.Context, input []byte, opts *OrientationOptions) (*OrientationResult, error)
+
+	// IsAvailable checks if the OCR engine can run, which is all image
+	// inputs need. PDF inputs also need the page renderer (pdftoppm by
+	// default), checked when one is processed
 	IsAvailable() bool
 }
 
+// DefaultReviewThreshold is the mean word confidence below which a page
+// is flagged for manual review.
+const DefaultReviewThreshold = 70
+
+// OCROptions controls how pages are rendered and recognised.
+type OCROptions struct {
+	// Language is a Tesseract language code, or several joined with "+"
+	// such as "eng+deu". Empty uses "eng".
+	Language string `json:"language,omitempty"`
+	// DPI is the resolution PDF pages are rendered at, and the resolution
+	// image inputs are taken to have. Zero uses 300.
+	DPI int `json:"dpi,omitempty"`
+	// Format is the page image format, "jpeg" (the default) or the
+	// lossless "png".
+	Format string `json:"format,omitempty"`
+	// Pages limits OCR to a page selection such as "1-5,8". The pages of
+	// a TIFF are selected the same way.
+	Pages string `json:"pages,omitempty"`
+	// PSM is Tesseract's page segmentation mode (1-13). Zero uses
+	// Tesseract's default.
+	PSM int `json:"psm,omitempty"`
+	// OEM is Tesseract's OCR engine mode (0-3). Nil uses Tesseract's
+	// default.
+	OEM *int `json:"oem,omitempty"`
+	// Engine names a registered OCREngine. Empty uses the service's
+	// engine, which is Tesseract unless set by NewOCRServiceWithEngine.
+	Engine string `json:"engine,omitempty"`
+	// TessdataDir is the directory holding the trained language data.
+	TessdataDir string `json:"tessdata_dir,omitempty"`
+	// UserWords are extra dictionary words, such as product names.
+	UserWords []string `json:"user_words,omitempty"`
+	// Workers is the most pages recognised at once. Zero uses the number
+	// of CPUs. Through the SDK, pages beyond the first run only while the
+	// WorkerPool has idle workers.
+	Workers int `json:"workers,omitempty"`
+	// Mode decides how CreateSearchablePDFWithOptions builds its output
+	// from a PDF; images always become new pages. Empty uses
+	// SearchableReplace.
+	Mode SearchableMode `json:"mode,omitempty"`
+	// ReviewThreshold is the mean word confidence (0-100) below which a
+	// page is flagged for review. Zero uses DefaultReviewThreshold.
+	ReviewThreshold float64 `json:"review_threshold,omitempty"`
+	// Progress, when set, is called after each page is recognised. Calls
+	// are not concurrent.
+	Progress func(OCRProgress) `json:"-"`
+}
+
+// OCRProgress reports a recognised page.
+type OCRProgress struct {
+	Page      int
+	Completed int
+	Total     int
+}
+
+// SearchableMode selects how a searchable PDF is built.
+type SearchableMode string
+
+const (
+	// SearchableReplace replaces every page with Tesseract's rendering of
+	// the page image.
+	SearchableReplace SearchableMode = "replace"
+	// SearchableHybrid keeps the original pages and adds an invisible
+	// text layer to those without text, leaving pages that already have
+	// text, including an earlier OCR layer, untouched.
+	SearchableHybrid SearchableMode = "hybrid"
+)
+
+var tesseractLanguage = regexp.MustCompile(`^[A-Za-z0-9_]+(\+[A-Za-z0-9_]+)*$`)
+
+// withDefaults validates opts and returns a copy with defaults filled in.
+func (o *OCROptions) withDefaults() (OCROptions, error) {
+	opts := OCROptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.Language == "" {
+		opts.Language = "eng"
+	}
+	if opts.DPI == 0 {
+		opts.DPI = 300
+	}
+	if opts.Workers == 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.ReviewThreshold == 0 {
+		opts.ReviewThreshold = DefaultReviewThreshold
+	}
+	switch opts.Mode {
+	case "":
+		opts.Mode = SearchableReplace
+	case SearchableReplace, SearchableHybrid:
+	default:
+		return opts, fmt.Errorf("unsupported searchable PDF mode %q", opts.Mode)
+	}
+	switch opts.Format = strings.ToLower(opts.Format); opts.Format {
+	case "", "jpg", "jpeg":
+		opts.Format = "jpeg"
+	case "png":
+	default:
+		return opts, fmt.Errorf("unsupported OCR image format %q", o.Format)
+	}
+
+	switch {
+	case !tesseractLanguage.MatchString(opts.Language):
+		return opts, fmt.Errorf("invalid OCR language %q", opts.Language)
+	case opts.DPI < 0 || opts.DPI > 1200:
+		return opts, fmt.Errorf("dpi must be between 1 and 1200, got %d", opts.DPI)
+	case opts.PSM < 0 || opts.PSM > 13:
+		return opts, fmt.Errorf("psm must be between 1 and 13, got %d", opts.PSM)
+	case opts.OEM != nil && (*opts.OEM < 0 || *opts.OEM > 3):
+		return opts, fmt.Errorf("oem must be between 0 and 3, got %d", *opts.OEM)
+	case opts.Workers < 0:
+		return opts, fmt.Errorf("workers must not be negative, got %d", opts.Workers)
+	case opts.ReviewThreshold < 0 || opts.ReviewThreshold > 100:
+		return opts, fmt.Errorf("review threshold must be between 0 and 100, got %g", opts.ReviewThreshold)
+	}
+	return opts, nil
+}
+
 type ocrService struct {
-	log logger.ILogger
+	log      logger.ILogger
+	engine   OCREngine
+	renderer PageRenderer
 }
 
 // NewOCRService creates a new OCR service
 func NewOCRService(log logger.ILogger) OCRService {
-	return &ocrService{log: log}
+	return NewOCRServiceWithEngine(log, NewTesseractEngine())
+}
+
+// NewOCRServiceWithEngine creates an OCR service that recognises pages
+// with engine unless OCROptions.Engine names another.
+func NewOCRServiceWithEngine(log logger.ILogger, engine OCREngine) OCRService {
+	return NewOCRServiceWithRenderer(log, engine, NewPopplerRenderer())
+}
+
+// NewOCRServiceWithRenderer is NewOCRServiceWithEngine with the renderer
+// PDF pages are rasterised with before recognition.
+func NewOCRServiceWithRenderer(log logger.ILogger, engine OCREngine, renderer PageRenderer) OCRService {
+	return &ocrService{log: log, engine: engine, renderer: renderer}
 }
 
 func (s *ocrService) IsAvailable() bool {
-	_, err := exec.LookPath("tesseract")
-	if err != nil {
-		return false
+	return s.engine.Available()
+}
+
+// engineFor returns the engine selected by opts.
+func (s *ocrService) engineFor(opts *OCROptions) (OCREngine, error) {
+	if opts.Engine == "" {
+		return s.engine, nil
 	}
-	_, err = exec.LookPath("pdftoppm")
-	return err == nil
+	return lookupOCREngine(opts.Engine)
 }
 
-func (s *ocrService) convertPDFToImages(ctx context.Context, pdfPath string, outDir string) ([]string, error) {
-	args := []string{"-jpeg", "-r", "300", pdfPath, filepath.Join(outDir, "page")}
-	cmd := exec.CommandContext(ctx, "pdftoppm", args...)
+// ocrPage is a page recognised by ocrPages.
+type ocrPage struct {
+	page   int
+	result *OCRPage
+	// pdf is the page as a searchable PDF, when asked for.
+	pdf []byte
+}
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return nil, fmt.Errorf("pdftoppm failed: %v, output: %s", err, string(output))
+// ocrPages recognises the selected pages in parallel, also building each
+// as a searchable PDF page when searchable is set. PDF pages are rendered
+// first; image inputs are recognised as they are, one page per image or
+// TIFF page. Pages are returned in document order. With skipFailed, pages
+// the engine fails on are logged and left out instead of failing the call.
+func (s *ocrService) ocrPages(ctx context.Context, input []byte, opts *OCROptions, searchable, skipFailed bool) ([]ocrPage, error) {
+	engine, err := s.engineFor(opts)
+	if err != nil {
+		return nil, err
+	}
+	if !engine.Available() {
+		return nil, fmt.Errorf("dependencies missing: OCR engine %q is not available", engine.Name())
 	}
 
-	files, err := os.ReadDir(outDir)
+	var (
+		count     int
+		pageImage func(ctx context.Context, page int) ([]byte, string, error)
+	)
+	if isPDF(input) {
+		if !s.renderer.Available() {
+			return nil, fmt.Errorf("dependencies missing: page renderer %q is not available", s.renderer.Name())
+		}
+		pdfCtx, err := readContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		count = pdfCtx.PageCount
+
+		tmpDir, err := os.MkdirTemp("", "ocr-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+		inputPath := filepath.Join(tmpDir, "input.pdf")
+		if err := writeFile(ctx, inputPath, input); err != nil {
+			return nil, err
+		}
+
+		pageImage = func(ctx context.Context, page int) ([]byte, string, error) {
+			img, err := s.renderer.RenderPage(ctx, inputPath, page, opts.DPI, opts.Format, false)
+			return img, opts.Format, err
+		}
+	} else {
+		images, err := openImageInput(input)
+		if err != nil {
+			return nil, err
+		}
+		count = images.pageCount()
+		pageImage = func(ctx context.Context, page int) ([]byte, string, error) {
+			img, err := images.page(page)
+			return img.data, img.format, err
+		}
+	}
+
+	selected, err := pageSelection(count, opts.Pages)
 	if err != nil {
 		return nil, err
 	}
-
-	var imageFiles []string
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".jpg") {
-			imageFiles = append(imageFiles, filepath.Join(outDir, f.Name()))
+	var pages []ocrPage
+	for p := 1; p <= count; p++ {
+		if selected[p] {
+			pages = append(pages, ocrPage{page: p})
 		}
 	}
-	sort.Strings(imageFiles)
+	trace.SpanFromContext(ctx).SetAttributes(AttrPageCount.Int(len(pages)), attribute.String("ocr.engine", engine.Name()))
+
+	var mu sync.Mutex
+	completed := 0
+	failed := make([]bool, len(pages))
+	err = runPages(ctx, len(pages), opts.Workers, func(ctx context.Context, i int) error {
+		p := &pages[i]
+		img, format, err := pageImage(ctx, p.page)
+		if err != nil {
+			return err
+		}
+
+		if err := s.recognizePage(ctx, engine, img, format, opts, searchable, p); err != nil {
+			s.log.Error("OCR failed on page", logger.Int("page", p.page), logger.String("engine", engine.Name()), logger.Error(err))
+			if !skipFailed || ctx.Err() != nil {
+				return fmt.Errorf("ocr failed on page %d: %w", p.page, err)
+			}
+			failed[i] = true
+		}
 
-	return imageFiles, nil
+		if opts.Progress != nil {
+			mu.Lock()
+			completed++
+			opts.Progress(OCRProgress{Page: p.page, Completed: completed, Total: len(pages)})
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	recognised := pages[:0]
+	for i, p := range pages {
+		if !failed[i] {
+			recognised = append(recognised, p)
+		}
+	}
+	return recognised, nil
 }
 
-func (s *ocrService) ExtractText(ctx context.Context, input []byte, lang string) (string, error) {
-	s.log.Info("OCRService.ExtractText called", logger.String("lang", lang))
+// recognizePage runs engine on one page image, filling in p.
+func (s *ocrService) recognizePage(ctx context.Context, engine OCREngine, img []byte, format string, opts *OCROptions, searchable bool, p *ocrPage) error {
+	ctx, span := startSpan(ctx, "ocr.recognize", AttrPage.Int(p.page), attribute.String("ocr.engine", engine.Name()))
+	var err error
+	defer func() { endSpan(span, err) }()
 
-	if !s.IsAvailable() {
-		return "", fmt.Errorf("dependencies missing: install 'tesseract-ocr' and 'poppler-utils'")
+	if pe, ok := engine.(SearchablePageEngine); ok && searchable {
+		p.pdf, err = pe.SearchablePage(ctx, img, opts)
+		return err
 	}
 
-	if lang == "" {
-		lang = "eng"
+	p.result, err = engine.Recognize(ctx, img, opts)
+	if err != nil {
+		return err
+	}
+	if p.result == nil {
+		p.result = &OCRPage{}
 	}
+	p.result.Page, p.result.DPI = p.page, opts.DPI
+	if p.result.Width == 0 || p.result.Height == 0 {
+		if p.result.Width, p.result.Height, err = imageSize(img); err != nil {
+			return err
+		}
+	}
+	if searchable {
+		p.pdf, err = searchablePage(ctx, img, format, p.result)
+	}
+	return err
+}
 
-	tmpDir, err := os.MkdirTemp("", "ocr-extract-*")
-	if err != nil {
-		return "", err
+func (s *ocrService) ExtractText(ctx context.Context, input []byte, lang string) (string, error) {
+	return s.ExtractTextWithOptions(ctx, input, &OCROptions{Language: lang})
+}
+
+func (s *ocrService) ExtractTextWithOptions(ctx context.Context, input []byte, opts *OCROptions) (string, error) {
+	var lang string
+	if opts != nil {
+		lang = opts.Language
 	}
-	defer os.RemoveAll(tmpDir)
+	ctx, span := startSpan(ctx, "OCRService.ExtractText", AttrInputBytes.Int(len(input)), attribute.String("ocr.language", lang))
+	text, err := s.extractText(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(text)))
+	return text, err
+}
 
-	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+func (s *ocrService) extractText(ctx context.Context, input []byte, opts *OCROptions) (string, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
 		return "", err
 	}
+	s.log.Info("OCRService.ExtractText called", logger.String("lang", o.Language))
 
-	images, err := s.convertPDFToImages(ctx, inputPath, tmpDir)
+	// Plain text is best effort: pages the engine fails on are skipped.
+	pages, err := s.ocrPages(ctx, input, &o, false, true)
 	if err != nil {
 		return "", err
 	}
 
 	var fullText strings.Builder
-
-	for _, imgPath := range images {
-		outBase := filepath.Join(tmpDir, filepath.Base(imgPath)+"_out")
-		args := []string{imgPath, outBase, "-l", lang}
-		cmd := exec.CommandContext(ctx, "tesseract", args...)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			s.log.Error("Tesseract failed on page", logger.String("image", filepath.Base(imgPath)), logger.String("error", string(output)))
-			continue
-		}
-
-		txtPath := outBase + ".txt"
-		content, err := os.ReadFile(txtPath)
-		if err == nil {
-			fullText.Write(content)
-			fullText.WriteString("\n\n")
-		}
+	for _, p := range pages {
+		fullText.WriteString((&OCRResult{Pages: []OCRPage{*p.result}}).Text())
+		fullText.WriteString("\n\n")
 	}
 
 	return fullText.String(), nil
 }
 
 func (s *ocrService) CreateSearchablePDF(ctx context.Context, input []byte, lang string) ([]byte, error) {
-	s.log.Info("OCRService.CreateSearchablePDF called", logger.String("lang", lang))
+	return s.CreateSearchablePDFWithOptions(ctx, input, &OCROptions{Language: lang})
+}
 
-	if !s.IsAvailable() {
-		return nil, fmt.Errorf("dependencies missing: install 'tesseract-ocr' and 'poppler-utils'")
+func (s *ocrService) CreateSearchablePDFWithOptions(ctx context.Context, input []byte, opts *OCROptions) ([]byte, error) {
+	var lang string
+	if opts != nil {
+		lang = opts.Language
+	}
+	ctx, span := startSpan(ctx, "OCRService.CreateSearchablePDF", AttrInputBytes.Int(len(input)), attribute.String("ocr.language", lang))
+	output, err := s.createSearchablePDF(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *ocrService) createSearchablePDF(ctx context.Context, input []byte, opts *OCROptions) ([]byte, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
 	}
+	s.log.Info("OCRService.CreateSearchablePDF called", logger.String("lang", o.Language), logger.String("mode", string(o.Mode)))
 
-	if lang == "" {
-		lang = "eng"
+	// Image inputs have no pages to keep, so they always become new pages.
+	if o.Mode == SearchableHybrid && isPDF(input) {
+		return s.createHybridPDF(ctx, input, &o)
 	}
 
 	tmpDir, err := os.MkdirTemp("", "ocr-pdf-*")
@@ -136,43 +420,33 @@ func (s *ocrService) CreateSearchablePDF(ctx context.Context, input []byte, lang
 	}
 	defer os.RemoveAll(tmpDir)
 
-	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
-		return nil, err
-	}
-
-	images, err := s.convertPDFToImages(ctx, inputPath, tmpDir)
+	pages, err := s.ocrPages(ctx, input, &o, true, false)
 	if err != nil {
 		return nil, err
 	}
 
-	var pdfPages []string
-
-	for _, imgPath := range images {
-		outBase := filepath.Join(tmpDir, filepath.Base(imgPath)+"_out")
-		args := []string{imgPath, outBase, "-l", lang, "pdf"}
-		cmd := exec.CommandContext(ctx, "tesseract", args...)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			s.log.Error("Tesseract failed on page", logger.String("image", filepath.Base(imgPath)), logger.String("error", string(output)))
-			return nil, fmt.Errorf("ocr failed on page: %w", err)
-		}
-
-		pdfPages = append(pdfPages, outBase+".pdf")
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages processed")
 	}
 
-	if len(pdfPages) == 0 {
-		return nil, fmt.Errorf("no pages processed")
+	pdfPages := make([]string, len(pages))
+	for i, p := range pages {
+		pdfPages[i] = filepath.Join(tmpDir, "page-"+strconv.Itoa(p.page)+".pdf")
+		if err := writeFile(ctx, pdfPages[i], p.pdf); err != nil {
+			return nil, err
+		}
 	}
 
 	outputPath := filepath.Join(tmpDir, "final.pdf")
 	conf := model.NewDefaultConfiguration()
 
-	if err := api.MergeCreateFile(pdfPages, outputPath, false, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.MergeCreateFile", func() error {
+		return api.MergeCreateFile(pdfPages, outputPath, false, conf)
+	}, AttrPageCount.Int(len(pdfPages))); err != nil {
 		return nil, fmt.Errorf("merge failed: %w", err)
 	}
 
-	output, err := os.ReadFile(outputPath)
+	output, err := readFile(ctx, outputPath)
 	if err != nil {
 		return nil, err
 	}
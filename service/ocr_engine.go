@@ -0,0 +1,258 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+var (
+	ErrUnknownOCREngine = errors.New("unknown OCR engine")
+	ErrInvalidOCREngine = errors.New("invalid OCR engine")
+)
+
+// OCREngine recognises the text in one page image. Pages are recognised
+// in parallel, so implementations must be safe for concurrent use.
+type OCREngine interface {
+	// Name is the name the engine is registered under, e.g. "tesseract".
+	Name() string
+	// Available reports whether the engine can run, such as whether its
+	// program is installed or its server configured.
+	Available() bool
+	// Recognize returns the lines and words of a PNG or JPEG image
+	// rendered at opts.DPI, with boxes in image pixels. Page and DPI are
+	// filled in by the caller, as are Width and Height when left zero.
+	Recognize(ctx context.Context, img []byte, opts *OCROptions) (*OCRPage, error)
+}
+
+// SearchablePageEngine is an OCREngine that builds searchable PDF pages
+// itself. For other engines, a page is made from the image with the
+// recognised words laid over it as invisible text.
+type SearchablePageEngine interface {
+	OCREngine
+	// SearchablePage returns a one-page PDF showing the image, sized for
+	// opts.DPI, with its text selectable.
+	SearchablePage(ctx context.Context, img []byte, opts *OCROptions) ([]byte, error)
+}
+
+var (
+	ocrEngineMu sync.RWMutex
+	ocrEngines  = map[string]OCREngine{"tesseract": NewTesseractEngine()}
+)
+
+// RegisterOCREngine makes an engine selectable through OCROptions.Engine.
+func RegisterOCREngine(engine OCREngine) error {
+	if engine == nil || engine.Name() == "" {
+		return fmt.Errorf("%w: engine and name are required", ErrInvalidOCREngine)
+	}
+
+	ocrEngineMu.Lock()
+	defer ocrEngineMu.Unlock()
+	if _, exists := ocrEngines[engine.Name()]; exists {
+		return fmt.Errorf("%w: engine %q is already registered", ErrInvalidOCREngine, engine.Name())
+	}
+	ocrEngines[engine.Name()] = engine
+	return nil
+}
+
+// UnregisterOCREngine removes a registered engine, for example in a test
+// cleanup. It reports whether the engine was registered.
+func UnregisterOCREngine(name string) bool {
+	ocrEngineMu.Lock()
+	defer ocrEngineMu.Unlock()
+	_, ok := ocrEngines[name]
+	delete(ocrEngines, name)
+	return ok
+}
+
+// RegisteredOCREngines lists the engines available to OCROptions.Engine.
+func RegisteredOCREngines() []string {
+	ocrEngineMu.RLock()
+	defer ocrEngineMu.RUnlock()
+
+	names := make([]string, 0, len(ocrEngines))
+	for name := range ocrEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupOCREngine(name string) (OCREngine, error) {
+	ocrEngineMu.RLock()
+	engine, ok := ocrEngines[name]
+	ocrEngineMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOCREngine, name)
+	}
+	return engine, nil
+}
+
+// installed reports whether every named program is on the PATH.
+func installed(names ...string) bool {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type staticOCREngine struct {
+	name string
+	page OCRPage
+}
+
+// NewStaticOCREngine returns an engine that recognises page on every image
+// without running anything, for tests and dry runs. Page numbers and sizes
+// are filled in per image as for any engine.
+func NewStaticOCREngine(name string, page OCRPage) OCREngine {
+	return staticOCREngine{name: name, page: page}
+}
+
+func (e staticOCREngine) Name() string  { return e.name }
+func (staticOCREngine) Available() bool { return true }
+
+func (e staticOCREngine) Recognize(ctx context.Context, img []byte, opts *OCROptions) (*OCRPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Callers fill in the returned page, so each call gets its own copy.
+	page := e.page
+	page.Lines = make([]OCRLine, len(e.page.Lines))
+	for i, line := range e.page.Lines {
+		line.Words = slices.Clone(line.Words)
+		page.Lines[i] = line
+	}
+	return &page, nil
+}
+
+type tesseractEngine struct{}
+
+// NewTesseractEngine returns the engine that runs the tesseract command.
+// It is registered as "tesseract" and is the default engine.
+func NewTesseractEngine() SearchablePageEngine {
+	return tesseractEngine{}
+}
+
+func (tesseractEngine) Name() string    { return "tesseract" }
+func (tesseractEngine) Available() bool { return installed("tesseract") }
+
+func (e tesseractEngine) Recognize(ctx context.Context, img []byte, opts *OCROptions) (*OCRPage, error) {
+	data, err := e.run(ctx, img, opts, "tsv")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseOCRTSV(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.Pages) == 0 {
+		return &OCRPage{}, nil
+	}
+	return &parsed.Pages[0], nil
+}
+
+func (e tesseractEngine) SearchablePage(ctx context.Context, img []byte, opts *OCROptions) ([]byte, error) {
+	return e.run(ctx, img, opts, "pdf")
+}
+
+// run writes img to a temporary directory, runs tesseract on it with the
+// given output config and returns the output file.
+func (tesseractEngine) run(ctx context.Context, img []byte, opts *OCROptions, config string) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "tesseract-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imgPath := filepath.Join(tmpDir, "page")
+	if err := writeFile(ctx, imgPath, img); err != nil {
+		return nil, err
+	}
+	outBase := filepath.Join(tmpDir, "out")
+
+	args := []string{imgPath, outBase, "-l", opts.Language, "--dpi", strconv.Itoa(opts.DPI)}
+	if opts.PSM != 0 {
+		args = append(args, "--psm", strconv.Itoa(opts.PSM))
+	}
+	if opts.OEM != nil {
+		args = append(args, "--oem", strconv.Itoa(*opts.OEM))
+	}
+	if opts.TessdataDir != "" {
+		args = append(args, "--tessdata-dir", opts.TessdataDir)
+	}
+	if len(opts.UserWords) > 0 {
+		wordsPath := filepath.Join(tmpDir, "user-words.txt")
+		if err := writeFile(ctx, wordsPath, []byte(strings.Join(opts.UserWords, "\n")+"\n")); err != nil {
+			return nil, err
+		}
+		args = append(args, "--user-words", wordsPath)
+	}
+	args = append(args, config)
+
+	if output, err := runCommand(ctx, "tesseract", args); err != nil {
+		return nil, fmt.Errorf("tesseract failed: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return readFile(ctx, outBase+"."+config)
+}
+
+// imageSize returns the pixel size of a PNG or JPEG image.
+func imageSize(img []byte) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// searchablePage builds a one-page PDF showing img at dpi, with the
+// words of page as invisible text over it.
+func searchablePage(ctx context.Context, img []byte, format string, page *OCRPage) ([]byte, error) {
+	scale := 72 / float64(page.DPI)
+	w, h := float64(page.Width)*scale, float64(page.Height)*scale
+
+	imgType := "JPG"
+	if format == "png" {
+		imgType = "PNG"
+	}
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{UnitStr: "pt", Size: gofpdf.SizeType{Wd: w, Ht: h}})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+	imgOpts := gofpdf.ImageOptions{ImageType: imgType}
+	pdf.RegisterImageOptionsReader("page", imgOpts, bytes.NewReader(img))
+	pdf.ImageOptions("page", 0, 0, w, h, false, imgOpts, 0, "")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	if len(page.Lines) == 0 {
+		return buf.Bytes(), nil
+	}
+
+	pdfCtx, err := readContext(ctx, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	font, err := newOCRFont(pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	if err := addTextLayer(pdfCtx, 1, *page, *font); err != nil {
+		return nil, err
+	}
+	return writeContext(ctx, pdfCtx)
+}
@@ -0,0 +1,194 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// fakeOCREngine recognises the same two words on every page.
+func fakeOCREngine(name string) service.OCREngine {
+	return service.NewStaticOCREngine(name, service.OCRPage{Lines: []service.OCRLine{{
+		Block: 1, Paragraph: 1, BBox: [4]int{300, 300, 900, 350},
+		Words: []service.OCRWord{
+			{Text: "Hello", BBox: [4]int{300, 300, 550, 350}, Confidence: 96},
+			{Text: "world", BBox: [4]int{600, 300, 900, 350}, Confidence: 40},
+		},
+	}}})
+}
+
+// fakeRenderer renders every page as a blank A4 page, so OCR paths run
+// without pdftoppm.
+type fakeRenderer struct{}
+
+func (fakeRenderer) Name() string    { return "fake" }
+func (fakeRenderer) Available() bool { return true }
+
+func (fakeRenderer) RenderPage(ctx context.Context, path string, page, dpi int, format string, gray bool) ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, 595*dpi/72, 842*dpi/72))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// fakeOCRService recognises pages with engine after rendering them with
+// fakeRenderer.
+func fakeOCRService(engine service.OCREngine) service.OCRService {
+	return service.NewOCRServiceWithRenderer(getTestLogger(), engine, fakeRenderer{})
+}
+
+func TestRegisterOCREngine(t *testing.T) {
+	if err := service.RegisterOCREngine(nil); !errors.Is(err, service.ErrInvalidOCREngine) {
+		t.Errorf("nil engine: got %v", err)
+	}
+	if err := service.RegisterOCREngine(fakeOCREngine("fake-registry")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.UnregisterOCREngine("fake-registry") })
+	if err := service.RegisterOCREngine(fakeOCREngine("fake-registry")); !errors.Is(err, service.ErrInvalidOCREngine) {
+		t.Errorf("duplicate engine: got %v", err)
+	}
+	if names := service.RegisteredOCREngines(); !slices.Contains(names, "tesseract") || !slices.Contains(names, "fake-registry") {
+		t.Errorf("registered engines = %v", names)
+	}
+	if service.UnregisterOCREngine("missing") {
+		t.Error("unregistering an unknown engine reported success")
+	}
+
+	ocrService := service.NewOCRService(getTestLogger())
+	_, err := ocrService.ExtractTextWithOptions(t.Context(), textPDF(t, "a"), &service.OCROptions{Engine: "missing"})
+	if !errors.Is(err, service.ErrUnknownOCREngine) {
+		t.Errorf("unknown engine: got %v", err)
+	}
+}
+
+func TestOCRService_FakeEngine(t *testing.T) {
+	ocrService := fakeOCRService(fakeOCREngine("fake"))
+	if !ocrService.IsAvailable() {
+		t.Fatal("fake engine should be available")
+	}
+	input := textPDF(t, "one", "two")
+	opts := &service.OCROptions{Format: "png"}
+
+	result, err := ocrService.Recognize(t.Context(), input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 2 || result.Pages[1].Page != 2 || result.Pages[0].Width == 0 {
+		t.Fatalf("pages = %+v", result.Pages)
+	}
+	if got := result.Pages[0].Lines[0].Text(); got != "Hello world" {
+		t.Errorf("line text = %q", got)
+	}
+	if review := result.ReviewPages(); !slices.Equal(review, []int{1, 2}) {
+		t.Errorf("review pages = %v", review)
+	}
+
+	text, err := ocrService.ExtractTextWithOptions(t.Context(), input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(text, "Hello world") != 2 {
+		t.Errorf("text = %q", text)
+	}
+
+	searchable, err := ocrService.CreateSearchablePDFWithOptions(t.Context(), input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := api.PageCount(bytes.NewReader(searchable), nil); err != nil || n != 2 {
+		t.Errorf("searchable PDF has %d pages, %v", n, err)
+	}
+}
+
+func TestOCRService_FakeEngineHybrid(t *testing.T) {
+	ocrService := fakeOCRService(fakeOCREngine("fake"))
+
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	img.SetGray(50, 50, color.Gray{})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	scan, err := service.NewJPGToPDFService(getTestLogger()).ConvertBytes(buf.Bytes(), "scan.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &service.OCROptions{Format: "png", Mode: service.SearchableHybrid}
+	output, err := ocrService.CreateSearchablePDFWithOptions(t.Context(), scan, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(output, scan) {
+		t.Fatal("scanned page got no text layer")
+	}
+	// The page now has text, so a second pass leaves it alone.
+	again, err := ocrService.CreateSearchablePDFWithOptions(t.Context(), output, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, output) {
+		t.Error("page with an OCR text layer was processed again")
+	}
+}
+
+// pickyOCREngine fails on images of one width and reads others like
+// fakeOCREngine.
+type pickyOCREngine struct {
+	service.OCREngine
+	failWidth int
+}
+
+func (e pickyOCREngine) Recognize(ctx context.Context, img []byte, opts *service.OCROptions) (*service.OCRPage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width == e.failWidth {
+		return nil, errors.New("unreadable page")
+	}
+	return e.OCREngine.Recognize(ctx, img, opts)
+}
+
+func TestOCRService_SkipsFailedPages(t *testing.T) {
+	ocrService := fakeOCRService(pickyOCREngine{fakeOCREngine("picky"), 120})
+	input := multiPageTIFF(100, 120, 140)
+
+	text, err := ocrService.ExtractText(t.Context(), input, "eng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(text, "Hello world") != 2 {
+		t.Errorf("text = %q, want the two readable pages", text)
+	}
+
+	if _, err := ocrService.Recognize(t.Context(), input, nil); err == nil {
+		t.Error("Recognize should fail on an unreadable page")
+	}
+	if _, err := ocrService.CreateSearchablePDF(t.Context(), input, "eng"); err == nil {
+		t.Error("CreateSearchablePDF should fail on an unreadable page")
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// maxTIFFPages bounds the pages read from one TIFF file.
+const maxTIFFPages = 10000
+
+var errUnsupportedOCRInput = errors.New("unsupported OCR input: expected a PDF, PNG, JPEG or TIFF file")
+
+// pageImage is one page of an image input, ready for an OCR engine.
+type pageImage struct {
+	data   []byte
+	format string
+}
+
+// isPDF reports whether data looks like a PDF. Like most readers, it
+// allows some bytes before the header.
+func isPDF(data []byte) bool {
+	return bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-"))
+}
+
+// imageInput is an image input split into pages. PNG and JPEG images are
+// one page, passed on as they are; TIFF pages are decoded and re-encoded
+// as PNG one at a time, when asked for.
+type imageInput struct {
+	data  []byte
+	kind  string
+	order binary.ByteOrder
+	// ifds holds the offset of each TIFF page's image file directory.
+	ifds []uint32
+}
+
+func openImageInput(data []byte) (*imageInput, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return &imageInput{data: data, kind: "png"}, nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return &imageInput{data: data, kind: "jpeg"}, nil
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return openTIFF(data)
+	}
+	return nil, errUnsupportedOCRInput
+}
+
+func (in *imageInput) pageCount() int {
+	if in.kind == "tiff" {
+		return len(in.ifds)
+	}
+	return 1
+}
+
+// page returns page n, counting from 1.
+func (in *imageInput) page(n int) (pageImage, error) {
+	if in.kind != "tiff" {
+		return pageImage{data: in.data, format: in.kind}, nil
+	}
+	img, err := tiff.Decode(io.NewSectionReader(tiffPageReader{in, in.ifds[n-1]}, 0, int64(len(in.data))))
+	if err != nil {
+		return pageImage{}, fmt.Errorf("tiff: page %d: %w", n, err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return pageImage{}, err
+	}
+	return pageImage{data: buf.Bytes(), format: "png"}, nil
+}
+
+// openTIFF walks the chain of image file directories (IFDs) of a TIFF
+// file without decoding any page.
+func openTIFF(data []byte) (*imageInput, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("tiff: truncated header")
+	}
+	in := &imageInput{data: data, kind: "tiff", order: binary.LittleEndian}
+	if data[0] == 'M' {
+		in.order = binary.BigEndian
+	}
+
+	seen := map[uint32]bool{}
+	for offset := in.order.Uint32(data[4:8]); offset != 0; {
+		if seen[offset] || len(in.ifds) == maxTIFFPages {
+			return nil, fmt.Errorf("tiff: too many pages or a loop in the page chain")
+		}
+		seen[offset] = true
+		if int64(offset)+2 > int64(len(data)) {
+			return nil, fmt.Errorf("tiff: page %d: offset out of range", len(in.ifds)+1)
+		}
+		entries := int64(in.order.Uint16(data[offset:]))
+		next := int64(offset) + 2 + entries*12
+		if next+4 > int64(len(data)) {
+			return nil, fmt.Errorf("tiff: page %d: directory out of range", len(in.ifds)+1)
+		}
+		in.ifds = append(in.ifds, offset)
+		offset = in.order.Uint32(data[next:])
+	}
+	if len(in.ifds) == 0 {
+		return nil, fmt.Errorf("tiff: no pages")
+	}
+	return in, nil
+}
+
+// tiffPageReader reads a TIFF file as if its header pointed at the IFD at
+// ifd. The decoder only reads the first IFD, so this makes it decode that
+// page; all other offsets in a TIFF are absolute and stay valid.
+type tiffPageReader struct {
+	in  *imageInput
+	ifd uint32
+}
+
+func (r tiffPageReader) ReadAt(p []byte, off int64) (int, error) {
+	data := r.in.data
+	if off < 0 {
+		return 0, errors.New("tiff: negative offset")
+	}
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := 0
+	if off < 8 {
+		var header [8]byte
+		copy(header[:4], data[:4])
+		r.in.order.PutUint32(header[4:], r.ifd)
+		n = copy(p, header[off:])
+	}
+	n += copy(p[n:], data[off+int64(n):])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// multiPageTIFF returns an uncompressed grayscale TIFF with one page of
+// each width, all 50 pixels high.
+func multiPageTIFF(widths ...int) []byte {
+	const height = 50
+	le := binary.LittleEndian
+	buf := []byte("II*\x00\x00\x00\x00\x00")
+	next := 4 // where the offset of the next IFD goes
+	for _, w := range widths {
+		pixels := len(buf)
+		buf = append(buf, bytes.Repeat([]byte{0xFF}, w*height)...)
+
+		le.PutUint32(buf[next:], uint32(len(buf)))
+		tags := [][2]uint32{
+			{256, uint32(w)}, {257, height}, {258, 8}, {259, 1}, {262, 1},
+			{273, uint32(pixels)}, {277, 1}, {278, height}, {279, uint32(w * height)},
+		}
+		buf = le.AppendUint16(buf, uint16(len(tags)))
+		for _, tag := range tags {
+			buf = le.AppendUint16(buf, uint16(tag[0]))
+			buf = le.AppendUint16(buf, 4) // LONG
+			buf = le.AppendUint32(buf, 1)
+			buf = le.AppendUint32(buf, tag[1])
+		}
+		next = len(buf)
+		buf = le.AppendUint32(buf, 0)
+	}
+	return buf
+}
+
+func TestOCRService_ImageInput(t *testing.T) {
+	// Images are recognised as they are, so no renderer is needed.
+	ocrService := service.NewOCRServiceWithRenderer(getTestLogger(), fakeOCREngine("fake"), missingRenderer{})
+	if !ocrService.IsAvailable() {
+		t.Fatal("OCR of images should not need a renderer")
+	}
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string][]byte{"png": pngData.Bytes(), "jpeg": jpegData.Bytes()} {
+		result, err := ocrService.Recognize(t.Context(), input, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(result.Pages) != 1 || result.Pages[0].Width != 200 || result.Pages[0].Height != 100 {
+			t.Errorf("%s: pages = %+v", name, result.Pages)
+		}
+
+		text, err := ocrService.ExtractText(t.Context(), input, "eng")
+		if err != nil || strings.TrimSpace(text) != "Hello world" {
+			t.Errorf("%s: text = %q, %v", name, text, err)
+		}
+
+		searchable, err := ocrService.CreateSearchablePDF(t.Context(), input, "eng")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if n, err := api.PageCount(bytes.NewReader(searchable), nil); err != nil || n != 1 {
+			t.Errorf("%s: searchable PDF has %d pages, %v", name, n, err)
+		}
+	}
+
+	if _, err := ocrService.ExtractText(t.Context(), []byte("GIF89a"), "eng"); err == nil {
+		t.Error("expected error for unsupported input")
+	}
+	if _, err := ocrService.ExtractText(t.Context(), textPDF(t, "a"), "eng"); err == nil || !strings.Contains(err.Error(), "dependencies missing") {
+		t.Errorf("PDF without a renderer: got %v", err)
+	}
+}
+
+func TestOCRService_MultiPageTIFF(t *testing.T) {
+	ocrService := service.NewOCRServiceWithEngine(getTestLogger(), fakeOCREngine("fake"))
+	input := multiPageTIFF(100, 120, 140)
+
+	result, err := ocrService.Recognize(t.Context(), input, &service.OCROptions{Pages: "2-3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 2 || result.Pages[0].Page != 2 || result.Pages[0].Width != 120 || result.Pages[1].Width != 140 {
+		t.Errorf("pages = %+v", result.Pages)
+	}
+
+	// Point page 1's pixel data past the end of the file: only selected
+	// pages are decoded, so the others still read.
+	broken := bytes.Clone(input)
+	ifd := binary.LittleEndian.Uint32(broken[4:])
+	binary.LittleEndian.PutUint32(broken[ifd+2+5*12+8:], 0xFFFFFFF0) // StripOffsets
+	if _, err := ocrService.Recognize(t.Context(), broken, &service.OCROptions{Pages: "2-3"}); err != nil {
+		t.Errorf("unselected broken page: %v", err)
+	}
+	if _, err := ocrService.Recognize(t.Context(), broken, &service.OCROptions{Pages: "1"}); err == nil {
+		t.Error("expected error for a broken selected page")
+	}
+
+	searchable, err := ocrService.CreateSearchablePDFWithOptions(t.Context(), input, &service.OCROptions{Mode: service.SearchableHybrid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := api.PageCount(bytes.NewReader(searchable), nil); err != nil || n != 3 {
+		t.Errorf("searchable PDF has %d pages, %v", n, err)
+	}
+}
+
+// missingRenderer is a renderer whose binary is not installed.
+type missingRenderer struct{ fakeRenderer }
+
+func (missingRenderer) Available() bool { return false }
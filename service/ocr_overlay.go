@@ -0,0 +1,215 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// ocrFontName is the BaseFont of the text layer's font. Like Tesseract's
+// own output it has no glyphs: the text is never painted, and every
+// character is half an em wide so it can be stretched over its word.
+const ocrFontName = "GlyphLessFont"
+
+// createHybridPDF adds an invisible text layer to the selected pages that
+// have no text, keeping every page and the document as they are.
+func (s *ocrService) createHybridPDF(ctx context.Context, input []byte, opts *OCROptions) ([]byte, error) {
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, opts.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []string
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		marks, err := pageMarks(pdfCtx, p)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		if marks.text || marks.hiddenText || marks.empty() {
+			continue
+		}
+		pages = append(pages, strconv.Itoa(p))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(AttrPageCount.Int(len(pages)))
+	if len(pages) == 0 {
+		s.log.Info("No pages need OCR")
+		return input, nil
+	}
+
+	ocrOpts := *opts
+	ocrOpts.Pages = strings.Join(pages, ",")
+	recognised, err := s.ocrPages(ctx, input, &ocrOpts, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var font *types.IndirectRef
+	for _, p := range recognised {
+		if len(p.result.Lines) == 0 {
+			continue
+		}
+		if font == nil {
+			if font, err = newOCRFont(pdfCtx); err != nil {
+				return nil, err
+			}
+		}
+		if err := addTextLayer(pdfCtx, p.page, *p.result, *font); err != nil {
+			return nil, fmt.Errorf("page %d: %w", p.page, err)
+		}
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Text layer added", logger.Int("pages", len(recognised)), logger.Int("size", len(output)))
+	return output, nil
+}
+
+// addTextLayer draws the words of page in invisible text over the page.
+// Word boxes are in pixels of the page as rendered, with any /Rotate
+// applied, so they are mapped back through the display matrix.
+func addTextLayer(pdfCtx *model.Context, pageNr int, page OCRPage, font types.IndirectRef) error {
+	d, _, inh, err := pdfCtx.PageDict(pageNr, false)
+	if err != nil {
+		return err
+	}
+	resources, err := ownResources(pdfCtx, d, inh)
+	if err != nil {
+		return err
+	}
+	fonts := dictEntry(pdfCtx, resources, "Font")
+	if fonts == nil {
+		fonts = types.Dict{}
+		resources["Font"] = fonts
+	}
+	name := "OCRText"
+	for i := 2; fonts[name] != nil; i++ {
+		name = "OCRText" + strconv.Itoa(i)
+	}
+	fonts[name] = font
+
+	m, _, height := displayMatrix(visibleBox(inh), normalizedRotation(inh.Rotate))
+	scale := 72 / float64(page.DPI)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "q %s cm\nBT 3 Tr\n", m.inverse().operands())
+	for _, line := range page.Lines {
+		for i, w := range line.Words {
+			text := []rune(w.Text)
+			// Every word but the last carries a space reaching to the next
+			// word, so extracted text keeps its word breaks.
+			right := w.BBox[2]
+			if i+1 < len(line.Words) {
+				text = append(text, ' ')
+				right = max(right, line.Words[i+1].BBox[0])
+			}
+			size := float64(w.BBox[3]-w.BBox[1]) * scale
+			width := float64(right-w.BBox[0]) * scale
+			if size <= 0 || width <= 0 {
+				continue
+			}
+			x := float64(w.BBox[0]) * scale
+			// The font's descent is a fifth of its size.
+			y := height - float64(w.BBox[3])*scale + size*0.2
+			stretch := width / (float64(len(text)) * size / 2) * 100
+			fmt.Fprintf(&b, "/%s %s Tf %s Tz 1 0 0 1 %s %s Tm <%s> Tj\n",
+				name, pdfNumber(size), pdfNumber(stretch), pdfNumber(x), pdfNumber(y), glyphlessCodes(text))
+		}
+	}
+	b.WriteString("ET\nQ\n")
+
+	return wrapPageContent(pdfCtx, d, []byte("q\n"), append([]byte("\nQ\n"), b.Bytes()...))
+}
+
+// glyphlessCodes encodes text as two-byte codes, which the text layer's
+// font maps straight to Unicode. Characters outside the Basic
+// Multilingual Plane become U+FFFD.
+func glyphlessCodes(text []rune) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r > 0xFFFF {
+			r = 0xFFFD
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// newOCRFont adds the text layer's Type0 font: Identity-H encoded, with
+// a ToUnicode map sending each two-byte code to the same code point.
+func newOCRFont(pdfCtx *model.Context) (*types.IndirectRef, error) {
+	var cmap bytes.Buffer
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// A bfrange may only vary in its last byte.
+	for hi := 0; hi < 256; hi += 100 {
+		n := min(100, 256-hi)
+		fmt.Fprintf(&cmap, "%d beginbfrange\n", n)
+		for j := hi; j < hi+n; j++ {
+			fmt.Fprintf(&cmap, "<%02X00> <%02XFF> <%02X00>\n", j, j, j)
+		}
+		cmap.WriteString("endbfrange\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	toUnicode, err := pdfCtx.StreamDictIndRef(cmap.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := pdfCtx.IndRefForNewObject(types.Dict{
+		"Type":        types.Name("FontDescriptor"),
+		"FontName":    types.Name(ocrFontName),
+		"Flags":       types.Integer(5),
+		"FontBBox":    types.Array{types.Integer(0), types.Integer(-200), types.Integer(500), types.Integer(800)},
+		"ItalicAngle": types.Integer(0),
+		"Ascent":      types.Integer(800),
+		"Descent":     types.Integer(-200),
+		"CapHeight":   types.Integer(800),
+		"StemV":       types.Integer(80),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cidFont, err := pdfCtx.IndRefForNewObject(types.Dict{
+		"Type":     types.Name("Font"),
+		"Subtype":  types.Name("CIDFontType2"),
+		"BaseFont": types.Name(ocrFontName),
+		"CIDSystemInfo": types.Dict{
+			"Registry":   types.StringLiteral("Adobe"),
+			"Ordering":   types.StringLiteral("Identity"),
+			"Supplement": types.Integer(0),
+		},
+		"FontDescriptor": *descriptor,
+		"DW":             types.Integer(500),
+		"CIDToGIDMap":    types.Name("Identity"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pdfCtx.IndRefForNewObject(types.Dict{
+		"Type":            types.Name("Font"),
+		"Subtype":         types.Name("Type0"),
+		"BaseFont":        types.Name(ocrFontName),
+		"Encoding":        types.Name("Identity-H"),
+		"DescendantFonts": types.Array{*cidFont},
+		"ToUnicode":       *toUnicode,
+	})
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// PageRenderer rasterises PDF pages for OCR. The default renderer runs
+// pdftoppm; others can be passed to NewOCRServiceWithRenderer.
+type PageRenderer interface {
+	// Name identifies the renderer in errors.
+	Name() string
+	// Available reports whether the renderer can run, for example
+	// whether its binary is installed.
+	Available() bool
+	// RenderPage renders one page of the PDF at path as a "png" or
+	// "jpeg" image at dpi, in grayscale when gray is set.
+	RenderPage(ctx context.Context, path string, page, dpi int, format string, gray bool) ([]byte, error)
+}
+
+// popplerRenderer renders pages with pdftoppm from poppler-utils.
+type popplerRenderer struct{}
+
+// NewPopplerRenderer returns the pdftoppm page renderer.
+func NewPopplerRenderer() PageRenderer {
+	return popplerRenderer{}
+}
+
+func (popplerRenderer) Name() string    { return "pdftoppm" }
+func (popplerRenderer) Available() bool { return installed("pdftoppm") }
+
+func (popplerRenderer) RenderPage(ctx context.Context, path string, page, dpi int, format string, gray bool) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "render-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imgPath, err := renderPage(ctx, path, tmpDir, page, dpi, format, gray)
+	if err != nil {
+		return nil, err
+	}
+	return readFile(ctx, imgPath)
+}
+
+// renderPage renders one page with pdftoppm as a "png" or "jpeg" image,
+// optionally in grayscale, and returns the image path.
+func renderPage(ctx context.Context, pdfPath, dir string, page, dpi int, format string, gray bool) (string, error) {
+	n := strconv.Itoa(page)
+	prefix := filepath.Join(dir, "page-"+n)
+	args := []string{"-" + format, "-r", strconv.Itoa(dpi), "-f", n, "-l", n, "-singlefile", pdfPath, prefix}
+	if gray {
+		args = append([]string{"-gray"}, args...)
+	}
+	if output, err := runCommand(ctx, "pdftoppm", args, AttrPage.Int(page)); err != nil {
+		return "", fmt.Errorf("pdftoppm failed on page %d: %v, output: %s", page, err, string(output))
+	}
+	if format == "jpeg" {
+		return prefix + ".jpg", nil
+	}
+	return prefix + "." + format, nil
+}
+
+// rendererOf returns the renderer an OCR service renders pages with, so
+// other services rendering pages for it use the same one.
+func rendererOf(ocr OCRService) PageRenderer {
+	if s, ok := ocr.(*ocrService); ok {
+		return s.renderer
+	}
+	return NewPopplerRenderer()
+}
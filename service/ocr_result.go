@@ -0,0 +1,438 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// OCRResult is the recognised text of a document with its layout.
+type OCRResult struct {
+	Pages []OCRPage `json:"pages"`
+	// ReviewThreshold is the threshold the pages were flagged against.
+	ReviewThreshold float64 `json:"review_threshold"`
+}
+
+// OCRPage is one recognised page. Boxes are [left top right bottom] in
+// pixels of the page image, which was rendered at DPI.
+type OCRPage struct {
+	Page   int       `json:"page"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	DPI    int       `json:"dpi,omitempty"`
+	Lines  []OCRLine `json:"lines"`
+	// MeanConfidence is the mean word confidence from 0 to 100.
+	MeanConfidence float64 `json:"mean_confidence"`
+	// NeedsReview is set when MeanConfidence is below the review
+	// threshold. Pages without words are not flagged.
+	NeedsReview bool `json:"needs_review"`
+}
+
+// OCRLine is a line of words. Block and Paragraph number the text block
+// and paragraph the line belongs to on its page, from 1.
+type OCRLine struct {
+	Block     int       `json:"block"`
+	Paragraph int       `json:"paragraph"`
+	BBox      [4]int    `json:"bbox"`
+	Words     []OCRWord `json:"words"`
+}
+
+// OCRWord is a recognised word with its confidence from 0 to 100.
+type OCRWord struct {
+	Text       string  `json:"text"`
+	BBox       [4]int  `json:"bbox"`
+	Confidence float64 `json:"confidence"`
+}
+
+func (s *ocrService) Recognize(ctx context.Context, input []byte, opts *OCROptions) (*OCRResult, error) {
+	ctx, span := startSpan(ctx, "OCRService.Recognize", AttrInputBytes.Int(len(input)))
+	result, err := s.recognize(ctx, input, opts)
+	var review int
+	if result != nil {
+		review = len(result.ReviewPages())
+	}
+	endSpan(span, err, attribute.Int("ocr.review_pages", review))
+	return result, err
+}
+
+func (s *ocrService) recognize(ctx context.Context, input []byte, opts *OCROptions) (*OCRResult, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("OCRService.Recognize called", logger.String("lang", o.Language))
+
+	pages, err := s.ocrPages(ctx, input, &o, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OCRResult{ReviewThreshold: o.ReviewThreshold}
+	for _, p := range pages {
+		result.Pages = append(result.Pages, *p.result)
+	}
+	result.flag()
+
+	s.log.Info("OCR recognition completed", logger.Int("pages", len(result.Pages)), logger.Int("review", len(result.ReviewPages())))
+	return result, nil
+}
+
+// flag computes each page's mean confidence and review flag.
+func (r *OCRResult) flag() {
+	for i := range r.Pages {
+		p := &r.Pages[i]
+		var sum float64
+		var n int
+		for _, line := range p.Lines {
+			for _, w := range line.Words {
+				sum += w.Confidence
+				n++
+			}
+		}
+		p.MeanConfidence, p.NeedsReview = 0, false
+		if n > 0 {
+			p.MeanConfidence = sum / float64(n)
+			p.NeedsReview = p.MeanConfidence < r.ReviewThreshold
+		}
+	}
+}
+
+// ReviewPages returns the pages flagged for manual review.
+func (r *OCRResult) ReviewPages() []int {
+	var pages []int
+	for _, p := range r.Pages {
+		if p.NeedsReview {
+			pages = append(pages, p.Page)
+		}
+	}
+	return pages
+}
+
+// Text returns the recognised text, one line per line and a blank line
+// between paragraphs and pages.
+func (r *OCRResult) Text() string {
+	var b strings.Builder
+	for i, p := range r.Pages {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for j, line := range p.Lines {
+			if j > 0 && (line.Block != p.Lines[j-1].Block || line.Paragraph != p.Lines[j-1].Paragraph) {
+				b.WriteString("\n")
+			}
+			b.WriteString(line.Text())
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// Text returns the words of the line separated by spaces.
+func (l OCRLine) Text() string {
+	words := make([]string, len(l.Words))
+	for i, w := range l.Words {
+		words[i] = w.Text
+	}
+	return strings.Join(words, " ")
+}
+
+// paragraphs splits a page's lines into runs sharing a block and
+// paragraph.
+func (p OCRPage) paragraphs() [][]OCRLine {
+	var paras [][]OCRLine
+	for i, line := range p.Lines {
+		if i == 0 || line.Block != p.Lines[i-1].Block || line.Paragraph != p.Lines[i-1].Paragraph {
+			paras = append(paras, nil)
+		}
+		paras[len(paras)-1] = append(paras[len(paras)-1], line)
+	}
+	return paras
+}
+
+// blocks splits paragraphs into runs sharing a block.
+func blocks(paras [][]OCRLine) [][][]OCRLine {
+	var out [][][]OCRLine
+	for i, para := range paras {
+		if i == 0 || para[0].Block != paras[i-1][0].Block {
+			out = append(out, nil)
+		}
+		out[len(out)-1] = append(out[len(out)-1], para)
+	}
+	return out
+}
+
+func linesBox(lines []OCRLine) [4]int {
+	box := lines[0].BBox
+	for _, l := range lines[1:] {
+		box = unionBox(box, l.BBox)
+	}
+	return box
+}
+
+func paragraphsBox(paras [][]OCRLine) [4]int {
+	box := linesBox(paras[0])
+	for _, p := range paras[1:] {
+		box = unionBox(box, linesBox(p))
+	}
+	return box
+}
+
+func unionBox(a, b [4]int) [4]int {
+	return [4]int{min(a[0], b[0]), min(a[1], b[1]), max(a[2], b[2]), max(a[3], b[3])}
+}
+
+// ParseOCRTSV reads Tesseract's TSV output. Pages are numbered by the
+// page_num column.
+// Fields are split on tabs only: TSV has no quoting, so a word that is
+// just a quote mark is read as it is.
+func ParseOCRTSV(data []byte) (*OCRResult, error) {
+	result := &OCRResult{ReviewThreshold: DefaultReviewThreshold}
+	var page *OCRPage
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		rec := strings.SplitN(line, "\t", 12)
+		if i == 0 && rec[0] == "level" {
+			continue
+		}
+		if len(rec) < 11 {
+			return nil, fmt.Errorf("ocr TSV line %d: expected at least 11 columns, got %d", i+1, len(rec))
+		}
+		var err error
+		var n [10]int
+		for j := range n {
+			if n[j], err = strconv.Atoi(rec[j]); err != nil {
+				return nil, fmt.Errorf("ocr TSV line %d: %w", i+1, err)
+			}
+		}
+		conf, err := strconv.ParseFloat(rec[10], 64)
+		if err != nil {
+			return nil, fmt.Errorf("ocr TSV line %d: %w", i+1, err)
+		}
+		text := ""
+		if len(rec) > 11 {
+			text = strings.TrimSpace(rec[11])
+		}
+
+		level, pageNum, block, par := n[0], n[1], n[2], n[3]
+		box := [4]int{n[6], n[7], n[6] + n[8], n[7] + n[9]}
+		if page == nil || page.Page != pageNum {
+			result.Pages = append(result.Pages, OCRPage{Page: pageNum})
+			page = &result.Pages[len(result.Pages)-1]
+		}
+		switch level {
+		case 1:
+			page.Width, page.Height = n[8], n[9]
+		case 4:
+			page.Lines = append(page.Lines, OCRLine{Block: block, Paragraph: par, BBox: box})
+		case 5:
+			if text == "" || conf < 0 || len(page.Lines) == 0 {
+				continue
+			}
+			line := &page.Lines[len(page.Lines)-1]
+			line.Words = append(line.Words, OCRWord{Text: text, BBox: box, Confidence: conf})
+		}
+	}
+
+	// Drop lines that held only whitespace.
+	for i := range result.Pages {
+		p := &result.Pages[i]
+		lines := p.Lines[:0]
+		for _, l := range p.Lines {
+			if len(l.Words) > 0 {
+				lines = append(lines, l)
+			}
+		}
+		p.Lines = lines
+	}
+	result.flag()
+	return result, nil
+}
+
+// TSV writes the result in Tesseract's TSV format.
+func (r *OCRResult) TSV() []byte {
+	var b bytes.Buffer
+	b.WriteString("level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n")
+	row := func(level, page, block, par, line, word int, box [4]int, conf float64, text string) {
+		fmt.Fprintf(&b, "%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n", level, page, block, par, line, word,
+			box[0], box[1], box[2]-box[0], box[3]-box[1], strconv.FormatFloat(conf, 'f', -1, 64), text)
+	}
+	for _, p := range r.Pages {
+		row(1, p.Page, 0, 0, 0, 0, [4]int{0, 0, p.Width, p.Height}, -1, "")
+		for bi, block := range blocks(p.paragraphs()) {
+			row(2, p.Page, bi+1, 0, 0, 0, paragraphsBox(block), -1, "")
+			for pi, para := range block {
+				row(3, p.Page, bi+1, pi+1, 0, 0, linesBox(para), -1, "")
+				for li, line := range para {
+					row(4, p.Page, bi+1, pi+1, li+1, 0, line.BBox, -1, "")
+					for wi, w := range line.Words {
+						row(5, p.Page, bi+1, pi+1, li+1, wi+1, w.BBox, w.Confidence, strings.ReplaceAll(w.Text, "\t", " "))
+					}
+				}
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// HOCR writes the result as an hOCR 1.2 document.
+func (r *OCRResult) HOCR() []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+ <head>
+  <title></title>
+  <meta http-equiv="Content-Type" content="text/html;charset=utf-8"/>
+  <meta name="ocr-system" content="convert-pdf-go-sdk"/>
+  <meta name="ocr-capabilities" content="ocr_page ocr_carea ocr_par ocr_line ocrx_word ocrp_wconf"/>
+ </head>
+ <body>
+`)
+	bbox := func(box [4]int) string {
+		return fmt.Sprintf("bbox %d %d %d %d", box[0], box[1], box[2], box[3])
+	}
+	for _, p := range r.Pages {
+		title := fmt.Sprintf("%s; ppageno %d", bbox([4]int{0, 0, p.Width, p.Height}), p.Page-1)
+		if p.DPI > 0 {
+			title += fmt.Sprintf("; scan_res %d %d", p.DPI, p.DPI)
+		}
+		fmt.Fprintf(&b, "  <div class=\"ocr_page\" id=\"page_%d\" title=\"%s\">\n", p.Page, title)
+		lineNo, wordNo := 0, 0
+		for bi, block := range blocks(p.paragraphs()) {
+			fmt.Fprintf(&b, "   <div class=\"ocr_carea\" id=\"block_%d_%d\" title=\"%s\">\n", p.Page, bi+1, bbox(paragraphsBox(block)))
+			for pi, para := range block {
+				fmt.Fprintf(&b, "    <p class=\"ocr_par\" id=\"par_%d_%d_%d\" title=\"%s\">\n", p.Page, bi+1, pi+1, bbox(linesBox(para)))
+				for _, line := range para {
+					lineNo++
+					fmt.Fprintf(&b, "     <span class=\"ocr_line\" id=\"line_%d_%d\" title=\"%s\">", p.Page, lineNo, bbox(line.BBox))
+					for i, w := range line.Words {
+						wordNo++
+						if i > 0 {
+							b.WriteString(" ")
+						}
+						fmt.Fprintf(&b, "<span class=\"ocrx_word\" id=\"word_%d_%d\" title=\"%s; x_wconf %d\">%s</span>",
+							p.Page, wordNo, bbox(w.BBox), int(w.Confidence+0.5), html.EscapeString(w.Text))
+					}
+					b.WriteString("</span>\n")
+				}
+				b.WriteString("    </p>\n")
+			}
+			b.WriteString("   </div>\n")
+		}
+		b.WriteString("  </div>\n")
+	}
+	b.WriteString(" </body>\n</html>\n")
+	return b.Bytes()
+}
+
+type altoDocument struct {
+	XMLName     xml.Name `xml:"alto"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	Description altoDescription
+	Layout      []altoPage `xml:"Layout>Page"`
+}
+
+type altoDescription struct {
+	MeasurementUnit string `xml:"MeasurementUnit"`
+	Software        string `xml:"OCRProcessing>ocrProcessingStep>processingSoftware>softwareName"`
+}
+
+type altoBox struct {
+	HPos   int `xml:"HPOS,attr"`
+	VPos   int `xml:"VPOS,attr"`
+	Width  int `xml:"WIDTH,attr"`
+	Height int `xml:"HEIGHT,attr"`
+}
+
+type altoPage struct {
+	ID         string `xml:"ID,attr"`
+	PhysicalNr int    `xml:"PHYSICAL_IMG_NR,attr"`
+	Width      int    `xml:"WIDTH,attr"`
+	Height     int    `xml:"HEIGHT,attr"`
+	PrintSpace struct {
+		altoBox
+		Blocks []altoTextBlock `xml:"TextBlock"`
+	}
+}
+
+type altoTextBlock struct {
+	ID string `xml:"ID,attr"`
+	altoBox
+	Lines []altoTextLine `xml:"TextLine"`
+}
+
+type altoTextLine struct {
+	ID string `xml:"ID,attr"`
+	altoBox
+	Items []any
+}
+
+type altoString struct {
+	XMLName xml.Name `xml:"String"`
+	ID      string   `xml:"ID,attr"`
+	altoBox
+	WC      string `xml:"WC,attr"`
+	Content string `xml:"CONTENT,attr"`
+}
+
+type altoSpace struct {
+	XMLName xml.Name `xml:"SP"`
+}
+
+func newAltoBox(box [4]int) altoBox {
+	return altoBox{HPos: box[0], VPos: box[1], Width: box[2] - box[0], Height: box[3] - box[1]}
+}
+
+// ALTO writes the result as an ALTO 4 XML document with pixel
+// measurements. Each paragraph becomes a TextBlock.
+func (r *OCRResult) ALTO() ([]byte, error) {
+	doc := altoDocument{
+		Xmlns:       "http://www.loc.gov/standards/alto/ns-v4#",
+		Description: altoDescription{MeasurementUnit: "pixel", Software: "convert-pdf-go-sdk"},
+	}
+	blockNo, lineNo, wordNo := 0, 0, 0
+	for _, p := range r.Pages {
+		page := altoPage{ID: fmt.Sprintf("page_%d", p.Page), PhysicalNr: p.Page, Width: p.Width, Height: p.Height}
+		page.PrintSpace.altoBox = altoBox{Width: p.Width, Height: p.Height}
+		for _, para := range p.paragraphs() {
+			blockNo++
+			block := altoTextBlock{ID: fmt.Sprintf("block_%d", blockNo), altoBox: newAltoBox(linesBox(para))}
+			for _, line := range para {
+				lineNo++
+				tl := altoTextLine{ID: fmt.Sprintf("line_%d", lineNo), altoBox: newAltoBox(line.BBox)}
+				for i, w := range line.Words {
+					wordNo++
+					if i > 0 {
+						tl.Items = append(tl.Items, altoSpace{})
+					}
+					tl.Items = append(tl.Items, altoString{
+						ID:      fmt.Sprintf("string_%d", wordNo),
+						altoBox: newAltoBox(w.BBox),
+						WC:      strconv.FormatFloat(w.Confidence/100, 'f', 2, 64),
+						Content: w.Text,
+					})
+				}
+				block.Lines = append(block.Lines, tl)
+			}
+			page.PrintSpace.Blocks = append(page.PrintSpace.Blocks, block)
+		}
+		doc.Layout = append(doc.Layout, page)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
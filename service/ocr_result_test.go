@@ -0,0 +1,136 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// tesseractTSV is trimmed output of tesseract 5 for a two-paragraph page.
+const tesseractTSV = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t2480\t3508\t-1\t\n" +
+	"2\t1\t1\t0\t0\t0\t200\t300\t900\t120\t-1\t\n" +
+	"3\t1\t1\t1\t0\t0\t200\t300\t900\t120\t-1\t\n" +
+	"4\t1\t1\t1\t1\t0\t200\t300\t900\t50\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t200\t300\t300\t50\t96.5\tInvoice\n" +
+	"5\t1\t1\t1\t1\t2\t520\t300\t200\t50\t91.5\tno.\n" +
+	"5\t1\t1\t1\t1\t3\t740\t300\t10\t50\t95\t \n" +
+	"4\t1\t1\t1\t2\t0\t200\t370\t600\t50\t-1\t\n" +
+	"5\t1\t1\t1\t2\t1\t200\t370\t600\t50\t42\tT0ta1\n" +
+	"2\t1\t2\t0\t0\t0\t200\t600\t400\t50\t-1\t\n" +
+	"3\t1\t2\t1\t0\t0\t200\t600\t400\t50\t-1\t\n" +
+	"4\t1\t2\t1\t1\t0\t200\t600\t400\t50\t-1\t\n" +
+	"5\t1\t2\t1\t1\t1\t200\t600\t400\t50\t90\t<Paid>\n"
+
+func TestParseOCRTSV(t *testing.T) {
+	result, err := service.ParseOCRTSV([]byte(tesseractTSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 1 {
+		t.Fatalf("pages = %d", len(result.Pages))
+	}
+	page := result.Pages[0]
+	if page.Width != 2480 || page.Height != 3508 || len(page.Lines) != 3 {
+		t.Fatalf("page = %+v", page)
+	}
+	if got := page.Lines[0].Words[1]; got.Text != "no." || got.BBox != [4]int{520, 300, 720, 350} || got.Confidence != 91.5 {
+		t.Errorf("word = %+v", got)
+	}
+	if page.MeanConfidence != 80 || page.NeedsReview {
+		t.Errorf("mean confidence = %v, review %v", page.MeanConfidence, page.NeedsReview)
+	}
+	if want := "Invoice no.\nT0ta1\n\n<Paid>\n"; result.Text() != want {
+		t.Errorf("text = %q, want %q", result.Text(), want)
+	}
+
+	reparsed, err := service.ParseOCRTSV(result.TSV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.Text() != result.Text() || reparsed.Pages[0].Lines[2].BBox != page.Lines[2].BBox {
+		t.Errorf("TSV round trip = %q", reparsed.Text())
+	}
+
+	if _, err := service.ParseOCRTSV([]byte("1\t1\t0\n")); err == nil {
+		t.Error("expected error for short rows")
+	}
+}
+
+func TestParseOCRTSV_QuoteWords(t *testing.T) {
+	tsv := "1\t1\t0\t0\t0\t0\t0\t0\t2480\t3508\t-1\t\n" +
+		"4\t1\t1\t1\t1\t0\t200\t300\t900\t50\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t200\t300\t20\t50\t90\t\"\n" +
+		"5\t1\t1\t1\t1\t2\t230\t300\t300\t50\t95\tHello\n" +
+		"5\t1\t1\t1\t1\t3\t540\t300\t300\t50\t95\tworld\"\n" +
+		"4\t1\t1\t1\t2\t0\t200\t370\t600\t50\t-1\t\n" +
+		"5\t1\t1\t1\t2\t1\t200\t370\t20\t50\t88\t\"\n"
+	result, err := service.ParseOCRTSV([]byte(tsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\" Hello world\"\n\"\n"; result.Text() != want {
+		t.Errorf("text = %q, want %q", result.Text(), want)
+	}
+	if n := len(result.Pages[0].Lines[0].Words); n != 3 {
+		t.Errorf("first line has %d words, want 3", n)
+	}
+}
+
+func TestOCRResultExport(t *testing.T) {
+	result, err := service.ParseOCRTSV([]byte(tesseractTSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hocr := string(result.HOCR())
+	for _, want := range []string{
+		`class="ocr_page" id="page_1" title="bbox 0 0 2480 3508; ppageno 0"`,
+		`class="ocr_carea" id="block_1_2"`,
+		`title="bbox 200 300 500 350; x_wconf 97">Invoice</span>`,
+		`&lt;Paid&gt;`,
+	} {
+		if !strings.Contains(hocr, want) {
+			t.Errorf("hOCR lacks %s", want)
+		}
+	}
+
+	alto, err := result.ALTO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Strings []struct {
+			Content string  `xml:"CONTENT,attr"`
+			WC      float64 `xml:"WC,attr"`
+			HPos    int     `xml:"HPOS,attr"`
+		} `xml:"Layout>Page>PrintSpace>TextBlock>TextLine>String"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(alto)).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Strings) != 4 || doc.Strings[3].Content != "<Paid>" || doc.Strings[1].WC != 0.92 || doc.Strings[1].HPos != 520 {
+		t.Errorf("ALTO strings = %+v", doc.Strings)
+	}
+}
+
+func TestOCRReviewThreshold(t *testing.T) {
+	ocrService := service.NewOCRService(getTestLogger())
+	if _, err := ocrService.Recognize(t.Context(), textPDF(t, "a"), &service.OCROptions{ReviewThreshold: 120}); err == nil {
+		t.Error("expected error for threshold above 100")
+	}
+	if !ocrService.IsAvailable() {
+		t.Skip("Tesseract not installed")
+	}
+
+	result, err := ocrService.Recognize(t.Context(), textPDF(t, "The quick brown fox", ""), &service.OCROptions{ReviewThreshold: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 2 || result.Pages[1].NeedsReview {
+		t.Errorf("pages = %+v", result.Pages)
+	}
+}
@@ -1,8 +1,10 @@
 package service_test
 
 import (
+	"bytes"
 	"context"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/infosec554/convert-pdf-go-sdk/service"
@@ -83,3 +85,119 @@ func TestOCRService_CreateSearchablePDF(t *testing.T) {
 		t.Logf("Searchable PDF created, size: %d", len(output))
 	}
 }
+
+func TestOCRService_CorrectOrientation(t *testing.T) {
+	ocrService := service.NewOCRService(getTestLogger())
+	input := textPDF(t, "The quick brown fox jumps over the lazy dog.")
+
+	if !ocrService.IsAvailable() {
+		if _, err := ocrService.CorrectOrientation(t.Context(), input, nil); err == nil {
+			t.Error("expected error when Tesseract is not installed")
+		}
+		t.Skip("Tesseract not installed")
+	}
+
+	upsideDown, err := service.NewRotateService(getTestLogger()).RotateBytes(input, 180, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ocrService.CorrectOrientation(t.Context(), upsideDown, &service.OrientationOptions{Deskew: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 1 || len(result.Output) == 0 {
+		t.Fatalf("result = %+v", result.Pages)
+	}
+	// Sparse vector text may be too little for OSD; only check what was found.
+	if p := result.Pages[0]; p.Rotated && p.Rotation != 180 {
+		t.Errorf("page rotated by %d, want 180", p.Rotation)
+	}
+	if result.Pages[0].Deskewed {
+		t.Error("vector page must not be re-rendered")
+	}
+}
+
+func TestParseOSD(t *testing.T) {
+	// Output of tesseract 5 --psm 0 for sideways and upside-down scans.
+	// For sideways pages "Rotate" is the opposite of "Orientation in degrees".
+	tests := []struct {
+		output   string
+		rotation int
+	}{
+		{"Page number: 0\nOrientation in degrees: 270\nRotate: 90\nOrientation confidence: 21.27\nScript: Latin\nScript confidence: 4.14\n", 90},
+		{"Page number: 0\nOrientation in degrees: 90\nRotate: 270\nOrientation confidence: 9.13\nScript: Latin\nScript confidence: 2.50\n", 270},
+		{"Page number: 0\nOrientation in degrees: 180\nRotate: 180\nOrientation confidence: 15.02\nScript: Latin\nScript confidence: 3.33\n", 180},
+	}
+	for _, tt := range tests {
+		got := service.ParseOSD([]byte(tt.output))
+		if got.Rotation != tt.rotation || got.Confidence == 0 || got.Script != "Latin" || got.ScriptConfidence == 0 {
+			t.Errorf("ParseOSD(%q) = %+v, want rotation %d", tt.output, got, tt.rotation)
+		}
+	}
+}
+
+func TestCorrectOrientationStep(t *testing.T) {
+	for _, opts := range []service.OrientationOptions{{MaxSkew: 60}, {DPI: -1}, {MinConfidence: -1}} {
+		if err := (&service.CorrectOrientationStep{OrientationOptions: opts}).Validate(); err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+	if err := (&service.CorrectOrientationStep{OrientationOptions: service.OrientationOptions{Deskew: true}}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOCROptionsValidation(t *testing.T) {
+	ocrService := service.NewOCRService(getTestLogger())
+	input := textPDF(t, "a")
+	oem := 7
+
+	for _, opts := range []*service.OCROptions{
+		{Language: "eng;rm -rf"},
+		{Format: "tiff"},
+		{PSM: 14},
+		{OEM: &oem},
+		{DPI: 5000},
+		{Workers: -1},
+	} {
+		if _, err := ocrService.ExtractTextWithOptions(t.Context(), input, opts); err == nil || strings.Contains(err.Error(), "dependencies missing") {
+			t.Errorf("%+v: expected validation error, got %v", *opts, err)
+		}
+	}
+}
+
+func TestOCRService_Progress(t *testing.T) {
+	ocrService := fakeOCRService(fakeOCREngine("fake"))
+
+	var progress []service.OCRProgress
+	opts := &service.OCROptions{Language: "eng", Format: "png", Pages: "2-3", Workers: 2, Progress: func(p service.OCRProgress) {
+		progress = append(progress, p)
+	}}
+	if _, err := ocrService.ExtractTextWithOptions(t.Context(), textPDF(t, "one", "two", "three"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 2 || progress[1].Completed != 2 || progress[1].Total != 2 {
+		t.Errorf("progress = %+v", progress)
+	}
+}
+
+func TestOCRService_HybridKeepsTextPages(t *testing.T) {
+	ocrService := service.NewOCRService(getTestLogger())
+	input := textPDF(t, "Already searchable", "Second page")
+
+	// Pages with a text layer are left alone, so no OCR runs at all.
+	output, err := ocrService.CreateSearchablePDFWithOptions(t.Context(), input, &service.OCROptions{Mode: service.SearchableHybrid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Error("digitally-born document was rewritten")
+	}
+
+	if _, err := ocrService.CreateSearchablePDFWithOptions(t.Context(), input, &service.OCROptions{Mode: "overlay"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if err := (&service.OCRStep{Mode: "overlay"}).Validate(); err == nil {
+		t.Error("expected step validation error for unknown mode")
+	}
+}
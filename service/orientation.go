@@ -0,0 +1,465 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// OrientationOptions controls orientation and skew correction.
+type OrientationOptions struct {
+	// MinConfidence is the OSD orientation confidence a page needs to be
+	// rotated. Zero uses 5.
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	// Deskew straightens tilted image-only pages by re-rendering them.
+	// Pages with real text or vector content are never re-rendered.
+	Deskew bool `json:"deskew,omitempty"`
+	// MaxSkew is the largest tilt in degrees that is corrected. Zero uses 5.
+	MaxSkew float64 `json:"max_skew,omitempty"`
+	// DPI is the resolution deskewed pages are re-rendered at. Zero uses 300.
+	DPI int `json:"dpi,omitempty"`
+	// Pages limits correction to a page selection such as "1-3".
+	Pages string `json:"pages,omitempty"`
+}
+
+// PageOrientation is the detected orientation of one page.
+type PageOrientation struct {
+	Page int `json:"page"`
+	// Rotation is the clockwise rotation in degrees (0, 90, 180 or 270)
+	// that turns the page upright.
+	Rotation int `json:"rotation"`
+	// Confidence is Tesseract's orientation confidence. It is zero when
+	// the page has too little text to tell.
+	Confidence       float64 `json:"confidence"`
+	Script           string  `json:"script,omitempty"`
+	ScriptConfidence float64 `json:"script_confidence,omitempty"`
+	// Skew is the tilt of the text lines in degrees once the page is
+	// upright, counter-clockwise positive.
+	Skew float64 `json:"skew"`
+	// Rotated and Deskewed report what CorrectOrientation changed.
+	Rotated  bool `json:"rotated"`
+	Deskewed bool `json:"deskewed"`
+}
+
+// OrientationResult is a corrected document with the per-page findings.
+type OrientationResult struct {
+	Output []byte            `json:"-"`
+	Pages  []PageOrientation `json:"pages"`
+}
+
+const (
+	osdRenderDPI = 300
+	// minSkew is the smallest tilt worth re-rendering a page for.
+	minSkew = 0.2
+)
+
+func (o *OrientationOptions) withDefaults() OrientationOptions {
+	opts := OrientationOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.MinConfidence == 0 {
+		opts.MinConfidence = 5
+	}
+	if opts.MaxSkew == 0 {
+		opts.MaxSkew = 5
+	}
+	if opts.DPI == 0 {
+		opts.DPI = 300
+	}
+	return opts
+}
+
+func (o *OrientationOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.MinConfidence < 0 || o.MaxSkew < 0 || o.MaxSkew > 45 {
+		return fmt.Errorf("invalid orientation options: min confidence %g, max skew %g", o.MinConfidence, o.MaxSkew)
+	}
+	if o.DPI < 0 || o.DPI > 1200 {
+		return fmt.Errorf("dpi must be between 1 and 1200, got %d", o.DPI)
+	}
+	return nil
+}
+
+func (s *ocrService) DetectOrientation(ctx context.Context, input []byte) ([]PageOrientation, error) {
+	ctx, span := startSpan(ctx, "OCRService.DetectOrientation", AttrInputBytes.Int(len(input)))
+	pages, err := s.detectOrientation(ctx, input, "", (*OrientationOptions)(nil).withDefaults().MaxSkew)
+	endSpan(span, err, AttrPageCount.Int(len(pages)))
+	return pages, err
+}
+
+func (s *ocrService) CorrectOrientation(ctx context.Context, input []byte, opts *OrientationOptions) (*OrientationResult, error) {
+	ctx, span := startSpan(ctx, "OCRService.CorrectOrientation", AttrInputBytes.Int(len(input)))
+	result, err := s.correctOrientation(ctx, input, opts)
+	var outputSize int
+	if result != nil {
+		outputSize = len(result.Output)
+	}
+	endSpan(span, err, AttrOutputBytes.Int(outputSize))
+	return result, err
+}
+
+func (s *ocrService) correctOrientation(ctx context.Context, input []byte, opts *OrientationOptions) (*OrientationResult, error) {
+	s.log.Info("OCRService.CorrectOrientation called")
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	o := opts.withDefaults()
+
+	pages, err := s.detectOrientation(ctx, input, o.Pages, o.MaxSkew)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rotate pages sharing an angle in one call.
+	byAngle := map[int][]string{}
+	for i, p := range pages {
+		if p.Rotation != 0 && p.Confidence >= o.MinConfidence {
+			byAngle[p.Rotation] = append(byAngle[p.Rotation], strconv.Itoa(p.Page))
+			pages[i].Rotated = true
+		}
+	}
+	output := input
+	rotator := NewRotateService(s.log)
+	for _, angle := range []int{90, 180, 270} {
+		if len(byAngle[angle]) == 0 {
+			continue
+		}
+		if output, err = rotator.RotateBytes(output, angle, strings.Join(byAngle[angle], ",")); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Deskew {
+		skews := map[int]float64{}
+		for _, p := range pages {
+			if math.Abs(p.Skew) >= minSkew {
+				skews[p.Page] = p.Skew
+			}
+		}
+		if len(skews) > 0 {
+			var deskewed map[int]bool
+			if output, deskewed, err = s.deskewPages(ctx, output, skews, o.DPI); err != nil {
+				return nil, err
+			}
+			for i := range pages {
+				pages[i].Deskewed = deskewed[pages[i].Page]
+			}
+		}
+	}
+
+	s.log.Info("Orientation corrected", logger.Int("pages", len(pages)), logger.Int("outputSize", len(output)))
+	return &OrientationResult{Output: output, Pages: pages}, nil
+}
+
+// detectOrientation renders the selected pages and runs Tesseract's
+// orientation and script detection on them. Skew is measured on the
+// same renders, up to maxSkew degrees either way.
+func (s *ocrService) detectOrientation(ctx context.Context, input []byte, pages string, maxSkew float64) ([]PageOrientation, error) {
+	s.log.Info("OCRService.DetectOrientation called", logger.String("pages", pages))
+
+	// Orientation detection needs Tesseract's OSD model, whatever the engine.
+	if !installed("tesseract") {
+		return nil, fmt.Errorf("dependencies missing: install 'tesseract-ocr'")
+	}
+	if !s.renderer.Available() {
+		return nil, fmt.Errorf("dependencies missing: page renderer %q is not available", s.renderer.Name())
+	}
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ocr-osd-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inputPath := filepath.Join(tmpDir, "input.pdf")
+	if err := writeFile(ctx, inputPath, input); err != nil {
+		return nil, err
+	}
+
+	var result []PageOrientation
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		data, err := s.renderer.RenderPage(ctx, inputPath, p, osdRenderDPI, "png", true)
+		if err != nil {
+			return nil, err
+		}
+		imgPath := filepath.Join(tmpDir, fmt.Sprintf("page-%d.png", p))
+		if err := writeFile(ctx, imgPath, data); err != nil {
+			return nil, err
+		}
+
+		page := PageOrientation{Page: p}
+		args := []string{imgPath, "stdout", "--psm", "0"}
+		output, err := runCommand(ctx, "tesseract", args, AttrPage.Int(p))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// Pages with too little text fail detection; leave them as they are.
+			s.log.Warn("Orientation detection failed on page", logger.Int("page", p), logger.String("output", string(output)))
+		} else {
+			page = ParseOSD(output)
+			page.Page = p
+		}
+
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		page.Skew = skewAngle(img, page.Rotation, maxSkew)
+		os.Remove(imgPath)
+
+		result = append(result, page)
+	}
+	return result, nil
+}
+
+// ParseOSD reads the output of tesseract --psm 0. Rotation comes from the
+// "Rotate" line, the clockwise rotation that turns the page upright;
+// "Orientation in degrees" is the counter-clockwise angle and differs from
+// it for sideways pages. Page and Skew are left zero.
+func ParseOSD(output []byte) PageOrientation {
+	var page PageOrientation
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Rotate":
+			if deg, err := strconv.Atoi(value); err == nil {
+				page.Rotation = normalizedRotation(deg)
+			}
+		case "Orientation confidence":
+			page.Confidence, _ = strconv.ParseFloat(value, 64)
+		case "Script":
+			page.Script = value
+		case "Script confidence":
+			page.ScriptConfidence, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	return page
+}
+
+// skewAngle estimates the tilt of text lines in img in degrees,
+// counter-clockwise positive, once img is turned clockwise by rotation. It
+// picks the shear that makes the row profile of dark pixels sharpest.
+func skewAngle(img image.Image, rotation int, maxSkew float64) float64 {
+	b := img.Bounds()
+	step := max(1, max(b.Dx(), b.Dy())/1200)
+	w, h := b.Dx()/step, b.Dy()/step
+
+	var xs, ys []float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x*step, b.Min.Y+y*step).RGBA()
+			if (299*r+587*g+114*bl)/1000 >= 0x8000 {
+				continue
+			}
+			// Turn the point upright, in image coordinates (y down).
+			ux, uy := float64(x), float64(y)
+			switch rotation {
+			case 90:
+				ux, uy = float64(h-1-y), float64(x)
+			case 180:
+				ux, uy = float64(w-1-x), float64(h-1-y)
+			case 270:
+				ux, uy = float64(y), float64(w-1-x)
+			}
+			xs = append(xs, ux)
+			ys = append(ys, uy)
+		}
+	}
+	if len(xs) < 100 || maxSkew <= 0 {
+		return 0
+	}
+
+	extent := float64(w + h)
+	offset := extent * math.Tan(maxSkew*math.Pi/180)
+	bins := make([]float64, int(extent+2*offset)+2)
+	sharpness := func(angle float64) float64 {
+		clear(bins)
+		t := math.Tan(angle * math.Pi / 180)
+		for i := range xs {
+			bins[int(ys[i]+xs[i]*t+offset)]++
+		}
+		var sum float64
+		for _, n := range bins {
+			sum += n * n
+		}
+		return sum
+	}
+
+	// A line tilted counter-clockwise by angle rises to the right, so
+	// y + x·tan(angle) is constant along it.
+	best, bestScore := 0.0, sharpness(0)
+	for tenths := -int(maxSkew * 10); tenths <= int(maxSkew*10); tenths++ {
+		angle := float64(tenths) / 10
+		if score := sharpness(angle); score > bestScore*1.0001 {
+			best, bestScore = angle, score
+		}
+	}
+	return best
+}
+
+// deskewPages re-renders image-only pages with their content turned
+// clockwise by the page's skew. Other pages are left alone.
+func (s *ocrService) deskewPages(ctx context.Context, input []byte, skews map[int]float64, dpi int) ([]byte, map[int]bool, error) {
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ocr-deskew-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inputPath := filepath.Join(tmpDir, "input.pdf")
+	if err := writeFile(ctx, inputPath, input); err != nil {
+		return nil, nil, err
+	}
+
+	pages := make([]int, 0, len(skews))
+	for p := range skews {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+
+	deskewed := map[int]bool{}
+	for _, p := range pages {
+		marks, err := pageMarks(pdfCtx, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !marks.image || marks.text || marks.drawing {
+			continue
+		}
+
+		data, err := s.renderer.RenderPage(ctx, inputPath, p, dpi, "jpeg", false)
+		if err != nil {
+			return nil, nil, err
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, rotateImage(img, skews[p]), &jpeg.Options{Quality: 90}); err != nil {
+			return nil, nil, err
+		}
+		if err := replacePageImage(pdfCtx, p, buf.Bytes()); err != nil {
+			return nil, nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		deskewed[p] = true
+	}
+	if len(deskewed) == 0 {
+		return input, deskewed, nil
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, deskewed, nil
+}
+
+// replacePageImage replaces a page's content with a JPEG of the page as
+// displayed, keeping its boxes, rotation and annotations.
+func replacePageImage(pdfCtx *model.Context, page int, jpg []byte) error {
+	d, _, inh, err := pdfCtx.PageDict(page, false)
+	if err != nil {
+		return err
+	}
+	ref, _, _, err := model.CreateImageResource(pdfCtx.XRefTable, bytes.NewReader(jpg))
+	if err != nil {
+		return err
+	}
+
+	m, width, height := displayMatrix(visibleBox(inh), normalizedRotation(inh.Rotate))
+	content := fmt.Sprintf("q %s cm %s 0 0 %s 0 0 cm /Scan Do Q\n", m.inverse().operands(), pdfNumber(width), pdfNumber(height))
+	contents, err := pdfCtx.StreamDictIndRef([]byte(content))
+	if err != nil {
+		return err
+	}
+	d["Contents"] = *contents
+	d["Resources"] = types.Dict{"XObject": types.Dict{"Scan": *ref}}
+	return nil
+}
+
+// rotateImage turns img clockwise by degrees about its centre, keeping its
+// size and filling uncovered corners with white.
+func rotateImage(img image.Image, degrees float64) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(src.Bounds())
+
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	cx, cy := float64(b.Dx())/2, float64(b.Dy())/2
+	for v := 0; v < b.Dy(); v++ {
+		for u := 0; u < b.Dx(); u++ {
+			// In image coordinates (y down) a positive angle turns clockwise,
+			// so sample the source turned back the other way.
+			du, dv := float64(u)+0.5-cx, float64(v)+0.5-cy
+			x := du*cos + dv*sin + cx - 0.5
+			y := -du*sin + dv*cos + cy - 0.5
+			o := dst.PixOffset(u, v)
+			sampleBilinear(src, x, y, dst.Pix[o:o+4])
+		}
+	}
+	return dst
+}
+
+func sampleBilinear(img *image.RGBA, x, y float64, out []uint8) {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	for c := range 4 {
+		v := (1-fx)*(1-fy)*channel(img, ix, iy, c) + fx*(1-fy)*channel(img, ix+1, iy, c) +
+			(1-fx)*fy*channel(img, ix, iy+1, c) + fx*fy*channel(img, ix+1, iy+1, c)
+		out[c] = uint8(v + 0.5)
+	}
+}
+
+// channel returns a colour channel of a pixel, white outside the image.
+func channel(img *image.RGBA, x, y, c int) float64 {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return 255
+	}
+	return float64(img.Pix[img.PixOffset(x, y)+c])
+}
@@ -0,0 +1,942 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+type OutlineService interface {
+	// GetOutline returns the bookmark tree; it is empty when the document
+	// has none.
+	GetOutline(input []byte) ([]OutlineItem, error)
+	GetOutlineJSON(input []byte) ([]byte, error)
+	// SetOutline replaces the bookmark tree. An empty list removes it.
+	SetOutline(input []byte, items []OutlineItem) ([]byte, error)
+	// EditOutline passes the current tree to edit and writes back what it
+	// returns.
+	EditOutline(input []byte, edit func([]OutlineItem) ([]OutlineItem, error)) ([]byte, error)
+	RemoveOutline(input []byte) ([]byte, error)
+	// DetectHeadings finds heading-like lines by font size and returns
+	// them as a bookmark tree without changing the document.
+	DetectHeadings(input []byte, opts *HeadingOptions) ([]OutlineItem, error)
+	// GenerateOutline replaces the bookmarks with those found by
+	// DetectHeadings.
+	GenerateOutline(input []byte, opts *HeadingOptions) ([]byte, error)
+	// ImportOutline replaces the bookmarks with a CSV or JSON spec; see
+	// ParseOutlineSpec.
+	ImportOutline(input []byte, spec []byte, format string) ([]byte, error)
+}
+
+// OutlineItem is one bookmark. Page is 1-based.
+//
+// Fit is the destination type: XYZ, Fit, FitH, FitV, FitB, FitBH or FitBV.
+// Left, Top and Zoom position an XYZ destination; Top also applies to FitH
+// and FitBH, and Left to FitV and FitBV. A nil coordinate or a zoom of 0
+// keeps the viewer's current setting. When Fit is empty, XYZ is used if
+// any of them is set and Fit otherwise. FitR destinations are read as Fit.
+type OutlineItem struct {
+	Title  string   `json:"title"`
+	Page   int      `json:"page"`
+	Fit    string   `json:"fit,omitempty"`
+	Left   *float64 `json:"left,omitempty"`
+	Top    *float64 `json:"top,omitempty"`
+	Zoom   float64  `json:"zoom,omitempty"`
+	Bold   bool     `json:"bold,omitempty"`
+	Italic bool     `json:"italic,omitempty"`
+	// Color is a hex RGB value such as "#1f4e79".
+	Color string `json:"color,omitempty"`
+	// Open shows the item's children expanded.
+	Open     bool          `json:"open,omitempty"`
+	Children []OutlineItem `json:"children,omitempty"`
+}
+
+// HeadingOptions tunes heading detection. Body text is taken to be the
+// font size covering the most characters; lines in larger fonts are
+// headings, with the largest size as level 1.
+type HeadingOptions struct {
+	// MinRatio is how much larger than body text a line's font must be.
+	MinRatio float64 `json:"min_ratio,omitempty"`
+	// MaxLevels limits how many distinct heading sizes are used; smaller
+	// ones are ignored.
+	MaxLevels int `json:"max_levels,omitempty"`
+	// MaxLength skips longer lines, which are rarely headings.
+	MaxLength int `json:"max_length,omitempty"`
+	// KeepRepeated keeps text that recurs on most pages, such as a
+	// running header set in a large font.
+	KeepRepeated bool `json:"keep_repeated,omitempty"`
+}
+
+func DefaultHeadingOptions() *HeadingOptions {
+	return &HeadingOptions{
+		MinRatio:  1.15,
+		MaxLevels: 3,
+		MaxLength: 120,
+	}
+}
+
+// withDefaults fills unset fields from DefaultHeadingOptions.
+func (o *HeadingOptions) withDefaults() HeadingOptions {
+	defaults := DefaultHeadingOptions()
+	if o == nil {
+		return *defaults
+	}
+	opts := *o
+	if opts.MinRatio <= 0 {
+		opts.MinRatio = defaults.MinRatio
+	}
+	if opts.MaxLevels <= 0 {
+		opts.MaxLevels = defaults.MaxLevels
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = defaults.MaxLength
+	}
+	return opts
+}
+
+var outlineFits = map[string]bool{
+	"XYZ": true, "Fit": true, "FitH": true, "FitV": true, "FitB": true, "FitBH": true, "FitBV": true,
+}
+
+type outlineService struct {
+	log logger.ILogger
+}
+
+func NewOutlineService(log logger.ILogger) OutlineService {
+	return &outlineService{log: log}
+}
+
+func (s *outlineService) GetOutline(input []byte) ([]OutlineItem, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.GetOutline", AttrInputBytes.Int(len(input)))
+	items, err := s.getOutline(ctx, input)
+	endSpan(span, err, attribute.Int("pdf.outline_items", countOutlineItems(items)))
+	return items, err
+}
+
+func (s *outlineService) getOutline(ctx context.Context, input []byte) ([]OutlineItem, error) {
+	s.log.Info("OutlineService.GetOutline called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return readOutline(pdfCtx)
+}
+
+func (s *outlineService) GetOutlineJSON(input []byte) ([]byte, error) {
+	items, err := s.GetOutline(input)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []OutlineItem{}
+	}
+	return json.MarshalIndent(items, "", "  ")
+}
+
+func (s *outlineService) SetOutline(input []byte, items []OutlineItem) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.SetOutline", AttrInputBytes.Int(len(input)))
+	output, err := s.editOutline(ctx, "OutlineService.SetOutline", input, func([]OutlineItem) ([]OutlineItem, error) {
+		return items, nil
+	})
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *outlineService) EditOutline(input []byte, edit func([]OutlineItem) ([]OutlineItem, error)) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.EditOutline", AttrInputBytes.Int(len(input)))
+	output, err := s.editOutline(ctx, "OutlineService.EditOutline", input, edit)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *outlineService) RemoveOutline(input []byte) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.RemoveOutline", AttrInputBytes.Int(len(input)))
+	output, err := s.editOutline(ctx, "OutlineService.RemoveOutline", input, func([]OutlineItem) ([]OutlineItem, error) {
+		return nil, nil
+	})
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *outlineService) editOutline(ctx context.Context, op string, input []byte, edit func([]OutlineItem) ([]OutlineItem, error)) ([]byte, error) {
+	s.log.Info(op + " called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	current, err := readOutline(pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := edit(current)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeOutline(pdfCtx, items); err != nil {
+		return nil, err
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		s.log.Error("outline write failed", logger.Error(err))
+		return nil, err
+	}
+	s.log.Info("Outline written", logger.Int("items", countOutlineItems(items)))
+	return output, nil
+}
+
+func (s *outlineService) DetectHeadings(input []byte, opts *HeadingOptions) ([]OutlineItem, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.DetectHeadings", AttrInputBytes.Int(len(input)))
+	items, err := s.detectHeadings(ctx, input, opts)
+	endSpan(span, err, attribute.Int("pdf.outline_items", countOutlineItems(items)))
+	return items, err
+}
+
+func (s *outlineService) detectHeadings(ctx context.Context, input []byte, opts *HeadingOptions) ([]OutlineItem, error) {
+	s.log.Info("OutlineService.DetectHeadings called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return headingOutline(ctx, pdfCtx, opts)
+}
+
+func (s *outlineService) GenerateOutline(input []byte, opts *HeadingOptions) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.GenerateOutline", AttrInputBytes.Int(len(input)))
+	output, err := s.generateOutline(ctx, input, opts)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *outlineService) generateOutline(ctx context.Context, input []byte, opts *HeadingOptions) ([]byte, error) {
+	s.log.Info("OutlineService.GenerateOutline called")
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	items, err := headingOutline(ctx, pdfCtx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no headings found")
+	}
+	if err := writeOutline(pdfCtx, items); err != nil {
+		return nil, err
+	}
+
+	output, err := writeContext(ctx, pdfCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("Outline generated", logger.Int("items", countOutlineItems(items)))
+	return output, nil
+}
+
+func (s *outlineService) ImportOutline(input []byte, spec []byte, format string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "OutlineService.ImportOutline", AttrInputBytes.Int(len(input)))
+	output, err := s.editOutline(ctx, "OutlineService.ImportOutline", input, func([]OutlineItem) ([]OutlineItem, error) {
+		return ParseOutlineSpec(spec, format)
+	})
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func countOutlineItems(items []OutlineItem) int {
+	n := len(items)
+	for _, item := range items {
+		n += countOutlineItems(item.Children)
+	}
+	return n
+}
+
+// readOutline walks the document's outline tree. Items whose destination
+// is not a page in this document, such as links to other files, are
+// skipped but their children are kept.
+func readOutline(pdfCtx *model.Context) ([]OutlineItem, error) {
+	root, err := pdfCtx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	outlines := dictEntry(pdfCtx, root, "Outlines")
+	if outlines == nil {
+		return nil, nil
+	}
+	return readOutlineItems(pdfCtx, outlines["First"], make(map[int]bool))
+}
+
+func readOutlineItems(pdfCtx *model.Context, first types.Object, seen map[int]bool) ([]OutlineItem, error) {
+	var items []OutlineItem
+	for obj := first; obj != nil; {
+		ir, ok := obj.(types.IndirectRef)
+		if !ok || seen[ir.ObjectNumber.Value()] {
+			break
+		}
+		seen[ir.ObjectNumber.Value()] = true
+
+		d, err := pdfCtx.DereferenceDict(ir)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			break
+		}
+		obj = d["Next"]
+
+		kids, err := readOutlineItems(pdfCtx, d["First"], seen)
+		if err != nil {
+			return nil, err
+		}
+
+		item, ok := outlineItem(pdfCtx, d)
+		if !ok {
+			items = append(items, kids...)
+			continue
+		}
+		item.Children = kids
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func outlineItem(pdfCtx *model.Context, d types.Dict) (OutlineItem, bool) {
+	var item OutlineItem
+	title, err := pdfCtx.DereferenceText(d["Title"])
+	if err != nil {
+		return item, false
+	}
+	item.Title = strings.Map(func(r rune) rune {
+		if r < 32 {
+			return -1
+		}
+		return r
+	}, title)
+
+	dest := d["Dest"]
+	if dest == nil {
+		action := dictEntry(pdfCtx, d, "A")
+		if action == nil {
+			return item, false
+		}
+		if s := action.NameEntry("S"); s == nil || *s != "GoTo" {
+			return item, false
+		}
+		dest = action["D"]
+	}
+	arr, err := destinationArray(pdfCtx, dest)
+	if err != nil || len(arr) < 2 {
+		return item, false
+	}
+
+	switch p := arr[0].(type) {
+	case types.IndirectRef:
+		item.Page, err = pdfCtx.PageNumber(p.ObjectNumber.Value())
+		if err != nil {
+			return item, false
+		}
+	case types.Integer:
+		item.Page = p.Value() + 1
+	default:
+		return item, false
+	}
+	if item.Page < 1 || item.Page > pdfCtx.PageCount {
+		return item, false
+	}
+
+	if fit, ok := arr[1].(types.Name); ok {
+		item.Fit = fit.Value()
+	}
+	params := arr[2:]
+	switch item.Fit {
+	case "XYZ":
+		item.Left = destNumber(pdfCtx, params, 0)
+		item.Top = destNumber(pdfCtx, params, 1)
+		if zoom := destNumber(pdfCtx, params, 2); zoom != nil {
+			item.Zoom = *zoom
+		}
+	case "FitH", "FitBH":
+		item.Top = destNumber(pdfCtx, params, 0)
+	case "FitV", "FitBV":
+		item.Left = destNumber(pdfCtx, params, 0)
+	case "Fit", "FitB":
+	default:
+		item.Fit = "Fit"
+	}
+
+	if c := d.ArrayEntry("C"); len(c) == 3 {
+		var rgb [3]float64
+		for i, o := range c {
+			rgb[i], _ = pdfCtx.DereferenceNumber(o)
+		}
+		if rgb != [3]float64{} {
+			item.Color = formatHexColor(rgb)
+		}
+	}
+	if f := d.IntEntry("F"); f != nil {
+		item.Italic = *f&1 != 0
+		item.Bold = *f&2 != 0
+	}
+	if count := d.IntEntry("Count"); count != nil {
+		item.Open = *count > 0
+	}
+	return item, true
+}
+
+// destinationArray resolves a destination, which may be a name looked up
+// in the document's named destinations.
+func destinationArray(pdfCtx *model.Context, dest types.Object) (types.Array, error) {
+	dest, err := pdfCtx.Dereference(dest)
+	if err != nil {
+		return nil, err
+	}
+	switch d := dest.(type) {
+	case types.Array:
+		return d, nil
+	case types.Name:
+		return pdfCtx.DereferenceDestArray(d.Value())
+	case types.StringLiteral, types.HexLiteral:
+		name, err := pdfCtx.DereferenceText(d)
+		if err != nil {
+			return nil, err
+		}
+		return pdfCtx.DereferenceDestArray(name)
+	case types.Dict:
+		return pdfCtx.DereferenceArray(d["D"])
+	}
+	return nil, fmt.Errorf("unsupported destination %v", dest)
+}
+
+func destNumber(pdfCtx *model.Context, params types.Array, i int) *float64 {
+	if i >= len(params) || params[i] == nil {
+		return nil
+	}
+	f, err := pdfCtx.DereferenceNumber(params[i])
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// writeOutline replaces the outline tree of pdfCtx with items. Titles and
+// destinations are validated first, so nothing is changed on error.
+func writeOutline(pdfCtx *model.Context, items []OutlineItem) error {
+	if err := validateOutline(items, pdfCtx.PageCount, ""); err != nil {
+		return err
+	}
+
+	root, err := pdfCtx.Catalog()
+	if err != nil {
+		return err
+	}
+	delete(root, "Outlines")
+	pdfCtx.Outlines = nil
+	if len(items) == 0 {
+		if mode := root.NameEntry("PageMode"); mode != nil && *mode == "UseOutlines" {
+			delete(root, "PageMode")
+		}
+		return nil
+	}
+
+	outlines := types.Dict{"Type": types.Name("Outlines")}
+	ir, err := pdfCtx.IndRefForNewObject(outlines)
+	if err != nil {
+		return err
+	}
+	first, last, visible, err := writeOutlineItems(pdfCtx, items, *ir)
+	if err != nil {
+		return err
+	}
+	outlines["First"] = *first
+	outlines["Last"] = *last
+	outlines["Count"] = types.Integer(visible)
+	root["Outlines"] = *ir
+	pdfCtx.Outlines = outlines
+	return nil
+}
+
+func validateOutline(items []OutlineItem, pageCount int, path string) error {
+	for i, item := range items {
+		where := fmt.Sprintf("%s%d", path, i+1)
+		if strings.TrimSpace(item.Title) == "" {
+			return fmt.Errorf("outline item %s: title is required", where)
+		}
+		if item.Page < 1 || item.Page > pageCount {
+			return fmt.Errorf("outline item %s (%q): page %d is outside 1-%d", where, item.Title, item.Page, pageCount)
+		}
+		if item.Fit != "" && !outlineFits[item.Fit] {
+			return fmt.Errorf("outline item %s (%q): unsupported fit %q", where, item.Title, item.Fit)
+		}
+		if item.Zoom < 0 {
+			return fmt.Errorf("outline item %s (%q): zoom must not be negative", where, item.Title)
+		}
+		if item.Color != "" {
+			if _, err := parseHexColor(item.Color); err != nil {
+				return fmt.Errorf("outline item %s (%q): %w", where, item.Title, err)
+			}
+		}
+		if err := validateOutline(item.Children, pageCount, where+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutlineItems creates the dictionaries for one level of the tree and
+// returns the first and last item and how many items are visible below
+// parent when it is open.
+func writeOutlineItems(pdfCtx *model.Context, items []OutlineItem, parent types.IndirectRef) (*types.IndirectRef, *types.IndirectRef, int, error) {
+	var first, prev *types.IndirectRef
+	var prevDict types.Dict
+	visible := 0
+
+	for _, item := range items {
+		d, err := outlineItemDict(pdfCtx, item, parent)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		ir, err := pdfCtx.IndRefForNewObject(d)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		visible++
+
+		if len(item.Children) > 0 {
+			kidFirst, kidLast, kidVisible, err := writeOutlineItems(pdfCtx, item.Children, *ir)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			d["First"] = *kidFirst
+			d["Last"] = *kidLast
+			if item.Open {
+				d["Count"] = types.Integer(kidVisible)
+				visible += kidVisible
+			} else {
+				d["Count"] = types.Integer(-kidVisible)
+			}
+		}
+
+		if first == nil {
+			first = ir
+		}
+		if prev != nil {
+			d["Prev"] = *prev
+			prevDict["Next"] = *ir
+		}
+		prev, prevDict = ir, d
+	}
+	return first, prev, visible, nil
+}
+
+func outlineItemDict(pdfCtx *model.Context, item OutlineItem, parent types.IndirectRef) (types.Dict, error) {
+	_, pageRef, _, err := pdfCtx.PageDict(item.Page, false)
+	if err != nil {
+		return nil, err
+	}
+	title, err := types.EscapedUTF16String(item.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	d := types.Dict{
+		"Title":  types.StringLiteral(*title),
+		"Parent": parent,
+		"Dest":   outlineDest(*pageRef, item),
+	}
+	if item.Color != "" {
+		rgb, _ := parseHexColor(item.Color)
+		d["C"] = types.Array{types.Float(rgb[0]), types.Float(rgb[1]), types.Float(rgb[2])}
+	}
+	flags := 0
+	if item.Italic {
+		flags |= 1
+	}
+	if item.Bold {
+		flags |= 2
+	}
+	if flags != 0 {
+		d["F"] = types.Integer(flags)
+	}
+	return d, nil
+}
+
+func outlineDest(page types.IndirectRef, item OutlineItem) types.Array {
+	fit := item.Fit
+	if fit == "" {
+		fit = "Fit"
+		if item.Left != nil || item.Top != nil || item.Zoom != 0 {
+			fit = "XYZ"
+		}
+	}
+
+	dest := types.Array{page, types.Name(fit)}
+	switch fit {
+	case "XYZ":
+		var zoom types.Object
+		if item.Zoom != 0 {
+			zoom = types.Float(item.Zoom)
+		}
+		dest = append(dest, optionalFloat(item.Left), optionalFloat(item.Top), zoom)
+	case "FitH", "FitBH":
+		dest = append(dest, optionalFloat(item.Top))
+	case "FitV", "FitBV":
+		dest = append(dest, optionalFloat(item.Left))
+	}
+	return dest
+}
+
+func optionalFloat(f *float64) types.Object {
+	if f == nil {
+		return nil
+	}
+	return types.Float(*f)
+}
+
+func parseHexColor(s string) ([3]float64, error) {
+	var rgb [3]float64
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return rgb, fmt.Errorf("invalid color %q, want #rrggbb", s)
+	}
+	for i := range rgb {
+		v, err := strconv.ParseUint(hex[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return rgb, fmt.Errorf("invalid color %q, want #rrggbb", s)
+		}
+		rgb[i] = float64(v) / 255
+	}
+	return rgb, nil
+}
+
+func formatHexColor(rgb [3]float64) string {
+	var b strings.Builder
+	b.WriteByte('#')
+	for _, c := range rgb {
+		fmt.Fprintf(&b, "%02x", int(math.Round(math.Max(0, math.Min(1, c))*255)))
+	}
+	return b.String()
+}
+
+// ParseOutlineSpec reads a bookmark tree from JSON or CSV. Format is
+// "json", "csv" or empty to detect it from the content.
+//
+// JSON is a list of OutlineItem objects, or an object with such a list
+// under "outline". CSV has one row per bookmark with the columns level,
+// title and page, where level 1 is the top; a header row naming the
+// columns is optional and also allows fit, left, top, zoom, bold, italic,
+// color and open columns in any order.
+func ParseOutlineSpec(spec []byte, format string) ([]OutlineItem, error) {
+	if format == "" {
+		format = "csv"
+		if trimmed := bytes.TrimSpace(spec); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+			format = "json"
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "json":
+		var items []OutlineItem
+		if trimmed := bytes.TrimSpace(spec); len(trimmed) > 0 && trimmed[0] == '{' {
+			var wrapped struct {
+				Outline []OutlineItem `json:"outline"`
+			}
+			if err := json.Unmarshal(spec, &wrapped); err != nil {
+				return nil, fmt.Errorf("outline JSON: %w", err)
+			}
+			return wrapped.Outline, nil
+		}
+		if err := json.Unmarshal(spec, &items); err != nil {
+			return nil, fmt.Errorf("outline JSON: %w", err)
+		}
+		return items, nil
+	case "csv":
+		return parseOutlineCSV(spec)
+	default:
+		return nil, fmt.Errorf("unsupported outline format %q", format)
+	}
+}
+
+func parseOutlineCSV(spec []byte) ([]OutlineItem, error) {
+	r := csv.NewReader(bytes.NewReader(spec))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	columns := map[string]int{"level": 0, "title": 1, "page": 2}
+	var root []OutlineItem
+	// path holds the index of the current item at each level.
+	var path []int
+
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("outline CSV: %w", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if row == 1 {
+			if _, err := strconv.Atoi(strings.TrimSpace(record[0])); err != nil {
+				columns = make(map[string]int)
+				for i, name := range record {
+					columns[strings.ToLower(strings.TrimSpace(name))] = i
+				}
+				for _, required := range []string{"level", "title", "page"} {
+					if _, ok := columns[required]; !ok {
+						return nil, fmt.Errorf("outline CSV: missing %s column", required)
+					}
+				}
+				continue
+			}
+		}
+
+		item, level, err := outlineCSVItem(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("outline CSV row %d: %w", row, err)
+		}
+		if level > len(path)+1 {
+			return nil, fmt.Errorf("outline CSV row %d: level %d follows level %d", row, level, len(path))
+		}
+
+		path = path[:level-1]
+		siblings := &root
+		for _, i := range path {
+			siblings = &(*siblings)[i].Children
+		}
+		*siblings = append(*siblings, item)
+		path = append(path, len(*siblings)-1)
+	}
+	return root, nil
+}
+
+func outlineCSVItem(record []string, columns map[string]int) (OutlineItem, int, error) {
+	var item OutlineItem
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	level, err := strconv.Atoi(field("level"))
+	if err != nil || level < 1 {
+		return item, 0, fmt.Errorf("invalid level %q", field("level"))
+	}
+	item.Title = field("title")
+	if item.Page, err = strconv.Atoi(field("page")); err != nil {
+		return item, 0, fmt.Errorf("invalid page %q", field("page"))
+	}
+	item.Fit = field("fit")
+	item.Color = field("color")
+
+	for name, dst := range map[string]**float64{"left": &item.Left, "top": &item.Top} {
+		if v := field(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return item, 0, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = &f
+		}
+	}
+	if v := field("zoom"); v != "" {
+		if item.Zoom, err = strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64); err != nil {
+			return item, 0, fmt.Errorf("invalid zoom %q", v)
+		}
+		if strings.HasSuffix(v, "%") {
+			item.Zoom /= 100
+		}
+	}
+	for name, dst := range map[string]*bool{"bold": &item.Bold, "italic": &item.Italic, "open": &item.Open} {
+		if v := field(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return item, 0, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = b
+		}
+	}
+	return item, level, nil
+}
+
+type heading struct {
+	line  textLine
+	level int
+}
+
+// headingOutline builds a bookmark tree from lines set in fonts larger
+// than the body text.
+func headingOutline(ctx context.Context, pdfCtx *model.Context, opts *HeadingOptions) ([]OutlineItem, error) {
+	o := opts.withDefaults()
+
+	var lines []textLine
+	if err := traceStep(ctx, "text.layout", func() error {
+		fonts := make(map[int]*pdfFont)
+		for p := 1; p <= pdfCtx.PageCount; p++ {
+			pageLines, err := pageTextLines(pdfCtx, p, fonts)
+			if err != nil {
+				return fmt.Errorf("page %d: %w", p, err)
+			}
+			lines = append(lines, pageLines...)
+		}
+		return nil
+	}, AttrPageCount.Int(pdfCtx.PageCount)); err != nil {
+		return nil, err
+	}
+
+	body := bodyFontSize(lines)
+	if body == 0 {
+		return nil, nil
+	}
+
+	var candidates []textLine
+	for _, l := range lines {
+		if roundSize(l.Size) >= body*o.MinRatio && isHeadingText(l.Text, o.MaxLength) {
+			candidates = append(candidates, l)
+		}
+	}
+	candidates = joinHeadingLines(candidates)
+	if !o.KeepRepeated {
+		candidates = dropRepeatedLines(candidates, pdfCtx.PageCount)
+	}
+
+	var sizes []float64
+	levels := make(map[float64]int)
+	for _, l := range candidates {
+		if _, ok := levels[roundSize(l.Size)]; !ok {
+			levels[roundSize(l.Size)] = 0
+			sizes = append(sizes, roundSize(l.Size))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sizes)))
+	for i, size := range sizes {
+		if i < o.MaxLevels {
+			levels[size] = i + 1
+		}
+	}
+
+	var headings []heading
+	for _, l := range candidates {
+		if level := levels[roundSize(l.Size)]; level > 0 {
+			headings = append(headings, heading{line: l, level: level})
+		}
+	}
+	return nestHeadings(headings), nil
+}
+
+func roundSize(size float64) float64 {
+	return math.Round(size*2) / 2
+}
+
+// bodyFontSize returns the font size covering the most characters.
+func bodyFontSize(lines []textLine) float64 {
+	chars := make(map[float64]int)
+	for _, l := range lines {
+		chars[roundSize(l.Size)] += len([]rune(l.Text))
+	}
+	var body float64
+	for size, n := range chars {
+		if n > chars[body] || (n == chars[body] && size < body) {
+			body = size
+		}
+	}
+	return body
+}
+
+func isHeadingText(text string, maxLength int) bool {
+	if len([]rune(text)) > maxLength {
+		return false
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinHeadingLines merges a heading that wraps onto following lines of
+// the same size.
+func joinHeadingLines(lines []textLine) []textLine {
+	var out []textLine
+	for _, l := range lines {
+		if n := len(out); n > 0 {
+			prev := &out[n-1]
+			gap := prev.Y - l.Y
+			if prev.Page == l.Page && roundSize(prev.Size) == roundSize(l.Size) && gap > 0 && gap <= l.Size*1.6 {
+				prev.Text += " " + l.Text
+				prev.Y = l.Y
+				continue
+			}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// dropRepeatedLines removes text that appears on more than half of the
+// pages of a document longer than two pages.
+func dropRepeatedLines(lines []textLine, pageCount int) []textLine {
+	if pageCount <= 2 {
+		return lines
+	}
+	pages := make(map[string]map[int]bool)
+	for _, l := range lines {
+		if pages[l.Text] == nil {
+			pages[l.Text] = make(map[int]bool)
+		}
+		pages[l.Text][l.Page] = true
+	}
+	var out []textLine
+	for _, l := range lines {
+		if len(pages[l.Text])*2 <= pageCount {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// nestHeadings turns a flat list of leveled headings into a tree. A
+// heading that skips a level is attached to the nearest shallower one.
+func nestHeadings(headings []heading) []OutlineItem {
+	var root []OutlineItem
+	var path []int
+	var levels []int
+
+	for _, h := range headings {
+		top := h.line.Y + h.line.Size
+		item := OutlineItem{Title: h.line.Text, Page: h.line.Page, Fit: "XYZ", Top: &top}
+
+		for len(levels) > 0 && levels[len(levels)-1] >= h.level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		siblings := &root
+		for _, i := range path {
+			siblings = &(*siblings)[i].Children
+		}
+		*siblings = append(*siblings, item)
+		path = append(path, len(*siblings)-1)
+		levels = append(levels, h.level)
+	}
+	return root
+}
@@ -0,0 +1,240 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// headingPDF builds one page per entry; each line is "size text", set top
+// to bottom.
+func headingPDF(t *testing.T, pages ...[]string) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	for _, lines := range pages {
+		pdf.AddPage()
+		y := 60.0
+		for _, line := range lines {
+			size, text, _ := strings.Cut(line, " ")
+			pt := map[string]float64{"h1": 24, "h2": 16, "p": 11}[size]
+			pdf.SetFont("Helvetica", "", pt)
+			pdf.Text(50, y, text)
+			y += pt * 1.8
+		}
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func outlineTitles(items []service.OutlineItem, prefix string) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, prefix+item.Title)
+		titles = append(titles, outlineTitles(item.Children, prefix+"-")...)
+	}
+	return titles
+}
+
+func TestOutlineSetAndGet(t *testing.T) {
+	outline := service.NewOutlineService(getTestLogger())
+	top := 700.0
+
+	items := []service.OutlineItem{
+		{Title: "Chapter 1", Page: 1, Bold: true, Color: "#1f4e79", Open: true, Children: []service.OutlineItem{
+			{Title: "Section 1.1", Page: 2, Top: &top, Zoom: 1.5},
+			{Title: "Résumé", Page: 3, Fit: "FitH", Top: &top},
+		}},
+		{Title: "Chapter 2", Page: 2, Italic: true},
+	}
+	output, err := outline.SetOutline(textPDF(t, "a", "b", "c"), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := outline.GetOutline(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := outlineTitles(got, ""); !equalStrings(titles, []string{"Chapter 1", "-Section 1.1", "-Résumé", "Chapter 2"}) {
+		t.Fatalf("titles = %v", titles)
+	}
+
+	ch1, sec, resume, ch2 := got[0], got[0].Children[0], got[0].Children[1], got[1]
+	if ch1.Page != 1 || !ch1.Bold || ch1.Color != "#1f4e79" || !ch1.Open || ch1.Fit != "Fit" {
+		t.Errorf("chapter 1 = %+v", ch1)
+	}
+	if sec.Page != 2 || sec.Fit != "XYZ" || sec.Top == nil || *sec.Top != 700 || sec.Left != nil || sec.Zoom != 1.5 {
+		t.Errorf("section 1.1 = %+v", sec)
+	}
+	if resume.Page != 3 || resume.Fit != "FitH" || resume.Top == nil || *resume.Top != 700 {
+		t.Errorf("résumé = %+v", resume)
+	}
+	if ch2.Page != 2 || !ch2.Italic || ch2.Open {
+		t.Errorf("chapter 2 = %+v", ch2)
+	}
+
+	data, err := outline.GetOutlineJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []service.OutlineItem
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded) != 2 || decoded[0].Children[0].Zoom != 1.5 {
+		t.Errorf("JSON = %s (%v)", data, err)
+	}
+
+	removed, err := outline.RemoveOutline(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := outline.GetOutline(removed); err != nil || len(got) != 0 {
+		t.Errorf("after remove: %v, %v", got, err)
+	}
+}
+
+func TestOutlineReadsExistingBookmarks(t *testing.T) {
+	outline := service.NewOutlineService(getTestLogger())
+
+	items, err := outline.GetOutline(textPDF(t, "#Intro", "x", "#Body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Title != "Intro" || items[0].Page != 1 || items[1].Title != "Body" || items[1].Page != 3 {
+		t.Errorf("items = %+v", items)
+	}
+
+	none, err := outline.GetOutline(textPDF(t, "x"))
+	if err != nil || none != nil {
+		t.Errorf("no outline: %v, %v", none, err)
+	}
+}
+
+func TestOutlineEditAndValidate(t *testing.T) {
+	outline := service.NewOutlineService(getTestLogger())
+	input := textPDF(t, "#Intro", "#Body")
+
+	output, err := outline.EditOutline(input, func(items []service.OutlineItem) ([]service.OutlineItem, error) {
+		items[1].Title = "Main Body"
+		return append(items, service.OutlineItem{Title: "Appendix", Page: 2}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := outline.GetOutline(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := outlineTitles(items, ""); !equalStrings(titles, []string{"Intro", "Main Body", "Appendix"}) {
+		t.Errorf("titles = %v", titles)
+	}
+
+	for name, item := range map[string]service.OutlineItem{
+		"page":  {Title: "Far", Page: 5},
+		"title": {Title: " ", Page: 1},
+		"fit":   {Title: "Odd", Page: 1, Fit: "FitR"},
+		"color": {Title: "Red", Page: 1, Color: "red"},
+	} {
+		if _, err := outline.SetOutline(input, []service.OutlineItem{item}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestImportOutline(t *testing.T) {
+	outline := service.NewOutlineService(getTestLogger())
+	input := textPDF(t, "a", "b", "c", "d")
+
+	csvSpec := "level,title,page,zoom,bold\n1,Part A,1,,true\n2,\"Details, more\",2,125%,\n2,Notes,3,,\n1,Part B,4,,\n"
+	output, err := outline.ImportOutline(input, []byte(csvSpec), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := outline.GetOutline(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := outlineTitles(items, ""); !equalStrings(titles, []string{"Part A", "-Details, more", "-Notes", "Part B"}) {
+		t.Fatalf("titles = %v", titles)
+	}
+	if !items[0].Bold || items[0].Children[0].Zoom != 1.25 || items[1].Page != 4 {
+		t.Errorf("items = %+v", items)
+	}
+
+	output, err = outline.ImportOutline(input, []byte(`{"outline":[{"title":"Only","page":2}]}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := outline.GetOutline(output); len(items) != 1 || items[0].Page != 2 {
+		t.Errorf("JSON import = %+v", items)
+	}
+
+	if _, err := service.ParseOutlineSpec([]byte("1,A,1\n3,B,2\n"), "csv"); err == nil {
+		t.Error("expected error for skipped level")
+	}
+	if _, err := service.ParseOutlineSpec([]byte("title,page\nA,1\n"), "csv"); err == nil {
+		t.Error("expected error for missing level column")
+	}
+}
+
+func TestDetectHeadings(t *testing.T) {
+	outline := service.NewOutlineService(getTestLogger())
+	body := "p Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor."
+	input := headingPDF(t,
+		[]string{"h1 Annual Report", "p 2025", body, body},
+		[]string{"h2 Revenue", body, body, "h2 Costs", body},
+		[]string{"h1 Outlook", body, "h2 Risks", body},
+	)
+
+	items, err := outline.DetectHeadings(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Annual Report", "-Revenue", "-Costs", "Outlook", "-Risks"}
+	if titles := outlineTitles(items, ""); !equalStrings(titles, want) {
+		t.Fatalf("titles = %v, want %v", titles, want)
+	}
+	if items[0].Children[1].Page != 2 || items[1].Page != 3 || items[1].Top == nil {
+		t.Errorf("items = %+v", items)
+	}
+
+	output, err := outline.GenerateOutline(input, &service.HeadingOptions{MaxLevels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := outline.GetOutline(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := outlineTitles(generated, ""); !equalStrings(titles, []string{"Annual Report", "Outlook"}) {
+		t.Errorf("generated = %v", titles)
+	}
+
+	if _, err := outline.GenerateOutline(textPDF(t, "plain"), nil); err == nil {
+		t.Error("expected error when no headings are found")
+	}
+}
+
+func TestOutlineStep(t *testing.T) {
+	svc := service.NewWithGotenberg("http://localhost:3000")
+
+	if err := (&service.OutlineStep{}).Validate(); err == nil {
+		t.Error("expected error without items or generate")
+	}
+
+	step := &service.OutlineStep{Items: []service.OutlineItem{{Title: "Start", Page: 1}}}
+	docs, err := step.Run(t.Context(), svc, []service.Document{{Name: "a.pdf", Data: textPDF(t, "a")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := svc.Outline().GetOutline(docs[0].Data)
+	if err != nil || len(items) != 1 || items[0].Title != "Start" {
+		t.Errorf("items = %+v, %v", items, err)
+	}
+}
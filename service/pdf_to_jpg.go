@@ -3,10 +3,10 @@ package service
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -44,6 +44,13 @@ func (s *pdfToJPGService) Convert(input io.Reader) ([]byte, error) {
 }
 
 func (s *pdfToJPGService) ConvertFile(inputPath, outputDir string) ([]string, error) {
+	ctx, span := startSpan(context.Background(), "PDFToJPGService.ConvertFile")
+	imageFiles, err := s.convertFile(ctx, inputPath, outputDir)
+	endSpan(span, err, AttrPageCount.Int(len(imageFiles)))
+	return imageFiles, err
+}
+
+func (s *pdfToJPGService) convertFile(ctx context.Context, inputPath, outputDir string) ([]string, error) {
 	s.log.Info("PDFToJPGService.ConvertFile called", logger.String("input", inputPath))
 
 	if err := os.MkdirAll(outputDir, 0777); err != nil {
@@ -52,9 +59,7 @@ func (s *pdfToJPGService) ConvertFile(inputPath, outputDir string) ([]string, er
 	}
 
 	prefix := filepath.Join(outputDir, "page")
-	cmd := exec.Command("pdftoppm", "-jpeg", "-r", "150", inputPath, prefix)
-
-	if output, err := cmd.CombinedOutput(); err != nil {
+	if output, err := runCommand(ctx, "pdftoppm", []string{"-jpeg", "-r", "150", inputPath, prefix}); err != nil {
 		s.log.Error("pdftoppm execution failed", logger.String("output", string(output)), logger.Error(err))
 		return nil, fmt.Errorf("image conversion failed: %w", err)
 	}
@@ -83,6 +88,13 @@ func (s *pdfToJPGService) ConvertFile(inputPath, outputDir string) ([]string, er
 }
 
 func (s *pdfToJPGService) ConvertBytes(input []byte) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "PDFToJPGService.ConvertBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.convertBytes(ctx, input)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *pdfToJPGService) convertBytes(ctx context.Context, input []byte) ([]byte, error) {
 	s.log.Info("PDFToJPGService.ConvertBytes called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-to-jpg-*")
@@ -92,12 +104,12 @@ func (s *pdfToJPGService) ConvertBytes(input []byte) ([]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	tmpInput := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(tmpInput, input, 0644); err != nil {
+	if err := writeFile(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
 
 	outputDir := filepath.Join(tmpDir, "output")
-	imageFiles, err := s.ConvertFile(tmpInput, outputDir)
+	imageFiles, err := s.convertFile(ctx, tmpInput, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +141,13 @@ func (s *pdfToJPGService) ConvertBytes(input []byte) ([]byte, error) {
 }
 
 func (s *pdfToJPGService) ConvertToImages(input []byte) ([][]byte, error) {
+	ctx, span := startSpan(context.Background(), "PDFToJPGService.ConvertToImages", AttrInputBytes.Int(len(input)))
+	images, err := s.convertToImages(ctx, input)
+	endSpan(span, err, AttrPageCount.Int(len(images)))
+	return images, err
+}
+
+func (s *pdfToJPGService) convertToImages(ctx context.Context, input []byte) ([][]byte, error) {
 	s.log.Info("PDFToJPGService.ConvertToImages called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-to-jpg-*")
@@ -138,12 +157,12 @@ func (s *pdfToJPGService) ConvertToImages(input []byte) ([][]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	tmpInput := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(tmpInput, input, 0644); err != nil {
+	if err := writeFile(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
 
 	outputDir := filepath.Join(tmpDir, "output")
-	imageFiles, err := s.ConvertFile(tmpInput, outputDir)
+	imageFiles, err := s.convertFile(ctx, tmpInput, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,434 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	ErrUnknownStep = errors.New("unknown pipeline step")
+	ErrInvalidStep = errors.New("invalid pipeline step")
+)
+
+// Document is one file flowing through a Pipeline. Name carries the file
+// extension, which conversion steps use to pick a backend.
+type Document struct {
+	Name string
+	Data []byte
+}
+
+// Step is one stage of a Pipeline. A step receives every document produced
+// by the previous step, so it can transform each one, fan out (split) or
+// fan in (merge).
+type Step interface {
+	// Type is the name the step is registered under, e.g. "compress".
+	Type() string
+	// Validate checks the step's parameters before anything runs.
+	Validate() error
+	Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error)
+}
+
+// StepFactory returns a new zero-valued step; parameters from a pipeline
+// definition are decoded into it as JSON, so it should be a pointer.
+type StepFactory func() Step
+
+var (
+	stepRegistryMu sync.RWMutex
+	stepRegistry   = builtinSteps()
+)
+
+// RegisterStep makes a custom step available to pipeline definitions.
+func RegisterStep(name string, factory StepFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("%w: step name and factory are required", ErrInvalidStep)
+	}
+
+	stepRegistryMu.Lock()
+	defer stepRegistryMu.Unlock()
+	if _, exists := stepRegistry[name]; exists {
+		return fmt.Errorf("%w: step %q is already registered", ErrInvalidStep, name)
+	}
+	stepRegistry[name] = factory
+	return nil
+}
+
+// UnregisterStep removes a step type, for example in a test cleanup. It
+// reports whether the step was registered.
+func UnregisterStep(name string) bool {
+	stepRegistryMu.Lock()
+	defer stepRegistryMu.Unlock()
+	_, ok := stepRegistry[name]
+	delete(stepRegistry, name)
+	return ok
+}
+
+// RegisteredSteps lists the step types available to pipeline definitions.
+func RegisteredSteps() []string {
+	stepRegistryMu.RLock()
+	defer stepRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(stepRegistry))
+	for name := range stepRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newStep(name string) (Step, error) {
+	stepRegistryMu.RLock()
+	factory, ok := stepRegistry[name]
+	stepRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStep, name)
+	}
+	return factory(), nil
+}
+
+// StepFunc adapts a function to the Step interface for one-off custom steps.
+type StepFunc struct {
+	Name string                                                                         `json:"-"`
+	Fn   func(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) `json:"-"`
+}
+
+func (s StepFunc) Type() string { return s.Name }
+
+func (s StepFunc) Validate() error {
+	if s.Fn == nil {
+		return errors.New("function is required")
+	}
+	return nil
+}
+
+func (s StepFunc) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return s.Fn(ctx, svc, docs)
+}
+
+type Pipeline struct {
+	pdfService PDFService
+	steps      []Step
+}
+
+func NewPipeline(pdfService PDFService) *Pipeline {
+	return &Pipeline{
+		pdfService: pdfService,
+		steps:      make([]Step, 0),
+	}
+}
+
+// Then appends any step, built-in or custom.
+func (p *Pipeline) Then(step Step) *Pipeline {
+	p.steps = append(p.steps, step)
+	return p
+}
+
+func (p *Pipeline) Compress() *Pipeline {
+	return p.Then(&CompressStep{})
+}
+
+func (p *Pipeline) Rotate(angle int, pages string) *Pipeline {
+	return p.Then(&RotateStep{Angle: angle, Pages: pages})
+}
+
+func (p *Pipeline) Watermark(text string, opts *WatermarkOptions) *Pipeline {
+	step := &WatermarkStep{Text: text}
+	if opts != nil {
+		step.FontSize = opts.FontSize
+		step.Position = opts.Position
+		step.Opacity = opts.Opacity
+		step.Color = opts.Color
+	}
+	return p.Then(step)
+}
+
+func (p *Pipeline) Protect(password string) *Pipeline {
+	return p.Then(&ProtectStep{Password: password})
+}
+
+func (p *Pipeline) Unlock(password string) *Pipeline {
+	return p.Then(&UnlockStep{Password: password})
+}
+
+// Split fans out into one document per range, or per page when no
+// ranges are given.
+func (p *Pipeline) Split(ranges ...string) *Pipeline {
+	return p.Then(&SplitStep{Ranges: ranges})
+}
+
+// Merge fans all current documents in to one.
+func (p *Pipeline) Merge(name string) *Pipeline {
+	return p.Then(&MergeStep{Name: name})
+}
+
+func (p *Pipeline) OCR(language string) *Pipeline {
+	return p.Then(&OCRStep{Language: language})
+}
+
+func (p *Pipeline) ConvertToPDF() *Pipeline {
+	return p.Then(&ConvertToPDFStep{})
+}
+
+func (p *Pipeline) Steps() []Step {
+	return append([]Step(nil), p.steps...)
+}
+
+// Validate checks every step without running anything.
+func (p *Pipeline) Validate() error {
+	if len(p.steps) == 0 {
+		return fmt.Errorf("%w: pipeline has no steps", ErrInvalidStep)
+	}
+	for i, step := range p.steps {
+		if step == nil {
+			return fmt.Errorf("%w: step %d is nil", ErrInvalidStep, i+1)
+		}
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("%w: step %d (%s): %v", ErrInvalidStep, i+1, step.Type(), err)
+		}
+	}
+	return nil
+}
+
+// StepReport describes one executed step.
+type StepReport struct {
+	Index           int
+	Type            string
+	Duration        time.Duration
+	InputDocuments  int
+	OutputDocuments int
+	InputBytes      int64
+	OutputBytes     int64
+	Error           error
+}
+
+type PipelineResult struct {
+	Documents []Document
+	Steps     []StepReport
+	Duration  time.Duration
+}
+
+// Run validates the pipeline and then runs each step in order. The result
+// holds reports for every step that ran, even when one fails.
+func (p *Pipeline) Run(ctx context.Context, docs ...Document) (*PipelineResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, span := startSpan(ctx, "Pipeline.Run", attribute.Int("pipeline.steps", len(p.steps)))
+	result, err := p.run(ctx, docs)
+	endSpan(span, err)
+	return result, err
+}
+
+func (p *Pipeline) run(ctx context.Context, docs []Document) (*PipelineResult, error) {
+	result := &PipelineResult{Steps: make([]StepReport, 0, len(p.steps))}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	for i, step := range p.steps {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		report := StepReport{
+			Index:          i + 1,
+			Type:           step.Type(),
+			InputDocuments: len(docs),
+			InputBytes:     documentsSize(docs),
+		}
+
+		stepCtx, span := startSpan(ctx, "pipeline.step "+step.Type(), AttrInputBytes.Int64(report.InputBytes))
+		stepStart := time.Now()
+		out, err := step.Run(stepCtx, p.pdfService, docs)
+		report.Duration = time.Since(stepStart)
+		report.OutputDocuments = len(out)
+		report.OutputBytes = documentsSize(out)
+		report.Error = err
+		endSpan(span, err, AttrOutputBytes.Int64(report.OutputBytes))
+
+		result.Steps = append(result.Steps, report)
+		if err != nil {
+			return result, fmt.Errorf("pipeline step %d (%s): %w", i+1, step.Type(), err)
+		}
+		docs = out
+	}
+
+	result.Documents = docs
+	return result, nil
+}
+
+// Execute runs the pipeline on a single PDF and expects a single document back.
+func (p *Pipeline) Execute(input []byte) ([]byte, error) {
+	result, err := p.Run(context.Background(), Document{Name: "input.pdf", Data: input})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Documents) != 1 {
+		return nil, fmt.Errorf("pipeline produced %d documents; use Run to receive all of them", len(result.Documents))
+	}
+	return result.Documents[0].Data, nil
+}
+
+func (p *Pipeline) Reset() *Pipeline {
+	p.steps = make([]Step, 0)
+	return p
+}
+
+func documentsSize(docs []Document) int64 {
+	var n int64
+	for _, d := range docs {
+		n += int64(len(d.Data))
+	}
+	return n
+}
+
+// PipelineDefinition is the JSON/YAML form of a Pipeline:
+//
+//	name: invoices
+//	steps:
+//	  - type: compress
+//	  - type: watermark
+//	    params: {text: PAID, opacity: 0.2}
+type PipelineDefinition struct {
+	Name  string           `json:"name,omitempty" yaml:"name,omitempty"`
+	Steps []StepDefinition `json:"steps" yaml:"steps"`
+}
+
+type StepDefinition struct {
+	Type   string                 `json:"type" yaml:"type"`
+	Params map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+func ParsePipelineJSON(data []byte) (*PipelineDefinition, error) {
+	var def PipelineDefinition
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return nil, fmt.Errorf("parse pipeline definition: %w", err)
+	}
+	return &def, nil
+}
+
+func ParsePipelineYAML(data []byte) (*PipelineDefinition, error) {
+	var def PipelineDefinition
+	if err := yaml.UnmarshalStrict(data, &def); err != nil {
+		return nil, fmt.Errorf("parse pipeline definition: %w", err)
+	}
+	for i := range def.Steps {
+		params, _ := normalizeYAML(def.Steps[i].Params).(map[string]interface{})
+		def.Steps[i].Params = params
+	}
+	return &def, nil
+}
+
+// LoadPipelineDefinition reads a .json, .yaml or .yml pipeline file.
+func LoadPipelineDefinition(path string) (*PipelineDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParsePipelineYAML(data)
+	default:
+		return ParsePipelineJSON(data)
+	}
+}
+
+// NewPipelineFromDefinition builds and validates a pipeline from its definition.
+func NewPipelineFromDefinition(pdfService PDFService, def *PipelineDefinition) (*Pipeline, error) {
+	if def == nil {
+		return nil, fmt.Errorf("%w: definition is nil", ErrInvalidStep)
+	}
+
+	p := NewPipeline(pdfService)
+	for i, sd := range def.Steps {
+		step, err := decodeStep(sd)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		p.Then(step)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Definition returns the serialisable form of the pipeline.
+func (p *Pipeline) Definition() (*PipelineDefinition, error) {
+	def := &PipelineDefinition{Steps: make([]StepDefinition, 0, len(p.steps))}
+	for _, step := range p.steps {
+		data, err := json.Marshal(step)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Type(), err)
+		}
+		var params map[string]interface{}
+		if err := json.Unmarshal(data, &params); err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Type(), err)
+		}
+		if len(params) == 0 {
+			params = nil
+		}
+		def.Steps = append(def.Steps, StepDefinition{Type: step.Type(), Params: params})
+	}
+	return def, nil
+}
+
+func decodeStep(sd StepDefinition) (Step, error) {
+	step, err := newStep(sd.Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.Params) == 0 {
+		return step, nil
+	}
+
+	data, err := json.Marshal(sd.Params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidStep, sd.Type, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(step); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidStep, sd.Type, err)
+	}
+	return step, nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values produced by
+// yaml.v2 into JSON-compatible maps.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalizeYAML(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeYAML(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,937 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func builtinSteps() map[string]StepFactory {
+	return map[string]StepFactory{
+		"compress":            func() Step { return &CompressStep{} },
+		"rotate":              func() Step { return &RotateStep{} },
+		"watermark":           func() Step { return &WatermarkStep{} },
+		"protect":             func() Step { return &ProtectStep{} },
+		"unlock":              func() Step { return &UnlockStep{} },
+		"split":               func() Step { return &SplitStep{} },
+		"merge":               func() Step { return &MergeStep{} },
+		"extract_pages":       func() Step { return &ExtractPagesStep{} },
+		"delete_pages":        func() Step { return &DeletePagesStep{} },
+		"reorder_pages":       func() Step { return &ReorderPagesStep{} },
+		"nup":                 func() Step { return &NUpStep{} },
+		"booklet":             func() Step { return &BookletStep{} },
+		"resize":              func() Step { return &ResizeStep{} },
+		"remove_blank_pages":  func() Step { return &RemoveBlankPagesStep{} },
+		"set_metadata":        func() Step { return &SetMetadataStep{} },
+		"outline":             func() Step { return &OutlineStep{} },
+		"annotations":         func() Step { return &AnnotationsStep{} },
+		"fill_form":           func() Step { return &FillFormStep{} },
+		"add_attachments":     func() Step { return &AddAttachmentsStep{} },
+		"pdfa":                func() Step { return &PDFAStep{} },
+		"ocr":                 func() Step { return &OCRStep{} },
+		"correct_orientation": func() Step { return &CorrectOrientationStep{} },
+		"convert_to_pdf":      func() Step { return &ConvertToPDFStep{} },
+		"pdf_to_jpg":          func() Step { return &PDFToJPGStep{} },
+		"extract_text":        func() Step { return &ExtractTextStep{} },
+		"extract_zones":       func() Step { return &ExtractZonesStep{} },
+		"extract_tables":      func() Step { return &ExtractTablesStep{} },
+		"export":              func() Step { return &ExportStep{} },
+		"extract_images":      func() Step { return &ExtractImagesStep{} },
+		"validate":            func() Step { return &ValidateStep{} },
+	}
+}
+
+// eachDocument applies fn to every document in turn, checking ctx between them.
+func eachDocument(ctx context.Context, docs []Document, fn func(Document) ([]Document, error)) ([]Document, error) {
+	out := make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		produced, err := fn(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", doc.Name, err)
+		}
+		out = append(out, produced...)
+	}
+	return out, nil
+}
+
+// transformEach replaces each document's data, keeping its name.
+func transformEach(ctx context.Context, docs []Document, fn func([]byte) ([]byte, error)) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		data, err := fn(doc.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Name: doc.Name, Data: data}}, nil
+	})
+}
+
+// derivedName turns "report.pdf" into "report-<suffix><ext>".
+func derivedName(name, suffix, ext string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	if base == "" || base == "." {
+		base = "document"
+	}
+	if suffix != "" {
+		base += "-" + suffix
+	}
+	return base + ext
+}
+
+func requireDocuments(docs []Document) error {
+	if len(docs) == 0 {
+		return errors.New("no input documents")
+	}
+	return nil
+}
+
+type CompressStep struct{}
+
+func (s *CompressStep) Type() string    { return "compress" }
+func (s *CompressStep) Validate() error { return nil }
+
+func (s *CompressStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, svc.Compress().CompressBytes)
+}
+
+type RotateStep struct {
+	Angle int    `json:"angle"`
+	Pages string `json:"pages,omitempty"`
+}
+
+func (s *RotateStep) Type() string { return "rotate" }
+
+func (s *RotateStep) Validate() error {
+	if s.Angle == 0 || s.Angle%90 != 0 {
+		return fmt.Errorf("angle must be a non-zero multiple of 90, got %d", s.Angle)
+	}
+	return nil
+}
+
+func (s *RotateStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Rotate().RotateBytes(data, s.Angle, s.Pages)
+	})
+}
+
+type WatermarkStep struct {
+	Text     string  `json:"text"`
+	FontSize int     `json:"font_size,omitempty"`
+	Position string  `json:"position,omitempty"`
+	Opacity  float64 `json:"opacity,omitempty"`
+	Color    string  `json:"color,omitempty"`
+}
+
+func (s *WatermarkStep) Type() string { return "watermark" }
+
+func (s *WatermarkStep) Validate() error {
+	if s.Text == "" {
+		return errors.New("text is required")
+	}
+	if s.FontSize < 0 {
+		return fmt.Errorf("font_size must not be negative, got %d", s.FontSize)
+	}
+	if s.Opacity < 0 || s.Opacity > 1 {
+		return fmt.Errorf("opacity must be between 0 and 1, got %g", s.Opacity)
+	}
+	switch s.Position {
+	case "", "diagonal", "center", "top", "bottom":
+	default:
+		return fmt.Errorf("unknown position %q", s.Position)
+	}
+	return nil
+}
+
+func (s *WatermarkStep) options() *WatermarkOptions {
+	opts := DefaultWatermarkOptions()
+	if s.FontSize > 0 {
+		opts.FontSize = s.FontSize
+	}
+	if s.Position != "" {
+		opts.Position = s.Position
+	}
+	if s.Opacity > 0 {
+		opts.Opacity = s.Opacity
+	}
+	if s.Color != "" {
+		opts.Color = s.Color
+	}
+	return opts
+}
+
+func (s *WatermarkStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	opts := s.options()
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Watermark().AddWatermarkBytes(data, s.Text, opts)
+	})
+}
+
+type ProtectStep struct {
+	Password string `json:"password"`
+}
+
+func (s *ProtectStep) Type() string { return "protect" }
+
+func (s *ProtectStep) Validate() error {
+	if s.Password == "" {
+		return errors.New("password is required")
+	}
+	return nil
+}
+
+func (s *ProtectStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Protect().ProtectBytes(data, s.Password)
+	})
+}
+
+type UnlockStep struct {
+	Password string `json:"password"`
+}
+
+func (s *UnlockStep) Type() string { return "unlock" }
+
+func (s *UnlockStep) Validate() error {
+	if s.Password == "" {
+		return errors.New("password is required")
+	}
+	return nil
+}
+
+func (s *UnlockStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Unlock().UnlockBytes(data, s.Password)
+	})
+}
+
+// SplitStep fans each document out into one document per range, or one
+// per page when no mode is set. Every, MaxBytes, Bookmarks and Separator
+// select the other split modes; at most one mode may be set.
+type SplitStep struct {
+	Ranges    []string          `json:"ranges,omitempty"`
+	Every     int               `json:"every,omitempty"`
+	MaxBytes  int64             `json:"max_bytes,omitempty"`
+	Bookmarks bool              `json:"bookmarks,omitempty"`
+	Separator *SeparatorOptions `json:"separator,omitempty"`
+}
+
+func (s *SplitStep) Type() string { return "split" }
+
+func (s *SplitStep) Validate() error {
+	for _, r := range s.Ranges {
+		if strings.TrimSpace(r) == "" {
+			return errors.New("ranges must not contain empty entries")
+		}
+	}
+	if s.Every < 0 {
+		return errors.New("every must be positive")
+	}
+	if s.MaxBytes < 0 {
+		return errors.New("max_bytes must be positive")
+	}
+	if s.Separator != nil && !s.Separator.Blank && !s.Separator.Barcode {
+		return errors.New("separator needs blank or barcode")
+	}
+
+	modes := 0
+	for _, set := range []bool{len(s.Ranges) > 0, s.Every > 0, s.MaxBytes > 0, s.Bookmarks, s.Separator != nil} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return errors.New("only one of ranges, every, max_bytes, bookmarks and separator may be set")
+	}
+	return nil
+}
+
+func (s *SplitStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		var parts []SplitPart
+		var err error
+		switch {
+		case s.Every > 0:
+			parts, err = svc.Split().SplitEvery(doc.Data, s.Every)
+		case s.MaxBytes > 0:
+			parts, err = svc.Split().SplitBySize(doc.Data, s.MaxBytes)
+		case s.Bookmarks:
+			parts, err = svc.Split().SplitByBookmarks(doc.Data)
+		case s.Separator != nil:
+			parts, err = svc.Split().SplitBySeparator(doc.Data, s.Separator)
+		case len(s.Ranges) > 0:
+			return s.splitRanges(svc, doc)
+		default:
+			return s.splitPages(svc, doc)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]Document, len(parts))
+		for i, part := range parts {
+			suffix := strings.TrimSuffix(part.Name, filepath.Ext(part.Name))
+			out[i] = Document{Name: derivedName(doc.Name, suffix, ".pdf"), Data: part.Data}
+		}
+		return out, nil
+	})
+}
+
+func (s *SplitStep) splitPages(svc PDFService, doc Document) ([]Document, error) {
+	pages, err := svc.Split().SplitToPages(doc.Data)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]Document, len(pages))
+	for i, data := range pages {
+		parts[i] = Document{Name: derivedName(doc.Name, fmt.Sprint(i+1), ".pdf"), Data: data}
+	}
+	return parts, nil
+}
+
+func (s *SplitStep) splitRanges(svc PDFService, doc Document) ([]Document, error) {
+	parts := make([]Document, 0, len(s.Ranges))
+	for _, r := range s.Ranges {
+		data, err := svc.Pages().ExtractPages(doc.Data, r)
+		if err != nil {
+			return nil, fmt.Errorf("range %s: %w", r, err)
+		}
+		suffix := strings.NewReplacer(",", "_", " ", "").Replace(r)
+		parts = append(parts, Document{Name: derivedName(doc.Name, suffix, ".pdf"), Data: data})
+	}
+	return parts, nil
+}
+
+// MergeStep fans all documents in to a single PDF. Setting any of the
+// layout options merges with MergeWithOptions, bookmarking each document
+// by name.
+type MergeStep struct {
+	Name            string `json:"name,omitempty"`
+	Bookmarks       bool   `json:"bookmarks,omitempty"`
+	TableOfContents bool   `json:"table_of_contents,omitempty"`
+	OddPageStart    bool   `json:"odd_page_start,omitempty"`
+}
+
+func (s *MergeStep) Type() string    { return "merge" }
+func (s *MergeStep) Validate() error { return nil }
+
+func (s *MergeStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	if err := requireDocuments(docs); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	var err error
+	if s.Bookmarks || s.TableOfContents || s.OddPageStart {
+		inputs := make([]MergeInput, len(docs))
+		for i, doc := range docs {
+			inputs[i] = MergeInput{Data: doc.Data, Name: doc.Name}
+		}
+		opts := DefaultMergeOptions()
+		opts.Bookmarks = s.Bookmarks
+		opts.TableOfContents = s.TableOfContents
+		opts.OddPageStart = s.OddPageStart
+		data, err = svc.Merge().MergeWithOptions(inputs, opts)
+	} else {
+		inputs := make([][]byte, len(docs))
+		for i, doc := range docs {
+			inputs[i] = doc.Data
+		}
+		data, err = svc.Merge().MergeBytes(inputs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := s.Name
+	if name == "" {
+		name = "merged.pdf"
+	}
+	return []Document{{Name: name, Data: data}}, nil
+}
+
+type ExtractPagesStep struct {
+	Pages string `json:"pages"`
+}
+
+func (s *ExtractPagesStep) Type() string { return "extract_pages" }
+
+func (s *ExtractPagesStep) Validate() error {
+	if s.Pages == "" {
+		return errors.New("pages is required")
+	}
+	return nil
+}
+
+func (s *ExtractPagesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().ExtractPages(data, s.Pages)
+	})
+}
+
+type DeletePagesStep struct {
+	Pages string `json:"pages"`
+}
+
+func (s *DeletePagesStep) Type() string { return "delete_pages" }
+
+func (s *DeletePagesStep) Validate() error {
+	if s.Pages == "" {
+		return errors.New("pages is required")
+	}
+	return nil
+}
+
+func (s *DeletePagesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().DeletePages(data, s.Pages)
+	})
+}
+
+type ReorderPagesStep struct {
+	Order []int `json:"order"`
+}
+
+func (s *ReorderPagesStep) Type() string { return "reorder_pages" }
+
+func (s *ReorderPagesStep) Validate() error {
+	if len(s.Order) == 0 {
+		return errors.New("order is required")
+	}
+	for _, page := range s.Order {
+		if page < 1 {
+			return fmt.Errorf("page numbers start at 1, got %d", page)
+		}
+	}
+	return nil
+}
+
+func (s *ReorderPagesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().ReorderPages(data, s.Order)
+	})
+}
+
+type NUpStep struct {
+	NUpOptions
+}
+
+func (s *NUpStep) Type() string { return "nup" }
+
+func (s *NUpStep) Validate() error {
+	if _, _, ok := nUpGrid(s.N); !ok {
+		return fmt.Errorf("n must be 2, 4, 6 or 9, got %d", s.N)
+	}
+	_, _, err := sheetSize(s.PaperSize, false)
+	return err
+}
+
+func (s *NUpStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().NUp(data, &s.NUpOptions)
+	})
+}
+
+type BookletStep struct {
+	BookletOptions
+}
+
+func (s *BookletStep) Type() string { return "booklet" }
+
+func (s *BookletStep) Validate() error {
+	_, _, err := sheetSize(s.PaperSize, true)
+	return err
+}
+
+func (s *BookletStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().Booklet(data, &s.BookletOptions)
+	})
+}
+
+type ResizeStep struct {
+	ResizeOptions
+}
+
+func (s *ResizeStep) Type() string { return "resize" }
+
+func (s *ResizeStep) Validate() error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if s.Width == 0 {
+		_, _, err := paperSize(s.PaperSize)
+		return err
+	}
+	return nil
+}
+
+func (s *ResizeStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().ResizePages(data, &s.ResizeOptions)
+	})
+}
+
+type RemoveBlankPagesStep struct {
+	BlankPageOptions
+}
+
+func (s *RemoveBlankPagesStep) Type() string { return "remove_blank_pages" }
+
+func (s *RemoveBlankPagesStep) Validate() error {
+	if s.Sensitivity < 0 || s.Sensitivity > 1 {
+		return fmt.Errorf("sensitivity must be between 0 and 1, got %g", s.Sensitivity)
+	}
+	return nil
+}
+
+func (s *RemoveBlankPagesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Pages().RemoveBlankPages(data, &s.BlankPageOptions)
+	})
+}
+
+type SetMetadataStep struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (s *SetMetadataStep) Type() string { return "set_metadata" }
+
+func (s *SetMetadataStep) Validate() error {
+	if len(s.Metadata) == 0 {
+		return errors.New("metadata is required")
+	}
+	return nil
+}
+
+func (s *SetMetadataStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Metadata().SetMetadata(data, s.Metadata)
+	})
+}
+
+// OutlineStep replaces each document's bookmarks with Items, or with
+// bookmarks generated from its headings when Generate is set.
+type OutlineStep struct {
+	Items    []OutlineItem   `json:"items,omitempty"`
+	Generate *HeadingOptions `json:"generate,omitempty"`
+}
+
+func (s *OutlineStep) Type() string { return "outline" }
+
+func (s *OutlineStep) Validate() error {
+	if (len(s.Items) > 0) == (s.Generate != nil) {
+		return errors.New("exactly one of items or generate is required")
+	}
+	return nil
+}
+
+func (s *OutlineStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		if s.Generate != nil {
+			return svc.Outline().GenerateOutline(data, s.Generate)
+		}
+		return svc.Outline().SetOutline(data, s.Items)
+	})
+}
+
+// AnnotationsStep adds Add to each document, then removes or flattens the
+// annotations matched by Filter when Remove or Flatten is set.
+type AnnotationsStep struct {
+	Add     []Annotation      `json:"add,omitempty"`
+	Remove  bool              `json:"remove,omitempty"`
+	Flatten bool              `json:"flatten,omitempty"`
+	Filter  *AnnotationFilter `json:"filter,omitempty"`
+}
+
+func (s *AnnotationsStep) Type() string { return "annotations" }
+
+func (s *AnnotationsStep) Validate() error {
+	if s.Remove && s.Flatten {
+		return errors.New("remove and flatten are mutually exclusive")
+	}
+	if len(s.Add) == 0 && !s.Remove && !s.Flatten {
+		return errors.New("add, remove or flatten is required")
+	}
+	return nil
+}
+
+func (s *AnnotationsStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		var err error
+		if len(s.Add) > 0 {
+			if data, err = svc.Annotations().AddAnnotations(data, s.Add); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case s.Flatten:
+			return svc.Annotations().FlattenAnnotations(data, s.Filter)
+		case s.Remove:
+			return svc.Annotations().RemoveAnnotations(data, s.Filter)
+		}
+		return data, nil
+	})
+}
+
+type FillFormStep struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func (s *FillFormStep) Type() string { return "fill_form" }
+
+func (s *FillFormStep) Validate() error {
+	if len(s.Data) == 0 {
+		return errors.New("data is required")
+	}
+	return nil
+}
+
+func (s *FillFormStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Form().FillForm(data, s.Data)
+	})
+}
+
+// AddAttachmentsStep embeds files; in JSON definitions their contents are base64.
+type AddAttachmentsStep struct {
+	Files map[string][]byte `json:"files"`
+}
+
+func (s *AddAttachmentsStep) Type() string { return "add_attachments" }
+
+func (s *AddAttachmentsStep) Validate() error {
+	if len(s.Files) == 0 {
+		return errors.New("files is required")
+	}
+	return nil
+}
+
+func (s *AddAttachmentsStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Attachment().AddAttachments(data, s.Files)
+	})
+}
+
+type PDFAStep struct {
+	Format string `json:"format,omitempty"`
+}
+
+func (s *PDFAStep) Type() string { return "pdfa" }
+
+func (s *PDFAStep) Validate() error {
+	switch s.Format {
+	case "", "PDF/A-1b", "PDF/A-2b", "PDF/A-3b":
+		return nil
+	default:
+		return fmt.Errorf("unsupported PDF/A format %q", s.Format)
+	}
+}
+
+func (s *PDFAStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.Archive().ConvertToPDFA(data, s.Format)
+	})
+}
+
+// OCRStep replaces each document with a searchable PDF.
+type OCRStep struct {
+	Language string         `json:"language,omitempty"`
+	Mode     SearchableMode `json:"mode,omitempty"`
+}
+
+func (s *OCRStep) Type() string { return "ocr" }
+
+func (s *OCRStep) Validate() error {
+	switch s.Mode {
+	case "", SearchableReplace, SearchableHybrid:
+		return nil
+	}
+	return fmt.Errorf("unsupported searchable PDF mode %q", s.Mode)
+}
+
+func (s *OCRStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		return svc.OCR().CreateSearchablePDFWithOptions(ctx, data, &OCROptions{Language: s.Language, Mode: s.Mode})
+	})
+}
+
+// CorrectOrientationStep turns scanned pages upright and optionally
+// deskews them.
+type CorrectOrientationStep struct {
+	OrientationOptions
+}
+
+func (s *CorrectOrientationStep) Type() string    { return "correct_orientation" }
+func (s *CorrectOrientationStep) Validate() error { return s.validate() }
+
+func (s *CorrectOrientationStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return transformEach(ctx, docs, func(data []byte) ([]byte, error) {
+		result, err := svc.OCR().CorrectOrientation(ctx, data, &s.OrientationOptions)
+		if err != nil {
+			return nil, err
+		}
+		return result.Output, nil
+	})
+}
+
+// ConvertToPDFStep converts Office documents and images to PDF, choosing the
+// converter from each document's extension. PDFs pass through unchanged.
+type ConvertToPDFStep struct{}
+
+func (s *ConvertToPDFStep) Type() string    { return "convert_to_pdf" }
+func (s *ConvertToPDFStep) Validate() error { return nil }
+
+func (s *ConvertToPDFStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		var data []byte
+		var err error
+
+		switch strings.ToLower(filepath.Ext(doc.Name)) {
+		case ".pdf":
+			return []Document{doc}, nil
+		case ".doc", ".docx", ".odt", ".rtf":
+			data, err = svc.WordToPDF().ConvertBytes(ctx, doc.Data, doc.Name)
+		case ".xls", ".xlsx", ".ods", ".csv":
+			data, err = svc.ExcelToPDF().ConvertBytes(ctx, doc.Data, doc.Name)
+		case ".ppt", ".pptx", ".odp":
+			data, err = svc.PowerPointToPDF().ConvertBytes(ctx, doc.Data, doc.Name)
+		case ".jpg", ".jpeg", ".png":
+			data, err = svc.JPGToPDF().ConvertBytes(doc.Data, doc.Name)
+		default:
+			return nil, fmt.Errorf("no converter for %q", filepath.Ext(doc.Name))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Name: derivedName(doc.Name, "", ".pdf"), Data: data}}, nil
+	})
+}
+
+// PDFToJPGStep fans each PDF out into one JPEG per page.
+type PDFToJPGStep struct{}
+
+func (s *PDFToJPGStep) Type() string    { return "pdf_to_jpg" }
+func (s *PDFToJPGStep) Validate() error { return nil }
+
+func (s *PDFToJPGStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		images, err := svc.PDFToJPG().ConvertToImages(doc.Data)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]Document, len(images))
+		for i, data := range images {
+			out[i] = Document{Name: derivedName(doc.Name, fmt.Sprintf("page-%d", i+1), ".jpg"), Data: data}
+		}
+		return out, nil
+	})
+}
+
+// ExtractTextStep replaces each PDF with a .txt document of its text,
+// falling back to OCR for scanned pages.
+type ExtractTextStep struct {
+	TextExtractionOptions
+}
+
+func (s *ExtractTextStep) Type() string { return "extract_text" }
+
+func (s *ExtractTextStep) Validate() error {
+	_, err := s.withDefaults()
+	return err
+}
+
+func (s *ExtractTextStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		result, err := svc.Text().ExtractTextWithOptions(ctx, doc.Data, &s.TextExtractionOptions)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Name: derivedName(doc.Name, "", ".txt"), Data: []byte(result.Text())}}, nil
+	})
+}
+
+// ExtractZonesStep replaces each PDF with a .json document of the values
+// read from the template's zones.
+type ExtractZonesStep struct {
+	Template ZoneTemplate `json:"template"`
+	TextExtractionOptions
+}
+
+func (s *ExtractZonesStep) Type() string { return "extract_zones" }
+
+func (s *ExtractZonesStep) Validate() error {
+	if err := s.Template.Validate(); err != nil {
+		return err
+	}
+	_, err := s.withDefaults()
+	return err
+}
+
+func (s *ExtractZonesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		result, err := svc.Text().ExtractZones(ctx, doc.Data, &s.Template, &s.TextExtractionOptions)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Name: derivedName(doc.Name, "zones", ".json"), Data: data}}, nil
+	})
+}
+
+// ExtractTablesStep replaces each PDF with its tables: one .json or .xlsx
+// document holding them all, or one .csv document per table.
+type ExtractTablesStep struct {
+	TableOptions
+	// Format is "json" (the default), "csv" or "xlsx".
+	Format string `json:"format,omitempty"`
+}
+
+func (s *ExtractTablesStep) Type() string { return "extract_tables" }
+
+func (s *ExtractTablesStep) Validate() error {
+	switch s.Format {
+	case "", "json", "csv", "xlsx":
+	default:
+		return fmt.Errorf("unsupported table format %q", s.Format)
+	}
+	_, err := s.withDefaults()
+	return err
+}
+
+func (s *ExtractTablesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		result, err := svc.Text().ExtractTables(ctx, doc.Data, &s.TableOptions)
+		if err != nil {
+			return nil, err
+		}
+		switch s.Format {
+		case "csv":
+			out := make([]Document, len(result.Tables))
+			for i, t := range result.Tables {
+				data, err := t.CSV()
+				if err != nil {
+					return nil, err
+				}
+				out[i] = Document{Name: derivedName(doc.Name, fmt.Sprintf("table-%d", i+1), ".csv"), Data: data}
+			}
+			return out, nil
+		case "xlsx":
+			data, err := result.XLSX()
+			if err != nil {
+				return nil, err
+			}
+			return []Document{{Name: derivedName(doc.Name, "tables", ".xlsx"), Data: data}}, nil
+		}
+		data, err := result.JSON()
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{Name: derivedName(doc.Name, "tables", ".json"), Data: data}}, nil
+	})
+}
+
+// ExportStep replaces each PDF with an HTML or Markdown document and,
+// unless SingleFile is set, the images it refers to. Images are named
+// after the document, since outputs are written side by side.
+type ExportStep struct {
+	ExportOptions
+	// Format is ExportHTML (the default) or ExportMarkdown.
+	Format ExportFormat `json:"format,omitempty"`
+}
+
+func (s *ExportStep) Type() string { return "export" }
+
+func (s *ExportStep) Validate() error {
+	switch s.Format {
+	case "", ExportHTML, ExportMarkdown:
+	default:
+		return fmt.Errorf("unsupported export format %q", s.Format)
+	}
+	_, err := s.withDefaults()
+	return err
+}
+
+func (s *ExportStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		opts := s.ExportOptions
+		if opts.ImagePrefix == "" {
+			opts.ImagePrefix = derivedName(doc.Name, "", "-")
+		}
+		var result *ExportResult
+		var err error
+		name := derivedName(doc.Name, "", ".html")
+		if s.Format == ExportMarkdown {
+			result, err = svc.Export().ToMarkdown(ctx, doc.Data, &opts)
+			name = derivedName(doc.Name, "", ".md")
+		} else {
+			result, err = svc.Export().ToHTML(ctx, doc.Data, &opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		out := []Document{{Name: name, Data: result.Document}}
+		names := make([]string, 0, len(result.Images))
+		for n := range result.Images {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			out = append(out, Document{Name: n, Data: result.Images[n]})
+		}
+		return out, nil
+	})
+}
+
+// ExtractImagesStep fans each PDF out into its embedded images.
+type ExtractImagesStep struct {
+	ImageExtractOptions
+}
+
+func (s *ExtractImagesStep) Type() string { return "extract_images" }
+
+func (s *ExtractImagesStep) Validate() error {
+	_, err := s.withDefaults()
+	return err
+}
+
+// imageExts maps ExtractedImage formats to file extensions.
+var imageExts = map[string]string{"png": ".png", "jpeg": ".jpg", "tiff": ".tif", "jpx": ".jp2"}
+
+func (s *ExtractImagesStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		images, err := svc.Images().ExtractImagesWithOptions(ctx, doc.Data, &s.ImageExtractOptions)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]Document, len(images))
+		for i, img := range images {
+			out[i] = Document{Name: derivedName(doc.Name, fmt.Sprintf("image-%d", i+1), imageExts[img.Format]), Data: img.Data}
+		}
+		return out, nil
+	})
+}
+
+// ValidateStep fails the pipeline if any document is not a valid PDF.
+type ValidateStep struct{}
+
+func (s *ValidateStep) Type() string    { return "validate" }
+func (s *ValidateStep) Validate() error { return nil }
+
+func (s *ValidateStep) Run(ctx context.Context, svc PDFService, docs []Document) ([]Document, error) {
+	return eachDocument(ctx, docs, func(doc Document) ([]Document, error) {
+		if err := svc.Info().ValidatePDF(doc.Data); err != nil {
+			return nil, err
+		}
+		return []Document{doc}, nil
+	})
+}
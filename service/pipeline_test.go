@@ -0,0 +1,249 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func TestPipelineRunReports(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	result, err := pdfService.Pipeline().
+		Compress().
+		Rotate(90, "").
+		Run(context.Background(), service.Document{Name: "in.pdf", Data: minimalPDF})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(result.Steps) != 2 {
+		t.Fatalf("Expected 2 step reports, got %d", len(result.Steps))
+	}
+	for i, want := range []string{"compress", "rotate"} {
+		report := result.Steps[i]
+		if report.Type != want || report.Index != i+1 {
+			t.Errorf("Step %d: expected %s, got %+v", i+1, want, report)
+		}
+		if report.InputDocuments != 1 || report.OutputDocuments != 1 || report.OutputBytes <= 0 {
+			t.Errorf("Step %d: unexpected report %+v", i+1, report)
+		}
+	}
+	if result.Steps[0].InputBytes != int64(len(minimalPDF)) {
+		t.Errorf("Expected input bytes %d, got %d", len(minimalPDF), result.Steps[0].InputBytes)
+	}
+	if len(result.Documents) != 1 || result.Documents[0].Name != "in.pdf" {
+		t.Errorf("Expected in.pdf as output, got %+v", result.Documents)
+	}
+}
+
+func TestPipelineValidatesBeforeRunning(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	ran := false
+	probe := service.StepFunc{Name: "probe", Fn: func(ctx context.Context, svc service.PDFService, docs []service.Document) ([]service.Document, error) {
+		ran = true
+		return docs, nil
+	}}
+
+	_, err := pdfService.Pipeline().Then(probe).Rotate(45, "").Execute(minimalPDF)
+	if !errors.Is(err, service.ErrInvalidStep) {
+		t.Errorf("Expected ErrInvalidStep, got %v", err)
+	}
+	if ran {
+		t.Error("Expected no step to run when validation fails")
+	}
+
+	if _, err := pdfService.Pipeline().Execute(minimalPDF); !errors.Is(err, service.ErrInvalidStep) {
+		t.Errorf("Expected empty pipeline to be rejected, got %v", err)
+	}
+}
+
+func TestPipelineMergeAndSplit(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	result, err := pdfService.Pipeline().
+		Merge("both.pdf").
+		Then(&service.ValidateStep{}).
+		Split().
+		Run(context.Background(),
+			service.Document{Name: "a.pdf", Data: minimalPDF},
+			service.Document{Name: "b.pdf", Data: minimalPDF},
+		)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if result.Steps[0].InputDocuments != 2 || result.Steps[0].OutputDocuments != 1 {
+		t.Errorf("Expected merge to fan in 2 documents, got %+v", result.Steps[0])
+	}
+	if len(result.Documents) != 2 {
+		t.Fatalf("Expected split to fan out 2 pages, got %d", len(result.Documents))
+	}
+	if result.Documents[0].Name != "both-1.pdf" || result.Documents[1].Name != "both-2.pdf" {
+		t.Errorf("Unexpected part names: %s, %s", result.Documents[0].Name, result.Documents[1].Name)
+	}
+
+	if _, err := pdfService.Pipeline().Split().Execute(result.Documents[0].Data); err != nil {
+		t.Errorf("Expected single-page split to return one document: %v", err)
+	}
+}
+
+func TestPipelineFromJSON(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	def, err := service.ParsePipelineJSON([]byte(`{
+		"name": "stamp",
+		"steps": [
+			{"type": "compress"},
+			{"type": "watermark", "params": {"text": "DRAFT", "opacity": 0.2}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParsePipelineJSON failed: %v", err)
+	}
+	if def.Name != "stamp" || len(def.Steps) != 2 {
+		t.Fatalf("Unexpected definition: %+v", def)
+	}
+
+	pipeline, err := service.NewPipelineFromDefinition(pdfService, def)
+	if err != nil {
+		t.Fatalf("NewPipelineFromDefinition failed: %v", err)
+	}
+	step, ok := pipeline.Steps()[1].(*service.WatermarkStep)
+	if !ok || step.Text != "DRAFT" || step.Opacity != 0.2 {
+		t.Errorf("Expected decoded watermark step, got %#v", pipeline.Steps()[1])
+	}
+}
+
+func TestPipelineFromYAML(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	def, err := service.ParsePipelineYAML([]byte(`
+name: invoices
+steps:
+  - type: set_metadata
+    params:
+      metadata:
+        Title: Invoice
+  - type: split
+    params:
+      ranges: ["1", "1"]
+`))
+	if err != nil {
+		t.Fatalf("ParsePipelineYAML failed: %v", err)
+	}
+
+	pipeline, err := service.NewPipelineFromDefinition(pdfService, def)
+	if err != nil {
+		t.Fatalf("NewPipelineFromDefinition failed: %v", err)
+	}
+	if meta := pipeline.Steps()[0].(*service.SetMetadataStep); meta.Metadata["Title"] != "Invoice" {
+		t.Errorf("Expected nested YAML params to decode, got %#v", meta)
+	}
+
+	result, err := pipeline.Run(context.Background(), service.Document{Name: "in.pdf", Data: minimalPDF})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Documents) != 2 {
+		t.Errorf("Expected one document per range, got %d", len(result.Documents))
+	}
+}
+
+func TestPipelineDefinitionErrors(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	tests := []struct {
+		name string
+		json string
+		want error
+	}{
+		{"unknown step", `{"steps":[{"type":"teleport"}]}`, service.ErrUnknownStep},
+		{"unknown param", `{"steps":[{"type":"rotate","params":{"angel":90}}]}`, service.ErrInvalidStep},
+		{"wrong type", `{"steps":[{"type":"rotate","params":{"angle":"ninety"}}]}`, service.ErrInvalidStep},
+		{"invalid value", `{"steps":[{"type":"protect","params":{"password":""}}]}`, service.ErrInvalidStep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := service.ParsePipelineJSON([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("ParsePipelineJSON failed: %v", err)
+			}
+			if _, err := service.NewPipelineFromDefinition(pdfService, def); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+type prefixNameStep struct {
+	Prefix string `json:"prefix"`
+}
+
+func (s *prefixNameStep) Type() string { return "test_prefix_name" }
+
+func (s *prefixNameStep) Validate() error {
+	if s.Prefix == "" {
+		return errors.New("prefix is required")
+	}
+	return nil
+}
+
+func (s *prefixNameStep) Run(ctx context.Context, svc service.PDFService, docs []service.Document) ([]service.Document, error) {
+	out := make([]service.Document, len(docs))
+	for i, doc := range docs {
+		out[i] = service.Document{Name: s.Prefix + doc.Name, Data: doc.Data}
+	}
+	return out, nil
+}
+
+func TestRegisterCustomStep(t *testing.T) {
+	if err := service.RegisterStep("test_prefix_name", func() service.Step { return &prefixNameStep{} }); err != nil {
+		t.Fatalf("RegisterStep failed: %v", err)
+	}
+	t.Cleanup(func() { service.UnregisterStep("test_prefix_name") })
+	if err := service.RegisterStep("compress", func() service.Step { return &prefixNameStep{} }); !errors.Is(err, service.ErrInvalidStep) {
+		t.Errorf("Expected duplicate registration to fail, got %v", err)
+	}
+
+	def, err := service.ParsePipelineJSON([]byte(`{"steps":[{"type":"test_prefix_name","params":{"prefix":"out-"}}]}`))
+	if err != nil {
+		t.Fatalf("ParsePipelineJSON failed: %v", err)
+	}
+	pipeline, err := service.NewPipelineFromDefinition(service.NewWithGotenberg("http://localhost:3000"), def)
+	if err != nil {
+		t.Fatalf("NewPipelineFromDefinition failed: %v", err)
+	}
+
+	result, err := pipeline.Run(context.Background(), service.Document{Name: "a.pdf", Data: minimalPDF})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Documents[0].Name != "out-a.pdf" || !bytes.Equal(result.Documents[0].Data, minimalPDF) {
+		t.Errorf("Unexpected output %q", result.Documents[0].Name)
+	}
+}
+
+func TestPipelineDefinitionRoundTrip(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	original := pdfService.Pipeline().Compress().Rotate(180, "1").Protect("secret")
+	def, err := original.Definition()
+	if err != nil {
+		t.Fatalf("Definition failed: %v", err)
+	}
+
+	rebuilt, err := service.NewPipelineFromDefinition(pdfService, def)
+	if err != nil {
+		t.Fatalf("NewPipelineFromDefinition failed: %v", err)
+	}
+	rotate, ok := rebuilt.Steps()[1].(*service.RotateStep)
+	if !ok || rotate.Angle != 180 || rotate.Pages != "1" {
+		t.Errorf("Expected rotate step to round-trip, got %#v", rebuilt.Steps()[1])
+	}
+}
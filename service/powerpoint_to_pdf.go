@@ -40,6 +40,13 @@ func (s *powerPointToPDFService) Convert(ctx context.Context, input io.Reader, f
 }
 
 func (s *powerPointToPDFService) ConvertFile(ctx context.Context, inputPath, outputPath string) error {
+	ctx, span := startSpan(ctx, "PowerPointToPDFService.ConvertFile")
+	err := s.convertFile(ctx, inputPath, outputPath)
+	endSpan(span, err)
+	return err
+}
+
+func (s *powerPointToPDFService) convertFile(ctx context.Context, inputPath, outputPath string) error {
 	s.log.Info("PowerPointToPDFService.ConvertFile called", logger.String("input", inputPath))
 
 	resultBytes, err := s.gotClient.PowerPointToPDF(ctx, inputPath)
@@ -48,7 +55,7 @@ func (s *powerPointToPDFService) ConvertFile(ctx context.Context, inputPath, out
 		return err
 	}
 
-	if err := os.WriteFile(outputPath, resultBytes, 0644); err != nil {
+	if err := writeFile(ctx, outputPath, resultBytes); err != nil {
 		s.log.Error("Failed to write output file", logger.Error(err))
 		return err
 	}
@@ -58,6 +65,13 @@ func (s *powerPointToPDFService) ConvertFile(ctx context.Context, inputPath, out
 }
 
 func (s *powerPointToPDFService) ConvertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "PowerPointToPDFService.ConvertBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.convertBytes(ctx, input, filename)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *powerPointToPDFService) convertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
 	s.log.Info("PowerPointToPDFService.ConvertBytes called")
 
 	ext := getPPTExtension(filename)
@@ -67,11 +81,9 @@ func (s *powerPointToPDFService) ConvertBytes(ctx context.Context, input []byte,
 	}
 	defer os.Remove(tmpInput.Name())
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
 	resultBytes, err := s.gotClient.PowerPointToPDF(ctx, tmpInput.Name())
 	if err != nil {
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -39,6 +40,13 @@ func (s *protectService) Protect(input io.Reader, password string) ([]byte, erro
 }
 
 func (s *protectService) ProtectFile(inputPath, outputPath, password string) error {
+	ctx, span := startSpan(context.Background(), "ProtectService.ProtectFile")
+	err := s.protectFile(ctx, inputPath, outputPath, password)
+	endSpan(span, err)
+	return err
+}
+
+func (s *protectService) protectFile(ctx context.Context, inputPath, outputPath, password string) error {
 	s.log.Info("ProtectService.ProtectFile called", logger.String("input", inputPath))
 
 	conf := api.LoadConfiguration()
@@ -48,7 +56,9 @@ func (s *protectService) ProtectFile(inputPath, outputPath, password string) err
 	conf.EncryptKeyLength = 256
 	conf.Permissions = model.PermissionsAll
 
-	if err := api.EncryptFile(inputPath, outputPath, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.EncryptFile", func() error {
+		return api.EncryptFile(inputPath, outputPath, conf)
+	}); err != nil {
 		s.log.Error("pdfcpu encrypt failed", logger.Error(err))
 		return fmt.Errorf("encryption failed: %w", err)
 	}
@@ -58,6 +68,13 @@ func (s *protectService) ProtectFile(inputPath, outputPath, password string) err
 }
 
 func (s *protectService) ProtectBytes(input []byte, password string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "ProtectService.ProtectBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.protectBytes(ctx, input, password)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *protectService) protectBytes(ctx context.Context, input []byte, password string) ([]byte, error) {
 	s.log.Info("ProtectService.ProtectBytes called")
 
 	tmpInput, err := os.CreateTemp("", "pdf-protect-*.pdf")
@@ -73,17 +90,15 @@ func (s *protectService) ProtectBytes(input []byte, password string) ([]byte, er
 	defer os.Remove(tmpOutput.Name())
 	tmpOutput.Close()
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
-	if err := s.ProtectFile(tmpInput.Name(), tmpOutput.Name(), password); err != nil {
+	if err := s.protectFile(ctx, tmpInput.Name(), tmpOutput.Name(), password); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(tmpOutput.Name())
+	output, err := readFile(ctx, tmpOutput.Name())
 	if err != nil {
 		return nil, err
 	}
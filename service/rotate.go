@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -38,6 +39,13 @@ func (s *rotateService) Rotate(input io.Reader, angle int, pages string) ([]byte
 }
 
 func (s *rotateService) RotateFile(inputPath, outputPath string, angle int, pages string) error {
+	ctx, span := startSpan(context.Background(), "RotateService.RotateFile")
+	err := s.rotateFile(ctx, inputPath, outputPath, angle, pages)
+	endSpan(span, err)
+	return err
+}
+
+func (s *rotateService) rotateFile(ctx context.Context, inputPath, outputPath string, angle int, pages string) error {
 	s.log.Info("RotateService.RotateFile called", logger.String("input", inputPath), logger.Int("angle", angle))
 
 	if angle != 90 && angle != 180 && angle != 270 {
@@ -54,10 +62,14 @@ func (s *rotateService) RotateFile(inputPath, outputPath string, angle int, page
 
 	var selectedPages []string
 	if pages != "" && pages != "all" {
-		selectedPages = []string{pages}
+		if selectedPages, err = api.ParsePageSelection(pages); err != nil {
+			return err
+		}
 	}
 
-	if err := api.RotateFile(outputPath, "", angle, selectedPages, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.RotateFile", func() error {
+		return api.RotateFile(outputPath, "", angle, selectedPages, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu rotate failed", logger.Error(err))
 		os.Remove(outputPath)
 		return fmt.Errorf("rotate failed: %w", err)
@@ -68,6 +80,13 @@ func (s *rotateService) RotateFile(inputPath, outputPath string, angle int, page
 }
 
 func (s *rotateService) RotateBytes(input []byte, angle int, pages string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "RotateService.RotateBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.rotateBytes(ctx, input, angle, pages)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *rotateService) rotateBytes(ctx context.Context, input []byte, angle int, pages string) ([]byte, error) {
 	s.log.Info("RotateService.RotateBytes called", logger.Int("angle", angle))
 
 	tmpInput, err := os.CreateTemp("", "pdf-rotate-*.pdf")
@@ -83,17 +102,15 @@ func (s *rotateService) RotateBytes(input []byte, angle int, pages string) ([]by
 	defer os.Remove(tmpOutput.Name())
 	tmpOutput.Close()
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
-	if err := s.RotateFile(tmpInput.Name(), tmpOutput.Name(), angle, pages); err != nil {
+	if err := s.rotateFile(ctx, tmpInput.Name(), tmpOutput.Name(), angle, pages); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(tmpOutput.Name())
+	output, err := readFile(ctx, tmpOutput.Name())
 	if err != nil {
 		return nil, err
 	}
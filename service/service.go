@@ -28,6 +28,9 @@ type PDFService interface {
 	Form() FormService
 	Attachment() AttachmentService
 	OCR() OCRService
+	Outline() OutlineService
+	Annotations() AnnotationService
+	Export() ExportService
 
 	Batch(maxWorkers int) *BatchProcessor
 	Pipeline() *Pipeline
@@ -55,11 +58,21 @@ type pdfService struct {
 	form            FormService
 	attachment      AttachmentService
 	ocr             OCRService
+	outline         OutlineService
+	annotations     AnnotationService
+	export          ExportService
 	log             logger.ILogger
 	gotClient       gotenberg.Client
 }
 
 func New(log logger.ILogger, gotClient gotenberg.Client) PDFService {
+	return NewWithRenderer(log, gotClient, NewPopplerRenderer())
+}
+
+// NewWithRenderer is New with the page renderer that OCR, orientation,
+// blank page and barcode detection rasterise pages with.
+func NewWithRenderer(log logger.ILogger, gotClient gotenberg.Client, renderer PageRenderer) PDFService {
+	ocr := NewOCRServiceWithRenderer(log, NewTesseractEngine(), renderer)
 	return &pdfService{
 		wordToPDF:       NewWordToPDFService(log, gotClient),
 		excelToPDF:      NewExcelToPDFService(log, gotClient),
@@ -68,20 +81,23 @@ func New(log logger.ILogger, gotClient gotenberg.Client) PDFService {
 		pdfToJPG:        NewPDFToJPGService(log),
 		compress:        NewCompressService(log),
 		merge:           NewMergeService(log),
-		split:           NewSplitService(log),
+		split:           NewSplitServiceWithRenderer(log, renderer),
 		rotate:          NewRotateService(log),
 		watermark:       NewWatermarkService(log),
 		protect:         NewProtectService(log),
 		unlock:          NewUnlockService(log),
 		info:            NewInfoService(log),
-		pages:           NewPageService(log),
-		text:            NewTextService(log),
+		pages:           NewPageServiceWithRenderer(log, renderer),
+		text:            NewTextServiceWithOCR(log, ocr),
 		metadata:        NewMetadataService(log),
 		images:          NewImageExtractService(log),
 		archive:         NewArchiveService(log, gotClient),
 		form:            NewFormService(log),
 		attachment:      NewAttachmentService(log),
-		ocr:             NewOCRService(log),
+		ocr:             ocr,
+		outline:         NewOutlineService(log),
+		annotations:     NewAnnotationService(log),
+		export:          NewExportService(log),
 		log:             log,
 		gotClient:       gotClient,
 	}
@@ -114,6 +130,9 @@ func (s *pdfService) Archive() ArchiveService                 { return s.archive
 func (s *pdfService) Form() FormService                       { return s.form }
 func (s *pdfService) Attachment() AttachmentService           { return s.attachment }
 func (s *pdfService) OCR() OCRService                         { return s.ocr }
+func (s *pdfService) Outline() OutlineService                 { return s.outline }
+func (s *pdfService) Annotations() AnnotationService          { return s.annotations }
+func (s *pdfService) Export() ExportService                   { return s.export }
 
 func (s *pdfService) Batch(maxWorkers int) *BatchProcessor {
 	return NewBatchProcessor(s, maxWorkers)
@@ -3,13 +3,19 @@ package service
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
 )
@@ -19,15 +25,65 @@ type SplitService interface {
 	SplitFile(inputPath, outputDir string, ranges string) ([]string, error)
 	SplitBytes(input []byte, ranges string) ([]byte, error)
 	SplitToPages(input []byte) ([][]byte, error)
+	// SplitParts splits on a comma-separated list of pdfcpu ranges, one
+	// part per range.
+	SplitParts(input []byte, ranges string) ([]SplitPart, error)
+	// SplitByBookmarks starts a part at every top-level bookmark, named
+	// after it. Pages before the first bookmark form their own part.
+	SplitByBookmarks(input []byte) ([]SplitPart, error)
+	// SplitEvery splits into chunks of at most pages pages.
+	SplitEvery(input []byte, pages int) ([]SplitPart, error)
+	// SplitBySize splits into runs of pages no larger than maxBytes each.
+	SplitBySize(input []byte, maxBytes int64) ([]SplitPart, error)
+	// SplitBySeparator splits a scanned batch at separator sheets.
+	SplitBySeparator(input []byte, opts *SeparatorOptions) ([]SplitPart, error)
+}
+
+// SplitPart is one document produced by a split. PageRange is the pages it
+// was taken from in the original document, e.g. "4-7".
+type SplitPart struct {
+	Name      string
+	PageRange string
+	Data      []byte
+}
+
+// ErrPageTooLarge is returned by SplitBySize when a single page exceeds
+// the size limit on its own.
+var ErrPageTooLarge = errors.New("page exceeds the maximum part size")
+
+// SeparatorOptions selects which pages count as separator sheets. At least
+// one of Blank or Barcode must be set.
+type SeparatorOptions struct {
+	// Blank treats pages without any text, image or drawing operators as
+	// separators.
+	Blank bool `json:"blank,omitempty"`
+	// Barcode treats pages carrying a barcode as separators. Pages are
+	// rendered with the service's page renderer (pdftoppm by default) and
+	// read with zbarimg, which must be installed.
+	Barcode bool `json:"barcode,omitempty"`
+	// BarcodeValue, if set, only matches barcodes with this value, e.g.
+	// "PATCHT".
+	BarcodeValue string `json:"barcode_value,omitempty"`
+	// KeepSeparators keeps each separator page at the start of the part it
+	// introduces instead of dropping it.
+	KeepSeparators bool `json:"keep_separators,omitempty"`
 }
 
 type splitService struct {
-	log logger.ILogger
+	log      logger.ILogger
+	renderer PageRenderer
 }
 
 func NewSplitService(log logger.ILogger) SplitService {
+	return NewSplitServiceWithRenderer(log, NewPopplerRenderer())
+}
+
+// NewSplitServiceWithRenderer creates a split service that renders pages
+// for barcode separator detection with renderer.
+func NewSplitServiceWithRenderer(log logger.ILogger, renderer PageRenderer) SplitService {
 	return &splitService{
-		log: log,
+		log:      log,
+		renderer: renderer,
 	}
 }
 
@@ -43,6 +99,13 @@ func (s *splitService) Split(input io.Reader, ranges string) ([]byte, error) {
 }
 
 func (s *splitService) SplitFile(inputPath, outputDir string, ranges string) ([]string, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitFile")
+	outputFiles, err := s.splitFile(ctx, inputPath, outputDir, ranges)
+	endSpan(span, err, attribute.Int("pdf.part_count", len(outputFiles)))
+	return outputFiles, err
+}
+
+func (s *splitService) splitFile(ctx context.Context, inputPath, outputDir string, ranges string) ([]string, error) {
 	s.log.Info("SplitService.SplitFile called", logger.String("input", inputPath))
 
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
@@ -59,7 +122,9 @@ func (s *splitService) SplitFile(inputPath, outputDir string, ranges string) ([]
 			continue
 		}
 
-		if err := api.ExtractPagesFile(inputPath, partDir, []string{r}, nil); err != nil {
+		if err := traceStep(ctx, "pdfcpu.ExtractPagesFile", func() error {
+			return api.ExtractPagesFile(inputPath, partDir, []string{r}, nil)
+		}); err != nil {
 			s.log.Error("pdfcpu extract failed", logger.String("range", r), logger.Error(err))
 			continue
 		}
@@ -85,6 +150,13 @@ func (s *splitService) SplitFile(inputPath, outputDir string, ranges string) ([]
 }
 
 func (s *splitService) SplitBytes(input []byte, ranges string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.splitBytes(ctx, input, ranges)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *splitService) splitBytes(ctx context.Context, input []byte, ranges string) ([]byte, error) {
 	s.log.Info("SplitService.SplitBytes called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-split-*")
@@ -94,12 +166,12 @@ func (s *splitService) SplitBytes(input []byte, ranges string) ([]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
 	outputDir := filepath.Join(tmpDir, "output")
-	outputFiles, err := s.SplitFile(inputPath, outputDir, ranges)
+	outputFiles, err := s.splitFile(ctx, inputPath, outputDir, ranges)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +184,7 @@ func (s *splitService) SplitBytes(input []byte, ranges string) ([]byte, error) {
 	zipWriter := zip.NewWriter(&zipBuffer)
 
 	for _, filePath := range outputFiles {
-		data, err := os.ReadFile(filePath)
+		data, err := readFile(ctx, filePath)
 		if err != nil {
 			continue
 		}
@@ -129,6 +201,13 @@ func (s *splitService) SplitBytes(input []byte, ranges string) ([]byte, error) {
 }
 
 func (s *splitService) SplitToPages(input []byte) ([][]byte, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitToPages", AttrInputBytes.Int(len(input)))
+	pages, err := s.splitToPages(ctx, input)
+	endSpan(span, err, AttrPageCount.Int(len(pages)))
+	return pages, err
+}
+
+func (s *splitService) splitToPages(ctx context.Context, input []byte) ([][]byte, error) {
 	s.log.Info("SplitService.SplitToPages called")
 
 	tmpDir, err := os.MkdirTemp("", "pdf-split-pages-*")
@@ -138,7 +217,7 @@ func (s *splitService) SplitToPages(input []byte) ([][]byte, error) {
 	defer os.RemoveAll(tmpDir)
 
 	inputPath := filepath.Join(tmpDir, "input.pdf")
-	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+	if err := writeFile(ctx, inputPath, input); err != nil {
 		return nil, err
 	}
 
@@ -147,7 +226,9 @@ func (s *splitService) SplitToPages(input []byte) ([][]byte, error) {
 		return nil, err
 	}
 
-	if err := api.SplitFile(inputPath, outputDir, 1, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.SplitFile", func() error {
+		return api.SplitFile(inputPath, outputDir, 1, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu split failed", logger.Error(err))
 		return nil, err
 	}
@@ -162,7 +243,7 @@ func (s *splitService) SplitToPages(input []byte) ([][]byte, error) {
 		if f.IsDir() {
 			continue
 		}
-		data, err := os.ReadFile(filepath.Join(outputDir, f.Name()))
+		data, err := readFile(ctx, filepath.Join(outputDir, f.Name()))
 		if err != nil {
 			continue
 		}
@@ -172,3 +253,458 @@ func (s *splitService) SplitToPages(input []byte) ([][]byte, error) {
 	s.log.Info("PDF split to pages completed", logger.Int("pages", len(pages)))
 	return pages, nil
 }
+
+// pageSpan is an inclusive run of pages in the source document.
+type pageSpan struct {
+	name        string
+	first, last int
+}
+
+func (p pageSpan) String() string {
+	if p.first == p.last {
+		return strconv.Itoa(p.first)
+	}
+	return fmt.Sprintf("%d-%d", p.first, p.last)
+}
+
+// splitInput holds a document written to a temporary directory for the
+// split modes below.
+type splitInput struct {
+	dir       string
+	path      string
+	pageCount int
+}
+
+func (s *splitService) openSplitInput(ctx context.Context, input []byte) (*splitInput, error) {
+	tmpDir, err := os.MkdirTemp("", "pdf-split-*")
+	if err != nil {
+		return nil, err
+	}
+	in := &splitInput{dir: tmpDir, path: filepath.Join(tmpDir, "input.pdf")}
+	if err := writeFile(ctx, in.path, input); err != nil {
+		in.close()
+		return nil, err
+	}
+	if err := traceStep(ctx, "pdfcpu.PageCountFile", func() (err error) {
+		in.pageCount, err = api.PageCountFile(in.path)
+		return err
+	}); err != nil {
+		in.close()
+		return nil, err
+	}
+	return in, nil
+}
+
+func (in *splitInput) close() {
+	os.RemoveAll(in.dir)
+}
+
+// extract returns the pages of span as a standalone PDF.
+func (in *splitInput) extract(ctx context.Context, span pageSpan) ([]byte, error) {
+	return in.collect(ctx, []string{span.String()})
+}
+
+func (in *splitInput) collect(ctx context.Context, selection []string) ([]byte, error) {
+	out, err := os.CreateTemp(in.dir, "part-*.pdf")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	if err := traceStep(ctx, "pdfcpu.CollectFile", func() error {
+		return api.CollectFile(in.path, out.Name(), selection, model.NewDefaultConfiguration())
+	}); err != nil {
+		return nil, err
+	}
+	return readFile(ctx, out.Name())
+}
+
+func (in *splitInput) parts(ctx context.Context, spans []pageSpan) ([]SplitPart, error) {
+	parts := make([]SplitPart, 0, len(spans))
+	for _, span := range spans {
+		data, err := in.extract(ctx, span)
+		if err != nil {
+			return nil, fmt.Errorf("pages %s: %w", span, err)
+		}
+		parts = append(parts, SplitPart{Name: span.name, PageRange: span.String(), Data: data})
+	}
+	return parts, nil
+}
+
+func (s *splitService) SplitParts(input []byte, ranges string) ([]SplitPart, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitParts", AttrInputBytes.Int(len(input)))
+	parts, err := s.splitParts(ctx, input, ranges)
+	endSpan(span, err, attribute.Int("pdf.part_count", len(parts)))
+	return parts, err
+}
+
+func (s *splitService) splitParts(ctx context.Context, input []byte, ranges string) ([]SplitPart, error) {
+	s.log.Info("SplitService.SplitParts called", logger.String("ranges", ranges))
+
+	in, err := s.openSplitInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.close()
+
+	var parts []SplitPart
+	for i, r := range strings.Split(ranges, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		data, err := in.collect(ctx, []string{r})
+		if err != nil {
+			return nil, fmt.Errorf("range %s: %w", r, err)
+		}
+		parts = append(parts, SplitPart{Name: fmt.Sprintf("part_%d.pdf", i+1), PageRange: r, Data: data})
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no page ranges given")
+	}
+	return parts, nil
+}
+
+func (s *splitService) SplitByBookmarks(input []byte) ([]SplitPart, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitByBookmarks", AttrInputBytes.Int(len(input)))
+	parts, err := s.splitByBookmarks(ctx, input)
+	endSpan(span, err, attribute.Int("pdf.part_count", len(parts)))
+	return parts, err
+}
+
+func (s *splitService) splitByBookmarks(ctx context.Context, input []byte) ([]SplitPart, error) {
+	s.log.Info("SplitService.SplitByBookmarks called")
+
+	in, err := s.openSplitInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.close()
+
+	bookmarks, err := listBookmarks(ctx, in.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookmarks) == 0 {
+		return nil, fmt.Errorf("document has no bookmarks")
+	}
+
+	var spans []pageSpan
+	names := make(map[string]int)
+	add := func(title string, first, last int) {
+		if first > last {
+			return
+		}
+		spans = append(spans, pageSpan{name: uniquePartName(names, title), first: first, last: last})
+	}
+
+	if bookmarks[0].PageFrom > 1 {
+		add("front_matter", 1, bookmarks[0].PageFrom-1)
+	}
+	for i, bm := range bookmarks {
+		last := in.pageCount
+		if i+1 < len(bookmarks) {
+			last = bookmarks[i+1].PageFrom - 1
+		}
+		add(bm.Title, bm.PageFrom, last)
+	}
+
+	return in.parts(ctx, spans)
+}
+
+type bookmarkStart struct {
+	Title    string
+	PageFrom int
+}
+
+// listBookmarks returns the top-level bookmarks that point at a page, in
+// page order.
+func listBookmarks(ctx context.Context, path string) ([]bookmarkStart, error) {
+	var starts []bookmarkStart
+	err := traceStep(ctx, "pdfcpu.Bookmarks", func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		bms, err := api.Bookmarks(f, model.NewDefaultConfiguration())
+		if err != nil {
+			return err
+		}
+		for _, bm := range bms {
+			if bm.PageFrom < 1 {
+				continue
+			}
+			if n := len(starts); n > 0 && bm.PageFrom <= starts[n-1].PageFrom {
+				continue
+			}
+			starts = append(starts, bookmarkStart{Title: bm.Title, PageFrom: bm.PageFrom})
+		}
+		return nil
+	})
+	return starts, err
+}
+
+// uniquePartName turns a bookmark title into a file name, numbering
+// repeats.
+func uniquePartName(seen map[string]int, title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':' || r < 32:
+			return '_'
+		default:
+			return r
+		}
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "section"
+	}
+
+	seen[name]++
+	if n := seen[name]; n > 1 {
+		name = fmt.Sprintf("%s_%d", name, n)
+	}
+	return name + ".pdf"
+}
+
+func (s *splitService) SplitEvery(input []byte, pages int) ([]SplitPart, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitEvery", AttrInputBytes.Int(len(input)))
+	parts, err := s.splitEvery(ctx, input, pages)
+	endSpan(span, err, attribute.Int("pdf.part_count", len(parts)))
+	return parts, err
+}
+
+func (s *splitService) splitEvery(ctx context.Context, input []byte, pages int) ([]SplitPart, error) {
+	s.log.Info("SplitService.SplitEvery called", logger.Int("pages", pages))
+
+	if pages <= 0 {
+		return nil, fmt.Errorf("pages per part must be positive, got %d", pages)
+	}
+
+	in, err := s.openSplitInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.close()
+
+	var spans []pageSpan
+	for first := 1; first <= in.pageCount; first += pages {
+		last := min(first+pages-1, in.pageCount)
+		spans = append(spans, pageSpan{name: fmt.Sprintf("part_%d.pdf", len(spans)+1), first: first, last: last})
+	}
+	return in.parts(ctx, spans)
+}
+
+func (s *splitService) SplitBySize(input []byte, maxBytes int64) ([]SplitPart, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitBySize", AttrInputBytes.Int(len(input)))
+	parts, err := s.splitBySize(ctx, input, maxBytes)
+	endSpan(span, err, attribute.Int("pdf.part_count", len(parts)))
+	return parts, err
+}
+
+// splitBySize finds the longest run of pages from each starting page that
+// fits in maxBytes. Shared resources such as fonts make a part's size hard
+// to predict from its pages, so candidates are measured by extracting them,
+// doubling the run and then bisecting to keep the number of extractions
+// logarithmic.
+func (s *splitService) splitBySize(ctx context.Context, input []byte, maxBytes int64) ([]SplitPart, error) {
+	s.log.Info("SplitService.SplitBySize called", logger.Int("maxBytes", int(maxBytes)))
+
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("maximum part size must be positive, got %d", maxBytes)
+	}
+
+	in, err := s.openSplitInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.close()
+
+	fits := func(first, last int) ([]byte, bool, error) {
+		data, err := in.extract(ctx, pageSpan{first: first, last: last})
+		return data, err == nil && int64(len(data)) <= maxBytes, err
+	}
+
+	var parts []SplitPart
+	for first := 1; first <= in.pageCount; {
+		data, ok, err := fits(first, first)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("page %d is %d bytes: %w", first, len(data), ErrPageTooLarge)
+		}
+
+		// lo always fits; hi, once set, is the first end known not to.
+		lo, hi := first, 0
+		for step := 1; hi == 0 && lo < in.pageCount; step *= 2 {
+			end := min(lo+step, in.pageCount)
+			d, ok, err := fits(first, end)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				lo, data = end, d
+			} else {
+				hi = end
+			}
+		}
+		for hi > lo+1 {
+			mid := (lo + hi) / 2
+			d, ok, err := fits(first, mid)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				lo, data = mid, d
+			} else {
+				hi = mid
+			}
+		}
+
+		span := pageSpan{first: first, last: lo}
+		parts = append(parts, SplitPart{Name: fmt.Sprintf("part_%d.pdf", len(parts)+1), PageRange: span.String(), Data: data})
+		first = lo + 1
+	}
+	return parts, nil
+}
+
+func (s *splitService) SplitBySeparator(input []byte, opts *SeparatorOptions) ([]SplitPart, error) {
+	ctx, span := startSpan(context.Background(), "SplitService.SplitBySeparator", AttrInputBytes.Int(len(input)))
+	parts, err := s.splitBySeparator(ctx, input, opts)
+	endSpan(span, err, attribute.Int("pdf.part_count", len(parts)))
+	return parts, err
+}
+
+func (s *splitService) splitBySeparator(ctx context.Context, input []byte, opts *SeparatorOptions) ([]SplitPart, error) {
+	s.log.Info("SplitService.SplitBySeparator called")
+
+	if opts == nil || (!opts.Blank && !opts.Barcode) {
+		return nil, fmt.Errorf("no separator detection selected")
+	}
+
+	in, err := s.openSplitInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.close()
+
+	separators := make([]bool, in.pageCount+1)
+	if opts.Blank {
+		blank, err := blankPages(ctx, in.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range blank {
+			separators[p] = true
+		}
+	}
+	if opts.Barcode {
+		pages, err := s.barcodePages(ctx, in, opts.BarcodeValue)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pages {
+			separators[p] = true
+		}
+	}
+
+	var spans []pageSpan
+	add := func(first, last int) {
+		if first <= last {
+			spans = append(spans, pageSpan{name: fmt.Sprintf("part_%d.pdf", len(spans)+1), first: first, last: last})
+		}
+	}
+	first := 1
+	for p := 1; p <= in.pageCount; p++ {
+		if !separators[p] {
+			continue
+		}
+		add(first, p-1)
+		first = p + 1
+		if opts.KeepSeparators {
+			first = p
+		}
+	}
+	add(first, in.pageCount)
+
+	if len(spans) == 0 {
+		return nil, fmt.Errorf("document contains only separator pages")
+	}
+	return in.parts(ctx, spans)
+}
+
+// blankPages reports pages whose content streams paint nothing visible.
+func blankPages(ctx context.Context, path string) ([]int, error) {
+	pdfCtx, err := readContextFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blank []int
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		marks, err := pageMarks(pdfCtx, p)
+		if err != nil {
+			return nil, err
+		}
+		if marks.empty() {
+			blank = append(blank, p)
+		}
+	}
+	return blank, nil
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// barcodePages renders every page and returns those on which zbarimg finds
+// a barcode, optionally only one with the given value.
+func (s *splitService) barcodePages(ctx context.Context, in *splitInput, value string) ([]int, error) {
+	if _, err := exec.LookPath("zbarimg"); err != nil {
+		return nil, fmt.Errorf("barcode separators need zbarimg: %w", err)
+	}
+	if !s.renderer.Available() {
+		return nil, fmt.Errorf("barcode separators need page renderer %q", s.renderer.Name())
+	}
+
+	renderDir := filepath.Join(in.dir, "render")
+	if err := os.MkdirAll(renderDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var pages []int
+	for page := 1; page <= in.pageCount; page++ {
+		data, err := s.renderer.RenderPage(ctx, in.path, page, 150, "png", true)
+		if err != nil {
+			return nil, err
+		}
+		img := filepath.Join(renderDir, fmt.Sprintf("page-%d.png", page))
+		if err := writeFile(ctx, img, data); err != nil {
+			return nil, err
+		}
+		output, err := runCommand(ctx, "zbarimg", []string{"--quiet", "--raw", img}, AttrPage.Int(page))
+		os.Remove(img)
+		if err != nil {
+			// zbarimg exits with status 4 when it finds nothing.
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == 4 {
+				continue
+			}
+			return nil, fmt.Errorf("zbarimg failed on page %d: %v, output: %s", page, err, string(output))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if value == "" || strings.TrimSpace(line) == value {
+				pages = append(pages, page)
+				break
+			}
+		}
+	}
+	return pages, nil
+}
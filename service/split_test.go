@@ -0,0 +1,191 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// textPDF builds one page per entry. Empty entries give blank pages and
+// entries starting with "#" also get a top-level bookmark.
+func textPDF(t *testing.T, pages ...string) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	for _, text := range pages {
+		pdf.AddPage()
+		if text == "" {
+			continue
+		}
+		if text[0] == '#' {
+			text = text[1:]
+			pdf.Bookmark(text, 0, 0)
+		}
+		pdf.Text(20, 20, text)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func partSummary(parts []service.SplitPart) (names, ranges []string) {
+	for _, p := range parts {
+		names = append(names, p.Name)
+		ranges = append(ranges, p.PageRange)
+	}
+	return names, ranges
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSplitEvery(t *testing.T) {
+	split := service.NewSplitService(getTestLogger())
+
+	parts, err := split.SplitEvery(textPDF(t, "a", "b", "c", "d", "e"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ranges := partSummary(parts); !equalStrings(ranges, []string{"1-2", "3-4", "5"}) {
+		t.Errorf("ranges = %v", ranges)
+	}
+	for _, p := range parts {
+		if len(p.Data) == 0 {
+			t.Errorf("%s is empty", p.Name)
+		}
+	}
+
+	if _, err := split.SplitEvery(textPDF(t, "a"), 0); err == nil {
+		t.Error("expected error for zero pages per part")
+	}
+}
+
+func TestSplitByBookmarks(t *testing.T) {
+	split := service.NewSplitService(getTestLogger())
+
+	parts, err := split.SplitByBookmarks(textPDF(t, "cover", "#Intro", "more", "#Results", "#Results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, ranges := partSummary(parts)
+	if !equalStrings(names, []string{"front_matter.pdf", "Intro.pdf", "Results.pdf", "Results_2.pdf"}) {
+		t.Errorf("names = %v", names)
+	}
+	if !equalStrings(ranges, []string{"1", "2-3", "4", "5"}) {
+		t.Errorf("ranges = %v", ranges)
+	}
+
+	if _, err := split.SplitByBookmarks(textPDF(t, "plain")); err == nil {
+		t.Error("expected error for a document without bookmarks")
+	}
+}
+
+func TestSplitBySeparatorBlank(t *testing.T) {
+	split := service.NewSplitService(getTestLogger())
+	input := textPDF(t, "a1", "a2", "", "b1", "", "", "c1")
+
+	parts, err := split.SplitBySeparator(input, &service.SeparatorOptions{Blank: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ranges := partSummary(parts); !equalStrings(ranges, []string{"1-2", "4", "7"}) {
+		t.Errorf("ranges = %v", ranges)
+	}
+
+	parts, err = split.SplitBySeparator(input, &service.SeparatorOptions{Blank: true, KeepSeparators: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ranges := partSummary(parts); !equalStrings(ranges, []string{"1-2", "3-4", "5", "6-7"}) {
+		t.Errorf("ranges with separators kept = %v", ranges)
+	}
+
+	if _, err := split.SplitBySeparator(input, &service.SeparatorOptions{}); err == nil {
+		t.Error("expected error when no separator detection is selected")
+	}
+}
+
+func TestSplitBySize(t *testing.T) {
+	split := service.NewSplitService(getTestLogger())
+	input := textPDF(t, "a", "b", "c", "d", "e", "f", "g", "h")
+
+	single, err := split.SplitEvery(input, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := split.SplitEvery(input, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := int64(len(pair[0].Data))
+
+	parts, err := split.SplitBySize(input, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parts {
+		if int64(len(p.Data)) > limit {
+			t.Errorf("%s is %d bytes, over the %d limit", p.Name, len(p.Data), limit)
+		}
+	}
+	if len(parts) < 4 {
+		t.Errorf("got %d parts, want at least 4 for pairs of pages", len(parts))
+	}
+
+	if _, err := split.SplitBySize(input, int64(len(single[0].Data))-1); !errors.Is(err, service.ErrPageTooLarge) {
+		t.Errorf("err = %v, want ErrPageTooLarge", err)
+	}
+}
+
+func TestSplitParts(t *testing.T) {
+	split := service.NewSplitService(getTestLogger())
+
+	parts, err := split.SplitParts(textPDF(t, "a", "b", "c"), "1-2, 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, ranges := partSummary(parts)
+	if !equalStrings(names, []string{"part_1.pdf", "part_2.pdf"}) || !equalStrings(ranges, []string{"1-2", "3"}) {
+		t.Errorf("names = %v, ranges = %v", names, ranges)
+	}
+}
+
+func TestSplitStepModes(t *testing.T) {
+	pdfService := service.NewWithGotenberg("http://localhost:3000")
+
+	def, err := service.ParsePipelineJSON([]byte(`{"steps": [{"type": "split", "params": {"every": 2}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := service.NewPipelineFromDefinition(pdfService, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Run(context.Background(), service.Document{Name: "scan.pdf", Data: textPDF(t, "a", "b", "c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 2 || result.Documents[0].Name != "scan-part_1.pdf" {
+		t.Errorf("documents = %d, first = %q", len(result.Documents), result.Documents[0].Name)
+	}
+
+	if err := (&service.SplitStep{Every: 2, Bookmarks: true}).Validate(); err == nil {
+		t.Error("expected error when two split modes are set")
+	}
+}
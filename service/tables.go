@@ -0,0 +1,864 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// TableMethod is how tables are found on a page.
+type TableMethod string
+
+const (
+	// TableAuto finds tables from ruling lines where a page has them and
+	// from text alignment in the rest of the page. It is the default.
+	TableAuto TableMethod = "auto"
+	// TableLattice finds tables from the lines drawn around and between
+	// their cells.
+	TableLattice TableMethod = "lattice"
+	// TableStream finds tables from text laid out in aligned columns, for
+	// tables without lines and for scanned pages.
+	TableStream TableMethod = "stream"
+)
+
+// Defaults for the smallest table reported.
+const (
+	DefaultTableMinRows    = 2
+	DefaultTableMinColumns = 2
+)
+
+// Tolerances, in points, used when matching table geometry.
+const (
+	// rulingSnap is how far apart rulings may be and still be treated
+	// as the same line, or as touching.
+	rulingSnap = 3
+	// columnGap is the gap between words, in multiples of their font
+	// size, that separates columns in stream tables.
+	columnGap = 1.0
+	// rowGap is the gap between lines, in multiples of their font size,
+	// that ends a stream table.
+	rowGap = 1.5
+)
+
+// TableOptions controls ExtractTables. Text is read as by
+// ExtractTextWithOptions: pages without meaningful text are recognised
+// with OCR and their tables found from the word boxes.
+type TableOptions struct {
+	TextExtractionOptions
+	// Method chooses how tables are found. Empty uses TableAuto.
+	Method TableMethod `json:"method,omitempty"`
+	// MinRows and MinColumns are the smallest table reported. Zero uses
+	// DefaultTableMinRows and DefaultTableMinColumns.
+	MinRows    int `json:"min_rows,omitempty"`
+	MinColumns int `json:"min_columns,omitempty"`
+}
+
+func (o *TableOptions) withDefaults() (TableOptions, error) {
+	opts := TableOptions{}
+	if o != nil {
+		opts = *o
+	}
+	text, err := opts.TextExtractionOptions.withDefaults()
+	if err != nil {
+		return opts, err
+	}
+	opts.TextExtractionOptions = text
+	switch opts.Method {
+	case "":
+		opts.Method = TableAuto
+	case TableAuto, TableLattice, TableStream:
+	default:
+		return opts, fmt.Errorf("unsupported table method %q", opts.Method)
+	}
+	if opts.MinRows == 0 {
+		opts.MinRows = DefaultTableMinRows
+	}
+	if opts.MinColumns == 0 {
+		opts.MinColumns = DefaultTableMinColumns
+	}
+	if opts.MinRows < 1 || opts.MinColumns < 1 {
+		return opts, fmt.Errorf("min rows and columns must be positive, got %d and %d", opts.MinRows, opts.MinColumns)
+	}
+	return opts, nil
+}
+
+// TableCell is one cell of a table. Row and Column index its top left
+// position in the table's grid from 0, and RowSpan and ColSpan count the
+// grid positions it covers. Coordinates are in points from the top left
+// corner of the page as displayed, as for zones.
+type TableCell struct {
+	Row     int     `json:"row"`
+	Column  int     `json:"column"`
+	RowSpan int     `json:"row_span"`
+	ColSpan int     `json:"col_span"`
+	Text    string  `json:"text"`
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	Width   float64 `json:"width"`
+	Height  float64 `json:"height"`
+}
+
+// Table is a table found on a page. Its cells cover the grid: every
+// position belongs to exactly one cell.
+type Table struct {
+	Page int `json:"page"`
+	// Method is TableLattice or TableStream, whichever found the table.
+	Method TableMethod `json:"method"`
+	// Source is TextMethodPDF or TextMethodOCR.
+	Source  TextMethod  `json:"source"`
+	Rows    int         `json:"rows"`
+	Columns int         `json:"columns"`
+	X       float64     `json:"x"`
+	Y       float64     `json:"y"`
+	Width   float64     `json:"width"`
+	Height  float64     `json:"height"`
+	Cells   []TableCell `json:"cells"`
+}
+
+// Grid returns the text of the table row by row. A spanning cell's text
+// is at its top left position; the other positions it covers are empty.
+func (t *Table) Grid() [][]string {
+	grid := make([][]string, t.Rows)
+	for i := range grid {
+		grid[i] = make([]string, t.Columns)
+	}
+	for _, c := range t.Cells {
+		if c.Row < t.Rows && c.Column < t.Columns {
+			grid[c.Row][c.Column] = c.Text
+		}
+	}
+	return grid
+}
+
+// CSV writes the table's grid as CSV.
+func (t *Table) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(t.Grid()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TableExtraction is the result of ExtractTables.
+type TableExtraction struct {
+	Tables []Table `json:"tables"`
+}
+
+// JSON writes the tables, with their cells and positions, as indented
+// JSON.
+func (e *TableExtraction) JSON() ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+func (s *textService) ExtractTables(ctx context.Context, input []byte, opts *TableOptions) (*TableExtraction, error) {
+	ctx, span := startSpan(ctx, "TextService.ExtractTables", AttrInputBytes.Int(len(input)))
+	result, err := s.extractTables(ctx, input, opts)
+	if result != nil {
+		span.SetAttributes(attribute.Int("tables.count", len(result.Tables)))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s *textService) extractTables(ctx context.Context, input []byte, opts *TableOptions) (*TableExtraction, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("TextService.ExtractTables called", logger.String("method", string(o.Method)), logger.String("pages", o.Pages))
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, o.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TableExtraction{}
+	fonts := map[int]*pdfFont{}
+	rulings := map[int][]tableRule{}
+	var needOCR []string
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		runs, rules, _, err := pageLayout(pdfCtx, p, fonts)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		_, _, inh, err := pdfCtx.PageDict(p, false)
+		if err != nil {
+			return nil, err
+		}
+		display, _, height := displayMatrix(visibleBox(inh), normalizedRotation(inh.Rotate))
+		rulings[p] = pageRules(rules, display, height)
+		words := layoutWords(runs, display, height)
+
+		texts := make([]string, len(words))
+		for i, w := range words {
+			texts[i] = w.Text
+		}
+		switch {
+		case o.OCR == TextOCRNever || (o.OCR == TextOCRAuto && meaningfulText(strings.Join(texts, " "), o.MinChars)):
+			result.Tables = append(result.Tables, findTables(p, TextMethodPDF, words, rulings[p], &o)...)
+		default:
+			marks, err := pageMarks(pdfCtx, p)
+			if err != nil {
+				return nil, fmt.Errorf("page %d: %w", p, err)
+			}
+			if !marks.empty() {
+				needOCR = append(needOCR, strconv.Itoa(p))
+			}
+		}
+	}
+
+	if len(needOCR) > 0 {
+		ocrOpts := OCROptions{}
+		if o.OCROptions != nil {
+			ocrOpts = *o.OCROptions
+		}
+		ocrOpts.Pages = strings.Join(needOCR, ",")
+		recognised, err := s.ocr.Recognize(ctx, input, &ocrOpts)
+		if err != nil {
+			return nil, fmt.Errorf("ocr fallback: %w", err)
+		}
+		for _, page := range recognised.Pages {
+			result.Tables = append(result.Tables, findTables(page.Page, TextMethodOCR, ocrWords(page), rulings[page.Page], &o)...)
+		}
+		sort.SliceStable(result.Tables, func(i, j int) bool { return result.Tables[i].Page < result.Tables[j].Page })
+	}
+
+	s.log.Info("Tables extracted", logger.Int("tables", len(result.Tables)), logger.Int("ocrPages", len(needOCR)))
+	return result, nil
+}
+
+// tableWord is a word in page space: points from the top left corner of
+// the page as displayed.
+type tableWord struct {
+	Text           string
+	X0, Y0, X1, Y1 float64
+	// Size is the font size, or the word's height for OCR words.
+	Size float64
+}
+
+// tableRule is a ruling in page space. Horizontal rules have Y0 == Y1
+// and vertical ones X0 == X1; both run from the lower to the higher
+// coordinate.
+type tableRule struct {
+	X0, Y0, X1, Y1 float64
+}
+
+func (r tableRule) horizontal() bool { return r.Y0 == r.Y1 }
+
+// layoutWords splits the text runs of a page into words in page space.
+// Glyphs are sorted into rows first, so words drawn a glyph at a time or
+// out of order are still put together.
+func layoutWords(runs []textRun, display matrix, height float64) []tableWord {
+	var glyphs []tableWord
+	for _, r := range runs {
+		for _, c := range r.Chars {
+			x0, y0 := display.apply(c.X, c.Y-r.Size*0.2)
+			x1, y1 := display.apply(c.X+c.Width, c.Y+r.Size*0.8)
+			glyphs = append(glyphs, tableWord{
+				Text: c.Text,
+				X0:   math.Min(x0, x1), Y0: height - math.Max(y0, y1),
+				X1: math.Max(x0, x1), Y1: height - math.Min(y0, y1),
+				Size: r.Size,
+			})
+		}
+	}
+
+	var words []tableWord
+	for _, row := range textRows(glyphs) {
+		start := len(words)
+		for _, g := range row {
+			if strings.TrimSpace(g.Text) == "" {
+				start = len(words)
+				continue
+			}
+			if n := len(words); n > start && g.X0-words[n-1].X1 <= g.Size*0.2 {
+				w := &words[n-1]
+				w.Text += g.Text
+				w.X1 = math.Max(w.X1, g.X1)
+				w.Y0, w.Y1 = math.Min(w.Y0, g.Y0), math.Max(w.Y1, g.Y1)
+				continue
+			}
+			words = append(words, g)
+		}
+	}
+	return words
+}
+
+// ocrWords converts the words of a recognised page to page space.
+func ocrWords(page OCRPage) []tableWord {
+	scale := 72.0 / 300 // the OCR default
+	if page.DPI > 0 {
+		scale = 72 / float64(page.DPI)
+	}
+	var words []tableWord
+	for _, l := range page.Lines {
+		for _, w := range l.Words {
+			if strings.TrimSpace(w.Text) == "" {
+				continue
+			}
+			words = append(words, tableWord{
+				Text: w.Text,
+				X0:   float64(w.BBox[0]) * scale, Y0: float64(w.BBox[1]) * scale,
+				X1: float64(w.BBox[2]) * scale, Y1: float64(w.BBox[3]) * scale,
+				Size: float64(w.BBox[3]-w.BBox[1]) * scale,
+			})
+		}
+	}
+	return words
+}
+
+// pageRules converts rulings to page space and joins pieces of the same
+// line, which many generators draw one cell at a time.
+func pageRules(rulings []ruling, display matrix, height float64) []tableRule {
+	var horizontal, vertical []tableRule
+	for _, r := range rulings {
+		x0, y0 := display.apply(r.X0, r.Y0)
+		x1, y1 := display.apply(r.X1, r.Y1)
+		y0, y1 = height-y0, height-y1
+		switch {
+		case math.Abs(y1-y0) < 1 && math.Abs(x1-x0) >= 1:
+			y := (y0 + y1) / 2
+			horizontal = append(horizontal, tableRule{X0: math.Min(x0, x1), Y0: y, X1: math.Max(x0, x1), Y1: y})
+		case math.Abs(x1-x0) < 1 && math.Abs(y1-y0) >= 1:
+			x := (x0 + x1) / 2
+			vertical = append(vertical, tableRule{X0: x, Y0: math.Min(y0, y1), X1: x, Y1: math.Max(y0, y1)})
+		}
+	}
+	return append(joinRules(horizontal, true), joinRules(vertical, false)...)
+}
+
+// joinRules merges rules that lie on the same line and touch or overlap.
+func joinRules(rules []tableRule, horizontal bool) []tableRule {
+	// pos is where a rule lies across its direction; lo and hi are its ends.
+	pos := func(r tableRule) float64 {
+		if horizontal {
+			return r.Y0
+		}
+		return r.X0
+	}
+	ends := func(r *tableRule) (*float64, *float64) {
+		if horizontal {
+			return &r.X0, &r.X1
+		}
+		return &r.Y0, &r.Y1
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if pi, pj := pos(rules[i]), pos(rules[j]); math.Abs(pi-pj) > rulingSnap/2 {
+			return pi < pj
+		}
+		li, _ := ends(&rules[i])
+		lj, _ := ends(&rules[j])
+		return *li < *lj
+	})
+
+	var joined []tableRule
+	for _, r := range rules {
+		if n := len(joined); n > 0 && math.Abs(pos(joined[n-1])-pos(r)) <= rulingSnap/2 {
+			_, hi := ends(&joined[n-1])
+			lo, rhi := ends(&r)
+			if *lo <= *hi+rulingSnap {
+				*hi = math.Max(*hi, *rhi)
+				continue
+			}
+		}
+		joined = append(joined, r)
+	}
+	return joined
+}
+
+// textRows groups words into rows of words that overlap vertically, top
+// to bottom, each sorted left to right.
+func textRows(words []tableWord) [][]tableWord {
+	sorted := slices.Clone(words)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Y0+sorted[i].Y1 < sorted[j].Y0+sorted[j].Y1 })
+
+	var rows [][]tableWord
+	var top, bottom float64
+	for _, w := range sorted {
+		if n := len(rows); n > 0 {
+			overlap := math.Min(bottom, w.Y1) - math.Max(top, w.Y0)
+			if overlap >= 0.5*math.Min(bottom-top, w.Y1-w.Y0) {
+				rows[n-1] = append(rows[n-1], w)
+				top, bottom = math.Min(top, w.Y0), math.Max(bottom, w.Y1)
+				continue
+			}
+		}
+		rows = append(rows, []tableWord{w})
+		top, bottom = w.Y0, w.Y1
+	}
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool { return row[i].X0 < row[j].X0 })
+	}
+	return rows
+}
+
+// wordsText joins words into lines of text.
+func wordsText(words []tableWord) string {
+	var lines []string
+	for _, row := range textRows(words) {
+		texts := make([]string, len(row))
+		for i, w := range row {
+			texts[i] = w.Text
+		}
+		lines = append(lines, strings.Join(texts, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// findTables finds the tables of one page. Lattice tables claim the words
+// inside them; with TableAuto the remaining words are searched for
+// stream tables.
+func findTables(page int, source TextMethod, words []tableWord, rules []tableRule, opts *TableOptions) []Table {
+	var tables []Table
+	if opts.Method != TableStream {
+		tables, words = latticeTables(words, rules)
+	}
+	if opts.Method != TableLattice {
+		tables = append(tables, streamTables(words)...)
+	}
+
+	var found []Table
+	for _, t := range tables {
+		if t.Rows < opts.MinRows || t.Columns < opts.MinColumns {
+			continue
+		}
+		t.Page, t.Source = page, source
+		found = append(found, t)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Y < found[j].Y })
+	return found
+}
+
+// latticeTables builds a table from each group of crossing rulings with
+// at least two lines each way. Column and row boundaries are where the
+// rulings lie; a boundary missing between two positions merges them into
+// one spanning cell. It returns the tables and the words outside them.
+func latticeTables(words []tableWord, rules []tableRule) ([]Table, []tableWord) {
+	parent := make([]int, len(rules))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, h := range rules {
+		if !h.horizontal() {
+			continue
+		}
+		for j, v := range rules {
+			if v.horizontal() {
+				continue
+			}
+			if v.X0 >= h.X0-rulingSnap && v.X0 <= h.X1+rulingSnap && h.Y0 >= v.Y0-rulingSnap && h.Y0 <= v.Y1+rulingSnap {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+	groups := map[int][]tableRule{}
+	var roots []int
+	for i, r := range rules {
+		root := find(i)
+		if groups[root] == nil {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], r)
+	}
+
+	used := make([]bool, len(words))
+	var tables []Table
+	for _, root := range roots {
+		var xs, ys []float64
+		for _, r := range groups[root] {
+			if r.horizontal() {
+				ys = append(ys, r.Y0)
+			} else {
+				xs = append(xs, r.X0)
+			}
+		}
+		xs, ys = snapValues(xs), snapValues(ys)
+		if len(xs) < 2 || len(ys) < 2 {
+			continue
+		}
+		table := latticeTable(xs, ys, groups[root])
+		for i := range table.Cells {
+			c := &table.Cells[i]
+			var inside []tableWord
+			for j, w := range words {
+				cx, cy := (w.X0+w.X1)/2, (w.Y0+w.Y1)/2
+				if !used[j] && cx >= c.X && cx <= c.X+c.Width && cy >= c.Y && cy <= c.Y+c.Height {
+					inside = append(inside, w)
+					used[j] = true
+				}
+			}
+			c.Text = wordsText(inside)
+		}
+		tables = append(tables, table)
+	}
+
+	var rest []tableWord
+	for i, w := range words {
+		if !used[i] {
+			rest = append(rest, w)
+		}
+	}
+	return tables, rest
+}
+
+// latticeTable lays out the cells of a grid with the given boundaries.
+func latticeTable(xs, ys []float64, rules []tableRule) Table {
+	// ruled reports whether a rule runs along the boundary at pos through
+	// the point at, in the given direction.
+	ruled := func(horizontal bool, pos, at float64) bool {
+		for _, r := range rules {
+			switch {
+			case horizontal && r.horizontal() && math.Abs(r.Y0-pos) <= rulingSnap && at >= r.X0-rulingSnap && at <= r.X1+rulingSnap:
+				return true
+			case !horizontal && !r.horizontal() && math.Abs(r.X0-pos) <= rulingSnap && at >= r.Y0-rulingSnap && at <= r.Y1+rulingSnap:
+				return true
+			}
+		}
+		return false
+	}
+
+	rows, cols := len(ys)-1, len(xs)-1
+	table := Table{Method: TableLattice, Rows: rows, Columns: cols, X: xs[0], Y: ys[0], Width: xs[cols] - xs[0], Height: ys[rows] - ys[0]}
+	covered := make([][]bool, rows)
+	for r := range covered {
+		covered[r] = make([]bool, cols)
+	}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if covered[r][c] {
+				continue
+			}
+			colSpan := 1
+			for c+colSpan < cols && !covered[r][c+colSpan] && !ruled(false, xs[c+colSpan], (ys[r]+ys[r+1])/2) {
+				colSpan++
+			}
+			rowSpan := 1
+		rowSpans:
+			for r+rowSpan < rows {
+				for k := c; k < c+colSpan; k++ {
+					if covered[r+rowSpan][k] || ruled(true, ys[r+rowSpan], (xs[k]+xs[k+1])/2) {
+						break rowSpans
+					}
+				}
+				rowSpan++
+			}
+			for i := r; i < r+rowSpan; i++ {
+				for k := c; k < c+colSpan; k++ {
+					covered[i][k] = true
+				}
+			}
+			table.Cells = append(table.Cells, TableCell{
+				Row: r, Column: c, RowSpan: rowSpan, ColSpan: colSpan,
+				X: xs[c], Y: ys[r], Width: xs[c+colSpan] - xs[c], Height: ys[r+rowSpan] - ys[r],
+			})
+		}
+	}
+	return table
+}
+
+// snapValues sorts values and replaces each cluster of values within
+// rulingSnap of each other by their mean.
+func snapValues(values []float64) []float64 {
+	sort.Float64s(values)
+	var out []float64
+	var sum float64
+	var n int
+	for i, v := range values {
+		if i > 0 && v-values[i-1] > rulingSnap {
+			out = append(out, sum/float64(n))
+			sum, n = 0, 0
+		}
+		sum += v
+		n++
+	}
+	if n > 0 {
+		out = append(out, sum/float64(n))
+	}
+	return out
+}
+
+// tableSegment is a run of words in one row with no column gap in it.
+type tableSegment struct {
+	words  []tableWord
+	x0, x1 float64
+}
+
+// streamTables finds tables in text laid out in columns: runs of
+// consecutive, closely spaced rows that each split into two or more
+// segments at wide gaps. Columns are taken from the rows with the most
+// segments; a segment reaching across a column boundary spans both
+// columns.
+func streamTables(words []tableWord) []Table {
+	type streamRow struct {
+		segments []tableSegment
+		y0, y1   float64
+		size     float64
+	}
+	var rows []streamRow
+	for _, words := range textRows(words) {
+		row := streamRow{y0: math.Inf(1), y1: math.Inf(-1)}
+		for _, w := range words {
+			row.y0, row.y1 = math.Min(row.y0, w.Y0), math.Max(row.y1, w.Y1)
+			row.size = math.Max(row.size, w.Size)
+			if n := len(row.segments); n > 0 && w.X0-row.segments[n-1].x1 <= w.Size*columnGap {
+				seg := &row.segments[n-1]
+				seg.words = append(seg.words, w)
+				seg.x1 = math.Max(seg.x1, w.X1)
+				continue
+			}
+			row.segments = append(row.segments, tableSegment{words: []tableWord{w}, x0: w.X0, x1: w.X1})
+		}
+		rows = append(rows, row)
+	}
+
+	var tables []Table
+	for start := 0; start < len(rows); {
+		if len(rows[start].segments) < 2 {
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(rows) && len(rows[end].segments) >= 2 && rows[end].y0-rows[end-1].y1 <= rowGap*rows[end-1].size {
+			end++
+		}
+		region := rows[start:end]
+		start = end
+
+		// Columns are the overlapping segments of the fullest rows.
+		most := 0
+		for _, row := range region {
+			most = max(most, len(row.segments))
+		}
+		var spans [][2]float64
+		for _, row := range region {
+			if len(row.segments) == most {
+				for _, seg := range row.segments {
+					spans = append(spans, [2]float64{seg.x0, seg.x1})
+				}
+			}
+		}
+		sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+		var columns [][2]float64
+		for _, s := range spans {
+			if n := len(columns); n > 0 && s[0] <= columns[n-1][1] {
+				columns[n-1][1] = math.Max(columns[n-1][1], s[1])
+				continue
+			}
+			columns = append(columns, s)
+		}
+		if len(columns) < 2 {
+			continue
+		}
+
+		x0, x1 := math.Inf(1), math.Inf(-1)
+		for _, row := range region {
+			x0 = math.Min(x0, row.segments[0].x0)
+			x1 = math.Max(x1, row.segments[len(row.segments)-1].x1)
+		}
+		bounds := []float64{x0}
+		for i := 1; i < len(columns); i++ {
+			bounds = append(bounds, (columns[i-1][1]+columns[i][0])/2)
+		}
+		bounds = append(bounds, x1)
+		column := func(x float64) int {
+			return max(0, sort.SearchFloat64s(bounds[1:len(bounds)-1], x))
+		}
+
+		table := Table{Method: TableStream, Rows: len(region), Columns: len(columns), X: x0, Y: region[0].y0, Width: x1 - x0, Height: region[len(region)-1].y1 - region[0].y0}
+		for r, row := range region {
+			cells := make([]TableCell, 0, len(columns))
+			var words [][]tableWord
+			for _, seg := range row.segments {
+				first, last := column(seg.x0), column(seg.x1)
+				if n := len(cells); n > 0 && first < cells[n-1].Column+cells[n-1].ColSpan {
+					c := &cells[n-1]
+					c.ColSpan = max(c.ColSpan, last-c.Column+1)
+					words[n-1] = append(words[n-1], seg.words...)
+					continue
+				}
+				for next := nextColumn(cells); next < first; next++ {
+					cells = append(cells, TableCell{Column: next, ColSpan: 1})
+					words = append(words, nil)
+				}
+				cells = append(cells, TableCell{Column: first, ColSpan: last - first + 1})
+				words = append(words, seg.words)
+			}
+			for next := nextColumn(cells); next < len(columns); next++ {
+				cells = append(cells, TableCell{Column: next, ColSpan: 1})
+				words = append(words, nil)
+			}
+			for i := range cells {
+				c := &cells[i]
+				c.Row, c.RowSpan, c.Text = r, 1, wordsText(words[i])
+				c.X, c.Width = bounds[c.Column], bounds[c.Column+c.ColSpan]-bounds[c.Column]
+				c.Y, c.Height = row.y0, row.y1-row.y0
+			}
+			table.Cells = append(table.Cells, cells...)
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// nextColumn is the first column after the cells of a row built so far.
+func nextColumn(cells []TableCell) int {
+	if n := len(cells); n > 0 {
+		return cells[n-1].Column + cells[n-1].ColSpan
+	}
+	return 0
+}
+
+// xlsxNumber matches cell text stored as a number in XLSX workbooks:
+// plain decimals short enough to keep every digit.
+var xlsxNumber = regexp.MustCompile(`^-?\d{1,15}(\.\d{1,15})?$`)
+
+// XLSX writes the tables as an Excel workbook with one sheet per table,
+// named after its page. Spanning cells are merged, and cells holding a
+// plain decimal number are stored as numbers.
+func (e *TableExtraction) XLSX() ([]byte, error) {
+	type sheet struct {
+		name string
+		xml  []byte
+	}
+	var sheets []sheet
+	perPage := map[int]int{}
+	for _, t := range e.Tables {
+		perPage[t.Page]++
+		sheets = append(sheets, sheet{name: fmt.Sprintf("Page %d Table %d", t.Page, perPage[t.Page]), xml: xlsxSheet(&t)})
+	}
+	if len(sheets) == 0 {
+		sheets = append(sheets, sheet{name: "Tables", xml: xlsxSheet(&Table{})})
+	}
+
+	var workbook, rels, types bytes.Buffer
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	types.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i, sh := range sheets {
+		n := i + 1
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlText(sh.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	types.WriteString(`</Types>`)
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"[Content_Types].xml", types.Bytes()},
+		{"_rels/.rels", []byte(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`)},
+		{"xl/workbook.xml", workbook.Bytes()},
+		{"xl/_rels/workbook.xml.rels", rels.Bytes()},
+	}
+	for i, sh := range sheets {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sh.xml})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xlsxSheet writes a table as a worksheet.
+func xlsxSheet(t *Table) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range t.Grid() {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, text := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			switch {
+			case text == "":
+			case xlsxNumber.MatchString(text):
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, text)
+			default:
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlText(text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+
+	var merges []string
+	for _, c := range t.Cells {
+		if c.RowSpan > 1 || c.ColSpan > 1 {
+			merges = append(merges, fmt.Sprintf(`<mergeCell ref="%s%d:%s%d"/>`,
+				xlsxColumn(c.Column), c.Row+1, xlsxColumn(c.Column+c.ColSpan-1), c.Row+c.RowSpan))
+		}
+	}
+	if len(merges) > 0 {
+		fmt.Fprintf(&b, `<mergeCells count="%d">%s</mergeCells>`, len(merges), strings.Join(merges, ""))
+	}
+	b.WriteString(`</worksheet>`)
+	return b.Bytes()
+}
+
+// xlsxColumn returns the letters of a 0-based column: A, B, ..., Z, AA.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,189 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// statementPDF returns a page with a ruled table, whose title spans all
+// columns and whose first date spans two rows, above a table laid out
+// with spaces only.
+func statementPDF(t *testing.T) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.AddPage()
+
+	cell := func(x, y, w, h float64, text string) {
+		pdf.SetXY(x, y)
+		pdf.CellFormat(w, h, text, "1", 0, "L", false, 0, "")
+	}
+	cell(50, 100, 300, 20, "Statement March")
+	cell(50, 120, 80, 20, "Date")
+	cell(130, 120, 140, 20, "Description")
+	cell(270, 120, 80, 20, "Amount")
+	cell(50, 140, 80, 40, "01.03.2026")
+	cell(130, 140, 140, 20, "Coffee")
+	cell(270, 140, 80, 20, "3.50")
+	cell(130, 160, 140, 20, "Lunch")
+	cell(270, 160, 80, 20, "12.00")
+
+	pdf.Text(50, 300, "Prices valid until further notice.")
+	for i, row := range [][]string{{"Item", "Qty", "Price"}, {"Tea", "2", "1.20"}, {"Green coffee", "1", "4.80"}} {
+		y := 330 + float64(i)*14
+		for j, x := range []float64{50, 200, 300} {
+			pdf.Text(x, y, row[j])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTextService_ExtractTables(t *testing.T) {
+	textService := service.NewTextService(getTestLogger())
+	result, err := textService.ExtractTables(t.Context(), statementPDF(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tables) != 2 {
+		t.Fatalf("found %d tables: %+v", len(result.Tables), result.Tables)
+	}
+
+	lattice := result.Tables[0]
+	if lattice.Method != service.TableLattice || lattice.Source != service.TextMethodPDF || lattice.Page != 1 {
+		t.Errorf("lattice table = %+v", lattice)
+	}
+	want := [][]string{
+		{"Statement March", "", ""},
+		{"Date", "Description", "Amount"},
+		{"01.03.2026", "Coffee", "3.50"},
+		{"", "Lunch", "12.00"},
+	}
+	if got := lattice.Grid(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lattice grid = %q", got)
+	}
+	spans := map[[2]int][2]int{}
+	for _, c := range lattice.Cells {
+		spans[[2]int{c.Row, c.Column}] = [2]int{c.RowSpan, c.ColSpan}
+	}
+	if spans[[2]int{0, 0}] != [2]int{1, 3} || spans[[2]int{2, 0}] != [2]int{2, 1} || len(lattice.Cells) != 9 {
+		t.Errorf("spans = %v", spans)
+	}
+	if lattice.X != 50 || lattice.Y != 100 || lattice.Width != 300 || lattice.Height != 80 {
+		t.Errorf("lattice bounds = %v %v %v %v", lattice.X, lattice.Y, lattice.Width, lattice.Height)
+	}
+
+	stream := result.Tables[1]
+	want = [][]string{{"Item", "Qty", "Price"}, {"Tea", "2", "1.20"}, {"Green coffee", "1", "4.80"}}
+	if got := stream.Grid(); stream.Method != service.TableStream || !reflect.DeepEqual(got, want) {
+		t.Errorf("stream table = %s %q", stream.Method, got)
+	}
+
+	data, err := stream.CSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, err := csv.NewReader(bytes.NewReader(data)).ReadAll(); err != nil || !reflect.DeepEqual(records, want) {
+		t.Errorf("csv = %q, %v", records, err)
+	}
+
+	lines, err := textService.ExtractTables(t.Context(), statementPDF(t), &service.TableOptions{Method: service.TableLattice})
+	if err != nil || len(lines.Tables) != 1 {
+		t.Errorf("lattice only: %d tables, %v", len(lines.Tables), err)
+	}
+	if _, err := textService.ExtractTables(t.Context(), statementPDF(t), &service.TableOptions{Method: "grid"}); err == nil {
+		t.Error("expected error for unknown method")
+	}
+}
+
+func TestTableExtraction_XLSX(t *testing.T) {
+	result, err := service.NewTextService(getTestLogger()).ExtractTables(t.Context(), statementPDF(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := result.XLSX()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("workbook lacks %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="Page 1 Table 2"`) {
+		t.Errorf("workbook = %s", files["xl/workbook.xml"])
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{`<mergeCell ref="A1:C1"/>`, `<mergeCell ref="A3:A4"/>`, `<c r="C3"><v>3.50</v></c>`, `<t xml:space="preserve">Lunch</t>`} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet lacks %s:\n%s", want, sheet)
+		}
+	}
+}
+
+// tableOCREngine recognises a two-column price list on every page.
+type tableOCREngine struct{}
+
+func (tableOCREngine) Name() string    { return "fake-table" }
+func (tableOCREngine) Available() bool { return true }
+
+func (tableOCREngine) Recognize(ctx context.Context, img []byte, opts *service.OCROptions) (*service.OCRPage, error) {
+	line := func(y int, left, right string) service.OCRLine {
+		return service.OCRLine{Block: 1, Paragraph: 1, BBox: [4]int{300, y, 1100, y + 50}, Words: []service.OCRWord{
+			{Text: left, BBox: [4]int{300, y, 500, y + 50}, Confidence: 90},
+			{Text: right, BBox: [4]int{900, y, 1100, y + 50}, Confidence: 90},
+		}}
+	}
+	return &service.OCRPage{Lines: []service.OCRLine{line(300, "Item", "Price"), line(380, "Tea", "1.20")}}, nil
+}
+
+func TestTextService_ExtractTablesOCR(t *testing.T) {
+	ocrService := fakeOCRService(tableOCREngine{})
+	textService := service.NewTextServiceWithOCR(getTestLogger(), ocrService)
+
+	result, err := textService.ExtractTables(t.Context(), mixedPDF(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tables) != 1 {
+		t.Fatalf("found %d tables: %+v", len(result.Tables), result.Tables)
+	}
+	table := result.Tables[0]
+	want := [][]string{{"Item", "Price"}, {"Tea", "1.20"}}
+	if got := table.Grid(); table.Page != 2 || table.Source != service.TextMethodOCR || !reflect.DeepEqual(got, want) {
+		t.Errorf("scanned table on page %d from %s = %q", table.Page, table.Source, got)
+	}
+	// Words are converted from pixels at 300 DPI to points.
+	if table.X != 72 || table.Y != 72 {
+		t.Errorf("table at %v,%v", table.X, table.Y)
+	}
+}
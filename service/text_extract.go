@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+// TextMethod records how a page's text was obtained.
+type TextMethod string
+
+const (
+	// TextMethodPDF is text read from the page's text layer.
+	TextMethodPDF TextMethod = "pdf"
+	// TextMethodOCR is text recognised from the rendered page.
+	TextMethodOCR TextMethod = "ocr"
+	// TextMethodNone marks a page left without text: it is blank, or it
+	// needed OCR and OCR was turned off.
+	TextMethodNone TextMethod = "none"
+)
+
+// TextOCRMode decides when ExtractTextWithOptions falls back to OCR.
+type TextOCRMode string
+
+const (
+	// TextOCRAuto runs OCR on pages whose text layer has no meaningful
+	// text but which are not blank.
+	TextOCRAuto TextOCRMode = "auto"
+	// TextOCRNever only reads text layers.
+	TextOCRNever TextOCRMode = "never"
+	// TextOCRAlways runs OCR on every non-blank page, ignoring text layers.
+	TextOCRAlways TextOCRMode = "always"
+)
+
+// DefaultMinTextChars is the fewest letters and digits a text layer must
+// yield for a page to count as having text.
+const DefaultMinTextChars = 3
+
+// TextExtractionOptions controls ExtractTextWithOptions.
+type TextExtractionOptions struct {
+	// Pages limits extraction to a page selection such as "1-5,8".
+	Pages string `json:"pages,omitempty"`
+	// OCR decides when to fall back to OCR. Empty uses TextOCRAuto.
+	OCR TextOCRMode `json:"ocr,omitempty"`
+	// MinChars is the fewest letters and digits a page's text layer must
+	// hold to be used. Zero uses DefaultMinTextChars.
+	MinChars int `json:"min_chars,omitempty"`
+	// OCROptions configures the fallback; its Pages is ignored.
+	OCROptions *OCROptions `json:"ocr_options,omitempty"`
+}
+
+func (o *TextExtractionOptions) withDefaults() (TextExtractionOptions, error) {
+	opts := TextExtractionOptions{}
+	if o != nil {
+		opts = *o
+	}
+	switch opts.OCR {
+	case "":
+		opts.OCR = TextOCRAuto
+	case TextOCRAuto, TextOCRNever, TextOCRAlways:
+	default:
+		return opts, fmt.Errorf("unsupported OCR mode %q", opts.OCR)
+	}
+	if opts.MinChars == 0 {
+		opts.MinChars = DefaultMinTextChars
+	}
+	if opts.MinChars < 0 {
+		return opts, fmt.Errorf("min chars must not be negative, got %d", opts.MinChars)
+	}
+	return opts, nil
+}
+
+// PageText is the text of one page and how it was obtained.
+type PageText struct {
+	Page   int        `json:"page"`
+	Text   string     `json:"text"`
+	Method TextMethod `json:"method"`
+	// Confidence is the mean OCR word confidence (0-100) for OCR pages.
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// TextExtraction is the result of ExtractTextWithOptions.
+type TextExtraction struct {
+	Pages []PageText `json:"pages"`
+}
+
+// Text returns the text of all pages, separated by blank lines.
+func (t *TextExtraction) Text() string {
+	texts := make([]string, len(t.Pages))
+	for i, p := range t.Pages {
+		texts[i] = p.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// OCRPages lists the pages whose text came from OCR.
+func (t *TextExtraction) OCRPages() []int {
+	var pages []int
+	for _, p := range t.Pages {
+		if p.Method == TextMethodOCR {
+			pages = append(pages, p.Page)
+		}
+	}
+	return pages
+}
+
+func (s *textService) ExtractTextWithOptions(ctx context.Context, input []byte, opts *TextExtractionOptions) (*TextExtraction, error) {
+	ctx, span := startSpan(ctx, "TextService.ExtractTextWithOptions", AttrInputBytes.Int(len(input)))
+	result, err := s.extractTextWithOptions(ctx, input, opts)
+	if result != nil {
+		span.SetAttributes(attribute.Int("text.ocr_pages", len(result.OCRPages())))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s *textService) extractTextWithOptions(ctx context.Context, input []byte, opts *TextExtractionOptions) (*TextExtraction, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("TextService.ExtractTextWithOptions called", logger.String("ocr", string(o.OCR)), logger.String("pages", o.Pages))
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectedPages(pdfCtx, o.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TextExtraction{}
+	fonts := map[int]*pdfFont{}
+	var needOCR []string
+	for p := 1; p <= pdfCtx.PageCount; p++ {
+		if !selected[p] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page := PageText{Page: p, Method: TextMethodNone}
+
+		lines, err := pageTextLines(pdfCtx, p, fonts)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", p, err)
+		}
+		texts := make([]string, len(lines))
+		for i, l := range lines {
+			texts[i] = l.Text
+		}
+		text := strings.Join(texts, "\n")
+
+		switch {
+		case o.OCR != TextOCRAlways && meaningfulText(text, o.MinChars):
+			page.Text, page.Method = text, TextMethodPDF
+		case o.OCR == TextOCRNever:
+			page.Text = text
+		default:
+			marks, err := pageMarks(pdfCtx, p)
+			if err != nil {
+				return nil, fmt.Errorf("page %d: %w", p, err)
+			}
+			if !marks.empty() {
+				needOCR = append(needOCR, strconv.Itoa(p))
+			}
+		}
+		result.Pages = append(result.Pages, page)
+	}
+
+	if len(needOCR) > 0 {
+		if err := s.ocrFallback(ctx, input, &o, needOCR, result); err != nil {
+			return nil, err
+		}
+	}
+
+	s.log.Info("Text extracted", logger.Int("pages", len(result.Pages)), logger.Int("ocrPages", len(needOCR)))
+	return result, nil
+}
+
+// ocrFallback recognises pages and stores their text in result.
+func (s *textService) ocrFallback(ctx context.Context, input []byte, opts *TextExtractionOptions, pages []string, result *TextExtraction) error {
+	ocrOpts := OCROptions{}
+	if opts.OCROptions != nil {
+		ocrOpts = *opts.OCROptions
+	}
+	ocrOpts.Pages = strings.Join(pages, ",")
+
+	recognised, err := s.ocr.Recognize(ctx, input, &ocrOpts)
+	if err != nil {
+		return fmt.Errorf("ocr fallback: %w", err)
+	}
+	byPage := make(map[int]OCRPage, len(recognised.Pages))
+	for _, p := range recognised.Pages {
+		byPage[p.Page] = p
+	}
+	for i := range result.Pages {
+		p := &result.Pages[i]
+		if ocrPage, ok := byPage[p.Page]; ok {
+			p.Text = strings.TrimSpace((&OCRResult{Pages: []OCRPage{ocrPage}}).Text())
+			p.Method = TextMethodOCR
+			p.Confidence = ocrPage.MeanConfidence
+		}
+	}
+	return nil
+}
+
+// meaningfulText reports whether text has at least minChars letters and
+// digits and little that is unreadable, such as the replacement and
+// private use characters left by fonts without a usable encoding.
+func meaningfulText(text string, minChars int) bool {
+	var alnum, junk int
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			alnum++
+		case r == unicode.ReplacementChar || unicode.Is(unicode.Co, r) || (unicode.IsControl(r) && !unicode.IsSpace(r)):
+			junk++
+		}
+	}
+	return alnum >= minChars && junk*10 <= alnum
+}
@@ -0,0 +1,98 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"slices"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// mixedPDF returns a document with a text page, a scanned (image-only)
+// page and a blank page.
+func mixedPDF(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	var scan bytes.Buffer
+	if err := png.Encode(&scan, img); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddPage()
+	pdf.Text(20, 20, "Born digital")
+	pdf.AddPage()
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("scan", opts, &scan)
+	pdf.ImageOptions("scan", 10, 10, 190, 270, false, opts, 0, "")
+	pdf.AddPage()
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTextService_ExtractTextWithOptions(t *testing.T) {
+	textService := service.NewTextService(getTestLogger())
+
+	result, err := textService.ExtractTextWithOptions(t.Context(), textPDF(t, "Hello world", "Second page"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 2 || result.Pages[0].Text != "Hello world" || result.Pages[1].Method != service.TextMethodPDF {
+		t.Errorf("pages = %+v", result.Pages)
+	}
+	if got := result.Text(); got != "Hello world\n\nSecond page" {
+		t.Errorf("text = %q", got)
+	}
+
+	// Without OCR the scanned page is reported rather than recognised.
+	result, err = textService.ExtractTextWithOptions(t.Context(), mixedPDF(t), &service.TextExtractionOptions{OCR: service.TextOCRNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var methods []service.TextMethod
+	for _, p := range result.Pages {
+		methods = append(methods, p.Method)
+	}
+	if want := []service.TextMethod{service.TextMethodPDF, service.TextMethodNone, service.TextMethodNone}; !slices.Equal(methods, want) {
+		t.Errorf("methods = %v, want %v", methods, want)
+	}
+
+	if _, err := textService.ExtractTextWithOptions(t.Context(), mixedPDF(t), &service.TextExtractionOptions{OCR: "sometimes"}); err == nil {
+		t.Error("expected error for unknown OCR mode")
+	}
+}
+
+func TestTextService_OCRFallback(t *testing.T) {
+	ocrService := fakeOCRService(fakeOCREngine("fake"))
+	textService := service.NewTextServiceWithOCR(getTestLogger(), ocrService)
+
+	result, err := textService.ExtractTextWithOptions(t.Context(), mixedPDF(t), &service.TextExtractionOptions{
+		OCROptions: &service.OCROptions{Format: "png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 3 {
+		t.Fatalf("pages = %+v", result.Pages)
+	}
+	if p := result.Pages[0]; p.Method != service.TextMethodPDF || p.Text != "Born digital" {
+		t.Errorf("page 1 = %+v", p)
+	}
+	if p := result.Pages[1]; p.Method != service.TextMethodOCR || p.Text != "Hello world" || p.Confidence != 68 {
+		t.Errorf("page 2 = %+v", p)
+	}
+	if p := result.Pages[2]; p.Method != service.TextMethodNone {
+		t.Errorf("blank page = %+v", p)
+	}
+	if got := result.OCRPages(); !slices.Equal(got, []int{2}) {
+		t.Errorf("OCR pages = %v", got)
+	}
+}
@@ -0,0 +1,1019 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// textRun is the text shown by one text operator, positioned in default
+// user space with the origin at the bottom left of the page.
+type textRun struct {
+	Text  string
+	X, Y  float64
+	Width float64
+	// Size is the font size after text and graphics scaling.
+	Size float64
+	Font string
+	// Chars are the run's glyphs with their origins and advances.
+	Chars []textChar
+}
+
+// textChar is one glyph of a text run.
+type textChar struct {
+	Text  string
+	X, Y  float64
+	Width float64
+}
+
+// textLine is a sequence of runs sharing a baseline.
+type textLine struct {
+	Page  int
+	Text  string
+	X, Y  float64
+	Width float64
+	Size  float64
+	Font  string
+}
+
+// ruling is a straight horizontal or vertical line drawn on a page, such
+// as a table border, in default user space.
+type ruling struct {
+	X0, Y0, X1, Y1 float64
+}
+
+// imageDraw is an image XObject drawn on a page, with the bounding box
+// of where it lands in default user space.
+type imageDraw struct {
+	Name   string
+	ObjNr  int
+	Stream *types.StreamDict
+	Box    [4]float64
+}
+
+// maxRulingWidth is the widest a filled rectangle may be, in points, to
+// count as a ruling rather than a shaded area.
+const maxRulingWidth = 3
+
+// maxFormDepth bounds how deeply nested form XObjects are followed.
+const maxFormDepth = 8
+
+// pageTextRuns returns the text runs of a page in content stream order,
+// including text inside form XObjects. Text in fonts without a usable
+// encoding, such as composite fonts lacking a ToUnicode map, is skipped.
+func pageTextRuns(pdfCtx *model.Context, page int, fonts map[int]*pdfFont) ([]textRun, error) {
+	x, err := extractPage(pdfCtx, page, fonts, false)
+	if err != nil {
+		return nil, err
+	}
+	return x.runs, nil
+}
+
+// pageLayout returns the text runs of a page like pageTextRuns, together
+// with its rulings and the images drawn on it.
+func pageLayout(pdfCtx *model.Context, page int, fonts map[int]*pdfFont) ([]textRun, []ruling, []imageDraw, error) {
+	x, err := extractPage(pdfCtx, page, fonts, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return x.runs, x.rulings, x.images, nil
+}
+
+func extractPage(pdfCtx *model.Context, page int, fonts map[int]*pdfFont, layout bool) (*textExtractor, error) {
+	d, _, inh, err := pdfCtx.PageDict(page, true)
+	if err != nil {
+		return nil, err
+	}
+	content, err := pdfCtx.PageContent(d, page)
+	if err != nil && !errors.Is(err, model.ErrNoContent) {
+		return nil, err
+	}
+
+	var resources types.Dict
+	if inh != nil {
+		resources = inh.Resources
+	}
+	x := &textExtractor{ctx: pdfCtx, fonts: fonts, layout: layout}
+	x.run(content, resources, identityMatrix, 0)
+	return x, nil
+}
+
+// pageTextLines groups the runs of a page into lines.
+func pageTextLines(pdfCtx *model.Context, page int, fonts map[int]*pdfFont) ([]textLine, error) {
+	runs, err := pageTextRuns(pdfCtx, page, fonts)
+	if err != nil {
+		return nil, err
+	}
+	return groupTextLines(page, runs), nil
+}
+
+// groupTextLines joins consecutive runs on the same baseline, inserting a
+// space where the gap between them is wider than a fraction of the font
+// size.
+func groupTextLines(page int, runs []textRun) []textLine {
+	var lines []textLine
+	for _, r := range runs {
+		if strings.TrimSpace(r.Text) == "" && len(lines) == 0 {
+			continue
+		}
+		if n := len(lines); n > 0 {
+			l := &lines[n-1]
+			size := math.Max(l.Size, r.Size)
+			end := l.X + l.Width
+			if math.Abs(r.Y-l.Y) <= size*0.3 && r.X >= end-size && r.X-end <= size*3 {
+				if r.X-end > size*0.15 && !strings.HasSuffix(l.Text, " ") && !strings.HasPrefix(r.Text, " ") {
+					l.Text += " "
+				}
+				l.Text += r.Text
+				l.Width = math.Max(end, r.X+r.Width) - l.X
+				if r.Size > l.Size && strings.TrimSpace(r.Text) != "" {
+					l.Size = r.Size
+					l.Font = r.Font
+				}
+				continue
+			}
+		}
+		if strings.TrimSpace(r.Text) == "" {
+			continue
+		}
+		lines = append(lines, textLine{Page: page, Text: r.Text, X: r.X, Y: r.Y, Width: r.Width, Size: r.Size, Font: r.Font})
+	}
+	for i := range lines {
+		lines[i].Text = strings.Join(strings.Fields(lines[i].Text), " ")
+	}
+	return lines
+}
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(tx, ty float64) matrix {
+	return matrix{1, 0, 0, 1, tx, ty}
+}
+
+// textState is the part of the graphics state that affects text, plus the
+// text and line matrices.
+type textState struct {
+	ctm       matrix
+	tm, tlm   matrix
+	font      *pdfFont
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64
+	leading   float64
+	rise      float64
+}
+
+type textExtractor struct {
+	ctx   *model.Context
+	fonts map[int]*pdfFont
+	runs  []textRun
+
+	// layout turns on collecting rulings, from the path being built, and
+	// image draws.
+	layout  bool
+	rulings []ruling
+	images  []imageDraw
+	path    []pathSegment
+	current [2]float64
+	start   [2]float64
+}
+
+// pathSegment is a straight piece of the current path, in default user
+// space. Rect marks the edges of a rectangle drawn with re.
+type pathSegment struct {
+	X0, Y0, X1, Y1 float64
+	Rect           bool
+}
+
+func (x *textExtractor) run(content []byte, resources types.Dict, ctm matrix, depth int) {
+	st := textState{ctm: ctm, tm: identityMatrix, tlm: identityMatrix, scale: 1}
+	var stack []textState
+
+	scanContent(content, func(op string, args []any) {
+		switch op {
+		case "q":
+			stack = append(stack, st)
+		case "Q":
+			if n := len(stack); n > 0 {
+				st = stack[n-1]
+				stack = stack[:n-1]
+			}
+		case "cm":
+			if m, ok := matrixOperand(args); ok {
+				st.ctm = m.mul(st.ctm)
+			}
+		case "BT":
+			st.tm, st.tlm = identityMatrix, identityMatrix
+		case "Tf":
+			if len(args) == 2 {
+				if name, ok := args[0].(pdfName); ok {
+					st.font = x.font(resources, string(name))
+				}
+				st.size = numberOperand(args, 1)
+			}
+		case "Tc":
+			st.charSpace = numberOperand(args, 0)
+		case "Tw":
+			st.wordSpace = numberOperand(args, 0)
+		case "Tz":
+			st.scale = numberOperand(args, 0) / 100
+		case "TL":
+			st.leading = numberOperand(args, 0)
+		case "Ts":
+			st.rise = numberOperand(args, 0)
+		case "Td":
+			st.moveLine(numberOperand(args, 0), numberOperand(args, 1))
+		case "TD":
+			st.leading = -numberOperand(args, 1)
+			st.moveLine(numberOperand(args, 0), numberOperand(args, 1))
+		case "Tm":
+			if m, ok := matrixOperand(args); ok {
+				st.tm, st.tlm = m, m
+			}
+		case "T*":
+			st.moveLine(0, -st.leading)
+		case "Tj":
+			if len(args) == 1 {
+				x.show(&st, []any{args[0]})
+			}
+		case "'":
+			st.moveLine(0, -st.leading)
+			if len(args) == 1 {
+				x.show(&st, []any{args[0]})
+			}
+		case "\"":
+			if len(args) == 3 {
+				st.wordSpace = numberOperand(args, 0)
+				st.charSpace = numberOperand(args, 1)
+				st.moveLine(0, -st.leading)
+				x.show(&st, []any{args[2]})
+			}
+		case "TJ":
+			if len(args) == 1 {
+				if arr, ok := args[0].([]any); ok {
+					x.show(&st, arr)
+				}
+			}
+		case "m", "l", "c", "v", "y", "h", "re":
+			if x.layout {
+				x.buildPath(op, args, st.ctm)
+			}
+		case "S", "s", "B", "B*", "b", "b*":
+			x.paintPath(true)
+		case "f", "F", "f*":
+			x.paintPath(false)
+		case "n":
+			x.path = x.path[:0]
+		case "Do":
+			if len(args) == 1 && depth < maxFormDepth {
+				if name, ok := args[0].(pdfName); ok {
+					x.form(resources, string(name), st.ctm, depth)
+				}
+			}
+		}
+	})
+}
+
+func (st *textState) moveLine(tx, ty float64) {
+	st.tlm = translate(tx, ty).mul(st.tlm)
+	st.tm = st.tlm
+}
+
+// show handles the operand of Tj or the array of TJ, producing one run.
+func (x *textExtractor) show(st *textState, items []any) {
+	if st.font == nil {
+		return
+	}
+
+	trm := matrix{st.size * st.scale, 0, 0, st.size, 0, st.rise}.mul(st.tm).mul(st.ctm)
+	startX, startY := trm[4], trm[5]
+	size := math.Hypot(trm[2], trm[3])
+
+	var sb strings.Builder
+	var chars []textChar
+	for _, item := range items {
+		switch v := item.(type) {
+		case pdfString:
+			for _, code := range st.font.codes(v) {
+				text := st.font.text(code)
+				sb.WriteString(text)
+				w := st.font.width(code)/1000*st.size + st.charSpace
+				if !st.font.twoByte && code == ' ' {
+					w += st.wordSpace
+				}
+				origin := matrix{1, 0, 0, 1, 0, st.rise}.mul(st.tm).mul(st.ctm)
+				st.tm = translate(w*st.scale, 0).mul(st.tm)
+				end := matrix{1, 0, 0, 1, 0, st.rise}.mul(st.tm).mul(st.ctm)
+				chars = append(chars, textChar{Text: text, X: origin[4], Y: origin[5], Width: math.Hypot(end[4]-origin[4], end[5]-origin[5])})
+			}
+		case float64:
+			shift := -v / 1000 * st.size
+			if v <= -200 {
+				sb.WriteByte(' ')
+			}
+			st.tm = translate(shift*st.scale, 0).mul(st.tm)
+		}
+	}
+
+	if sb.Len() == 0 {
+		return
+	}
+	end := matrix{1, 0, 0, 1, 0, st.rise}.mul(st.tm).mul(st.ctm)
+	x.runs = append(x.runs, textRun{
+		Text:  sb.String(),
+		X:     startX,
+		Y:     startY,
+		Width: math.Hypot(end[4]-startX, end[5]-startY),
+		Size:  size,
+		Font:  st.font.baseFont,
+		Chars: chars,
+	})
+}
+
+// buildPath adds a path construction operator to the current path.
+// Curves only move the current point, since they never form rulings.
+func (x *textExtractor) buildPath(op string, args []any, ctm matrix) {
+	point := func(i int) [2]float64 {
+		px, py := ctm.apply(numberOperand(args, i), numberOperand(args, i+1))
+		return [2]float64{px, py}
+	}
+	line := func(to [2]float64, rect bool) {
+		x.path = append(x.path, pathSegment{X0: x.current[0], Y0: x.current[1], X1: to[0], Y1: to[1], Rect: rect})
+		x.current = to
+	}
+	switch op {
+	case "m":
+		x.current = point(0)
+		x.start = x.current
+	case "l":
+		line(point(0), false)
+	case "c":
+		x.current = point(4)
+	case "v", "y":
+		x.current = point(2)
+	case "h":
+		line(x.start, false)
+	case "re":
+		rx, ry := numberOperand(args, 0), numberOperand(args, 1)
+		w, h := numberOperand(args, 2), numberOperand(args, 3)
+		corners := [][2]float64{{rx, ry}, {rx + w, ry}, {rx + w, ry + h}, {rx, ry + h}}
+		for i, c := range corners {
+			px, py := ctm.apply(c[0], c[1])
+			if i == 0 {
+				x.current = [2]float64{px, py}
+				x.start = x.current
+				continue
+			}
+			line([2]float64{px, py}, true)
+		}
+		line(x.start, true)
+	}
+}
+
+// paintPath turns the current path into rulings. Stroked paths give
+// their horizontal and vertical segments; filled paths only count when
+// they are rectangles thin enough to be drawn lines.
+func (x *textExtractor) paintPath(stroke bool) {
+	defer func() { x.path = x.path[:0] }()
+	if !x.layout {
+		return
+	}
+	if stroke {
+		for _, seg := range x.path {
+			if math.Abs(seg.X1-seg.X0) < 1 || math.Abs(seg.Y1-seg.Y0) < 1 {
+				x.rulings = append(x.rulings, ruling{X0: seg.X0, Y0: seg.Y0, X1: seg.X1, Y1: seg.Y1})
+			}
+		}
+		return
+	}
+	for i := 0; i+3 < len(x.path); i++ {
+		if !x.path[i].Rect || !x.path[i+3].Rect {
+			continue
+		}
+		// The first two edges of a rectangle run between opposite corners.
+		box := normalizeRect([4]float64{x.path[i].X0, x.path[i].Y0, x.path[i+1].X1, x.path[i+1].Y1})
+		w, h := box[2]-box[0], box[3]-box[1]
+		switch {
+		case h <= maxRulingWidth && w > h:
+			x.rulings = append(x.rulings, ruling{X0: box[0], Y0: (box[1] + box[3]) / 2, X1: box[2], Y1: (box[1] + box[3]) / 2})
+		case w <= maxRulingWidth && h > w:
+			x.rulings = append(x.rulings, ruling{X0: (box[0] + box[2]) / 2, Y0: box[1], X1: (box[0] + box[2]) / 2, Y1: box[3]})
+		}
+		i += 3
+	}
+}
+
+// form follows a form XObject, whose content is drawn with its own
+// matrix and, when present, its own resources.
+func (x *textExtractor) form(resources types.Dict, name string, ctm matrix, depth int) {
+	xobjects := dictEntry(x.ctx, resources, "XObject")
+	if xobjects == nil {
+		return
+	}
+	sd, _, err := x.ctx.DereferenceStreamDict(xobjects[name])
+	if err != nil || sd == nil {
+		return
+	}
+	subtype := sd.Dict.NameEntry("Subtype")
+	if subtype != nil && *subtype == "Image" && x.layout {
+		draw := imageDraw{Name: name, Stream: sd}
+		if ir, ok := xobjects[name].(types.IndirectRef); ok {
+			draw.ObjNr = ir.ObjectNumber.Value()
+		}
+		// Images fill the unit square of the current matrix.
+		draw.Box = normalizeRect([4]float64{ctm[4], ctm[5], ctm[4], ctm[5]})
+		for _, corner := range [][2]float64{{1, 0}, {0, 1}, {1, 1}} {
+			cx, cy := ctm.apply(corner[0], corner[1])
+			draw.Box = [4]float64{math.Min(draw.Box[0], cx), math.Min(draw.Box[1], cy), math.Max(draw.Box[2], cx), math.Max(draw.Box[3], cy)}
+		}
+		x.images = append(x.images, draw)
+		return
+	}
+	if subtype == nil || *subtype != "Form" {
+		return
+	}
+	if err := sd.Decode(); err != nil {
+		return
+	}
+
+	m := identityMatrix
+	if arr, err := x.ctx.DereferenceArray(sd.Dict["Matrix"]); err == nil && len(arr) == 6 {
+		for i, o := range arr {
+			m[i], _ = x.ctx.DereferenceNumber(o)
+		}
+	}
+	formResources := dictEntry(x.ctx, sd.Dict, "Resources")
+	if formResources == nil {
+		formResources = resources
+	}
+	x.run(sd.Content, formResources, m.mul(ctm), depth+1)
+}
+
+func (x *textExtractor) font(resources types.Dict, name string) *pdfFont {
+	fonts := dictEntry(x.ctx, resources, "Font")
+	if fonts == nil {
+		return nil
+	}
+	obj := fonts[name]
+	ir, isRef := obj.(types.IndirectRef)
+	if isRef {
+		if f, ok := x.fonts[ir.ObjectNumber.Value()]; ok {
+			return f
+		}
+	}
+	d, err := x.ctx.DereferenceDict(obj)
+	if err != nil || d == nil {
+		return nil
+	}
+	f := loadFont(x.ctx, d)
+	if isRef {
+		x.fonts[ir.ObjectNumber.Value()] = f
+	}
+	return f
+}
+
+func dictEntry(ctx *model.Context, d types.Dict, key string) types.Dict {
+	if d == nil {
+		return nil
+	}
+	entry, err := ctx.DereferenceDict(d[key])
+	if err != nil {
+		return nil
+	}
+	return entry
+}
+
+func numberOperand(args []any, i int) float64 {
+	if i < len(args) {
+		if f, ok := args[i].(float64); ok {
+			return f
+		}
+	}
+	return 0
+}
+
+func matrixOperand(args []any) (matrix, bool) {
+	var m matrix
+	if len(args) != 6 {
+		return m, false
+	}
+	for i, a := range args {
+		f, ok := a.(float64)
+		if !ok {
+			return m, false
+		}
+		m[i] = f
+	}
+	return m, true
+}
+
+// pdfFont holds what is needed to turn shown strings into text and
+// advance widths.
+type pdfFont struct {
+	baseFont     string
+	twoByte      bool
+	toUnicode    map[int]string
+	encoding     map[int]rune
+	widths       map[int]float64
+	defaultWidth float64
+}
+
+func loadFont(ctx *model.Context, d types.Dict) *pdfFont {
+	f := &pdfFont{widths: make(map[int]float64), defaultWidth: 500}
+	if name := d.NameEntry("BaseFont"); name != nil {
+		f.baseFont = *name
+	}
+
+	if sd, _, err := ctx.DereferenceStreamDict(d["ToUnicode"]); err == nil && sd != nil {
+		if err := sd.Decode(); err == nil {
+			f.toUnicode = parseToUnicode(sd.Content)
+		}
+	}
+
+	if subtype := d.NameEntry("Subtype"); subtype != nil && *subtype == "Type0" {
+		f.twoByte = true
+		f.defaultWidth = 1000
+		if kids, err := ctx.DereferenceArray(d["DescendantFonts"]); err == nil && len(kids) > 0 {
+			if cid, err := ctx.DereferenceDict(kids[0]); err == nil && cid != nil {
+				f.loadCIDWidths(ctx, cid)
+			}
+		}
+		return f
+	}
+
+	if first, err := ctx.DereferenceNumber(d["FirstChar"]); err == nil {
+		if widths, err := ctx.DereferenceArray(d["Widths"]); err == nil {
+			for i, w := range widths {
+				f.widths[int(first)+i], _ = ctx.DereferenceNumber(w)
+			}
+		}
+	}
+	if desc := dictEntry(ctx, d, "FontDescriptor"); desc != nil {
+		if w, err := ctx.DereferenceNumber(desc["MissingWidth"]); err == nil && w > 0 {
+			f.defaultWidth = w
+		}
+	}
+
+	f.encoding = make(map[int]rune)
+	if enc := dictEntry(ctx, d, "Encoding"); enc != nil {
+		if diffs, err := ctx.DereferenceArray(enc["Differences"]); err == nil {
+			code := 0
+			for _, o := range diffs {
+				switch v := o.(type) {
+				case types.Integer:
+					code = v.Value()
+				case types.Name:
+					if r, ok := glyphRune(v.Value()); ok {
+						f.encoding[code] = r
+					}
+					code++
+				}
+			}
+		}
+	}
+	return f
+}
+
+// loadCIDWidths reads the W array of a CID font: entries are either
+// "c [w1 w2 ...]" or "cFirst cLast w".
+func (f *pdfFont) loadCIDWidths(ctx *model.Context, cid types.Dict) {
+	if dw, err := ctx.DereferenceNumber(cid["DW"]); err == nil {
+		f.defaultWidth = dw
+	}
+	w, err := ctx.DereferenceArray(cid["W"])
+	if err != nil {
+		return
+	}
+	for i := 0; i+1 < len(w); {
+		first, err := ctx.DereferenceNumber(w[i])
+		if err != nil {
+			return
+		}
+		if arr, err := ctx.DereferenceArray(w[i+1]); err == nil && arr != nil {
+			for j, o := range arr {
+				f.widths[int(first)+j], _ = ctx.DereferenceNumber(o)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, _ := ctx.DereferenceNumber(w[i+1])
+		width, _ := ctx.DereferenceNumber(w[i+2])
+		for c := int(first); c <= int(last) && c-int(first) < 65536; c++ {
+			f.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+func (f *pdfFont) codes(s pdfString) []int {
+	if !f.twoByte {
+		codes := make([]int, len(s))
+		for i, b := range s {
+			codes[i] = int(b)
+		}
+		return codes
+	}
+	codes := make([]int, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		codes = append(codes, int(s[i])<<8|int(s[i+1]))
+	}
+	return codes
+}
+
+func (f *pdfFont) text(code int) string {
+	if s, ok := f.toUnicode[code]; ok {
+		return s
+	}
+	if f.twoByte {
+		return ""
+	}
+	if r, ok := f.encoding[code]; ok {
+		return string(r)
+	}
+	return string(winAnsiRune(byte(code)))
+}
+
+func (f *pdfFont) width(code int) float64 {
+	if w, ok := f.widths[code]; ok && w > 0 {
+		return w
+	}
+	// The standard 14 fonts may leave out Widths; their metrics are known.
+	if !f.twoByte && len(f.widths) == 0 && font.IsCoreFont(f.baseFont) {
+		return float64(font.CharWidth(f.baseFont, rune(code)))
+	}
+	return f.defaultWidth
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap.
+func parseToUnicode(data []byte) map[int]string {
+	m := make(map[int]string)
+	scanContent(data, func(op string, args []any) {
+		switch op {
+		case "endbfchar":
+			for i := 0; i+1 < len(args); i += 2 {
+				src, ok1 := args[i].(pdfString)
+				dst, ok2 := args[i+1].(pdfString)
+				if ok1 && ok2 {
+					m[bytesCode(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(args); i += 3 {
+				lo, ok1 := args[i].(pdfString)
+				hi, ok2 := args[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				first, last := bytesCode(lo), bytesCode(hi)
+				if last < first || last-first > 65535 {
+					continue
+				}
+				switch dst := args[i+2].(type) {
+				case pdfString:
+					base := []rune(utf16Text(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for c := first; c <= last; c++ {
+						r := append([]rune{}, base...)
+						r[len(r)-1] += rune(c - first)
+						m[c] = string(r)
+					}
+				case []any:
+					for j, o := range dst {
+						if s, ok := o.(pdfString); ok && first+j <= last {
+							m[first+j] = utf16Text(s)
+						}
+					}
+				}
+			}
+		}
+	})
+	return m
+}
+
+func bytesCode(b []byte) int {
+	code := 0
+	for _, c := range b {
+		code = code<<8 | int(c)
+	}
+	return code
+}
+
+func utf16Text(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh maps the bytes 0x80-0x9F of WinAnsiEncoding, which differ
+// from Latin-1.
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+func winAnsiRune(b byte) rune {
+	if b >= 0x80 && b < 0xA0 {
+		if r := winAnsiHigh[b-0x80]; r != 0 {
+			return r
+		}
+		return ' '
+	}
+	if b < 0x20 {
+		return ' '
+	}
+	return rune(b)
+}
+
+// glyphNames covers the glyph names commonly found in Differences arrays
+// besides single letters and uniXXXX names.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*',
+	"plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/', "colon": ':',
+	"semicolon": ';', "less": '<', "equal": '=', "greater": '>', "question": '?', "at": '@',
+	"bracketleft": '[', "backslash": '\\', "bracketright": ']', "underscore": '_',
+	"braceleft": '{', "bar": '|', "braceright": '}', "zero": '0', "one": '1', "two": '2',
+	"three": '3', "four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"bullet": '•', "endash": '–', "emdash": '—', "ellipsis": '…', "fi": 'ﬁ', "fl": 'ﬂ',
+	"copyright": '©', "registered": '®', "degree": '°', "section": '§', "paragraph": '¶',
+}
+
+func glyphRune(name string) (rune, bool) {
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if v, err := strconv.ParseUint(name[3:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+// Operands produced by scanContent besides float64, bool, nil and []any.
+type (
+	pdfName   string
+	pdfString []byte
+)
+
+type (
+	contentOperator string
+	arrayEnd        struct{}
+	dictEnd         struct{}
+)
+
+// scanContent tokenizes a content stream, calling fn for every operator
+// with the operands that precede it. Dictionaries are parsed but passed as
+// nil and inline image data is skipped. The args slice is reused between
+// calls.
+func scanContent(content []byte, fn func(op string, args []any)) {
+	s := &contentScanner{data: content}
+	var args []any
+	for {
+		obj, ok := s.next()
+		if !ok {
+			return
+		}
+		switch v := obj.(type) {
+		case contentOperator:
+			fn(string(v), args)
+			if v == "ID" {
+				s.skipInlineImage()
+			}
+			args = args[:0]
+		case arrayEnd, dictEnd:
+		default:
+			args = append(args, obj)
+		}
+	}
+}
+
+type contentScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *contentScanner) next() (any, bool) {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case isPDFSpace(c):
+			s.pos++
+		case c == '%':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' && s.data[s.pos] != '\r' {
+				s.pos++
+			}
+		case c == '(':
+			return s.literalString(), true
+		case c == '<' && s.peek(1) == '<':
+			s.pos += 2
+			for {
+				obj, ok := s.next()
+				if !ok {
+					return nil, false
+				}
+				if _, end := obj.(dictEnd); end {
+					return nil, true
+				}
+			}
+		case c == '>' && s.peek(1) == '>':
+			s.pos += 2
+			return dictEnd{}, true
+		case c == '<':
+			return s.hexString(), true
+		case c == '[':
+			s.pos++
+			arr := []any{}
+			for {
+				obj, ok := s.next()
+				if !ok {
+					return arr, true
+				}
+				switch obj.(type) {
+				case arrayEnd:
+					return arr, true
+				case contentOperator, dictEnd:
+				default:
+					arr = append(arr, obj)
+				}
+			}
+		case c == ']':
+			s.pos++
+			return arrayEnd{}, true
+		case c == '/':
+			s.pos++
+			return pdfName(s.regular()), true
+		case isPDFDelimiter(c):
+			s.pos++
+		default:
+			tok := s.regular()
+			if f, err := strconv.ParseFloat(tok, 64); err == nil {
+				return f, true
+			}
+			switch tok {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			case "null":
+				return nil, true
+			}
+			return contentOperator(tok), true
+		}
+	}
+	return nil, false
+}
+
+func (s *contentScanner) peek(n int) byte {
+	if s.pos+n < len(s.data) {
+		return s.data[s.pos+n]
+	}
+	return 0
+}
+
+func (s *contentScanner) regular() string {
+	start := s.pos
+	for s.pos < len(s.data) && !isPDFSpace(s.data[s.pos]) && !isPDFDelimiter(s.data[s.pos]) {
+		s.pos++
+	}
+	tok := s.data[start:s.pos]
+	if s.pos == start {
+		s.pos++
+	}
+	return string(tok)
+}
+
+func (s *contentScanner) literalString() pdfString {
+	var out []byte
+	depth := 0
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		s.pos++
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if s.pos >= len(s.data) {
+				return out
+			}
+			e := s.data[s.pos]
+			s.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if s.pos < len(s.data) && s.data[s.pos] == '\n' {
+					s.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '7'; i++ {
+						v = v*8 + int(s.data[s.pos]-'0')
+						s.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (s *contentScanner) hexString() pdfString {
+	s.pos++
+	var out []byte
+	var digits []byte
+	for s.pos < len(s.data) && s.data[s.pos] != '>' {
+		if v, ok := hexDigit(s.data[s.pos]); ok {
+			digits = append(digits, v)
+		}
+		s.pos++
+	}
+	s.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, 0)
+	}
+	for i := 0; i < len(digits); i += 2 {
+		out = append(out, digits[i]<<4|digits[i+1])
+	}
+	return out
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// skipInlineImage moves past the binary data that follows an ID operator,
+// up to and including the EI operator.
+func (s *contentScanner) skipInlineImage() {
+	s.pos++
+	for ; s.pos+1 < len(s.data); s.pos++ {
+		if s.data[s.pos] == 'E' && s.data[s.pos+1] == 'I' && isPDFSpace(s.data[s.pos-1]) &&
+			(s.pos+2 == len(s.data) || isPDFSpace(s.data[s.pos+2])) {
+			s.pos += 2
+			return
+		}
+	}
+	s.pos = len(s.data)
+}
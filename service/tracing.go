@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans are created through the global OpenTelemetry tracer provider, so
+// tracing stays a no-op until the application calls otel.SetTracerProvider.
+const tracerName = "github.com/infosec554/convert-pdf-go-sdk/service"
+
+// Span attribute keys shared by all services.
+const (
+	AttrInputBytes  = attribute.Key("pdf.input_bytes")
+	AttrOutputBytes = attribute.Key("pdf.output_bytes")
+	AttrPageCount   = attribute.Key("pdf.page_count")
+	AttrPage        = attribute.Key("pdf.page")
+	AttrErrorClass  = attribute.Key("error.class")
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(AttrErrorClass.String(ErrorClass(err)))
+	}
+	span.End()
+}
+
+// traceStep runs fn in a child span, e.g. a single pdfcpu call.
+func traceStep(ctx context.Context, name string, fn func() error, attrs ...attribute.KeyValue) error {
+	_, span := startSpan(ctx, name, attrs...)
+	err := fn()
+	endSpan(span, err)
+	return err
+}
+
+// writeFile writes a temp file inside a "tempfile.write" span.
+func writeFile(ctx context.Context, path string, data []byte) error {
+	return traceStep(ctx, "tempfile.write", func() error {
+		return os.WriteFile(path, data, 0644)
+	}, AttrOutputBytes.Int(len(data)))
+}
+
+// writeTemp writes data to an already created temp file and closes it.
+func writeTemp(ctx context.Context, f *os.File, data []byte) error {
+	return traceStep(ctx, "tempfile.write", func() error {
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, AttrOutputBytes.Int(len(data)))
+}
+
+// readFile reads a temp file inside a "tempfile.read" span.
+func readFile(ctx context.Context, path string) ([]byte, error) {
+	_, span := startSpan(ctx, "tempfile.read")
+	data, err := os.ReadFile(path)
+	endSpan(span, err, AttrInputBytes.Int(len(data)))
+	return data, err
+}
+
+// runCommand runs an external tool such as pdftoppm or tesseract in its own span.
+func runCommand(ctx context.Context, name string, args []string, attrs ...attribute.KeyValue) ([]byte, error) {
+	ctx, span := startSpan(ctx, "exec "+name, append(attrs, attribute.String("process.executable.name", name))...)
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	endSpan(span, err)
+	return output, err
+}
+
+// ErrorClass labels err by cause for the error.class span attribute:
+// "timeout", "canceled", "subprocess", "io" or "other". pdfsdk.ErrorClass
+// falls back to it for errors that are not the SDK's own, so spans and
+// metrics label the same failure alike.
+func ErrorClass(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &exitErr):
+		return "subprocess"
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		return "io"
+	default:
+		return "other"
+	}
+}
+
+// readContextFile parses a PDF with pdfcpu inside a "pdfcpu.ReadContextFile" span.
+func readContextFile(ctx context.Context, path string) (*model.Context, error) {
+	_, span := startSpan(ctx, "pdfcpu.ReadContextFile")
+	pdfCtx, err := api.ReadContextFile(path)
+	if pdfCtx != nil {
+		span.SetAttributes(AttrPageCount.Int(pdfCtx.PageCount))
+	}
+	endSpan(span, err)
+	return pdfCtx, err
+}
+
+// readContext parses an in-memory PDF with pdfcpu for direct edits.
+func readContext(ctx context.Context, input []byte) (*model.Context, error) {
+	_, span := startSpan(ctx, "pdfcpu.ReadValidateAndOptimize", AttrInputBytes.Int(len(input)))
+	pdfCtx, err := api.ReadValidateAndOptimize(bytes.NewReader(input), model.NewDefaultConfiguration())
+	if pdfCtx != nil {
+		span.SetAttributes(AttrPageCount.Int(pdfCtx.PageCount))
+	}
+	endSpan(span, err)
+	return pdfCtx, err
+}
+
+// writeContext serializes a pdfcpu context inside a "pdfcpu.WriteContext" span.
+func writeContext(ctx context.Context, pdfCtx *model.Context) ([]byte, error) {
+	_, span := startSpan(ctx, "pdfcpu.WriteContext")
+	var buf bytes.Buffer
+	err := api.WriteContext(pdfCtx, &buf)
+	endSpan(span, err, AttrOutputBytes.Int(buf.Len()))
+	return buf.Bytes(), err
+}
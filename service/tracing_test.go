@@ -0,0 +1,172 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/gotenberg"
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func spanAttr(span *tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingCompressBytes(t *testing.T) {
+	exporter := setupTracing(t)
+
+	svc := service.NewCompressService(getTestLogger())
+	if _, err := svc.CompressBytes(minimalPDF); err != nil {
+		t.Fatalf("CompressBytes failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	root := findSpan(spans, "CompressService.CompressBytes")
+	if root == nil {
+		t.Fatalf("Expected CompressService.CompressBytes span, got %d spans", len(spans))
+	}
+	if v, ok := spanAttr(root, service.AttrInputBytes); !ok || v.AsInt64() != int64(len(minimalPDF)) {
+		t.Errorf("Expected input bytes %d, got %v", len(minimalPDF), v.AsInt64())
+	}
+	if _, ok := spanAttr(root, service.AttrOutputBytes); !ok {
+		t.Error("Expected output bytes attribute")
+	}
+
+	step := findSpan(spans, "pdfcpu.OptimizeFile")
+	if step == nil {
+		t.Fatal("Expected pdfcpu.OptimizeFile child span")
+	}
+	if step.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Error("Expected pdfcpu.OptimizeFile to be a child of the service span")
+	}
+	if findSpan(spans, "tempfile.write") == nil {
+		t.Error("Expected tempfile.write span")
+	}
+}
+
+func TestTracingRecordsErrors(t *testing.T) {
+	exporter := setupTracing(t)
+
+	svc := service.NewInfoService(getTestLogger())
+	if _, err := svc.GetInfoBytes([]byte("not a pdf")); err == nil {
+		t.Fatal("Expected error for invalid input")
+	}
+
+	root := findSpan(exporter.GetSpans(), "InfoService.GetInfoBytes")
+	if root == nil {
+		t.Fatal("Expected InfoService.GetInfoBytes span")
+	}
+	if root.Status.Code != codes.Error {
+		t.Errorf("Expected error status, got %v", root.Status.Code)
+	}
+	if _, ok := spanAttr(root, service.AttrErrorClass); !ok {
+		t.Error("Expected error.class attribute")
+	}
+}
+
+func TestTracingMergeCountsPathInputs(t *testing.T) {
+	exporter := setupTracing(t)
+
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	if err := os.WriteFile(path, minimalPDF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputs := []service.MergeInput{{Path: path}, {Data: minimalPDF}}
+	if _, err := service.NewMergeService(getTestLogger()).MergeWithOptions(inputs, nil); err != nil {
+		t.Fatalf("MergeWithOptions failed: %v", err)
+	}
+
+	root := findSpan(exporter.GetSpans(), "MergeService.MergeWithOptions")
+	if root == nil {
+		t.Fatal("Expected MergeService.MergeWithOptions span")
+	}
+	if v, _ := spanAttr(root, service.AttrInputBytes); v.AsInt64() != 2*int64(len(minimalPDF)) {
+		t.Errorf("Expected %d input bytes, got %d", 2*len(minimalPDF), v.AsInt64())
+	}
+}
+
+func TestTracingPropagatesToGotenberg(t *testing.T) {
+	exporter := setupTracing(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	withUser := strings.Replace(server.URL, "http://", "http://api:secret@", 1)
+	svc := service.NewWordToPDFService(getTestLogger(), gotenberg.New(withUser))
+	_, err := svc.ConvertBytes(ctx, []byte("doc"), "a.docx")
+	parent.End()
+	if err == nil {
+		t.Fatal("Expected error from unavailable Gotenberg")
+	}
+
+	traceID := parent.SpanContext().TraceID().String()
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("Expected traceparent with trace %s, got %q", traceID, traceparent)
+	}
+
+	spans := exporter.GetSpans()
+	httpSpan := findSpan(spans, "POST /forms/libreoffice/convert")
+	if httpSpan == nil {
+		t.Fatal("Expected Gotenberg client span")
+	}
+	if v, ok := spanAttr(httpSpan, "http.response.status_code"); !ok || v.AsInt64() != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code 503, got %v", v.AsInt64())
+	}
+	if v, _ := spanAttr(httpSpan, "url.full"); v.AsString() != server.URL+"/forms/libreoffice/convert" {
+		t.Errorf("Expected url.full without credentials, got %q", v.AsString())
+	}
+
+	root := findSpan(spans, "WordToPDFService.ConvertBytes")
+	if root == nil {
+		t.Fatal("Expected WordToPDFService.ConvertBytes span")
+	}
+	if root.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected service span to be a child of the caller's span")
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"io"
 	"os"
 
@@ -37,6 +38,13 @@ func (s *unlockService) Unlock(input io.Reader, password string) ([]byte, error)
 }
 
 func (s *unlockService) UnlockFile(inputPath, outputPath, password string) error {
+	ctx, span := startSpan(context.Background(), "UnlockService.UnlockFile")
+	err := s.unlockFile(ctx, inputPath, outputPath, password)
+	endSpan(span, err)
+	return err
+}
+
+func (s *unlockService) unlockFile(ctx context.Context, inputPath, outputPath, password string) error {
 	s.log.Info("UnlockService.UnlockFile called", logger.String("input", inputPath))
 
 	conf := api.LoadConfiguration()
@@ -45,7 +53,9 @@ func (s *unlockService) UnlockFile(inputPath, outputPath, password string) error
 		conf.OwnerPW = password
 	}
 
-	if err := api.DecryptFile(inputPath, outputPath, conf); err != nil {
+	if err := traceStep(ctx, "pdfcpu.DecryptFile", func() error {
+		return api.DecryptFile(inputPath, outputPath, conf)
+	}); err != nil {
 		s.log.Error("pdfcpu decrypt failed, copying as-is", logger.Error(err))
 		inputBytes, err := os.ReadFile(inputPath)
 		if err != nil {
@@ -59,6 +69,13 @@ func (s *unlockService) UnlockFile(inputPath, outputPath, password string) error
 }
 
 func (s *unlockService) UnlockBytes(input []byte, password string) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "UnlockService.UnlockBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.unlockBytes(ctx, input, password)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *unlockService) unlockBytes(ctx context.Context, input []byte, password string) ([]byte, error) {
 	s.log.Info("UnlockService.UnlockBytes called")
 
 	tmpInput, err := os.CreateTemp("", "pdf-unlock-*.pdf")
@@ -74,17 +91,15 @@ func (s *unlockService) UnlockBytes(input []byte, password string) ([]byte, erro
 	defer os.Remove(tmpOutput.Name())
 	tmpOutput.Close()
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
-	if err := s.UnlockFile(tmpInput.Name(), tmpOutput.Name(), password); err != nil {
+	if err := s.unlockFile(ctx, tmpInput.Name(), tmpOutput.Name(), password); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(tmpOutput.Name())
+	output, err := readFile(ctx, tmpOutput.Name())
 	if err != nil {
 		return nil, err
 	}
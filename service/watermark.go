@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -55,6 +56,13 @@ func (s *watermarkService) AddWatermark(input io.Reader, text string, options *W
 }
 
 func (s *watermarkService) AddWatermarkFile(inputPath, outputPath, text string, options *WatermarkOptions) error {
+	ctx, span := startSpan(context.Background(), "WatermarkService.AddWatermarkFile")
+	err := s.addWatermarkFile(ctx, inputPath, outputPath, text, options)
+	endSpan(span, err)
+	return err
+}
+
+func (s *watermarkService) addWatermarkFile(ctx context.Context, inputPath, outputPath, text string, options *WatermarkOptions) error {
 	s.log.Info("WatermarkService.AddWatermarkFile called", logger.String("input", inputPath))
 
 	if options == nil {
@@ -84,7 +92,9 @@ func (s *watermarkService) AddWatermarkFile(inputPath, outputPath, text string,
 		return fmt.Errorf("watermark create failed: %w", err)
 	}
 
-	if err := api.AddWatermarksFile(outputPath, "", nil, wm, nil); err != nil {
+	if err := traceStep(ctx, "pdfcpu.AddWatermarksFile", func() error {
+		return api.AddWatermarksFile(outputPath, "", nil, wm, nil)
+	}); err != nil {
 		s.log.Error("pdfcpu watermark failed", logger.Error(err))
 		os.Remove(outputPath)
 		return fmt.Errorf("watermark failed: %w", err)
@@ -95,6 +105,13 @@ func (s *watermarkService) AddWatermarkFile(inputPath, outputPath, text string,
 }
 
 func (s *watermarkService) AddWatermarkBytes(input []byte, text string, options *WatermarkOptions) ([]byte, error) {
+	ctx, span := startSpan(context.Background(), "WatermarkService.AddWatermarkBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.addWatermarkBytes(ctx, input, text, options)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *watermarkService) addWatermarkBytes(ctx context.Context, input []byte, text string, options *WatermarkOptions) ([]byte, error) {
 	s.log.Info("WatermarkService.AddWatermarkBytes called")
 
 	if options == nil {
@@ -114,17 +131,15 @@ func (s *watermarkService) AddWatermarkBytes(input []byte, text string, options
 	defer os.Remove(tmpOutput.Name())
 	tmpOutput.Close()
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
-	if err := s.AddWatermarkFile(tmpInput.Name(), tmpOutput.Name(), text, options); err != nil {
+	if err := s.addWatermarkFile(ctx, tmpInput.Name(), tmpOutput.Name(), text, options); err != nil {
 		return nil, err
 	}
 
-	output, err := os.ReadFile(tmpOutput.Name())
+	output, err := readFile(ctx, tmpOutput.Name())
 	if err != nil {
 		return nil, err
 	}
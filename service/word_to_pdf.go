@@ -40,6 +40,13 @@ func (s *wordToPDFService) Convert(ctx context.Context, input io.Reader, filenam
 }
 
 func (s *wordToPDFService) ConvertFile(ctx context.Context, inputPath, outputPath string) error {
+	ctx, span := startSpan(ctx, "WordToPDFService.ConvertFile")
+	err := s.convertFile(ctx, inputPath, outputPath)
+	endSpan(span, err)
+	return err
+}
+
+func (s *wordToPDFService) convertFile(ctx context.Context, inputPath, outputPath string) error {
 	s.log.Info("WordToPDFService.ConvertFile called", logger.String("input", inputPath))
 
 	resultBytes, err := s.gotClient.WordToPDF(ctx, inputPath)
@@ -48,7 +55,7 @@ func (s *wordToPDFService) ConvertFile(ctx context.Context, inputPath, outputPat
 		return err
 	}
 
-	if err := os.WriteFile(outputPath, resultBytes, 0644); err != nil {
+	if err := writeFile(ctx, outputPath, resultBytes); err != nil {
 		s.log.Error("Failed to write output file", logger.Error(err))
 		return err
 	}
@@ -58,6 +65,13 @@ func (s *wordToPDFService) ConvertFile(ctx context.Context, inputPath, outputPat
 }
 
 func (s *wordToPDFService) ConvertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "WordToPDFService.ConvertBytes", AttrInputBytes.Int(len(input)))
+	output, err := s.convertBytes(ctx, input, filename)
+	endSpan(span, err, AttrOutputBytes.Int(len(output)))
+	return output, err
+}
+
+func (s *wordToPDFService) convertBytes(ctx context.Context, input []byte, filename string) ([]byte, error) {
 	s.log.Info("WordToPDFService.ConvertBytes called")
 
 	tmpInput, err := os.CreateTemp("", "word-input-*"+getExtension(filename))
@@ -66,11 +80,9 @@ func (s *wordToPDFService) ConvertBytes(ctx context.Context, input []byte, filen
 	}
 	defer os.Remove(tmpInput.Name())
 
-	if _, err := tmpInput.Write(input); err != nil {
-		tmpInput.Close()
+	if err := writeTemp(ctx, tmpInput, input); err != nil {
 		return nil, err
 	}
-	tmpInput.Close()
 
 	resultBytes, err := s.gotClient.WordToPDF(ctx, tmpInput.Name())
 	if err != nil {
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkerSlots lends spare capacity to an operation that splits its work,
+// such as OCR recognising pages in parallel. The operation itself holds
+// one slot; each further worker needs one from TryAcquire.
+type WorkerSlots interface {
+	// TryAcquire takes a slot if one is free now.
+	TryAcquire() bool
+	// Release returns a slot taken by TryAcquire.
+	Release()
+}
+
+type workerSlotsKey struct{}
+
+// WithWorkerSlots returns a context whose parallel operations borrow
+// workers from slots. The SDK sets it to its WorkerPool.
+func WithWorkerSlots(ctx context.Context, slots WorkerSlots) context.Context {
+	return context.WithValue(ctx, workerSlotsKey{}, slots)
+}
+
+func workerSlotsFromContext(ctx context.Context) WorkerSlots {
+	slots, _ := ctx.Value(workerSlotsKey{}).(WorkerSlots)
+	return slots
+}
+
+// runPages calls fn for every index below n on up to workers goroutines
+// and returns the first error. One worker always runs; when ctx carries
+// WorkerSlots, each further worker starts only once it gets a slot, which
+// is retried as work is handed out.
+func runPages(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	slots := workerSlotsFromContext(ctx)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	running := 0
+	start := func(borrowed bool) {
+		running++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if borrowed {
+				defer slots.Release()
+			}
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, i); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range n {
+		if running < max(workers, 1) {
+			switch {
+			case running == 0:
+				start(false)
+			case slots == nil:
+				start(false)
+			case slots.TryAcquire():
+				start(true)
+			}
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return context.Cause(ctx)
+}
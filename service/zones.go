@@ -0,0 +1,451 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/infosec554/convert-pdf-go-sdk/pkg/logger"
+)
+
+var ErrInvalidZoneTemplate = errors.New("invalid zone template")
+
+// ZoneType is the kind of value a zone holds.
+type ZoneType string
+
+const (
+	// ZoneText is the zone's text as it is. It is the default.
+	ZoneText ZoneType = "text"
+	// ZoneInteger is a whole number, read into an int64.
+	ZoneInteger ZoneType = "integer"
+	// ZoneNumber is a decimal number such as an amount, read into a
+	// float64. Currency symbols and thousands separators are ignored,
+	// and both "1,234.50" and "1.234,50" are understood.
+	ZoneNumber ZoneType = "number"
+	// ZoneDate is a date, read into a time.Time using the zone's
+	// DateLayouts.
+	ZoneDate ZoneType = "date"
+)
+
+// DefaultDateLayouts are tried, in order, for date zones without their
+// own layouts. Numeric dates are read day first; give a zone
+// "01/02/2006" for US dates.
+var DefaultDateLayouts = []string{
+	"2006-01-02", "02.01.2006", "02/01/2006", "2 January 2006", "2 Jan 2006", "January 2, 2006", "Jan 2, 2006",
+}
+
+// Zone is a named rectangle on a page. Coordinates are in points from
+// the top left corner of the page as displayed, that is after any
+// /Rotate and within the crop box.
+type Zone struct {
+	Name   string  `json:"name"`
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// Type is the kind of value expected. Empty uses ZoneText.
+	Type ZoneType `json:"type,omitempty"`
+	// Pattern is a regular expression the text must contain. When it
+	// has a capture group, the first group is the value.
+	Pattern string `json:"pattern,omitempty"`
+	// DateLayouts are Go time layouts for date zones. Empty uses
+	// DefaultDateLayouts.
+	DateLayouts []string `json:"date_layouts,omitempty"`
+	// Required zones are invalid when empty.
+	Required bool `json:"required,omitempty"`
+}
+
+// ZoneTemplate is a reusable set of zones for one document layout, such
+// as a supplier's invoice.
+type ZoneTemplate struct {
+	Name  string `json:"name,omitempty"`
+	Zones []Zone `json:"zones"`
+}
+
+// ParseZoneTemplate reads a template from JSON and validates it.
+func ParseZoneTemplate(data []byte) (*ZoneTemplate, error) {
+	var t ZoneTemplate
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidZoneTemplate, err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Validate checks that zones are named uniquely and have a page, a size,
+// a known type and a valid pattern.
+func (t *ZoneTemplate) Validate() error {
+	if t == nil || len(t.Zones) == 0 {
+		return fmt.Errorf("%w: no zones", ErrInvalidZoneTemplate)
+	}
+	names := map[string]bool{}
+	for i, z := range t.Zones {
+		switch {
+		case z.Name == "":
+			return fmt.Errorf("%w: zone %d has no name", ErrInvalidZoneTemplate, i+1)
+		case names[z.Name]:
+			return fmt.Errorf("%w: zone %q is defined twice", ErrInvalidZoneTemplate, z.Name)
+		case z.Page < 1:
+			return fmt.Errorf("%w: zone %q: page must be at least 1", ErrInvalidZoneTemplate, z.Name)
+		case z.X < 0 || z.Y < 0 || z.Width <= 0 || z.Height <= 0:
+			return fmt.Errorf("%w: zone %q: position must not be negative and size must be positive", ErrInvalidZoneTemplate, z.Name)
+		}
+		names[z.Name] = true
+		switch z.Type {
+		case "", ZoneText, ZoneInteger, ZoneNumber, ZoneDate:
+		default:
+			return fmt.Errorf("%w: zone %q: unknown type %q", ErrInvalidZoneTemplate, z.Name, z.Type)
+		}
+		if _, err := regexp.Compile(z.Pattern); err != nil {
+			return fmt.Errorf("%w: zone %q: %v", ErrInvalidZoneTemplate, z.Name, err)
+		}
+	}
+	return nil
+}
+
+// ZoneValue is the value read from one zone.
+type ZoneValue struct {
+	Name string `json:"name"`
+	Page int    `json:"page"`
+	// Text is the zone's text before parsing.
+	Text string `json:"text"`
+	// Value is a string, int64, float64 or time.Time depending on the
+	// zone's type, or nil when the zone is empty or invalid.
+	Value  any        `json:"value,omitempty"`
+	Method TextMethod `json:"method"`
+	// Confidence is 100 for text layer values and the mean word
+	// confidence for OCR values.
+	Confidence float64 `json:"confidence"`
+	Valid      bool    `json:"valid"`
+	// Error says why the value is invalid.
+	Error string `json:"error,omitempty"`
+}
+
+// ZoneExtraction is the result of ExtractZones.
+type ZoneExtraction struct {
+	Template string      `json:"template,omitempty"`
+	Values   []ZoneValue `json:"values"`
+}
+
+// Valid reports whether every zone's value is valid.
+func (z *ZoneExtraction) Valid() bool {
+	for _, v := range z.Values {
+		if !v.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// Value returns the value of the named zone.
+func (z *ZoneExtraction) Value(name string) (ZoneValue, bool) {
+	for _, v := range z.Values {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return ZoneValue{}, false
+}
+
+func (s *textService) ExtractZones(ctx context.Context, input []byte, tmpl *ZoneTemplate, opts *TextExtractionOptions) (*ZoneExtraction, error) {
+	ctx, span := startSpan(ctx, "TextService.ExtractZones", AttrInputBytes.Int(len(input)))
+	result, err := s.extractZones(ctx, input, tmpl, opts)
+	if result != nil {
+		span.SetAttributes(attribute.Int("zones.count", len(result.Values)), attribute.Bool("zones.valid", result.Valid()))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+// zonePage is what extractZones keeps about a page between zones.
+type zonePage struct {
+	runs    []textRun
+	display matrix
+	height  float64
+	image   bool
+	// render is the page rendered for OCR, once needed.
+	render image.Image
+}
+
+func (s *textService) extractZones(ctx context.Context, input []byte, tmpl *ZoneTemplate, opts *TextExtractionOptions) (*ZoneExtraction, error) {
+	if err := tmpl.Validate(); err != nil {
+		return nil, err
+	}
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	ocrOpts, err := o.OCROptions.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("TextService.ExtractZones called", logger.String("template", tmpl.Name), logger.Int("zones", len(tmpl.Zones)))
+
+	pdfCtx, err := readContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpDir string
+	defer func() {
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+
+	fonts := map[int]*pdfFont{}
+	pages := map[int]*zonePage{}
+	result := &ZoneExtraction{Template: tmpl.Name}
+	for _, z := range tmpl.Zones {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if z.Page > pdfCtx.PageCount {
+			return nil, fmt.Errorf("zone %q: page %d is beyond the last page (%d)", z.Name, z.Page, pdfCtx.PageCount)
+		}
+
+		page := pages[z.Page]
+		if page == nil {
+			page = &zonePage{}
+			if page.runs, err = pageTextRuns(pdfCtx, z.Page, fonts); err != nil {
+				return nil, fmt.Errorf("page %d: %w", z.Page, err)
+			}
+			_, _, inh, err := pdfCtx.PageDict(z.Page, false)
+			if err != nil {
+				return nil, err
+			}
+			page.display, _, page.height = displayMatrix(visibleBox(inh), normalizedRotation(inh.Rotate))
+			marks, err := pageMarks(pdfCtx, z.Page)
+			if err != nil {
+				return nil, fmt.Errorf("page %d: %w", z.Page, err)
+			}
+			page.image = marks.image
+			pages[z.Page] = page
+		}
+
+		value := ZoneValue{Name: z.Name, Page: z.Page, Method: TextMethodNone}
+		text := zoneText(z.Page, page, z)
+		switch {
+		case o.OCR != TextOCRAlways && meaningfulText(text, 1):
+			value.Text, value.Method, value.Confidence = text, TextMethodPDF, 100
+		case o.OCR == TextOCRNever || (o.OCR == TextOCRAuto && !page.image):
+			value.Text = text
+		default:
+			if page.render == nil {
+				if tmpDir == "" {
+					if tmpDir, err = os.MkdirTemp("", "zones-*"); err != nil {
+						return nil, err
+					}
+				}
+				if page.render, err = s.renderZonePage(ctx, input, tmpDir, z.Page, ocrOpts.DPI); err != nil {
+					return nil, err
+				}
+			}
+			if value.Text, value.Confidence, err = s.ocrZone(ctx, page.render, z, &ocrOpts); err != nil {
+				return nil, fmt.Errorf("zone %q: %w", z.Name, err)
+			}
+			value.Method = TextMethodOCR
+		}
+
+		value.Value, value.Error = parseZoneValue(z, value.Text)
+		value.Valid = value.Error == ""
+		result.Values = append(result.Values, value)
+	}
+
+	invalid := 0
+	for _, v := range result.Values {
+		if !v.Valid {
+			invalid++
+		}
+	}
+	s.log.Info("Zones extracted", logger.Int("zones", len(result.Values)), logger.Int("invalid", invalid))
+	return result, nil
+}
+
+// zoneText returns the text of the glyphs whose centres lie in the zone.
+func zoneText(pageNr int, page *zonePage, z Zone) string {
+	// The zone in display space, whose origin is the bottom left corner.
+	x0, x1 := z.X, z.X+z.Width
+	y0, y1 := page.height-z.Y-z.Height, page.height-z.Y
+
+	var parts []textRun
+	for _, r := range page.runs {
+		var part *textRun
+		for _, c := range r.Chars {
+			x, y := page.display.apply(c.X+c.Width/2, c.Y+r.Size*0.3)
+			if x < x0 || x > x1 || y < y0 || y > y1 {
+				part = nil
+				continue
+			}
+			if part == nil {
+				parts = append(parts, textRun{X: c.X, Y: r.Y, Size: r.Size, Font: r.Font})
+				part = &parts[len(parts)-1]
+			}
+			part.Text += c.Text
+			part.Width = c.X + c.Width - part.X
+		}
+	}
+
+	lines := groupTextLines(pageNr, parts)
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// renderZonePage renders a page as a grayscale PNG with the OCR
+// service's renderer and decodes it.
+func (s *textService) renderZonePage(ctx context.Context, input []byte, tmpDir string, page, dpi int) (image.Image, error) {
+	renderer := rendererOf(s.ocr)
+	if !renderer.Available() {
+		return nil, fmt.Errorf("dependencies missing: page renderer %q is not available", renderer.Name())
+	}
+	inputPath := filepath.Join(tmpDir, "input.pdf")
+	if _, err := os.Stat(inputPath); err != nil {
+		if err := writeFile(ctx, inputPath, input); err != nil {
+			return nil, err
+		}
+	}
+	data, err := renderer.RenderPage(ctx, inputPath, page, dpi, "png", true)
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// ocrZone recognises the part of a rendered page covered by a zone. A
+// zone is a single block of text, so unless set otherwise Tesseract's
+// page segmentation is told as much.
+func (s *textService) ocrZone(ctx context.Context, render image.Image, z Zone, opts *OCROptions) (string, float64, error) {
+	scale := float64(opts.DPI) / 72
+	rect := image.Rect(
+		int(math.Floor(z.X*scale)), int(math.Floor(z.Y*scale)),
+		int(math.Ceil((z.X+z.Width)*scale)), int(math.Ceil((z.Y+z.Height)*scale)),
+	).Intersect(render.Bounds())
+	if rect.Empty() {
+		return "", 0, nil
+	}
+	sub, ok := render.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return "", 0, fmt.Errorf("cannot crop %T", render)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, sub.SubImage(rect)); err != nil {
+		return "", 0, err
+	}
+
+	zoneOpts := *opts
+	zoneOpts.Pages, zoneOpts.Progress = "", nil
+	if zoneOpts.PSM == 0 {
+		zoneOpts.PSM = 6
+	}
+	recognised, err := s.ocr.Recognize(ctx, buf.Bytes(), &zoneOpts)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(recognised.Pages) == 0 {
+		return "", 0, nil
+	}
+	return strings.TrimSpace(recognised.Text()), recognised.Pages[0].MeanConfidence, nil
+}
+
+// parseZoneValue checks text against the zone's pattern and type,
+// returning the typed value or why it is invalid.
+func parseZoneValue(z Zone, text string) (any, string) {
+	value := strings.TrimSpace(text)
+	if z.Pattern != "" && value != "" {
+		m := regexp.MustCompile(z.Pattern).FindStringSubmatch(value)
+		switch {
+		case m == nil:
+			return nil, fmt.Sprintf("%q does not match %q", value, z.Pattern)
+		case len(m) > 1:
+			value = m[1]
+		default:
+			value = m[0]
+		}
+	}
+	if value == "" {
+		if z.Required {
+			return nil, "required value is missing"
+		}
+		return nil, ""
+	}
+
+	switch z.Type {
+	case ZoneInteger:
+		f, err := parseNumber(value)
+		if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+			return nil, fmt.Sprintf("%q is not a whole number", value)
+		}
+		return int64(f), ""
+	case ZoneNumber:
+		f, err := parseNumber(value)
+		if err != nil {
+			return nil, fmt.Sprintf("%q is not a number", value)
+		}
+		return f, ""
+	case ZoneDate:
+		layouts := z.DateLayouts
+		if len(layouts) == 0 {
+			layouts = DefaultDateLayouts
+		}
+		value = strings.Join(strings.Fields(value), " ")
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, ""
+			}
+		}
+		return nil, fmt.Sprintf("%q is not a date", value)
+	}
+	return value, ""
+}
+
+// parseNumber reads a number written with any common separators,
+// ignoring currency symbols, units and spaces. When both "," and "."
+// appear the later one is the decimal separator; a lone "," is decimal
+// unless exactly three digits follow it.
+func parseNumber(s string) (float64, error) {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) || r == '.' || r == ',' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	n := b.String()
+	dot, comma := strings.LastIndex(n, "."), strings.LastIndex(n, ",")
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		n = strings.ReplaceAll(strings.ReplaceAll(n, ".", ""), ",", ".")
+	case dot >= 0 && comma >= 0:
+		n = strings.ReplaceAll(n, ",", "")
+	case comma >= 0 && strings.Count(n, ",") == 1 && len(n)-comma-1 != 3:
+		n = strings.ReplaceAll(n, ",", ".")
+	case comma >= 0:
+		n = strings.ReplaceAll(n, ",", "")
+	case strings.Count(n, ".") > 1:
+		n = strings.ReplaceAll(n, ".", "")
+	}
+	return strconv.ParseFloat(n, 64)
+}
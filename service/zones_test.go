@@ -0,0 +1,154 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// invoicePDF returns an A4 page with labelled fields, and the zone
+// covering the value after each label, in points from the top left.
+func invoicePDF(t *testing.T) ([]byte, map[string]service.Zone) {
+	t.Helper()
+	pdf := gofpdf.New("P", "pt", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddPage()
+
+	zones := map[string]service.Zone{}
+	fields := []struct{ name, label, value string }{
+		{"invoice_no", "Invoice No: ", "INV-1042"},
+		{"date", "Date: ", "05.03.2026"},
+		{"total", "Total: ", "1.234,50 EUR"},
+		{"quantity", "Quantity: ", "12"},
+		{"reference", "Reference: ", "abc"},
+	}
+	for i, f := range fields {
+		y := 100 + float64(i)*30
+		pdf.Text(50, y, f.label+f.value)
+		x := 50 + pdf.GetStringWidth(f.label)
+		zones[f.name] = service.Zone{Name: f.name, Page: 1, X: x - 2, Y: y - 14, Width: pdf.GetStringWidth(f.value) + 4, Height: 20}
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), zones
+}
+
+func TestParseZoneTemplate(t *testing.T) {
+	tmpl := service.ZoneTemplate{Name: "acme", Zones: []service.Zone{
+		{Name: "invoice_no", Page: 1, X: 400, Y: 60, Width: 150, Height: 20, Pattern: `INV-\d+`, Required: true},
+		{Name: "total", Page: 2, X: 400, Y: 700, Width: 100, Height: 20, Type: service.ZoneNumber},
+	}}
+	data, err := json.Marshal(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := service.ParseZoneTemplate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*parsed, tmpl) {
+		t.Errorf("round trip = %+v", *parsed)
+	}
+
+	for _, bad := range []string{
+		`{"zones": []}`,
+		`{"zones": [{"name": "a", "page": 1, "width": 10, "height": 10}, {"name": "a", "page": 1, "width": 10, "height": 10}]}`,
+		`{"zones": [{"name": "a", "page": 0, "width": 10, "height": 10}]}`,
+		`{"zones": [{"name": "a", "page": 1, "width": 0, "height": 10}]}`,
+		`{"zones": [{"name": "a", "page": 1, "width": 10, "height": 10, "type": "money"}]}`,
+		`{"zones": [{"name": "a", "page": 1, "width": 10, "height": 10, "pattern": "("}]}`,
+		`{"zones": [{"name": "a", "page": 1, "width": 10, "height": 10, "colour": "red"}]}`,
+	} {
+		if _, err := service.ParseZoneTemplate([]byte(bad)); !errors.Is(err, service.ErrInvalidZoneTemplate) {
+			t.Errorf("%s: got %v", bad, err)
+		}
+	}
+}
+
+func TestTextService_ExtractZones(t *testing.T) {
+	textService := service.NewTextService(getTestLogger())
+	input, zones := invoicePDF(t)
+
+	invoiceNo := zones["invoice_no"]
+	invoiceNo.Pattern, invoiceNo.Required = `INV-(\d+)`, true
+	date := zones["date"]
+	date.Type = service.ZoneDate
+	total := zones["total"]
+	total.Type = service.ZoneNumber
+	quantity := zones["quantity"]
+	quantity.Type = service.ZoneInteger
+	reference := zones["reference"]
+	reference.Type = service.ZoneInteger
+	empty := service.Zone{Name: "signature", Page: 1, X: 50, Y: 600, Width: 200, Height: 40, Required: true}
+	tmpl := &service.ZoneTemplate{Name: "acme", Zones: []service.Zone{invoiceNo, date, total, quantity, reference, empty}}
+
+	result, err := textService.ExtractZones(t.Context(), input, tmpl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"invoice_no": "1042",
+		"date":       time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC),
+		"total":      1234.5,
+		"quantity":   int64(12),
+	}
+	for name, value := range want {
+		v, ok := result.Value(name)
+		if !ok || !v.Valid || !reflect.DeepEqual(v.Value, value) || v.Method != service.TextMethodPDF || v.Confidence != 100 {
+			t.Errorf("%s = %+v, want %v", name, v, value)
+		}
+	}
+	if v, _ := result.Value("reference"); v.Valid || v.Text != "abc" {
+		t.Errorf("reference = %+v, want invalid integer", v)
+	}
+	// An empty zone on a page without images is not sent to OCR.
+	if v, _ := result.Value("signature"); v.Valid || v.Method != service.TextMethodNone {
+		t.Errorf("signature = %+v, want missing", v)
+	}
+	if result.Valid() {
+		t.Error("result with invalid zones reported valid")
+	}
+
+	// Zones are measured on the page as displayed.
+	rotated, err := service.NewRotateService(getTestLogger()).RotateBytes(input, 90, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const height = 841.89
+	z := zones["invoice_no"]
+	z.X, z.Y, z.Width, z.Height = height-z.Y-z.Height, z.X, z.Height, z.Width
+	result, err = textService.ExtractZones(t.Context(), rotated, &service.ZoneTemplate{Zones: []service.Zone{z}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := result.Values[0]; v.Text != "INV-1042" {
+		t.Errorf("rotated page: %+v", v)
+	}
+
+	if _, err := textService.ExtractZones(t.Context(), input, &service.ZoneTemplate{Zones: []service.Zone{{Name: "x", Page: 2, Width: 1, Height: 1}}}, nil); err == nil {
+		t.Error("expected error for a zone beyond the last page")
+	}
+}
+
+func TestTextService_ExtractZonesOCR(t *testing.T) {
+	ocrService := fakeOCRService(fakeOCREngine("fake"))
+	textService := service.NewTextServiceWithOCR(getTestLogger(), ocrService)
+
+	tmpl := &service.ZoneTemplate{Zones: []service.Zone{{Name: "greeting", Page: 2, X: 100, Y: 100, Width: 200, Height: 50}}}
+	result, err := textService.ExtractZones(t.Context(), mixedPDF(t), tmpl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := result.Values[0]; v.Method != service.TextMethodOCR || v.Value != "Hello world" || v.Confidence != 68 {
+		t.Errorf("scanned zone = %+v", v)
+	}
+}
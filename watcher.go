@@ -0,0 +1,406 @@
+package pdfsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+// WatchFolder is an inbox whose files are run through a named pipeline.
+// Done, Error, Output and the hidden .processing directory default to
+// subdirectories of Inbox.
+type WatchFolder struct {
+	Inbox    string
+	Pipeline string
+	Done     string
+	Error    string
+	// Output receives the documents produced by the pipeline.
+	Output string
+	// Extensions limits which files are picked up; all files when empty.
+	Extensions []string
+}
+
+type WatcherConfig struct {
+	Folders   []WatchFolder
+	Pipelines map[string]*service.Pipeline
+	// PollInterval is how often inboxes are scanned.
+	PollInterval time.Duration
+	// StableFor is how long a file's size and modification time must stay
+	// unchanged before it is treated as fully written.
+	StableFor time.Duration
+	// MaxConcurrent and MemoryBudget size the WorkerPool that admits files,
+	// each weighted by its size.
+	MaxConcurrent int
+	MemoryBudget  int64
+	// OnReport is called after each file is finished.
+	OnReport func(*WatchReport)
+}
+
+func DefaultWatcherConfig() *WatcherConfig {
+	return &WatcherConfig{
+		PollInterval:  2 * time.Second,
+		StableFor:     2 * time.Second,
+		MaxConcurrent: 4,
+	}
+}
+
+type WatchStatus string
+
+const (
+	WatchStatusDone  WatchStatus = "done"
+	WatchStatusError WatchStatus = "error"
+)
+
+// WatchReport is written as a JSON sidecar next to the moved input.
+type WatchReport struct {
+	Input      string        `json:"input"`
+	Pipeline   string        `json:"pipeline"`
+	Status     WatchStatus   `json:"status"`
+	InputSize  int64         `json:"input_size"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration_ns"`
+	Outputs    []WatchOutput `json:"outputs,omitempty"`
+	Steps      []WatchStep   `json:"steps,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Path is where the input was moved to.
+	Path string `json:"path"`
+}
+
+type WatchOutput struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type WatchStep struct {
+	Type            string        `json:"type"`
+	Duration        time.Duration `json:"duration_ns"`
+	InputDocuments  int           `json:"input_documents"`
+	OutputDocuments int           `json:"output_documents"`
+	OutputBytes     int64         `json:"output_bytes"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// Watcher polls inbox directories and processes files once they have
+// finished being written. Claimed files are moved into a .processing
+// directory, so files interrupted by a crash are returned to the inbox and
+// processed again on the next start.
+type Watcher struct {
+	cfg     WatcherConfig
+	folders []WatchFolder
+	pool    *WorkerPool
+
+	mu     sync.Mutex
+	seen   map[string]fileState
+	active sync.WaitGroup
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// NewWatcher validates cfg and creates the folders it uses.
+func NewWatcher(cfg *WatcherConfig) (*Watcher, error) {
+	c := *DefaultWatcherConfig()
+	if cfg != nil {
+		c = *cfg
+		defaults := DefaultWatcherConfig()
+		if c.PollInterval <= 0 {
+			c.PollInterval = defaults.PollInterval
+		}
+		if c.StableFor <= 0 {
+			c.StableFor = defaults.StableFor
+		}
+		if c.MaxConcurrent <= 0 {
+			c.MaxConcurrent = defaults.MaxConcurrent
+		}
+	}
+	if len(c.Folders) == 0 {
+		return nil, errors.New("watcher: no folders configured")
+	}
+
+	w := &Watcher{
+		cfg: c,
+		pool: NewWorkerPoolWithConfig(&WorkerPoolConfig{
+			MaxWorkers:   c.MaxConcurrent,
+			MemoryBudget: c.MemoryBudget,
+		}),
+		seen: make(map[string]fileState),
+	}
+
+	for _, f := range c.Folders {
+		if f.Inbox == "" {
+			return nil, errors.New("watcher: folder has no inbox")
+		}
+		p, ok := c.Pipelines[f.Pipeline]
+		if !ok {
+			return nil, fmt.Errorf("watcher: %s: unknown pipeline %q", f.Inbox, f.Pipeline)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("watcher: pipeline %q: %w", f.Pipeline, err)
+		}
+
+		f.Inbox = filepath.Clean(f.Inbox)
+		if f.Done == "" {
+			f.Done = filepath.Join(f.Inbox, "done")
+		}
+		if f.Error == "" {
+			f.Error = filepath.Join(f.Inbox, "error")
+		}
+		if f.Output == "" {
+			f.Output = filepath.Join(f.Inbox, "output")
+		}
+		for _, dir := range []string{f.Inbox, f.Done, f.Error, f.Output, processingDir(f)} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+		w.folders = append(w.folders, f)
+	}
+	return w, nil
+}
+
+// Pool returns the WorkerPool that limits how many files run at once.
+func (w *Watcher) Pool() *WorkerPool {
+	return w.pool
+}
+
+// Run recovers interrupted files, then watches until ctx is done. Files
+// already being processed are allowed to finish before Run returns. A
+// priority set on ctx with WithPriority applies to every file.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.Recover(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	defer w.active.Wait()
+
+	for {
+		w.Scan(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recover moves files left in .processing by an earlier run back into
+// their inbox.
+func (w *Watcher) Recover() error {
+	for _, f := range w.folders {
+		entries, err := os.ReadDir(processingDir(f))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			from := filepath.Join(processingDir(f), e.Name())
+			if err := os.Rename(from, uniquePath(f.Inbox, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Scan checks every inbox once and starts processing files that are stable.
+// It blocks while the pool is full.
+func (w *Watcher) Scan(ctx context.Context) {
+	now := time.Now()
+	for _, f := range w.folders {
+		for _, path := range w.readyFiles(f, now) {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			weight := Weight{Bytes: info.Size()}
+			if err := w.pool.Acquire(ctx, weight, PriorityFromContext(ctx)); err != nil {
+				return
+			}
+
+			claimed := filepath.Join(processingDir(f), filepath.Base(path))
+			if err := os.Rename(path, claimed); err != nil {
+				w.pool.Release(weight)
+				continue
+			}
+
+			w.active.Add(1)
+			go func(f WatchFolder, claimed string, size int64) {
+				defer w.active.Done()
+				defer w.pool.Release(weight)
+				w.process(ctx, f, claimed, size)
+			}(f, claimed, info.Size())
+		}
+	}
+}
+
+func (w *Watcher) readyFiles(f WatchFolder, now time.Time) []string {
+	entries, err := os.ReadDir(f.Inbox)
+	if err != nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var ready []string
+	present := make(map[string]bool)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") || !matchesExtension(name, f.Extensions) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(f.Inbox, name)
+		present[path] = true
+		prev, ok := w.seen[path]
+		if !ok || prev.size != info.Size() || !prev.modTime.Equal(info.ModTime()) {
+			w.seen[path] = fileState{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if now.Sub(prev.since) >= w.cfg.StableFor {
+			ready = append(ready, path)
+			delete(w.seen, path)
+		}
+	}
+
+	for path := range w.seen {
+		if filepath.Dir(path) == f.Inbox && !present[path] {
+			delete(w.seen, path)
+		}
+	}
+	sort.Strings(ready)
+	return ready
+}
+
+// process runs the folder's pipeline on a claimed file. It is detached from
+// the watcher's context so shutdown does not turn in-flight files into
+// failures.
+func (w *Watcher) process(ctx context.Context, f WatchFolder, claimed string, size int64) {
+	ctx = context.WithoutCancel(ctx)
+	name := filepath.Base(claimed)
+	report := &WatchReport{
+		Input:     filepath.Join(f.Inbox, name),
+		Pipeline:  f.Pipeline,
+		InputSize: size,
+		StartedAt: time.Now(),
+	}
+
+	outputs, err := w.runPipeline(ctx, f, claimed, report)
+	report.Outputs = outputs
+	report.FinishedAt = time.Now()
+	report.Duration = report.FinishedAt.Sub(report.StartedAt)
+
+	dest := f.Done
+	report.Status = WatchStatusDone
+	if err != nil {
+		dest = f.Error
+		report.Status = WatchStatusError
+		report.Error = err.Error()
+	}
+
+	report.Path = uniquePath(dest, name)
+	if err := os.Rename(claimed, report.Path); err != nil {
+		report.Status = WatchStatusError
+		report.Error = fmt.Sprintf("move input: %v", err)
+		report.Path = claimed
+	}
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		_ = os.WriteFile(report.Path+".json", data, 0644)
+	}
+
+	if w.cfg.OnReport != nil {
+		w.cfg.OnReport(report)
+	}
+}
+
+func (w *Watcher) runPipeline(ctx context.Context, f WatchFolder, claimed string, report *WatchReport) ([]WatchOutput, error) {
+	data, err := os.ReadFile(claimed)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := w.cfg.Pipelines[f.Pipeline].Run(ctx, service.Document{Name: filepath.Base(claimed), Data: data})
+	if result != nil {
+		for _, s := range result.Steps {
+			step := WatchStep{
+				Type:            s.Type,
+				Duration:        s.Duration,
+				InputDocuments:  s.InputDocuments,
+				OutputDocuments: s.OutputDocuments,
+				OutputBytes:     s.OutputBytes,
+			}
+			if s.Error != nil {
+				step.Error = s.Error.Error()
+			}
+			report.Steps = append(report.Steps, step)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []WatchOutput
+	for _, doc := range result.Documents {
+		path := uniquePath(f.Output, filepath.Base(doc.Name))
+		if err := os.WriteFile(path, doc.Data, 0644); err != nil {
+			return outputs, err
+		}
+		outputs = append(outputs, WatchOutput{Path: path, Size: int64(len(doc.Data))})
+	}
+	return outputs, nil
+}
+
+func processingDir(f WatchFolder) string {
+	return filepath.Join(f.Inbox, ".processing")
+}
+
+func matchesExtension(name string, extensions []string) bool {
+	if len(extensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(name)
+	for _, e := range extensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniquePath returns dir/name, or dir/name-N.ext if that already exists.
+func uniquePath(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		path = filepath.Join(dir, base+"-"+strconv.Itoa(i)+ext)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package pdfsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pdfsdk "github.com/infosec554/convert-pdf-go-sdk"
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func upperPipeline(sdk *pdfsdk.SDK) *service.Pipeline {
+	return sdk.Pipeline().Then(service.StepFunc{
+		Name: "upper",
+		Fn: func(ctx context.Context, svc service.PDFService, docs []service.Document) ([]service.Document, error) {
+			var out []service.Document
+			for _, d := range docs {
+				if strings.Contains(string(d.Data), "fail") {
+					return nil, errors.New("bad document")
+				}
+				out = append(out, service.Document{Name: "upper-" + d.Name, Data: []byte(strings.ToUpper(string(d.Data)))})
+			}
+			return out, nil
+		},
+	})
+}
+
+func newTestWatcher(t *testing.T, inbox string, reports *[]*pdfsdk.WatchReport, mu *sync.Mutex) *pdfsdk.Watcher {
+	t.Helper()
+	sdk := pdfsdk.New("http://localhost:3000")
+	t.Cleanup(sdk.Close)
+
+	w, err := pdfsdk.NewWatcher(&pdfsdk.WatcherConfig{
+		Folders:      []pdfsdk.WatchFolder{{Inbox: inbox, Pipeline: "upper"}},
+		Pipelines:    map[string]*service.Pipeline{"upper": upperPipeline(sdk)},
+		PollInterval: 5 * time.Millisecond,
+		StableFor:    20 * time.Millisecond,
+		OnReport: func(r *pdfsdk.WatchReport) {
+			mu.Lock()
+			*reports = append(*reports, r)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func runWatcherUntil(t *testing.T, w *pdfsdk.Watcher, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- w.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("watcher did not finish in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherProcessesFiles(t *testing.T) {
+	inbox := t.TempDir()
+	var mu sync.Mutex
+	var reports []*pdfsdk.WatchReport
+	w := newTestWatcher(t, inbox, &reports, &mu)
+
+	os.WriteFile(filepath.Join(inbox, "good.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(inbox, "bad.txt"), []byte("fail"), 0644)
+
+	runWatcherUntil(t, w, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reports) == 2
+	})
+
+	out, err := os.ReadFile(filepath.Join(inbox, "output", "upper-good.txt"))
+	if err != nil || string(out) != "HELLO" {
+		t.Errorf("output = %q, %v", out, err)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "done", "good.txt")); err != nil {
+		t.Errorf("input not moved to done: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "error", "bad.txt")); err != nil {
+		t.Errorf("input not moved to error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(inbox, "error", "bad.txt.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report pdfsdk.WatchReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != pdfsdk.WatchStatusError || report.Error == "" || report.Pipeline != "upper" {
+		t.Errorf("sidecar report = %+v", report)
+	}
+}
+
+func TestWatcherWaitsForStableSize(t *testing.T) {
+	inbox := t.TempDir()
+	var mu sync.Mutex
+	var reports []*pdfsdk.WatchReport
+	w := newTestWatcher(t, inbox, &reports, &mu)
+
+	path := filepath.Join(inbox, "growing.txt")
+	os.WriteFile(path, []byte("part"), 0644)
+	w.Scan(context.Background())
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("file claimed before its size was stable")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	w.Scan(context.Background())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("stable file was not claimed")
+	}
+}
+
+func TestWatcherRecoversInterruptedFiles(t *testing.T) {
+	inbox := t.TempDir()
+	processing := filepath.Join(inbox, ".processing")
+	os.MkdirAll(processing, 0755)
+	os.WriteFile(filepath.Join(processing, "left.txt"), []byte("again"), 0644)
+
+	var mu sync.Mutex
+	var reports []*pdfsdk.WatchReport
+	w := newTestWatcher(t, inbox, &reports, &mu)
+
+	runWatcherUntil(t, w, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reports) == 1
+	})
+
+	if reports[0].Status != pdfsdk.WatchStatusDone {
+		t.Errorf("report = %+v", reports[0])
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "output", "upper-left.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewWatcherUnknownPipeline(t *testing.T) {
+	_, err := pdfsdk.NewWatcher(&pdfsdk.WatcherConfig{
+		Folders: []pdfsdk.WatchFolder{{Inbox: t.TempDir(), Pipeline: "missing"}},
+	})
+	if err == nil {
+		t.Error("expected error for unknown pipeline")
+	}
+}
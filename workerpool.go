@@ -0,0 +1,345 @@
+package pdfsdk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority orders queued work in the WorkerPool. Higher classes are
+// admitted more often, but lower classes are never starved.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = 3
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// priorityStride sets each class's share of admissions: high is admitted
+// four times as often as low when both are waiting.
+var priorityStride = [numPriorities]uint64{PriorityLow: 4, PriorityNormal: 2, PriorityHigh: 1}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose SDK operations are queued with p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by WithPriority, or PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p.normalize()
+	}
+	return PriorityNormal
+}
+
+func (p Priority) normalize() Priority {
+	if p < PriorityLow {
+		return PriorityLow
+	}
+	if p > PriorityHigh {
+		return PriorityHigh
+	}
+	return p
+}
+
+// Weight is the cost of a job: worker slots and an estimate of the memory
+// it holds. The zero Weight is one slot and no bytes.
+type Weight struct {
+	Slots int
+	Bytes int64
+}
+
+type WorkerPoolConfig struct {
+	MaxWorkers int
+	// MemoryBudget caps the sum of Weight.Bytes admitted at once; 0 disables it.
+	// A job larger than the budget is admitted once no other memory is in use.
+	MemoryBudget int64
+	// MaxQueueDepth is the number of jobs allowed to wait; beyond it Acquire
+	// fails with ErrWorkerPoolFull. 0 means unlimited.
+	MaxQueueDepth int
+}
+
+type WorkerPool struct {
+	mu           sync.Mutex
+	maxWorkers   int
+	memoryBudget int64
+	maxQueue     int
+
+	active     int
+	bytesInUse int64
+	processed  int64
+	rejected   int64
+
+	queues  [numPriorities][]*poolWaiter
+	pass    [numPriorities]uint64
+	vtime   uint64
+	queued  int
+	waits   int64
+	waitSum time.Duration
+	waitMax time.Duration
+}
+
+type poolWaiter struct {
+	weight   Weight
+	priority Priority
+	enqueued time.Time
+	ready    chan struct{}
+}
+
+func NewWorkerPool(maxWorkers int) *WorkerPool {
+	return NewWorkerPoolWithConfig(&WorkerPoolConfig{MaxWorkers: maxWorkers})
+}
+
+func NewWorkerPoolWithConfig(cfg *WorkerPoolConfig) *WorkerPool {
+	if cfg == nil {
+		cfg = &WorkerPoolConfig{}
+	}
+	maxWorkers := cfg.MaxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = 10
+	}
+	return &WorkerPool{
+		maxWorkers:   maxWorkers,
+		memoryBudget: cfg.MemoryBudget,
+		maxQueue:     cfg.MaxQueueDepth,
+	}
+}
+
+// Acquire blocks until w fits in the pool, ctx is done, or the queue is
+// full. Each successful Acquire must be paired with Release(w).
+func (wp *WorkerPool) Acquire(ctx context.Context, w Weight, p Priority) error {
+	w = wp.normalize(w)
+	p = p.normalize()
+
+	wp.mu.Lock()
+	if wp.queued == 0 && wp.fits(w) {
+		wp.take(w, 0)
+		wp.mu.Unlock()
+		return nil
+	}
+	if wp.maxQueue > 0 && wp.queued >= wp.maxQueue {
+		wp.rejected++
+		wp.mu.Unlock()
+		return ErrWorkerPoolFull
+	}
+
+	waiter := &poolWaiter{weight: w, priority: p, enqueued: time.Now(), ready: make(chan struct{})}
+	if len(wp.queues[p]) == 0 && wp.pass[p] < wp.vtime {
+		wp.pass[p] = wp.vtime
+	}
+	wp.queues[p] = append(wp.queues[p], waiter)
+	wp.queued++
+	wp.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	select {
+	case <-waiter.ready:
+		// Admitted while giving up; hand the capacity back.
+		wp.release(w)
+	default:
+		wp.remove(waiter)
+		wp.dispatch()
+	}
+	return ctx.Err()
+}
+
+// TryAcquire admits w only if it fits now and nobody is queued ahead of it.
+func (wp *WorkerPool) TryAcquire(w Weight) bool {
+	w = wp.normalize(w)
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if wp.queued > 0 || !wp.fits(w) {
+		return false
+	}
+	wp.take(w, 0)
+	return true
+}
+
+func (wp *WorkerPool) Release(w Weight) {
+	w = wp.normalize(w)
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.release(w)
+	wp.processed++
+}
+
+// giveBack frees w like Release but does not count a processed job, for
+// slots lent to an operation that is already counted.
+func (wp *WorkerPool) giveBack(w Weight) {
+	w = wp.normalize(w)
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.release(w)
+}
+
+// Do runs fn while holding w.
+func (wp *WorkerPool) Do(ctx context.Context, w Weight, p Priority, fn func() error) error {
+	if err := wp.Acquire(ctx, w, p); err != nil {
+		return err
+	}
+	defer wp.Release(w)
+	return fn()
+}
+
+func (wp *WorkerPool) Stats() (active, maxWorkers int, processed int64) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return wp.active, wp.maxWorkers, wp.processed
+}
+
+func (wp *WorkerPool) Available() int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return wp.maxWorkers - wp.active
+}
+
+type WorkerPoolStats struct {
+	Active        int
+	MaxWorkers    int
+	Processed     int64
+	Queued        int
+	QueuedByClass map[Priority]int
+	Rejected      int64
+	BytesInUse    int64
+	MemoryBudget  int64
+	// Admitted counts every successful Acquire; QueueWait is the total
+	// time those jobs spent queued.
+	Admitted     int64
+	QueueWait    time.Duration
+	MaxQueueWait time.Duration
+}
+
+// AverageQueueWait is the mean time an admitted job waited for capacity.
+func (s WorkerPoolStats) AverageQueueWait() time.Duration {
+	if s.Admitted == 0 {
+		return 0
+	}
+	return s.QueueWait / time.Duration(s.Admitted)
+}
+
+func (wp *WorkerPool) Snapshot() WorkerPoolStats {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	byClass := make(map[Priority]int, numPriorities)
+	for p := range wp.queues {
+		byClass[Priority(p)] = len(wp.queues[p])
+	}
+	return WorkerPoolStats{
+		Active:        wp.active,
+		MaxWorkers:    wp.maxWorkers,
+		Processed:     wp.processed,
+		Queued:        wp.queued,
+		QueuedByClass: byClass,
+		Rejected:      wp.rejected,
+		BytesInUse:    wp.bytesInUse,
+		MemoryBudget:  wp.memoryBudget,
+		Admitted:      wp.waits,
+		QueueWait:     wp.waitSum,
+		MaxQueueWait:  wp.waitMax,
+	}
+}
+
+func (wp *WorkerPool) normalize(w Weight) Weight {
+	if w.Slots <= 0 {
+		w.Slots = 1
+	}
+	if w.Slots > wp.maxWorkers {
+		w.Slots = wp.maxWorkers
+	}
+	if w.Bytes < 0 {
+		w.Bytes = 0
+	}
+	return w
+}
+
+func (wp *WorkerPool) fits(w Weight) bool {
+	if wp.active+w.Slots > wp.maxWorkers {
+		return false
+	}
+	if wp.memoryBudget > 0 && wp.bytesInUse > 0 && wp.bytesInUse+w.Bytes > wp.memoryBudget {
+		return false
+	}
+	return true
+}
+
+func (wp *WorkerPool) take(w Weight, waited time.Duration) {
+	wp.active += w.Slots
+	wp.bytesInUse += w.Bytes
+	wp.waits++
+	wp.waitSum += waited
+	if waited > wp.waitMax {
+		wp.waitMax = waited
+	}
+}
+
+func (wp *WorkerPool) release(w Weight) {
+	wp.active -= w.Slots
+	wp.bytesInUse -= w.Bytes
+	wp.dispatch()
+}
+
+// dispatch admits queued jobs using stride scheduling across priority
+// classes. It stops at the first head-of-line job that does not fit so
+// large jobs cannot be overtaken indefinitely.
+func (wp *WorkerPool) dispatch() {
+	for wp.queued > 0 {
+		p := -1
+		for c := numPriorities - 1; c >= 0; c-- {
+			if len(wp.queues[c]) > 0 && (p < 0 || wp.pass[c] < wp.pass[p]) {
+				p = c
+			}
+		}
+
+		waiter := wp.queues[p][0]
+		if !wp.fits(waiter.weight) {
+			return
+		}
+
+		wp.queues[p][0] = nil
+		wp.queues[p] = wp.queues[p][1:]
+		wp.queued--
+		wp.vtime = wp.pass[p]
+		wp.pass[p] += priorityStride[p]
+
+		wp.take(waiter.weight, time.Since(waiter.enqueued))
+		close(waiter.ready)
+	}
+}
+
+func (wp *WorkerPool) remove(waiter *poolWaiter) {
+	q := wp.queues[waiter.priority]
+	for i, w := range q {
+		if w == waiter {
+			wp.queues[waiter.priority] = append(q[:i], q[i+1:]...)
+			wp.queued--
+			return
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package pdfsdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pdfsdk "github.com/infosec554/convert-pdf-go-sdk"
+	"github.com/infosec554/convert-pdf-go-sdk/service"
+)
+
+func waitForQueued(t *testing.T, wp *pdfsdk.WorkerPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for wp.Snapshot().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d queued jobs, got %d", n, wp.Snapshot().Queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPoolAcquireContext(t *testing.T) {
+	wp := pdfsdk.NewWorkerPool(1)
+	ctx := context.Background()
+
+	if err := wp.Acquire(ctx, pdfsdk.Weight{}, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := wp.Acquire(timeoutCtx, pdfsdk.Weight{}, pdfsdk.PriorityNormal); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if queued := wp.Snapshot().Queued; queued != 0 {
+		t.Errorf("Expected canceled waiter to leave the queue, got %d", queued)
+	}
+
+	wp.Release(pdfsdk.Weight{})
+	if wp.Available() != 1 {
+		t.Errorf("Expected 1 available worker, got %d", wp.Available())
+	}
+}
+
+func TestWorkerPoolQueueDepth(t *testing.T) {
+	wp := pdfsdk.NewWorkerPoolWithConfig(&pdfsdk.WorkerPoolConfig{MaxWorkers: 1, MaxQueueDepth: 1})
+	ctx := context.Background()
+
+	if err := wp.Acquire(ctx, pdfsdk.Weight{}, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- wp.Acquire(ctx, pdfsdk.Weight{}, pdfsdk.PriorityNormal)
+	}()
+	waitForQueued(t, wp, 1)
+
+	if err := wp.Acquire(ctx, pdfsdk.Weight{}, pdfsdk.PriorityHigh); !errors.Is(err, pdfsdk.ErrWorkerPoolFull) {
+		t.Errorf("Expected ErrWorkerPoolFull, got %v", err)
+	}
+
+	wp.Release(pdfsdk.Weight{})
+	if err := <-done; err != nil {
+		t.Fatalf("Queued Acquire failed: %v", err)
+	}
+	wp.Release(pdfsdk.Weight{})
+
+	stats := wp.Snapshot()
+	if stats.Rejected != 1 {
+		t.Errorf("Expected 1 rejected job, got %d", stats.Rejected)
+	}
+	if stats.Admitted != 2 || stats.QueueWait <= 0 {
+		t.Errorf("Expected queue wait to be recorded, got %+v", stats)
+	}
+}
+
+func TestWorkerPoolMemoryBudget(t *testing.T) {
+	wp := pdfsdk.NewWorkerPoolWithConfig(&pdfsdk.WorkerPoolConfig{MaxWorkers: 4, MemoryBudget: 100})
+	ctx := context.Background()
+	big := pdfsdk.Weight{Slots: 1, Bytes: 60}
+
+	if err := wp.Acquire(ctx, big, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if wp.TryAcquire(big) {
+		t.Fatal("Expected second job to exceed the memory budget")
+	}
+	if !wp.TryAcquire(pdfsdk.Weight{Bytes: 40}) {
+		t.Fatal("Expected small job to fit in the remaining budget")
+	}
+	if stats := wp.Snapshot(); stats.BytesInUse != 100 {
+		t.Errorf("Expected 100 bytes in use, got %d", stats.BytesInUse)
+	}
+
+	wp.Release(big)
+	wp.Release(pdfsdk.Weight{Bytes: 40})
+
+	// A job larger than the whole budget still runs once the pool is free.
+	if !wp.TryAcquire(pdfsdk.Weight{Bytes: 500}) {
+		t.Error("Expected oversized job to be admitted when no memory is in use")
+	}
+}
+
+func TestWorkerPoolPriorityFairness(t *testing.T) {
+	wp := pdfsdk.NewWorkerPool(1)
+	ctx := context.Background()
+
+	if err := wp.Acquire(ctx, pdfsdk.Weight{}, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []pdfsdk.Priority
+	var wg sync.WaitGroup
+	enqueue := func(p pdfsdk.Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := wp.Acquire(ctx, pdfsdk.Weight{}, p); err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			wp.Release(pdfsdk.Weight{})
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		enqueue(pdfsdk.PriorityLow)
+		waitForQueued(t, wp, i+1)
+	}
+	for i := 0; i < 4; i++ {
+		enqueue(pdfsdk.PriorityHigh)
+		waitForQueued(t, wp, i+5)
+	}
+
+	wp.Release(pdfsdk.Weight{})
+	wg.Wait()
+
+	if len(order) != 8 {
+		t.Fatalf("Expected 8 admissions, got %d", len(order))
+	}
+	if order[0] != pdfsdk.PriorityHigh {
+		t.Errorf("Expected high priority first, got %v", order)
+	}
+	lastHigh, firstLow := -1, -1
+	for i, p := range order {
+		if p == pdfsdk.PriorityHigh {
+			lastHigh = i
+		} else if firstLow < 0 {
+			firstLow = i
+		}
+	}
+	if firstLow > lastHigh {
+		t.Errorf("Expected low priority work to be interleaved, got %v", order)
+	}
+}
+
+func TestSDKOperationsUseWorkerPool(t *testing.T) {
+	sdk := pdfsdk.NewWithOptions(&pdfsdk.Options{MaxWorkers: 1})
+	defer sdk.Close()
+
+	sdk.Info().GetInfoBytes([]byte("not a pdf"))
+	if _, _, processed := sdk.Workers().Stats(); processed != 1 {
+		t.Errorf("Expected operation to pass through the worker pool, got %d processed", processed)
+	}
+
+	if err := sdk.Workers().Acquire(context.Background(), pdfsdk.Weight{}, pdfsdk.PriorityNormal); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer sdk.Workers().Release(pdfsdk.Weight{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := sdk.WordToPDF().ConvertBytes(ctx, []byte("doc"), "a.docx")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected queued operation to time out, got %v", err)
+	}
+	if errs := sdk.Metrics().Snapshot().Errors; errs["timeout"] != 1 {
+		t.Errorf("Expected timeout to be recorded, got %v", errs)
+	}
+}
+
+// blankTIFF returns an uncompressed grayscale TIFF of n blank 10x10 pages.
+func blankTIFF(n int) []byte {
+	le := binary.LittleEndian
+	buf := []byte("II*\x00\x00\x00\x00\x00")
+	next := 4
+	for range n {
+		pixels := len(buf)
+		buf = append(buf, bytes.Repeat([]byte{0xFF}, 100)...)
+		le.PutUint32(buf[next:], uint32(len(buf)))
+		tags := [][2]uint32{
+			{256, 10}, {257, 10}, {258, 8}, {259, 1}, {262, 1},
+			{273, uint32(pixels)}, {277, 1}, {278, 10}, {279, 100},
+		}
+		buf = le.AppendUint16(buf, uint16(len(tags)))
+		for _, tag := range tags {
+			buf = le.AppendUint16(buf, uint16(tag[0]))
+			buf = le.AppendUint16(buf, 4)
+			buf = le.AppendUint32(buf, 1)
+			buf = le.AppendUint32(buf, tag[1])
+		}
+		next = len(buf)
+		buf = le.AppendUint32(buf, 0)
+	}
+	return buf
+}
+
+func TestBorrowedOCRSlotsAreNotCountedAsProcessed(t *testing.T) {
+	page := service.OCRPage{Lines: []service.OCRLine{{
+		Words: []service.OCRWord{{Text: "page", BBox: [4]int{0, 0, 10, 10}, Confidence: 90}},
+	}}}
+	if err := service.RegisterOCREngine(service.NewStaticOCREngine("pool-test", page)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.UnregisterOCREngine("pool-test") })
+	sdk := pdfsdk.NewWithOptions(&pdfsdk.Options{MaxWorkers: 4})
+	defer sdk.Close()
+
+	text, err := sdk.OCR().ExtractTextWithOptions(context.Background(), blankTIFF(3), &service.OCROptions{Engine: "pool-test", Workers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(text, "page") != 3 {
+		t.Errorf("Expected every page to be read, got %q", text)
+	}
+	if active, _, processed := sdk.Workers().Stats(); active != 0 || processed != 1 {
+		t.Errorf("Expected one processed job and no active workers, got %d processed, %d active", processed, active)
+	}
+}